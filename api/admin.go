@@ -0,0 +1,25 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// AdminTokenHeader is the request header carrying the admin token for privileged operations
+const AdminTokenHeader = "X-Admin-Token"
+
+var ErrAdminRequired = errors.New("This operation requires a valid admin token")
+
+// requireAdmin only calls next if the request has the API's admin token.
+func (a *API) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(AdminTokenHeader)
+		if a.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.AdminToken)) != 1 {
+			err := writeError(w, ErrAdminRequired.Error(), http.StatusForbidden)
+			logError(err)
+			return
+		}
+		next(w, r)
+	}
+}
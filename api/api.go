@@ -4,20 +4,43 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/backup"
 	"github.com/nickcoast/timetravel/entity"
 	"github.com/nickcoast/timetravel/service"
+	"github.com/nickcoast/timetravel/tenant"
 )
 
 type API struct {
 	records service.RecordService         // memory
 	sqlite  service.ObjectResourceService // sqlite
 
+	// AdminToken authorizes privileged operations (e.g. purge) sent with the AdminTokenHeader.
+	// Empty disables them.
+	AdminToken string
+
+	// Backups backs up the database for "admin/backup". Nil if the storage has no backups.
+	Backups *backup.Manager
+
+	// Tenants are the agencies' databases. Each v2 request uses its tenant's, named by TenantHeader or
+	// a subdomain of Domain. Nil if there is one database for everyone.
+	Tenants *tenant.Pool
+	Domain  string
+
+	// DeleteTokenTTL is how long the token from "delete" can be used to confirm the deletion
+	DeleteTokenTTL time.Duration
+	deleteTokens   *deleteTokens
 }
 
 func NewAPI(records service.RecordService, sqlite service.ObjectResourceService) *API {
-	return &API{records, sqlite}
+	return &API{
+		records:        records,
+		sqlite:         sqlite,
+		DeleteTokenTTL: DefaultDeleteTokenTTL,
+		deleteTokens:   newDeleteTokens(),
+	}
 }
 
 // generates all api routes
@@ -33,22 +56,52 @@ func (a *API) CreateV1Routes(routes *mux.Router) {
 func (a *API) CreateV2Routes(routes *mux.Router) {
 	i := routes
 	// i.Path("/help").HandlerFunc(a.GetRoutes).Methods("GET") // TODO
+	// consistent backup of the database while the server runs. Requires admin token.
+	i.Path("/admin/backup").HandlerFunc(a.requireAdmin(a.Backup)).Methods("POST")
+	// tenants, each with its own database. Require admin token.
+	i.Path("/admin/tenants").HandlerFunc(a.requireAdmin(a.ListTenants)).Methods("GET")
+	i.Path("/admin/tenants").HandlerFunc(a.requireAdmin(a.CreateTenant)).Methods("POST")
+	i.Path("/admin/tenants/{name}").HandlerFunc(a.requireAdmin(a.DropTenant)).Methods("DELETE")
+
+	// the routes below use the request's tenant's database, if there are tenants
+	i = routes.NewRoute().Subrouter()
+	i.Use(a.withTenant)
 	i.Path("/{type}").HandlerFunc(a.GetResource).Methods("GET")
 	i.Path("/{type}/history/{id:[0-9]+}").HandlerFunc(a.GetResourceRecords).Methods("GET")
 	i.Path("/{type}/id/{id:[0-9]+}").HandlerFunc(a.GetResourceById).Methods("GET")
 	i.Path("/{type}/new").HandlerFunc(a.Create).Methods("POST")
 	i.Path("/{type}/update").HandlerFunc(a.Update).Methods("PUT")
-
-	// Permanently deletes record (insured, employee, or insured address)
-	// Should be allowed to supervisors in case of erroneous data or FBI investigations
-	// TODO: force consumer to confirm before allowing permanent deletion.
+	// back-dated change: effective at a past "validFrom", known as of now
+	i.Path("/{type}/correct").HandlerFunc(a.Correct).Methods("POST")
+	// next term of a policy, starting when its latest term expires
+	i.Path("/policy/renew").HandlerFunc(a.Renew).Methods("POST")
+	// scheduled changes: "update" with a future "validFrom" takes effect later and can be cancelled until then
+	i.Path("/insured/pending/{insuredId:[0-9]+}").HandlerFunc(a.GetPendingChanges).Methods("GET")
+	i.Path("/{type}/pending/{recordId:[0-9]+}").HandlerFunc(a.CancelPendingChange).Methods("DELETE")
+
+	// Soft deletes record (insured, employee, or insured address). History is kept.
+	// "delete" previews the deletion and returns a token; "confirmdelete" with the token deletes.
 	i.Path("/{type}/delete/{id:[0-9]+}").HandlerFunc(a.Delete).Methods("DELETE")
+	i.Path("/{type}/confirmdelete/{id:[0-9]+}").HandlerFunc(a.ConfirmDelete).Methods("DELETE")
+	// Permanently deletes record and all of its history.
+	// Only allowed to supervisors (admin token) in case of erroneous data or FBI investigations
+	i.Path("/{type}/purge/{id:[0-9]+}").HandlerFunc(a.requireAdmin(a.Purge)).Methods("DELETE")
+	// Restores record (insured, employee, or insured address) as it was at "asOf" by appending new records.
+	i.Path("/{type}/restore/{id:[0-9]+}").HandlerFunc(a.Restore).Methods("POST")
 
 	// !!!TIME TRAVEL!!! - use getbydate and getbytimestamp to get records valid at a particular time
-	//i.Path("/{type}/confirmdelete/{id:[0-9]+}").HandlerFunc(a.Delete).Methods("DELETE")
 	i.Path("/{type}/getbydate/{insuredId}/{date}").HandlerFunc(a.GetResourceByDate).Methods("GET")
 	// same as above, but using integer timestamp for exact times
 	i.Path("/{type}/getbytimestamp/{insuredId}/{date}").HandlerFunc(a.GetResourceByTimestamp).Methods("GET")
+	// valid time ("valid") and transaction time ("known") given separately
+	i.Path("/{type}/bitemporal/{insuredId}").HandlerFunc(a.GetResourceByBitemporalDate).Methods("GET")
+	// what changed between two instants
+	i.Path("/insured/diff/{insuredId:[0-9]+}").HandlerFunc(a.GetInsuredDiff).Methods("GET")
+	// every event for an insured, in order
+	i.Path("/insured/timeline/{insuredId:[0-9]+}").HandlerFunc(a.GetTimeline).Methods("GET")
+	// every insured as it was at a point in time
+	i.Path("/insured/snapshot").HandlerFunc(a.GetSnapshot).Methods("GET")
+	i.Path("/insured/snapshot/stream").HandlerFunc(a.StreamSnapshot).Methods("GET")
 
 	ad := routes.PathPrefix("/address").Subrouter()
 	ad.Path("/id/{id:[0-9]+}").HandlerFunc(a.GetRecords).Methods("GET")
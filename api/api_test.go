@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -16,8 +17,14 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/nickcoast/timetravel/api"
+	"github.com/nickcoast/timetravel/backup"
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/eventlog"
+	"github.com/nickcoast/timetravel/memory"
+	"github.com/nickcoast/timetravel/seed"
 	"github.com/nickcoast/timetravel/service"
 	"github.com/nickcoast/timetravel/sqlite"
+	"github.com/nickcoast/timetravel/tenant"
 )
 
 type APItest struct {
@@ -50,7 +57,7 @@ type APItest struct {
 // TODO: can test a bunch of GET requests in one test. New, Update, Delete can be separate
 
 func TestAPI_InvalidRequest_Get(t *testing.T) {
-	_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 	defer MustCloseDB(t, db)
 
 	t.Run("Path", func(t *testing.T) {
@@ -75,7 +82,7 @@ func TestAPI_InvalidRequest_Get(t *testing.T) {
 }
 
 func TestAPI_GetById(t *testing.T) {
-	_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 	defer MustCloseDB(t, db)
 
 	t.Run("Insured", func(t *testing.T) {
@@ -87,19 +94,19 @@ func TestAPI_GetById(t *testing.T) {
 	t.Run("Employee", func(t *testing.T) { // should get latest Mister Bungle record. lol
 		req, _ := http.NewRequest("GET", "/api/v2/employee/id/2", nil)
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":"2","name":"Mister Bungle","startDate":"1984-11-10","endDate":"1996-06-01","insuredId":"1","recordTimestamp":"852206400","recordDateTime":"Thu, 02 Jan 1997 12:00:00 UTC"}` + "\n"
+		expectedResponseString := `{"id":"2","name":"Mister Bungle","startDate":"1984-11-10","endDate":"1996-06-01","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"852206400","recordDateTime":"Thu, 02 Jan 1997 12:00:00 UTC","validFrom":"852206400","validTo":""}` + "\n"
 		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
 	})
 	t.Run("Employee_EmptyEndDate", func(t *testing.T) { // should get latest Mister Bungle record. lol
 		req, _ := http.NewRequest("GET", "/api/v2/employee/id/1", nil)
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":"1","name":"Jimmy Temelpa","startDate":"1984-10-01","endDate":"","insuredId":"1","recordTimestamp":"468072000","recordDateTime":"Wed, 31 Oct 1984 12:00:00 UTC"}` + "\n"
+		expectedResponseString := `{"id":"1","name":"Jimmy Temelpa","startDate":"1984-10-01","endDate":"","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"468072000","recordDateTime":"Wed, 31 Oct 1984 12:00:00 UTC","validFrom":"468072000","validTo":""}` + "\n"
 		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
 	})
 	t.Run("Address", func(t *testing.T) { // should get 123 Fake Street, Springfield, Oregon
 		req, _ := http.NewRequest("GET", "/api/v2/address/id/1", nil)
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":"1","address":"123 Fake Street, Springfield, Oregon","recordTimestamp":"468072000","recordDateTime":"Wed, 31 Oct 1984 12:00:00 UTC"}` + "\n"
+		expectedResponseString := `{"id":"1","addressId":"1","type":"mailing","address":"123 Fake St, Springfield, Oregon","line1":"123 Fake St","line2":"","city":"Springfield","region":"Oregon","postalCode":"","country":"","recordTimestamp":"468072000","recordDateTime":"Wed, 31 Oct 1984 12:00:00 UTC","validFrom":"468072000","validTo":""}` + "\n"
 		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
 	})
 }
@@ -107,7 +114,7 @@ func TestAPI_GetById(t *testing.T) {
 func TestAPI_InvalidRequest_Put(t *testing.T) {
 
 	t.Run("SQL_DROP_DATABASE", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		requestBody := map[string]string{
@@ -117,11 +124,11 @@ func TestAPI_InvalidRequest_Put(t *testing.T) {
 			"startDate":  "2006-01-02",
 		}
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":1,"data":{"endDate":"","id":"1","insuredId":"1","name":"DROP DATABASE;","recordTimestamp":"","startDate":"2006-01-02"}}` + "\n"
+		expectedResponseString := `{"id":1,"data":{"annualPayroll":"0.00","endDate":"","id":"1","insuredId":"1","jobClassCode":"","name":"DROP DATABASE;","recordTimestamp":"","startDate":"2006-01-02","workLocation":""}}` + "\n"
 		checkResponse(t, req, httpserver, requestBody, expectedResponseCode, expectedResponseString)
 	})
 	t.Run("SQL_DELETE_FROM_INSURED", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		requestBody := map[string]string{
@@ -132,7 +139,7 @@ func TestAPI_InvalidRequest_Put(t *testing.T) {
 			"endDate":    "1420-04-20",
 		}
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":1,"data":{"endDate":"1420-04-20","id":"1","insuredId":"1","name":"DELETE FROM insured;","recordTimestamp":"","startDate":"1000-01-01"}}` + "\n"
+		expectedResponseString := `{"id":1,"data":{"annualPayroll":"0.00","endDate":"1420-04-20","id":"1","insuredId":"1","jobClassCode":"","name":"DELETE FROM insured;","recordTimestamp":"","startDate":"1000-01-01","workLocation":""}}` + "\n"
 		checkResponse(t, req, httpserver, requestBody, expectedResponseCode, expectedResponseString)
 
 		/* req, _ = http.NewRequest("GET", "/api/v2/insured/id/1", nil)
@@ -142,7 +149,7 @@ func TestAPI_InvalidRequest_Put(t *testing.T) {
 }
 
 func TestAPI_GetById_ShouldFail_NotFound(t *testing.T) {
-	_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 	defer MustCloseDB(t, db)
 
 	t.Run("TestAPI_GetById_Insured_ShouldFail_NotFound", func(t *testing.T) {
@@ -167,20 +174,39 @@ func TestAPI_GetById_ShouldFail_NotFound(t *testing.T) {
 
 // TestAPI_GetByTime
 func TestAPI_GetByTime(t *testing.T) {
-	_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 	defer MustCloseDB(t, db)
 	t.Run("TestAPI_GetByTime_Timestamp", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/api/v2/insured/getbytimestamp/2/954590400", nil) // 2000-04-01
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":"2","name":"John Smith","policyNumber":"1001","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","employees":{"0":{"id":"3","name":"John Smith","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC"},"1":{"id":"4","name":"Jane Doe","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC"},"2":{"id":"5","name":"Grant Tombly","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC"}},"insuredAddresses":{}}` + "\n"
+		expectedResponseString := `{"id":"2","name":"John Smith","policyNumber":"1001","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","employees":{"0":{"id":"3","name":"John Smith","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","validFrom":"946684799","validTo":""},"1":{"id":"4","name":"Jane Doe","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC","validFrom":"954590400","validTo":""},"2":{"id":"5","name":"Grant Tombly","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC","validFrom":"954590400","validTo":""}},"insuredAddresses":{}}` + "\n"
 		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
 	})
 	t.Run("TestAPI_GetByTime_Date", func(t *testing.T) { // 2000-04-01
 		req, _ := http.NewRequest("GET", "/api/v2/insured/getbydate/2/2000-04-01", nil)
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":"2","name":"John Smith","policyNumber":"1001","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","employees":{"0":{"id":"3","name":"John Smith","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC"},"1":{"id":"4","name":"Jane Doe","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC"},"2":{"id":"5","name":"Grant Tombly","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC"}},"insuredAddresses":{}}` + "\n"
+		expectedResponseString := `{"id":"2","name":"John Smith","policyNumber":"1001","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","employees":{"0":{"id":"3","name":"John Smith","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","validFrom":"946684799","validTo":""},"1":{"id":"4","name":"Jane Doe","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC","validFrom":"954590400","validTo":""},"2":{"id":"5","name":"Grant Tombly","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC","validFrom":"954590400","validTo":""}},"insuredAddresses":{}}` + "\n"
 		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
 	})
+	t.Run("TestAPI_GetByTime_Date_SystemTimezone", func(t *testing.T) { // a date ends at midnight in the system timezone, not UTC
+		local := time.Local
+		time.Local = time.FixedZone("UTC-13", -13*60*60)
+		defer func() { time.Local = local }()
+		// Jane Doe and Grant Tombly, recorded 2000-04-01 12:00 UTC, are still 2000-03-31 at UTC-13
+		req, _ := http.NewRequest("GET", "/api/v2/insured/getbydate/2/2000-03-31", nil)
+		rr := httptest.NewRecorder()
+		httpserver.Handler.ServeHTTP(rr, req)
+		var insured struct {
+			Employees map[string]interface{} `json:"employees"`
+		}
+		if got, want := rr.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if err := json.Unmarshal(rr.Body.Bytes(), &insured); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(insured.Employees), 3; got != want {
+			t.Fatalf("len(employees)=%v, want %v", got, want)
+		}
+	})
 	t.Run("TestAPI_GetByTime_Date_NotFound", func(t *testing.T) { // non-existent insuredId. // 2000-04-01
 		req, _ := http.NewRequest("GET", "/api/v2/insured/getbydate/99/2000-04-01", nil)
 		expectedResponseCode := http.StatusNotFound
@@ -197,21 +223,58 @@ func TestAPI_GetByTime(t *testing.T) {
 	t.Run("TestAPI_GetByTime_Timestamp", func(t *testing.T) {
 		req, _ := http.NewRequest("GET", "/api/v2/insured/getbytimestamp/2/954590400", nil) // 2000-04-01
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":"2","name":"John Smith","policyNumber":"1001","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","employees":{"0":{"id":"3","name":"John Smith","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC"},"1":{"id":"4","name":"Jane Doe","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC"},"2":{"id":"5","name":"Grant Tombly","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC"}},"insuredAddresses":{}}` + "\n"
+		expectedResponseString := `{"id":"2","name":"John Smith","policyNumber":"1001","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","employees":{"0":{"id":"3","name":"John Smith","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","validFrom":"946684799","validTo":""},"1":{"id":"4","name":"Jane Doe","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC","validFrom":"954590400","validTo":""},"2":{"id":"5","name":"Grant Tombly","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC","validFrom":"954590400","validTo":""}},"insuredAddresses":{}}` + "\n"
+		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+	})
+}
+
+func TestAPI_GetByBitemporalDate(t *testing.T) {
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+	t.Run("Insured", func(t *testing.T) { // true in 1990, as known on 1996-01-02 (before Mister Bungle's end date was recorded)
+		req, _ := http.NewRequest("GET", "/api/v2/insured/bitemporal/1?valid=1990-01-01&known=1996-01-02", nil)
+		expectedResponseCode := http.StatusOK
+		expectedResponseString := `{"id":"1","name":"Jimmy Temelpa","policyNumber":"1000","recordTimestamp":"468072000","recordDateTime":"Wed, 31 Oct 1984 12:00:00 UTC","employees":{"0":{"id":"1","name":"Jimmy Temelpa","startDate":"1984-10-01","endDate":"","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"468072000","recordDateTime":"Wed, 31 Oct 1984 12:00:00 UTC","validFrom":"468072000","validTo":""},"1":{"id":"2","name":"Mister Bungle","startDate":"1984-11-10","endDate":"","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"469368000","recordDateTime":"Thu, 15 Nov 1984 12:00:00 UTC","validFrom":"469368000","validTo":""}},"insuredAddresses":{"0":{"id":"2","addressId":"1","type":"mailing","address":"123 REAL St, Springfield, Oregon","line1":"123 REAL St","line2":"","city":"Springfield","region":"Oregon","postalCode":"","country":"","recordTimestamp":"469368001","recordDateTime":"Thu, 15 Nov 1984 12:00:01 UTC","validFrom":"469368001","validTo":""}}}` + "\n"
+		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+	})
+	t.Run("Address_KnownDefaultsToNow", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/address/bitemporal/1?valid=1984-11-01", nil)
+		expectedResponseCode := http.StatusOK
+		expectedResponseString := `{"0":{"id":"1","addressId":"1","type":"mailing","address":"123 Fake St, Springfield, Oregon","line1":"123 Fake St","line2":"","city":"Springfield","region":"Oregon","postalCode":"","country":"","recordTimestamp":"468072000","recordDateTime":"Wed, 31 Oct 1984 12:00:00 UTC","validFrom":"468072000","validTo":""}}` + "\n"
+		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+	})
+	t.Run("Employee_Timestamps", func(t *testing.T) { // Jane Doe and Grant Tombly not yet known
+		req, _ := http.NewRequest("GET", "/api/v2/employee/bitemporal/2?valid=954590399&known=954590400", nil)
+		expectedResponseCode := http.StatusOK
+		expectedResponseString := `{"0":{"id":"3","name":"John Smith","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","validFrom":"946684799","validTo":""}}` + "\n"
+		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+	})
+	t.Run("Employee_DateIncludesLastSecond", func(t *testing.T) { // John Smith was recorded at 1999-12-31 23:59:59 UTC
+		req, _ := http.NewRequest("GET", "/api/v2/employee/bitemporal/2?valid=2000-04-01&known=1999-12-31", nil)
+		expectedResponseCode := http.StatusOK
+		expectedResponseString := `{"0":{"id":"3","name":"John Smith","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","validFrom":"946684799","validTo":""}}` + "\n"
+		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+	})
+	t.Run("InvalidDate", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/employee/bitemporal/1?valid=asdf", nil)
+		expectedResponseCode := http.StatusBadRequest
+		expectedResponseString := `{"error":"` + api.ErrInvalidInstant.Error() + `"}` + "\n"
 		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
 	})
 }
 
 func TestAPI_DeleteById(t *testing.T) {
 	t.Run("TestAPI_DeleteById_Insured", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t) // Load new test DB for each sub-test that alters the DB
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo") // Load new test DB for each sub-test that alters the DB
 		defer MustCloseDB(t, db)
 
-		// 1.)
+		// 1.) DELETE with confirmation
 		req, _ := http.NewRequest("DELETE", "/api/v2/employees/delete/4", nil)
+		token := requestDeleteToken(t, req, httpserver)
+		confirmReq, _ := http.NewRequest("DELETE", "/api/v2/employees/confirmdelete/4?token="+token, nil)
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":"4","name":"Jane Doe","startDate":"1985-05-15","endDate":"1999-12-25","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC"}` + "\n"
-		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+		expectedResponseString := `{"id":"4","name":"Jane Doe","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC","validFrom":"954590400","validTo":""}` + "\n"
+		checkResponse(t, confirmReq, httpserver, nil, expectedResponseCode, expectedResponseString)
 
 		// 2.) CONFIRM DELETED. 2nd request should return 404
 		expectedResponseCode = http.StatusNotFound
@@ -220,14 +283,16 @@ func TestAPI_DeleteById(t *testing.T) {
 
 	})
 	t.Run("TestAPI_DeleteById_Employee", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 
-		// 1.) DELETE
+		// 1.) DELETE with confirmation
 		req, _ := http.NewRequest("DELETE", "/api/v2/employees/delete/2", nil)
+		token := requestDeleteToken(t, req, httpserver)
+		confirmReq, _ := http.NewRequest("DELETE", "/api/v2/employees/confirmdelete/2?token="+token, nil)
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":"2","name":"Mister Bungle","startDate":"1984-11-10","endDate":"1996-06-01","insuredId":"1","recordTimestamp":"852206400","recordDateTime":"Thu, 02 Jan 1997 12:00:00 UTC"}` + "\n"
-		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+		expectedResponseString := `{"id":"2","name":"Mister Bungle","startDate":"1984-11-10","endDate":"1996-06-01","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"852206400","recordDateTime":"Thu, 02 Jan 1997 12:00:00 UTC","validFrom":"852206400","validTo":""}` + "\n"
+		checkResponse(t, confirmReq, httpserver, nil, expectedResponseCode, expectedResponseString)
 
 		// 2.) CONFIRM DELETED. 2nd request should return 404
 		expectedResponseCode = http.StatusNotFound
@@ -235,14 +300,16 @@ func TestAPI_DeleteById(t *testing.T) {
 		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
 	})
 	t.Run("TestAPI_DeleteById_Address", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 
-		// 1.) DELETE
+		// 1.) DELETE with confirmation
 		req, _ := http.NewRequest("DELETE", "/api/v2/address/delete/2", nil)
+		token := requestDeleteToken(t, req, httpserver)
+		confirmReq, _ := http.NewRequest("DELETE", "/api/v2/address/confirmdelete/2?token="+token, nil)
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":"2","address":"123 REAL Street, Springfield, Oregon","recordTimestamp":"469368001","recordDateTime":"Thu, 15 Nov 1984 12:00:01 UTC"}` + "\n"
-		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+		expectedResponseString := `{"id":"2","addressId":"1","type":"mailing","address":"123 REAL St, Springfield, Oregon","line1":"123 REAL St","line2":"","city":"Springfield","region":"Oregon","postalCode":"","country":"","recordTimestamp":"469368001","recordDateTime":"Thu, 15 Nov 1984 12:00:01 UTC","validFrom":"469368001","validTo":""}` + "\n"
+		checkResponse(t, confirmReq, httpserver, nil, expectedResponseCode, expectedResponseString)
 
 		// 2.) CONFIRM DELETED. 2nd request should return 404
 		expectedResponseCode = http.StatusNotFound
@@ -251,8 +318,56 @@ func TestAPI_DeleteById(t *testing.T) {
 	})
 }
 
+func TestAPI_ConfirmDelete(t *testing.T) {
+	a, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+
+	t.Run("Preview", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/api/v2/insured/delete/1", nil)
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if !strings.Contains(response.Body.String(), `"employeeRecords":2,"addressRecords":1`) {
+			t.Errorf("Expected 2 employee and 1 address records in preview. Got %s", response.Body.String())
+		}
+		// not deleted until confirmed
+		req, _ = http.NewRequest("GET", "/api/v2/address/bitemporal/1", nil) // now
+		checkResponseCode(t, http.StatusOK, executeRequest(req, httpserver).Code)
+	})
+	t.Run("Fail_NoToken", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/api/v2/insured/confirmdelete/1", nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, api.ErrInvalidDeleteToken) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusForbidden, expectedResponseString)
+	})
+	t.Run("Fail_OtherRecord", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/api/v2/employee/delete/1", nil)
+		token := requestDeleteToken(t, req, httpserver)
+		req, _ = http.NewRequest("DELETE", "/api/v2/employee/confirmdelete/2?token="+token, nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, api.ErrInvalidDeleteToken) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusForbidden, expectedResponseString)
+	})
+	t.Run("SingleUse", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/api/v2/employees/delete/1", nil)
+		token := requestDeleteToken(t, req, httpserver)
+		req, _ = http.NewRequest("DELETE", "/api/v2/employee/confirmdelete/1?token="+token, nil)
+		checkResponseCode(t, http.StatusOK, executeRequest(req, httpserver).Code)
+
+		req, _ = http.NewRequest("DELETE", "/api/v2/employee/confirmdelete/1?token="+token, nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, api.ErrInvalidDeleteToken) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusForbidden, expectedResponseString)
+	})
+	t.Run("Fail_Expired", func(t *testing.T) {
+		a.DeleteTokenTTL = -time.Second
+		defer func() { a.DeleteTokenTTL = api.DefaultDeleteTokenTTL }()
+		req, _ := http.NewRequest("DELETE", "/api/v2/insured/delete/1", nil)
+		token := requestDeleteToken(t, req, httpserver)
+		req, _ = http.NewRequest("DELETE", "/api/v2/insured/confirmdelete/1?token="+token, nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, api.ErrInvalidDeleteToken) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusForbidden, expectedResponseString)
+	})
+}
+
 func TestAPI_DeleteById_NotFound(t *testing.T) {
-	_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 	defer MustCloseDB(t, db)
 	t.Run("TestAPI_DeleteById_NotFound_Insured", func(t *testing.T) {
 		req, _ := http.NewRequest("DELETE", "/api/v2/employees/delete/99", nil)
@@ -277,8 +392,336 @@ func TestAPI_DeleteById_NotFound(t *testing.T) {
 	})
 }
 
+func TestAPI_SoftDelete(t *testing.T) {
+	t.Run("Employee", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+
+		response := confirmDelete(t, "/api/v2/employee/delete/2", httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		// before the deletion, Mister Bungle is still there
+		req, _ := http.NewRequest("GET", "/api/v2/insured/getbytimestamp/1/852206401", nil)
+		response = executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if !strings.Contains(response.Body.String(), "Mister Bungle") {
+			t.Errorf("Expected Mister Bungle before deletion. Got %s", response.Body.String())
+		}
+		// after
+		req, _ = http.NewRequest("GET", "/api/v2/insured/getbytimestamp/1/"+fmt.Sprint(time.Now().Unix()+1), nil)
+		response = executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if strings.Contains(response.Body.String(), "Mister Bungle") {
+			t.Errorf("Expected no Mister Bungle after deletion. Got %s", response.Body.String())
+		}
+		req, _ = http.NewRequest("GET", "/api/v2/employee/id/2", nil)
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, `{"error":"record of id 2 does not exist"}`+"\n")
+
+		// history is kept
+		req, _ = http.NewRequest("GET", "/api/v2/insured/timeline/1?order=desc&limit=1", nil)
+		response = executeRequest(req, httpserver)
+		if !strings.Contains(response.Body.String(), `"type":"employee.deleted"`) {
+			t.Errorf("Expected employee.deleted event. Got %s", response.Body.String())
+		}
+	})
+	t.Run("Insured", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+
+		response := confirmDelete(t, "/api/v2/insured/delete/2", httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		req, _ := http.NewRequest("GET", "/api/v2/insured/getbytimestamp/2/954590400", nil) // 2000-04-01
+		response = executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		now := fmt.Sprint(time.Now().Unix() + 1)
+		req, _ = http.NewRequest("GET", "/api/v2/insured/getbytimestamp/2/"+now, nil)
+		expectedResponseString := `{"error":"No record for Insured 2 and date ` + now + ` exist"}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, expectedResponseString)
+		req, _ = http.NewRequest("GET", "/api/v2/insured/id/2", nil)
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, `{"error":"record of id 2 does not exist"}`+"\n")
+		req, _ = http.NewRequest("GET", "/api/v2/employee/id/4", nil)
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, `{"error":"record of id 4 does not exist"}`+"\n")
+
+		req, _ = http.NewRequest("DELETE", "/api/v2/insured/delete/2", nil)
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, `{"error":"Cannot delete. Record does not exist."}`+"\n")
+	})
+}
+
+func TestAPI_Restore(t *testing.T) {
+	t.Run("Employee_BadUpdate", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		beforeUpdate := fmt.Sprint(time.Now().Unix() - 1)
+
+		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
+		requestBody := map[string]string{
+			"employeeId": "1",
+			"name":       "Jimmy Typo",
+			"insuredId":  "1",
+			"startDate":  "1984-10-01",
+		}
+		requestJSON, _ := json.Marshal(requestBody)
+		req.Body = io.NopCloser(strings.NewReader(string(requestJSON)))
+		checkResponseCode(t, http.StatusOK, executeRequest(req, httpserver).Code)
+
+		req, _ = http.NewRequest("POST", "/api/v2/employee/restore/1?asOf="+beforeUpdate, nil)
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if !strings.Contains(response.Body.String(), `"name":"Jimmy Temelpa"`) {
+			t.Errorf("Expected restored name. Got %s", response.Body.String())
+		}
+		// bad update is kept in history
+		req, _ = http.NewRequest("GET", "/api/v2/employee/history/1", nil)
+		response = executeRequest(req, httpserver)
+		if !strings.Contains(response.Body.String(), "Jimmy Typo") {
+			t.Errorf("Expected bad update in history. Got %s", response.Body.String())
+		}
+
+		req, _ = http.NewRequest("POST", "/api/v2/employee/restore/1?asOf="+beforeUpdate, nil)
+		checkResponse(t, req, httpserver, nil, http.StatusConflict, `{"error":"Nothing to restore: record is already as it was at that time"}`+"\n")
+	})
+	t.Run("Insured_Deleted", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		beforeDelete := fmt.Sprint(time.Now().Unix() - 1)
+
+		response := confirmDelete(t, "/api/v2/insured/delete/2", httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		req, _ := http.NewRequest("POST", "/api/v2/employee/restore/4?asOf="+beforeDelete, nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, service.ErrRestoreRequiresInsured) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusConflict, expectedResponseString)
+
+		req, _ = http.NewRequest("POST", "/api/v2/insured/restore/2?asOf="+beforeDelete, nil)
+		response = executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if !strings.Contains(response.Body.String(), "Jane Doe") {
+			t.Errorf("Expected restored employees. Got %s", response.Body.String())
+		}
+		req, _ = http.NewRequest("GET", "/api/v2/employee/id/4", nil)
+		checkResponseCode(t, http.StatusOK, executeRequest(req, httpserver).Code)
+	})
+	t.Run("Fail_NoAsOf", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("POST", "/api/v2/insured/restore/1", nil)
+		checkResponse(t, req, httpserver, nil, http.StatusBadRequest, `{"error":"Restore requires 'asOf': the time to restore to"}`+"\n")
+	})
+}
+
+func TestAPI_Snapshot(t *testing.T) {
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+
+	t.Run("Snapshot", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/snapshot?timestamp=978307200", nil) // 2001-01-01
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		body := response.Body.String()
+		if !strings.HasPrefix(body, `{"timestamp":"978307200","total":2,`) || !strings.Contains(body, "Grant Tombly") || !strings.Contains(body, "Mars") {
+			t.Errorf("Expected both insureds with employees and address. Got %s", body)
+		}
+	})
+	t.Run("Filter", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/snapshot?timestamp=1997-02-01&limit=1", nil)
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		body := response.Body.String()
+		if !strings.Contains(body, `"total":1,`) || strings.Contains(body, "John Smith") {
+			t.Errorf("Expected only Jimmy Temelpa before John Smith was insured. Got %s", body)
+		}
+	})
+	t.Run("Stream", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/snapshot/stream?timestamp=978307200", nil)
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if got, want := response.Header().Get("X-Total-Count"), "2"; got != want {
+			t.Errorf("Expected X-Total-Count %s. Got %s", want, got)
+		}
+		if got, want := strings.Count(response.Body.String(), "\n"), 2; got != want {
+			t.Errorf("Expected %d lines. Got %s", want, response.Body.String())
+		}
+	})
+	t.Run("Fail_BadTimestamp", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/snapshot?timestamp=yesterday", nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, api.ErrInvalidInstant) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusBadRequest, expectedResponseString)
+	})
+}
+
+func TestAPI_Purge(t *testing.T) {
+	a, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+	a.AdminToken = "secret"
+
+	t.Run("Fail_NoToken", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/api/v2/employee/purge/2", nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, api.ErrAdminRequired) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusForbidden, expectedResponseString)
+	})
+	t.Run("Fail_WrongToken", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/api/v2/employee/purge/2", nil)
+		req.Header.Set(api.AdminTokenHeader, "guess")
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, api.ErrAdminRequired) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusForbidden, expectedResponseString)
+	})
+	t.Run("SoftDeleted", func(t *testing.T) {
+		response := confirmDelete(t, "/api/v2/employee/delete/2", httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		req, _ := http.NewRequest("DELETE", "/api/v2/employee/purge/2", nil)
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		checkResponse(t, req, httpserver, nil, http.StatusOK, `{"id":"2","purged":"true"}`+"\n")
+
+		// no history left
+		req, _ = http.NewRequest("GET", "/api/v2/insured/getbytimestamp/1/852206401", nil)
+		response = executeRequest(req, httpserver)
+		if strings.Contains(response.Body.String(), "Mister Bungle") {
+			t.Errorf("Expected no Mister Bungle after purge. Got %s", response.Body.String())
+		}
+
+		req, _ = http.NewRequest("DELETE", "/api/v2/employee/purge/2", nil)
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, `{"error":"Cannot purge. Record does not exist."}`+"\n")
+	})
+}
+
+func TestAPI_Backup(t *testing.T) {
+	a, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+	a.AdminToken = "secret"
+
+	t.Run("Fail_NoToken", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v2/admin/backup", nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, api.ErrAdminRequired) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusForbidden, expectedResponseString)
+	})
+	sqliteDB, ok := db.(*sqlite.DB)
+	if !ok {
+		t.Run("Fail_NoBackups", func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/api/v2/admin/backup", nil)
+			req.Header.Set(api.AdminTokenHeader, "secret")
+			checkResponse(t, req, httpserver, nil, http.StatusNotImplemented, `{"error":"Backups are only available with the sqlite storage"}`+"\n")
+		})
+		return
+	}
+	a.Backups = backup.NewManager(sqliteDB, t.TempDir())
+	t.Run("OK", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v2/admin/backup", nil)
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusCreated, response.Code)
+		var b backup.Backup
+		if err := json.Unmarshal(response.Body.Bytes(), &b); err != nil {
+			t.Fatal(err)
+		} else if b.Size == 0 {
+			t.Fatalf("Expected a backup. Got %s", response.Body.String())
+		}
+		backups, err := a.Backups.List()
+		if err != nil {
+			t.Fatal(err)
+		} else if len(backups) != 1 || backups[0].Path != b.Path {
+			t.Fatalf("backups=%+v, want %+v", backups, b)
+		}
+	})
+}
+
+func TestAPI_Tenants(t *testing.T) {
+	pool, err := tenant.NewPool(filepath.Join(t.TempDir(), "{tenant}.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	a, _, httpserver := SetUpRoutes(pool)
+	a.AdminToken = "secret"
+	a.Tenants, a.Domain = pool, "example.com"
+
+	t.Run("Create", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v2/admin/tenants", strings.NewReader(`{"name":"acme","seed":"demo"}`))
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		checkResponseCode(t, http.StatusCreated, executeRequest(req, httpserver).Code)
+		req, _ = http.NewRequest("POST", "/api/v2/admin/tenants", strings.NewReader(`{"name":"globex"}`))
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		checkResponseCode(t, http.StatusCreated, executeRequest(req, httpserver).Code)
+	})
+	t.Run("Fail_Create", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v2/admin/tenants", nil)
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		checkResponse(t, req, httpserver, map[string]string{"name": "acme"}, http.StatusConflict, fmt.Sprintf(`{"error":"%s"}`, tenant.ErrTenantExists)+"\n")
+		req, _ = http.NewRequest("POST", "/api/v2/admin/tenants", strings.NewReader(`{"name":"../acme"}`))
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, httpserver).Code)
+		req, _ = http.NewRequest("POST", "/api/v2/admin/tenants", strings.NewReader(`{"name":"initech"}`))
+		checkResponseCode(t, http.StatusForbidden, executeRequest(req, httpserver).Code)
+	})
+	t.Run("List", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/admin/tenants", nil)
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		var tenants []tenant.Tenant
+		if err := json.Unmarshal(response.Body.Bytes(), &tenants); err != nil {
+			t.Fatal(err)
+		} else if len(tenants) != 2 || tenants[0].Name != "acme" || tenants[1].Name != "globex" {
+			t.Fatalf("tenants=%+v", tenants)
+		}
+	})
+	// each tenant sees only its own data
+	t.Run("Isolated", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/id/2", nil)
+		req.Header.Set(api.TenantHeader, "acme")
+		checkResponseCode(t, http.StatusOK, executeRequest(req, httpserver).Code)
+		req, _ = http.NewRequest("GET", "/api/v2/insured/id/2", nil)
+		req.Header.Set(api.TenantHeader, "globex")
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, httpserver).Code)
+		req, _ = http.NewRequest("GET", "/api/v2/insured/id/2", nil)
+		req.Host = "acme.example.com:8000"
+		checkResponseCode(t, http.StatusOK, executeRequest(req, httpserver).Code)
+	})
+	t.Run("Fail_Tenant", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/id/2", nil)
+		checkResponse(t, req, httpserver, nil, http.StatusBadRequest, fmt.Sprintf(`{"error":"%s"}`, tenant.ErrNoTenant)+"\n")
+		req, _ = http.NewRequest("GET", "/api/v2/insured/id/2", nil)
+		req.Header.Set(api.TenantHeader, "initech")
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, fmt.Sprintf(`{"error":"%s"}`, tenant.ErrUnknownTenant)+"\n")
+	})
+	// a delete token confirms only the tenant's own record, not the one with the same id in another tenant
+	t.Run("Fail_DeleteOtherTenant", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v2/admin/tenants", strings.NewReader(`{"name":"umbrella","seed":"demo"}`))
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		checkResponseCode(t, http.StatusCreated, executeRequest(req, httpserver).Code)
+
+		req, _ = http.NewRequest("DELETE", "/api/v2/employee/delete/1", nil)
+		req.Header.Set(api.TenantHeader, "acme")
+		token := requestDeleteToken(t, req, httpserver)
+		req, _ = http.NewRequest("DELETE", "/api/v2/employee/confirmdelete/1?token="+token, nil)
+		req.Header.Set(api.TenantHeader, "umbrella")
+		checkResponse(t, req, httpserver, nil, http.StatusForbidden, fmt.Sprintf(`{"error":"%s"}`, api.ErrInvalidDeleteToken)+"\n")
+		req, _ = http.NewRequest("GET", "/api/v2/employee/id/1", nil)
+		req.Header.Set(api.TenantHeader, "umbrella")
+		checkResponseCode(t, http.StatusOK, executeRequest(req, httpserver).Code)
+
+		req, _ = http.NewRequest("DELETE", "/api/v2/employee/confirmdelete/1?token="+token, nil)
+		req.Header.Set(api.TenantHeader, "acme")
+		checkResponseCode(t, http.StatusOK, executeRequest(req, httpserver).Code)
+	})
+	t.Run("Drop", func(t *testing.T) {
+		req, _ := http.NewRequest("DELETE", "/api/v2/admin/tenants/acme", nil)
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		checkResponseCode(t, http.StatusOK, executeRequest(req, httpserver).Code)
+		req, _ = http.NewRequest("GET", "/api/v2/insured/id/2", nil)
+		req.Header.Set(api.TenantHeader, "acme")
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, httpserver).Code)
+		req, _ = http.NewRequest("DELETE", "/api/v2/admin/tenants/acme", nil)
+		req.Header.Set(api.AdminTokenHeader, "secret")
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, httpserver).Code)
+	})
+}
+
 func TestAPI_Create(t *testing.T) {
-	_, httpserver, db := MustOpenDBAndSetUpRoutes(t) // move this inside each sub-test if they affect each other
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo") // move this inside each sub-test if they affect each other
 	defer MustCloseDB(t, db)
 
 	t.Run("Insured", func(t *testing.T) {
@@ -293,7 +736,7 @@ func TestAPI_Create(t *testing.T) {
 	t.Run("Address", func(t *testing.T) {
 		req, _ := http.NewRequest("POST", "/api/v2/address/new", nil)
 		expectedResponseCode := http.StatusCreated
-		expectedResponseString := `{"id":5,"data":{"address":"911 Reno Street","id":"5","insuredId":"2","recordTimestamp":""}}` + "\n"
+		expectedResponseString := `{"id":5,"data":{"address":"911 Reno St","addressId":"2","city":"","country":"","id":"5","insuredId":"2","line1":"911 Reno St","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"mailing"}}` + "\n"
 		requestBody := map[string]string{
 			"address":   "911 Reno Street",
 			"insuredId": "2",
@@ -309,7 +752,7 @@ func TestAPI_Create(t *testing.T) {
 	t.Run("Employee", func(t *testing.T) {
 		req, _ := http.NewRequest("POST", "/api/v2/employee/new", nil)
 		expectedResponseCode := http.StatusCreated
-		expectedResponseString := `{"id":7,"data":{"endDate":"1994-01-14","id":"7","insuredId":"2","name":"Charles Bronson","recordTimestamp":"","startDate":"1974-07-24"}}` + "\n"
+		expectedResponseString := `{"id":6,"data":{"annualPayroll":"0.00","endDate":"1994-01-14","id":"6","insuredId":"2","jobClassCode":"","name":"Charles Bronson","recordTimestamp":"","startDate":"1974-07-24","workLocation":""}}` + "\n"
 		requestBody := map[string]string{
 			"name":      "Charles Bronson",
 			"startDate": "1974-07-24",
@@ -321,7 +764,7 @@ func TestAPI_Create(t *testing.T) {
 }
 
 func TestAPI_Update_Insured(t *testing.T) {
-	_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 	defer MustCloseDB(t, db)
 	t.Run("TestAPI_Update_Insured", func(t *testing.T) {
 		req, _ := http.NewRequest("PUT", "/api/v2/insured/update", nil)
@@ -337,7 +780,7 @@ func TestAPI_Update_Insured(t *testing.T) {
 
 func TestAPI_Update_Employee(t *testing.T) {
 	t.Run("Fail_MissingEmployeeId", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		expectedResponseCode := http.StatusBadRequest
@@ -354,7 +797,7 @@ func TestAPI_Update_Employee(t *testing.T) {
 	// Deleted "TestAPI_Update_Employee_Fail_RequireCreate"
 
 	t.Run("Fail_NoChanges", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		expectedResponseCode := http.StatusConflict
@@ -372,7 +815,7 @@ func TestAPI_Update_Employee(t *testing.T) {
 
 	// TODO:
 	/* t.Run("Fail_MalformedDate", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		expectedResponseCode := http.StatusOK
@@ -389,7 +832,7 @@ func TestAPI_Update_Employee(t *testing.T) {
 
 	// TODO:
 	/* t.Run("Fail_StartDateAfterEndDate", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		expectedResponseCode := http.StatusBadRequest
@@ -406,7 +849,7 @@ func TestAPI_Update_Employee(t *testing.T) {
 
 	// TODO:
 	/* t.Run("Fail_WrongInsuredId", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		expectedResponseCode := http.StatusConflict
@@ -423,7 +866,7 @@ func TestAPI_Update_Employee(t *testing.T) {
 	}) */
 
 	t.Run("Fail_MissingInsuredId", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		expectedResponseCode := http.StatusConflict
@@ -442,11 +885,11 @@ func TestAPI_Update_Employee(t *testing.T) {
 
 	// update
 	t.Run("Succeed_FullData", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":2,"data":{"endDate":"1999-01-14","id":"2","insuredId":"1","name":"Mister Bungle","recordTimestamp":"","startDate":"1974-07-24"}}` + "\n"
+		expectedResponseString := `{"id":2,"data":{"annualPayroll":"0.00","endDate":"1999-01-14","id":"2","insuredId":"1","jobClassCode":"","name":"Mister Bungle","recordTimestamp":"","startDate":"1974-07-24","workLocation":""}}` + "\n"
 		requestBody := map[string]string{
 			"name":       "Mister Bungle",
 			"startDate":  "1974-07-24",
@@ -458,7 +901,7 @@ func TestAPI_Update_Employee(t *testing.T) {
 	})
 
 	t.Run("Succeed_EmptyEndDate", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		requestBody := map[string]string{
@@ -469,13 +912,13 @@ func TestAPI_Update_Employee(t *testing.T) {
 			// no end date - should not change existing end date
 		}
 		expectedResponseCode := http.StatusOK
-		expectedResponseString := `{"id":1,"data":{"endDate":"","id":"1","insuredId":"1","name":"Jimathy Trashleigh Moganstern III Esquire","recordTimestamp":"","startDate":"2006-01-02"}}` + "\n"
+		expectedResponseString := `{"id":1,"data":{"annualPayroll":"0.00","endDate":"","id":"1","insuredId":"1","jobClassCode":"","name":"Jimathy Trashleigh Moganstern III Esquire","recordTimestamp":"","startDate":"2006-01-02","workLocation":""}}` + "\n"
 		checkResponse(t, req, httpserver, requestBody, expectedResponseCode, expectedResponseString)
 	})
 
 	// TODO:
 	/* t.Run("PartialUpdate_Succeed", func(t *testing.T) {
-		_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 		defer MustCloseDB(t, db)
 		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
 		requestBody := map[string]string{
@@ -490,6 +933,85 @@ func TestAPI_Update_Employee(t *testing.T) {
 	}) */
 }
 
+func TestAPI_EmployeeRating(t *testing.T) {
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+	employee := func(fields map[string]string) map[string]string {
+		requestBody := map[string]string{
+			"name":       "Jimmy Temelpa",
+			"startDate":  "1984-10-01",
+			"insuredId":  "1",
+			"employeeId": "1",
+		}
+		for key, value := range fields {
+			requestBody[key] = value
+		}
+		return requestBody
+	}
+
+	t.Run("Update", func(t *testing.T) {
+		// 1.) rated
+		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
+		expectedResponseString := `{"id":1,"data":{"annualPayroll":"52000.00","endDate":"","id":"1","insuredId":"1","jobClassCode":"8810","name":"Jimmy Temelpa","recordTimestamp":"","startDate":"1984-10-01","workLocation":"Springfield"}}` + "\n"
+		requestBody := employee(map[string]string{"jobClassCode": "8810", "annualPayroll": "52,000", "workLocation": "Springfield"})
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+
+		// 2.) no change
+		expectedResponseString = fmt.Sprintf(`{"error":"%s"}`, service.ErrRecordUpdateRequireChange) + "\n"
+		checkResponse(t, req, httpserver, requestBody, http.StatusConflict, expectedResponseString)
+
+		// 3.) the others are kept
+		expectedResponseString = `{"id":1,"data":{"annualPayroll":"60000.00","endDate":"","id":"1","insuredId":"1","jobClassCode":"8810","name":"Jimmy Temelpa","recordTimestamp":"","startDate":"1984-10-01","workLocation":"Springfield"}}` + "\n"
+		requestBody = employee(map[string]string{"annualPayroll": "60000"})
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Update_Clear", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
+		requestBody := employee(map[string]string{"jobClassCode": "8810", "annualPayroll": "52,000", "workLocation": "Springfield"})
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, `{"id":1,"data":{"annualPayroll":"52000.00","endDate":"","id":"1","insuredId":"1","jobClassCode":"8810","name":"Jimmy Temelpa","recordTimestamp":"","startDate":"1984-10-01","workLocation":"Springfield"}}`+"\n")
+
+		// sent empty: cleared. Not sent: kept
+		expectedResponseString := `{"id":1,"data":{"annualPayroll":"52000.00","endDate":"","id":"1","insuredId":"1","jobClassCode":"8810","name":"Jimmy Temelpa","recordTimestamp":"","startDate":"1984-10-01","workLocation":""}}` + "\n"
+		requestBody = employee(map[string]string{"workLocation": ""})
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+
+		expectedResponseString = `{"id":1,"data":{"annualPayroll":"0.00","endDate":"","id":"1","insuredId":"1","jobClassCode":"","name":"Jimmy Temelpa","recordTimestamp":"","startDate":"1984-10-01","workLocation":""}}` + "\n"
+		requestBody = employee(map[string]string{"jobClassCode": "", "annualPayroll": ""})
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Update_Invalid", func(t *testing.T) {
+		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
+		expectedResponseString := `{"error":"Invalid employee: Employee job class code must be 4 digits, e.g. '8810'."}` + "\n"
+		checkResponse(t, req, httpserver, employee(map[string]string{"jobClassCode": "88"}), http.StatusBadRequest, expectedResponseString)
+
+		expectedResponseString = `{"error":"Invalid employee: annualPayroll: Amount must be a number with at most 2 decimals, e.g. '1250.50'"}` + "\n"
+		checkResponse(t, req, httpserver, employee(map[string]string{"annualPayroll": "lots"}), http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("GetByDate", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/getbydate/1/"+time.Now().Format("2006-01-02"), nil)
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if want := `"name":"Jimmy Temelpa","startDate":"1984-10-01","endDate":"","jobClassCode":"8810","annualPayroll":"60000.00","workLocation":"Springfield"`; !strings.Contains(response.Body.String(), want) {
+			t.Errorf("Expected %s. Got %s", want, response.Body.String())
+		}
+	})
+	t.Run("History", func(t *testing.T) { // how each field evolved
+		req, _ := http.NewRequest("GET", "/api/v2/employee/history/1", nil)
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		ratings := regexp.MustCompile(`"jobClassCode":"([0-9]*)","annualPayroll":"([0-9.]+)","workLocation":"([^"]*)"`).FindAllStringSubmatch(response.Body.String(), -1)
+		got := []string{}
+		for _, rating := range ratings {
+			got = append(got, strings.Join(rating[1:], " "))
+		}
+		if want := "[ 0.00  8810 52000.00 Springfield 8810 60000.00 Springfield]"; fmt.Sprint(got) != want {
+			t.Errorf("Expected ratings %s. Got %v", want, got)
+		}
+	})
+}
+
 func checkResponse(t *testing.T, req *http.Request, httpserver *http.Server, requestBody map[string]string, expectedResponseCode int, expectedResponseString string) {
 	requestJSON, err := json.Marshal(requestBody)
 	if err != nil {
@@ -507,7 +1029,7 @@ func checkResponse(t *testing.T, req *http.Request, httpserver *http.Server, req
 }
 
 func TestAPI_Update_Address(t *testing.T) {
-	_, httpserver, db := MustOpenDBAndSetUpRoutes(t)
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
 	defer MustCloseDB(t, db)
 
 	t.Run("Conflict", func(t *testing.T) {
@@ -523,7 +1045,7 @@ func TestAPI_Update_Address(t *testing.T) {
 
 		// 2.) change of address
 		expectedResponseCode = http.StatusOK
-		expectedResponseString = `{"id":5,"data":{"address":"911 Las Vegas Street","id":"5","insuredId":"1","recordTimestamp":""}}` + "\n"
+		expectedResponseString = `{"id":5,"data":{"address":"911 Las Vegas St","addressId":"1","city":"","country":"","id":"5","insuredId":"1","line1":"911 Las Vegas St","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"mailing"}}` + "\n"
 		requestBody = map[string]string{
 			"address":   "911 Las Vegas Street",
 			"insuredId": "1",
@@ -533,6 +1055,446 @@ func TestAPI_Update_Address(t *testing.T) {
 
 }
 
+func TestAPI_AddressTypes(t *testing.T) {
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+
+	t.Run("Create", func(t *testing.T) {
+		// 1.) billing address alongside the mailing address
+		req, _ := http.NewRequest("POST", "/api/v2/address/new", nil)
+		expectedResponseString := `{"id":5,"data":{"address":"1 Billing Ln","addressId":"2","city":"","country":"","id":"5","insuredId":"1","line1":"1 Billing Ln","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"billing"}}` + "\n"
+		requestBody := map[string]string{
+			"address":   "1 Billing Lane",
+			"insuredId": "1",
+			"type":      "billing",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusCreated, expectedResponseString)
+
+		// 2.) only one billing address
+		expectedResponseString = `{"error":"Record already exists. Use 'update' to update"}` + "\n"
+		checkResponse(t, req, httpserver, requestBody, http.StatusConflict, expectedResponseString)
+
+		// 3.) any number of locations
+		for i, address := range []string{"Warehouse 1", "Warehouse 2"} {
+			expectedResponseString = fmt.Sprintf(`{"id":%d,"data":{"address":"%s","addressId":"%d","city":"","country":"","id":"%d","insuredId":"1","line1":"%s","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"location"}}`, 6+i, address, 3+i, 6+i, address) + "\n"
+			requestBody = map[string]string{
+				"address":   address,
+				"insuredId": "1",
+				"type":      "location",
+			}
+			checkResponse(t, req, httpserver, requestBody, http.StatusCreated, expectedResponseString)
+		}
+	})
+	t.Run("Scheduled", func(t *testing.T) { // addresses are looked up when the change takes effect
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+
+		// 1.) insured 2 will have a mailing address from 2099-01-01
+		req, _ := http.NewRequest("POST", "/api/v2/address/new", nil)
+		expectedResponseString := `{"id":5,"data":{"address":"1 Future Way","addressId":"2","city":"","country":"","id":"5","insuredId":"2","line1":"1 Future Way","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"mailing","validFrom":"4070908800"}}` + "\n"
+		requestBody := map[string]string{
+			"address":   "1 Future Way",
+			"insuredId": "2",
+			"validFrom": "2099-01-01",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusCreated, expectedResponseString)
+
+		// 2.) so not a second one from 2099-06-01
+		expectedResponseString = `{"error":"Record already exists. Use 'update' to update"}` + "\n"
+		requestBody["address"], requestBody["validFrom"] = "2 Future Way", "2099-06-01"
+		checkResponse(t, req, httpserver, requestBody, http.StatusConflict, expectedResponseString)
+
+		// 3.) but it can be changed from 2099-06-01
+		req, _ = http.NewRequest("PUT", "/api/v2/address/update", nil)
+		expectedResponseString = `{"id":6,"data":{"address":"2 Future Way","addressId":"2","city":"","country":"","id":"6","insuredId":"2","line1":"2 Future Way","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"mailing","validFrom":"4083955200"}}` + "\n"
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Create_InvalidType", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v2/address/new", nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, service.ErrInvalidAddressType) + "\n"
+		requestBody := map[string]string{
+			"address":   "1 Beach Road",
+			"insuredId": "1",
+			"type":      "vacation",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("Update", func(t *testing.T) {
+		// 1.) by type
+		req, _ := http.NewRequest("PUT", "/api/v2/address/update", nil)
+		expectedResponseString := `{"id":8,"data":{"address":"2 Billing Ln","addressId":"2","city":"","country":"","id":"8","insuredId":"1","line1":"2 Billing Ln","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"billing"}}` + "\n"
+		requestBody := map[string]string{
+			"address":   "2 Billing Lane",
+			"insuredId": "1",
+			"type":      "billing",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+
+		// 2.) two locations: which one?
+		expectedResponseString = fmt.Sprintf(`{"error":"%s"}`, service.ErrEntityIDInvalid) + "\n"
+		requestBody = map[string]string{
+			"address":   "Warehouse 3",
+			"insuredId": "1",
+			"type":      "location",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+
+		// 3.) by address id
+		expectedResponseString = `{"id":9,"data":{"address":"Warehouse 3","addressId":"4","city":"","country":"","id":"9","insuredId":"1","line1":"Warehouse 3","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"location"}}` + "\n"
+		requestBody["addressId"] = "4"
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Independent_Histories", func(t *testing.T) { // the mailing address is unchanged by the others
+		req, _ := http.NewRequest("GET", "/api/v2/address/bitemporal/1?valid=1997-01-03", nil)
+		expectedResponseString := `{"0":{"id":"4","addressId":"1","type":"mailing","address":"Mars","line1":"Mars","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"852206401","recordDateTime":"Thu, 02 Jan 1997 12:00:01 UTC","validFrom":"852206401","validTo":""}}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+
+		req, _ = http.NewRequest("GET", "/api/v2/address/bitemporal/1", nil) // now
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		for _, address := range []string{`"address":"Mars"`, `"address":"2 Billing Ln"`, `"address":"Warehouse 1"`, `"address":"Warehouse 3"`} {
+			if !strings.Contains(response.Body.String(), address) {
+				t.Errorf("Expected %s in %s", address, response.Body.String())
+			}
+		}
+	})
+}
+
+func TestAPI_StructuredAddress(t *testing.T) {
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+
+	t.Run("Create", func(t *testing.T) { // normalized
+		req, _ := http.NewRequest("POST", "/api/v2/address/new", nil)
+		expectedResponseString := `{"id":5,"data":{"address":"1600 Pennsylvania Ave NW, Washington, DC 20500, US","addressId":"2","city":"Washington","country":"US","id":"5","insuredId":"1","line1":"1600 Pennsylvania Ave NW","line2":"","postalCode":"20500","recordTimestamp":"","region":"DC","type":"billing"}}` + "\n"
+		requestBody := map[string]string{
+			"line1":      "1600  Pennsylvania Avenue NW",
+			"city":       "Washington",
+			"region":     "district of columbia",
+			"postalCode": "20500",
+			"country":    "usa",
+			"insuredId":  "1",
+			"type":       "billing",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusCreated, expectedResponseString)
+	})
+	t.Run("Update_MustChange", func(t *testing.T) { // the same address, written differently
+		req, _ := http.NewRequest("PUT", "/api/v2/address/update", nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, service.ErrRecordUpdateRequireChange) + "\n"
+		requestBody := map[string]string{
+			"address":   "1600 pennsylvania ave. nw, WASHINGTON, DC 20500, United States",
+			"insuredId": "1",
+			"type":      "billing",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusConflict, expectedResponseString)
+	})
+	t.Run("Update_OneLine", func(t *testing.T) { // split into fields
+		req, _ := http.NewRequest("PUT", "/api/v2/address/update", nil)
+		expectedResponseString := `{"id":6,"data":{"address":"1 Main St, Springfield, OR 97477-1234, US","addressId":"2","city":"Springfield","country":"US","id":"6","insuredId":"1","line1":"1 Main St","line2":"","postalCode":"97477-1234","recordTimestamp":"","region":"OR","type":"billing"}}` + "\n"
+		requestBody := map[string]string{
+			"address":   "1 Main Street, Springfield, or 974771234, USA",
+			"insuredId": "1",
+			"type":      "billing",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Create_InvalidPostalCode", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v2/address/new", nil)
+		expectedResponseString := `{"error":"Invalid address: Postal code \"1234\" is not valid for US."}` + "\n"
+		requestBody := map[string]string{
+			"line1":      "2 Main St",
+			"city":       "Springfield",
+			"region":     "OR",
+			"postalCode": "1234",
+			"country":    "US",
+			"insuredId":  "1",
+			"type":       "location",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("Create_InvalidCountry", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/api/v2/address/new", nil)
+		expectedResponseString := `{"error":"Invalid address: Country must be a two-letter ISO 3166 code."}` + "\n"
+		requestBody := map[string]string{
+			"line1":     "2 Main St",
+			"city":      "Springfield",
+			"country":   "Freedonia",
+			"insuredId": "1",
+			"type":      "location",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+	})
+}
+
+func TestAPI_Policy(t *testing.T) {
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+	// records are created now
+	ignoreRecordTime := func(body string) string {
+		body = regexp.MustCompile(`"recordTimestamp":"[0-9]+"`).ReplaceAllString(body, `"recordTimestamp":""`)
+		return regexp.MustCompile(`"recordDateTime":"[^"]+"`).ReplaceAllString(body, `"recordDateTime":""`)
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		// 1.) first term: a year from 2020-01-01. The policy number is the insured's.
+		req, _ := http.NewRequest("POST", "/api/v2/policy/new", nil)
+		expectedResponseString := `{"id":1,"data":{"aggregateLimit":"2000000.00","effectiveDate":"2020-01-01","expirationDate":"2021-01-01","id":"1","insuredId":"1","occurrenceLimit":"1000000.00","policyNumber":"1000","premium":"1250.00","recordTimestamp":"","term":"1"}}` + "\n"
+		requestBody := map[string]string{
+			"insuredId":       "1",
+			"effectiveDate":   "2020-01-01",
+			"occurrenceLimit": "1,000,000",
+			"aggregateLimit":  "2000000",
+			"premium":         "1250",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusCreated, expectedResponseString)
+
+		// 2.) premium required
+		expectedResponseString = `{"error":"Invalid policy: premium required"}` + "\n"
+		delete(requestBody, "premium")
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+
+		// 3.) amounts are money
+		expectedResponseString = `{"error":"Invalid policy: premium: Amount must be a number with at most 2 decimals, e.g. '1250.50'"}` + "\n"
+		requestBody["premium"] = "12.505"
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("Update", func(t *testing.T) {
+		// 1.) the term has expired
+		req, _ := http.NewRequest("PUT", "/api/v2/policy/update", nil)
+		expectedResponseString := `{"error":"Invalid policy: the change must take effect during the current term. Use 'renew' for the next term"}` + "\n"
+		requestBody := map[string]string{
+			"policyId": "1",
+			"premium":  "1500",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+
+		// 2.) endorsement during the term
+		req, _ = http.NewRequest("POST", "/api/v2/policy/correct", nil)
+		expectedResponseString = `{"id":1,"data":{"aggregateLimit":"2000000.00","effectiveDate":"2020-01-01","expirationDate":"2021-01-01","id":"1","insuredId":"1","occurrenceLimit":"1000000.00","policyNumber":"1000","premium":"1500.00","recordTimestamp":"","term":"1","validFrom":"1593561600"}}` + "\n"
+		requestBody["validFrom"] = "2020-07-01"
+		checkResponse(t, req, httpserver, requestBody, http.StatusCreated, expectedResponseString)
+
+		// 3.) no change
+		expectedResponseString = fmt.Sprintf(`{"error":"%s"}`, service.ErrRecordUpdateRequireChange) + "\n"
+		checkResponse(t, req, httpserver, requestBody, http.StatusConflict, expectedResponseString)
+	})
+	t.Run("Renew", func(t *testing.T) {
+		// 1.) next term: 2021-01-01 to 2022-01-01, with the endorsed premium
+		req, _ := http.NewRequest("POST", "/api/v2/policy/renew", nil)
+		expectedResponseString := `{"id":1,"data":{"aggregateLimit":"2000000.00","effectiveDate":"2021-01-01","expirationDate":"2022-01-01","id":"1","insuredId":"1","occurrenceLimit":"1000000.00","policyNumber":"1000","premium":"1500.00","recordTimestamp":"","term":"2","validFrom":"1609459200"}}` + "\n"
+		requestBody := map[string]string{
+			"policyId": "1",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusCreated, expectedResponseString)
+
+		// 2.) no such policy
+		expectedResponseString = fmt.Sprintf(`{"error":"%s"}`, service.ErrRecordDoesNotExist) + "\n"
+		requestBody["policyId"] = "9"
+		checkResponse(t, req, httpserver, requestBody, http.StatusNotFound, expectedResponseString)
+	})
+	t.Run("GetByDate", func(t *testing.T) { // the terms in force, as known now
+		for i, date := range []string{"2020-03-01", "2020-08-01", "2021-03-01"} {
+			req, _ := http.NewRequest("GET", "/api/v2/policy/bitemporal/1?valid="+date, nil)
+			expectedResponseString := []string{`{"0":{"id":"1","policyNumber":"1000","term":"1","effectiveDate":"2020-01-01","expirationDate":"2021-01-01","occurrenceLimit":"1000000.00","aggregateLimit":"2000000.00","premium":"1250.00","insuredId":"1","recordTimestamp":"","recordDateTime":"","validFrom":"1577836800","validTo":""}}` + "\n", `{"0":{"id":"1","policyNumber":"1000","term":"1","effectiveDate":"2020-01-01","expirationDate":"2021-01-01","occurrenceLimit":"1000000.00","aggregateLimit":"2000000.00","premium":"1500.00","insuredId":"1","recordTimestamp":"","recordDateTime":"","validFrom":"1593561600","validTo":""}}` + "\n", `{"0":{"id":"1","policyNumber":"1000","term":"2","effectiveDate":"2021-01-01","expirationDate":"2022-01-01","occurrenceLimit":"1000000.00","aggregateLimit":"2000000.00","premium":"1500.00","insuredId":"1","recordTimestamp":"","recordDateTime":"","validFrom":"1609459200","validTo":""}}` + "\n"}[i]
+			response := executeRequest(req, httpserver)
+			checkResponseCode(t, http.StatusOK, response.Code)
+			checkResponseData(t, expectedResponseString, ignoreRecordTime(response.Body.String()), false)
+		}
+		// as known then: not yet recorded
+		req, _ := http.NewRequest("GET", "/api/v2/policy/getbydate/1/2020-03-01", nil)
+		expectedResponseString := `{"error":"No policy in force for Insured 1 at date 2020-03-01"}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, expectedResponseString)
+	})
+	t.Run("History", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/policy/history/1", nil)
+		expectedResponseString := `[{"id":"1","policyNumber":"1000","term":"1","effectiveDate":"2020-01-01","expirationDate":"2021-01-01","occurrenceLimit":"1000000.00","aggregateLimit":"2000000.00","premium":"1250.00","insuredId":"1","recordTimestamp":"","recordDateTime":"","validFrom":"1577836800","validTo":""},{"id":"1","policyNumber":"1000","term":"1","effectiveDate":"2020-01-01","expirationDate":"2021-01-01","occurrenceLimit":"1000000.00","aggregateLimit":"2000000.00","premium":"1500.00","insuredId":"1","recordTimestamp":"","recordDateTime":"","validFrom":"1593561600","validTo":""},{"id":"1","policyNumber":"1000","term":"2","effectiveDate":"2021-01-01","expirationDate":"2022-01-01","occurrenceLimit":"1000000.00","aggregateLimit":"2000000.00","premium":"1500.00","insuredId":"1","recordTimestamp":"","recordDateTime":"","validFrom":"1609459200","validTo":""}]` + "\n"
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		checkResponseData(t, expectedResponseString, ignoreRecordTime(response.Body.String()), false)
+	})
+}
+
+func TestAPI_Claim(t *testing.T) {
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+	// records are created now
+	ignoreRecordTime := func(body string) string {
+		body = regexp.MustCompile(`"recordTimestamp":"[0-9]+","recordDateTime":"[^"]+","validFrom":"[0-9]+"`).ReplaceAllString(body, `"recordTimestamp":"","recordDateTime":"","validFrom":""`)
+		return body
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		// 1.) claims are open
+		req, _ := http.NewRequest("POST", "/api/v2/claim/new", nil)
+		expectedResponseString := `{"id":1,"data":{"description":"Warehouse fire","id":"1","insuredId":"1","lossDate":"1990-06-01","recordTimestamp":"","status":"open"}}` + "\n"
+		requestBody := map[string]string{
+			"insuredId":   "1",
+			"lossDate":    "1990-06-01",
+			"description": "Warehouse fire",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusCreated, expectedResponseString)
+
+		// 2.) the insured did not exist yet
+		expectedResponseString = `{"error":"Invalid claim: the insured did not exist on the loss date"}` + "\n"
+		requestBody["lossDate"] = "1980-01-01"
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+
+		// 3.) description required
+		expectedResponseString = `{"error":"Invalid claim: description required"}` + "\n"
+		requestBody["lossDate"] = "1990-06-01"
+		delete(requestBody, "description")
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("Update_Status", func(t *testing.T) {
+		// 1.) not investigated yet
+		req, _ := http.NewRequest("PUT", "/api/v2/claim/update", nil)
+		expectedResponseString := `{"error":"Invalid claim: a claim that is 'open' cannot become 'paid'"}` + "\n"
+		requestBody := map[string]string{
+			"claimId": "1",
+			"status":  "paid",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+
+		// 2.) no change
+		expectedResponseString = `{"error":"update must modify at least one value"}` + "\n"
+		requestBody["status"] = "open"
+		checkResponse(t, req, httpserver, requestBody, http.StatusConflict, expectedResponseString)
+
+		// 3.) open -> investigating -> paid -> closed
+		for _, status := range []string{"investigating", "paid", "closed"} {
+			expectedResponseString = `{"id":1,"data":{"description":"Warehouse fire","id":"1","insuredId":"1","lossDate":"1990-06-01","recordTimestamp":"","status":"` + status + `"}}` + "\n"
+			requestBody["status"] = status
+			checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+		}
+
+		// 4.) closed claims do not change
+		expectedResponseString = `{"error":"Invalid claim: the claim is closed"}` + "\n"
+		requestBody = map[string]string{
+			"claimId":     "1",
+			"description": "Warehouse fire and flood",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("Detail", func(t *testing.T) { // with the insured on the loss date
+		req, _ := http.NewRequest("GET", "/api/v2/claim/id/1", nil)
+		expectedResponseString := `{"id":"1","lossDate":"1990-06-01","description":"Warehouse fire","status":"closed","insuredId":"1","recordTimestamp":"","recordDateTime":"","validFrom":"","validTo":"","insured":{"id":"1","name":"Jimmy Temelpa","policyNumber":"1000","recordTimestamp":"468072000","recordDateTime":"Wed, 31 Oct 1984 12:00:00 UTC","employees":{"0":{"id":"1","name":"Jimmy Temelpa","startDate":"1984-10-01","endDate":"","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"","recordDateTime":"","validFrom":"","validTo":""},"1":{"id":"2","name":"Mister Bungle","startDate":"1984-11-10","endDate":"","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"","recordDateTime":"","validFrom":"","validTo":""}},"insuredAddresses":{"0":{"id":"2","addressId":"1","type":"mailing","address":"123 REAL St, Springfield, Oregon","line1":"123 REAL St","line2":"","city":"Springfield","region":"Oregon","postalCode":"","country":"","recordTimestamp":"","recordDateTime":"","validFrom":"","validTo":""}}}}` + "\n"
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		checkResponseData(t, expectedResponseString, ignoreRecordTime(response.Body.String()), false)
+	})
+	t.Run("Delete", func(t *testing.T) { // closed, not deleted
+		req, _ := http.NewRequest("DELETE", "/api/v2/claim/delete/1", nil)
+		expectedResponseString := `{"error":"Invalid claim: a claim is closed, not deleted"}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("History", func(t *testing.T) { // status history
+		req, _ := http.NewRequest("GET", "/api/v2/claim/history/1", nil)
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		statuses := regexp.MustCompile(`"status":"([a-z]+)"`).FindAllStringSubmatch(response.Body.String(), -1)
+		got := []string{}
+		for _, status := range statuses {
+			got = append(got, status[1])
+		}
+		if want := "[open investigating paid closed]"; fmt.Sprint(got) != want {
+			t.Errorf("Expected statuses %s. Got %v", want, got)
+		}
+	})
+}
+
+func TestAPI_Correct(t *testing.T) {
+	t.Run("Address", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+
+		// 1.) insured 1 actually moved on 1990-01-01. Learned about it today.
+		req, _ := http.NewRequest("POST", "/api/v2/address/correct", nil)
+		expectedResponseCode := http.StatusCreated
+		expectedResponseString := `{"id":5,"data":{"address":"742 Evergreen Ter","addressId":"1","city":"","country":"","id":"5","insuredId":"1","line1":"742 Evergreen Ter","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"mailing","validFrom":"631152000"}}` + "\n"
+		requestBody := map[string]string{
+			"address":   "742 Evergreen Terrace",
+			"insuredId": "1",
+			"validFrom": "1990-01-01",
+		}
+		checkResponse(t, req, httpserver, requestBody, expectedResponseCode, expectedResponseString)
+
+		// 2.) what was known in 1995 is unchanged
+		req, _ = http.NewRequest("GET", "/api/v2/address/getbydate/1/1995-01-01", nil)
+		expectedResponseCode = http.StatusOK
+		expectedResponseString = `{"id":"2","addressId":"1","type":"mailing","address":"123 REAL St, Springfield, Oregon","line1":"123 REAL St","line2":"","city":"Springfield","region":"Oregon","postalCode":"","country":"","recordTimestamp":"469368001","recordDateTime":"Thu, 15 Nov 1984 12:00:01 UTC","validFrom":"469368001","validTo":""}` + "\n"
+		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+
+		// 3.) what was true in 1995, as known now
+		req, _ = http.NewRequest("GET", "/api/v2/address/bitemporal/1?valid=1995-01-01", nil)
+		expectedResponseCode = http.StatusOK
+		expectedResponseString = `{"0":{"id":"5","addressId":"1","type":"mailing","address":"742 Evergreen Ter","line1":"742 Evergreen Ter","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"","recordDateTime":"","validFrom":"631152000","validTo":""}}` + "\n"
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, expectedResponseCode, response.Code)
+		actual := regexp.MustCompile(`("recordTimestamp":")[0-9]+(","recordDateTime":")[^"]+"`).ReplaceAllString(response.Body.String(), `${1}${2}"`)
+		checkResponseData(t, expectedResponseString, actual, false)
+
+		// 4.) later moves still take precedence
+		req, _ = http.NewRequest("GET", "/api/v2/address/getbytimestamp/1/"+fmt.Sprint(time.Now().Unix()), nil)
+		expectedResponseCode = http.StatusOK
+		expectedResponseString = `{"id":"4","addressId":"1","type":"mailing","address":"Mars","line1":"Mars","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"852206401","recordDateTime":"Thu, 02 Jan 1997 12:00:01 UTC","validFrom":"852206401","validTo":""}` + "\n"
+		checkResponse(t, req, httpserver, nil, expectedResponseCode, expectedResponseString)
+	})
+	t.Run("Employee", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("POST", "/api/v2/employee/correct", nil)
+		expectedResponseCode := http.StatusCreated
+		expectedResponseString := `{"id":2,"data":{"annualPayroll":"0.00","endDate":"1995-12-31","id":"2","insuredId":"1","jobClassCode":"","name":"Mister Bungle","recordTimestamp":"","startDate":"1984-11-10","validFrom":"820540800","workLocation":""}}` + "\n"
+		requestBody := map[string]string{
+			"employeeId": "2",
+			"insuredId":  "1",
+			"name":       "Mister Bungle",
+			"startDate":  "1984-11-10",
+			"endDate":    "1995-12-31",
+			"validFrom":  "820540800", // 1996-01-01
+		}
+		checkResponse(t, req, httpserver, requestBody, expectedResponseCode, expectedResponseString)
+	})
+	t.Run("Fail_NoChange", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("POST", "/api/v2/address/correct", nil)
+		expectedResponseCode := http.StatusConflict
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, service.ErrRecordUpdateRequireChange) + "\n"
+		requestBody := map[string]string{
+			"address":   "123 REAL Street, Springfield, Oregon", // already the address in 1990
+			"insuredId": "1",
+			"validFrom": "1990-01-01",
+		}
+		checkResponse(t, req, httpserver, requestBody, expectedResponseCode, expectedResponseString)
+	})
+	t.Run("Fail_MissingValidFrom", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("POST", "/api/v2/address/correct", nil)
+		expectedResponseCode := http.StatusBadRequest
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, service.ErrCorrectionRequiresValidFrom) + "\n"
+		requestBody := map[string]string{
+			"address":   "742 Evergreen Terrace",
+			"insuredId": "1",
+		}
+		checkResponse(t, req, httpserver, requestBody, expectedResponseCode, expectedResponseString)
+	})
+	t.Run("Fail_FutureValidFrom", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("POST", "/api/v2/address/correct", nil)
+		expectedResponseCode := http.StatusBadRequest
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, service.ErrCorrectionNotInPast) + "\n"
+		requestBody := map[string]string{
+			"address":   "742 Evergreen Terrace",
+			"insuredId": "1",
+			"validFrom": time.Now().Add(time.Hour * 48).Format("2006-01-02"),
+		}
+		checkResponse(t, req, httpserver, requestBody, expectedResponseCode, expectedResponseString)
+	})
+}
+
 func executeRequest(req *http.Request, httpserver *http.Server) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
 	httpserver.Handler.ServeHTTP(rr, req)
@@ -557,14 +1519,304 @@ func checkResponseData(t *testing.T, expected, actual string, ignoreTimestamp bo
 
 var dump = flag.Bool("dump", true, "save work data")
 
+// storage is the backend the API tests run against. "memory", the default, needs no database files.
+var storage = flag.String("storage", "memory", `storage backend: "memory", "sqlite", or "eventlog"`)
+
+// testStore is the storage of a test's routes
+type testStore interface {
+	service.Store
+	Close() error
+}
+
+func TestAPI_ScheduledChange(t *testing.T) {
+	// pending changes have a recordTimestamp of "now"
+	ignoreRecordTime := func(body string) string {
+		body = regexp.MustCompile(`"recordTimestamp":"[0-9]+"`).ReplaceAllString(body, `"recordTimestamp":""`)
+		return regexp.MustCompile(`"recordDateTime":"[^"]+"`).ReplaceAllString(body, `"recordDateTime":""`)
+	}
+	t.Run("Address", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+
+		// 1.) insured 1 will move on 2099-01-01
+		req, _ := http.NewRequest("PUT", "/api/v2/address/update", nil)
+		expectedResponseCode := http.StatusOK
+		expectedResponseString := `{"id":5,"data":{"address":"1 Future Way","addressId":"1","city":"","country":"","id":"5","insuredId":"1","line1":"1 Future Way","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"mailing","validFrom":"4070908800"}}` + "\n"
+		requestBody := map[string]string{
+			"address":   "1 Future Way",
+			"insuredId": "1",
+			"validFrom": "2099-01-01",
+		}
+		checkResponse(t, req, httpserver, requestBody, expectedResponseCode, expectedResponseString)
+
+		// 2.) the move is pending
+		req, _ = http.NewRequest("GET", "/api/v2/insured/pending/1", nil)
+		expectedResponseString = `[{"type":"address","recordId":"5","validFrom":"4070908800","recordTimestamp":"","resource":{"id":"5","addressId":"1","type":"mailing","address":"1 Future Way","line1":"1 Future Way","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"","recordDateTime":"","validFrom":"4070908800","validTo":""}}]` + "\n"
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		checkResponseData(t, expectedResponseString, ignoreRecordTime(response.Body.String()), false)
+
+		// 3.) current address is unchanged
+		req, _ = http.NewRequest("GET", "/api/v2/address/bitemporal/1", nil)
+		expectedResponseString = `{"0":{"id":"4","addressId":"1","type":"mailing","address":"Mars","line1":"Mars","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"852206401","recordDateTime":"Thu, 02 Jan 1997 12:00:01 UTC","validFrom":"852206401","validTo":""}}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+
+		// 4.) the move is in effect from 2099
+		req, _ = http.NewRequest("GET", "/api/v2/address/bitemporal/1?valid=2099-06-01", nil)
+		expectedResponseString = `{"0":{"id":"5","addressId":"1","type":"mailing","address":"1 Future Way","line1":"1 Future Way","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"","recordDateTime":"","validFrom":"4070908800","validTo":""}}` + "\n"
+		response = executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		checkResponseData(t, expectedResponseString, ignoreRecordTime(response.Body.String()), false)
+
+		// 5.) cancel the move
+		req, _ = http.NewRequest("DELETE", "/api/v2/address/pending/5", nil)
+		expectedResponseString = `{"type":"address","recordId":"5","validFrom":"4070908800","recordTimestamp":"","resource":{"id":"5","addressId":"1","type":"mailing","address":"1 Future Way","line1":"1 Future Way","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"","recordDateTime":"","validFrom":"4070908800","validTo":""}}` + "\n"
+		response = executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		checkResponseData(t, expectedResponseString, ignoreRecordTime(response.Body.String()), false)
+
+		// 6.) nothing pending, and Mars is still the address in 2099
+		req, _ = http.NewRequest("GET", "/api/v2/insured/pending/1", nil)
+		checkResponse(t, req, httpserver, nil, http.StatusOK, `[]`+"\n")
+		req, _ = http.NewRequest("GET", "/api/v2/address/bitemporal/1?valid=2099-06-01", nil)
+		expectedResponseString = `{"0":{"id":"4","addressId":"1","type":"mailing","address":"Mars","line1":"Mars","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"852206401","recordDateTime":"Thu, 02 Jan 1997 12:00:01 UTC","validFrom":"852206401","validTo":""}}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+
+		// 7.) cannot cancel twice
+		req, _ = http.NewRequest("DELETE", "/api/v2/address/pending/5", nil)
+		expectedResponseString = fmt.Sprintf(`{"error":"%s"}`, service.ErrChangeNotPending) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusConflict, expectedResponseString)
+	})
+	t.Run("Employee", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("PUT", "/api/v2/employee/update", nil)
+		expectedResponseString := `{"id":2,"data":{"annualPayroll":"0.00","endDate":"2098-12-31","id":"2","insuredId":"1","jobClassCode":"","name":"Mister Bungle","recordTimestamp":"","startDate":"1984-11-10","validFrom":"4070908800","workLocation":""}}` + "\n"
+		requestBody := map[string]string{
+			"employeeId": "2",
+			"insuredId":  "1",
+			"name":       "Mister Bungle",
+			"startDate":  "1984-11-10",
+			"endDate":    "2098-12-31",
+			"validFrom":  "4070908800", // 2099-01-01
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+
+		// current employee list does not include the scheduled record
+		req, _ = http.NewRequest("GET", "/api/v2/insured/pending/1", nil)
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		if !strings.Contains(response.Body.String(), `"type":"employee"`) {
+			t.Errorf("Expected pending employee change. Got %s", response.Body.String())
+		}
+		req, _ = http.NewRequest("GET", "/api/v2/employee/id/2", nil)
+		response = executeRequest(req, httpserver)
+		if strings.Contains(response.Body.String(), "2098-12-31") {
+			t.Errorf("Scheduled change should not be in effect yet. Got %s", response.Body.String())
+		}
+	})
+	t.Run("Fail_NotInFuture", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("PUT", "/api/v2/address/update", nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, service.ErrScheduledChangeNotInFuture) + "\n"
+		requestBody := map[string]string{
+			"address":   "1 Future Way",
+			"insuredId": "1",
+			"validFrom": "1990-01-01",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("ValidTo", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+
+		// insured 1 is at 1 Future Way for 2099 only
+		req, _ := http.NewRequest("PUT", "/api/v2/address/update", nil)
+		expectedResponseString := `{"id":5,"data":{"address":"1 Future Way","addressId":"1","city":"","country":"","id":"5","insuredId":"1","line1":"1 Future Way","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"mailing","validFrom":"4070908800","validTo":"4102444800"}}` + "\n"
+		requestBody := map[string]string{
+			"address":   "1 Future Way",
+			"insuredId": "1",
+			"validFrom": "2099-01-01",
+			"validTo":   "2100-01-01",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, expectedResponseString)
+
+		req, _ = http.NewRequest("GET", "/api/v2/address/bitemporal/1?valid=2099-12-31", nil) // last second of 2099
+		expectedResponseString = `{"0":{"id":"5","addressId":"1","type":"mailing","address":"1 Future Way","line1":"1 Future Way","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"","recordDateTime":"","validFrom":"4070908800","validTo":"4102444800"}}` + "\n"
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		checkResponseData(t, expectedResponseString, ignoreRecordTime(response.Body.String()), false)
+
+		req, _ = http.NewRequest("GET", "/api/v2/address/bitemporal/1?valid=2100-01-01", nil)
+		expectedResponseString = `{"0":{"id":"4","addressId":"1","type":"mailing","address":"Mars","line1":"Mars","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"852206401","recordDateTime":"Thu, 02 Jan 1997 12:00:01 UTC","validFrom":"852206401","validTo":""}}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Fail_ValidToNotAfterValidFrom", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("PUT", "/api/v2/address/update", nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, service.ErrValidToNotAfterValidFrom) + "\n"
+		requestBody := map[string]string{
+			"address":   "1 Future Way",
+			"insuredId": "1",
+			"validFrom": "2099-01-01",
+			"validTo":   "2099-01-01",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("Fail_CancelEffective", func(t *testing.T) {
+		_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+		defer MustCloseDB(t, db)
+		req, _ := http.NewRequest("DELETE", "/api/v2/address/pending/4", nil)
+		expectedResponseString := fmt.Sprintf(`{"error":"%s"}`, service.ErrChangeNotPending) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusConflict, expectedResponseString)
+
+		req, _ = http.NewRequest("DELETE", "/api/v2/address/pending/99", nil)
+		expectedResponseString = fmt.Sprintf(`{"error":"%s"}`, service.ErrRecordDoesNotExist) + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, expectedResponseString)
+	})
+}
+
+func TestAPI_InsuredDiff(t *testing.T) {
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+
+	t.Run("Modified", func(t *testing.T) {
+		// 1984-11-22 to 1997-01-02 12:00:01
+		req, _ := http.NewRequest("GET", "/api/v2/insured/diff/1?from=470000000&to=852206401", nil)
+		expectedResponseString := `{"insuredId":"1","from":"470000000","to":"852206401",` +
+			`"employees":{"added":[],"removed":[],"modified":[{"employeeId":"2","name":"Mister Bungle","fields":[{"field":"endDate","before":"","after":"1996-06-01"}]}]},` +
+			`"insuredAddresses":[{"addressId":"1","type":"mailing","before":"123 REAL St, Springfield, Oregon","after":"Mars"}]}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Added", func(t *testing.T) {
+		// 1984-10-31 12:01:40, before Mister Bungle was hired
+		req, _ := http.NewRequest("GET", "/api/v2/insured/diff/1?from=468072100&to=470000000", nil)
+		expectedResponseString := `{"insuredId":"1","from":"468072100","to":"470000000",` +
+			`"employees":{"added":[{"id":"2","name":"Mister Bungle","startDate":"1984-11-10","endDate":"","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"469368000","recordDateTime":"Thu, 15 Nov 1984 12:00:00 UTC","validFrom":"469368000","validTo":""}],"removed":[],"modified":[]},` +
+			`"insuredAddresses":[{"addressId":"1","type":"mailing","before":"123 Fake St, Springfield, Oregon","after":"123 REAL St, Springfield, Oregon"}]}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Text", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/diff/1?from=470000000&to=852206401&format=text", nil)
+		expectedResponseString := "Insured 1 changes\n" +
+			"From: Thu, 22 Nov 1984 19:33:20 UTC\n" +
+			"To:   Thu, 02 Jan 1997 12:00:01 UTC\n" +
+			"\nEmployees modified:\n" +
+			"  ~ [2] Mister Bungle\n" +
+			"      endDate: \"\" -> \"1996-06-01\"\n" +
+			"\nAddresses changed:\n" +
+			"  [1] mailing: \"123 REAL St, Springfield, Oregon\" -> \"Mars\"\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+	})
+	t.Run("AddressValidTo", func(t *testing.T) { // the same address, valid to 2033-05-18
+		recorded := time.Unix(1000000000, 0)
+		address := &entity.Address{AddressId: 1, InsuredId: 1, Address: "Mars", RecordTimestamp: recorded, ValidFrom: recorded, ValidTo: time.Unix(2000000000, 0)}
+		if _, err := db.CreateAddress(context.Background(), address); err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest("GET", "/api/v2/insured/diff/1?from=999999999&to=1000000001", nil)
+		expectedResponseString := `{"insuredId":"1","from":"999999999","to":"1000000001",` +
+			`"employees":{"added":[],"removed":[],"modified":[]},` +
+			`"insuredAddresses":[{"addressId":"1","type":"mailing","before":"Mars","after":"Mars","fields":[{"field":"validTo","before":"","after":"2000000000"}]}]}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+
+		req, _ = http.NewRequest("GET", "/api/v2/insured/diff/1?from=999999999&to=1000000001&format=text", nil)
+		expectedResponseString = "Insured 1 changes\n" +
+			"From: Sun, 09 Sep 2001 01:46:39 UTC\n" +
+			"To:   Sun, 09 Sep 2001 01:46:41 UTC\n" +
+			"\nAddresses changed:\n" +
+			"  [1] mailing: \"Mars\" -> \"Mars\"\n" +
+			"      validTo: \"\" -> \"2000000000\"\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+	})
+	t.Run("NoChanges", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/diff/2?from=946684799&to=946684800&format=text", nil)
+		expectedResponseString := "Insured 2 changes\n" +
+			"From: Fri, 31 Dec 1999 23:59:59 UTC\n" +
+			"To:   Sat, 01 Jan 2000 00:00:00 UTC\n" +
+			"\nNo changes\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Fail_MissingFrom", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/diff/1", nil)
+		expectedResponseString := `{"error":"'from' is required. ` + api.ErrInvalidInstant.Error() + `"}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusBadRequest, expectedResponseString)
+	})
+	t.Run("Fail_NotFound", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/diff/99?from=470000000", nil)
+		expectedResponseString := `{"error":"No record for Insured 99 exists"}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, expectedResponseString)
+	})
+}
+
+func TestAPI_Timeline(t *testing.T) {
+	_, httpserver, db := MustOpenDBAndSetUpRoutes(t, "demo")
+	defer MustCloseDB(t, db)
+
+	t.Run("Ascending", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/timeline/2", nil)
+		expectedResponseString := `{"insuredId":"2","total":4,"events":[` +
+			`{"type":"insured.created","timestamp":"946684799","dateTime":"Fri, 31 Dec 1999 23:59:59 UTC","recordId":"2","resource":{"id":"2","name":"John Smith","policyNumber":"1001","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","employees":{},"insuredAddresses":{}}},` +
+			`{"type":"employee.created","timestamp":"946684799","dateTime":"Fri, 31 Dec 1999 23:59:59 UTC","recordId":"5","resource":{"id":"3","name":"John Smith","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"946684799","recordDateTime":"Fri, 31 Dec 1999 23:59:59 UTC","validFrom":"946684799","validTo":""}},` +
+			`{"type":"employee.created","timestamp":"954590400","dateTime":"Sat, 01 Apr 2000 12:00:00 UTC","recordId":"6","resource":{"id":"4","name":"Jane Doe","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC","validFrom":"954590400","validTo":""}},` +
+			`{"type":"employee.created","timestamp":"954590400","dateTime":"Sat, 01 Apr 2000 12:00:00 UTC","recordId":"7","resource":{"id":"5","name":"Grant Tombly","startDate":"1985-05-15","endDate":"1999-12-25","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"2","recordTimestamp":"954590400","recordDateTime":"Sat, 01 Apr 2000 12:00:00 UTC","validFrom":"954590400","validTo":""}}]}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Descending_Limit", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/timeline/1?order=desc&limit=2", nil)
+		expectedResponseString := `{"insuredId":"1","total":9,"events":[` +
+			`{"type":"address.updated","timestamp":"852206401","dateTime":"Thu, 02 Jan 1997 12:00:01 UTC","recordId":"4","resource":{"id":"4","addressId":"1","type":"mailing","address":"Mars","line1":"Mars","line2":"","city":"","region":"","postalCode":"","country":"","recordTimestamp":"852206401","recordDateTime":"Thu, 02 Jan 1997 12:00:01 UTC","validFrom":"852206401","validTo":""}},` +
+			`{"type":"employee.updated","timestamp":"852206400","dateTime":"Thu, 02 Jan 1997 12:00:00 UTC","recordId":"4","resource":{"id":"2","name":"Mister Bungle","startDate":"1984-11-10","endDate":"1996-06-01","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"852206400","recordDateTime":"Thu, 02 Jan 1997 12:00:00 UTC","validFrom":"852206400","validTo":""}}]}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+	})
+	t.Run("TimeWindow", func(t *testing.T) {
+		// 1984-11-15 12:00:00 to 12:00:01
+		req, _ := http.NewRequest("GET", "/api/v2/insured/timeline/1?from=469368000&to=469368001", nil)
+		expectedResponseString := `{"insuredId":"1","total":2,"events":[` +
+			`{"type":"employee.created","timestamp":"469368000","dateTime":"Thu, 15 Nov 1984 12:00:00 UTC","recordId":"2","resource":{"id":"2","name":"Mister Bungle","startDate":"1984-11-10","endDate":"","jobClassCode":"","annualPayroll":"0.00","workLocation":"","insuredId":"1","recordTimestamp":"469368000","recordDateTime":"Thu, 15 Nov 1984 12:00:00 UTC","validFrom":"469368000","validTo":""}},` +
+			`{"type":"address.updated","timestamp":"469368001","dateTime":"Thu, 15 Nov 1984 12:00:01 UTC","recordId":"2","resource":{"id":"2","addressId":"1","type":"mailing","address":"123 REAL St, Springfield, Oregon","line1":"123 REAL St","line2":"","city":"Springfield","region":"Oregon","postalCode":"","country":"","recordTimestamp":"469368001","recordDateTime":"Thu, 15 Nov 1984 12:00:01 UTC","validFrom":"469368001","validTo":""}}]}` + "\n"
+		checkResponse(t, req, httpserver, nil, http.StatusOK, expectedResponseString)
+	})
+	t.Run("Cancelled", func(t *testing.T) {
+		req, _ := http.NewRequest("PUT", "/api/v2/address/update", nil)
+		requestBody := map[string]string{
+			"address":   "1 Future Way",
+			"insuredId": "1",
+			"validFrom": "2099-01-01",
+		}
+		checkResponse(t, req, httpserver, requestBody, http.StatusOK, `{"id":5,"data":{"address":"1 Future Way","addressId":"1","city":"","country":"","id":"5","insuredId":"1","line1":"1 Future Way","line2":"","postalCode":"","recordTimestamp":"","region":"","type":"mailing","validFrom":"4070908800"}}`+"\n")
+		req, _ = http.NewRequest("DELETE", "/api/v2/address/pending/5", nil)
+		response := executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+
+		req, _ = http.NewRequest("GET", "/api/v2/insured/timeline/1?order=desc&limit=2", nil)
+		response = executeRequest(req, httpserver)
+		checkResponseCode(t, http.StatusOK, response.Code)
+		body := response.Body.String()
+		if !strings.Contains(body, `"total":11`) || !strings.Contains(body, `"type":"address.cancelled"`) || !strings.Contains(body, `"type":"address.updated","timestamp"`) {
+			t.Errorf("Expected address update and cancellation events. Got %s", body)
+		}
+	})
+	t.Run("Fail_Order", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/timeline/1?order=sideways", nil)
+		checkResponse(t, req, httpserver, nil, http.StatusBadRequest, `{"error":"order must be 'asc' or 'desc'"}`+"\n")
+	})
+	t.Run("Fail_NotFound", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/api/v2/insured/timeline/99", nil)
+		checkResponse(t, req, httpserver, nil, http.StatusNotFound, `{"error":"No record for Insured 99 exists"}`+"\n")
+	})
+}
+
 // Ensure the test database can open & close.
 func TestDB(t *testing.T) {
-	db := MustOpenDB(t)
+	db := MustOpenDB(t, "demo")
 	MustCloseDB(t, db)
 }
 
-// MustOpenDB returns a new, open DB. Fatal on error.
-func MustOpenDB(tb testing.TB) *sqlite.DB {
+// MustOpenDB returns a new, open DB with the fixture set named, e.g. "demo". None if empty. Fatal on error.
+func MustOpenDB(tb testing.TB, fixtures string) *sqlite.DB {
 	tb.Helper()
 
 	// Write to an in-memory database by default.
@@ -584,11 +1836,27 @@ func MustOpenDB(tb testing.TB) *sqlite.DB {
 	if err := db.Open(); err != nil {
 		tb.Fatal(err)
 	}
+	if fixtures != "" {
+		MustSeed(tb, db, fixtures)
+	}
 	return db
 }
 
+// MustSeed adds the fixture set named, e.g. "demo", through the service. Fatal on error.
+func MustSeed(tb testing.TB, db service.Store, name string) {
+	tb.Helper()
+	set, err := seed.Load(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := service.NewSqliteRecordService(db)
+	if err := s.Seed(context.Background(), set); err != nil {
+		tb.Fatal(err)
+	}
+}
+
 // MustCloseDB closes the DB. Fatal on error.
-func MustCloseDB(tb testing.TB, db *sqlite.DB) {
+func MustCloseDB(tb testing.TB, db testStore) {
 	tb.Helper()
 	if err := db.Close(); err != nil {
 		tb.Fatal(err)
@@ -605,10 +1873,10 @@ func MustCloseDBAndDelete(tb testing.TB, db *sqlite.DB, dir string) {
 //"*mux.Router, service.SqliteRecordService, "
 
 // TODO: get this from server.go
-func SetUpRoutes(db *sqlite.DB) (*api.API, service.SqliteRecordService, *http.Server) {
+func SetUpRoutes(db service.Store) (*api.API, service.SqliteRecordService, *http.Server) {
 	router := mux.NewRouter()
 	memoryService := service.NewInMemoryRecordService() // not testing this but need to avoid nil pointer ref
-	sqliteService := service.NewSqliteRecordService()
+	sqliteService := service.NewSqliteRecordService(db)
 	api := api.NewAPI(&memoryService, &sqliteService)
 
 	apiRoute := router.PathPrefix("/api/v1").Subrouter()
@@ -630,16 +1898,50 @@ func SetUpRoutes(db *sqlite.DB) (*api.API, service.SqliteRecordService, *http.Se
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
 	}
-
-	//db := sqlite.NewDB("file:main.db?cache=shared&mode=rwc&locking_mode=NORMAL&_fk=1&synchronous=2")
-	// injects db into the sqlite service so it can interact with the database.
-	sqliteService.SetService(db)
 	return api, sqliteService, HTTPServer
 }
 
-func MustOpenDBAndSetUpRoutes(t testing.TB) (*api.API, *http.Server, *sqlite.DB) {
+// MustOpenDBAndSetUpRoutes opens a DB of the -storage flag's backend with the fixture set named, e.g. "demo", and routes to it
+func MustOpenDBAndSetUpRoutes(t testing.TB, fixtures string) (*api.API, *http.Server, testStore) {
 	fmt.Println("Test name opening DB:", t.Name())
-	db := MustOpenDB(t)
+	var db testStore
+	switch *storage {
+	case "sqlite":
+		db = MustOpenDB(t, "")
+	case "eventlog":
+		log := eventlog.NewDB(filepath.Join(t.TempDir(), "test.log"))
+		if err := log.Open(); err != nil {
+			t.Fatal(err)
+		}
+		db = log
+	default:
+		db = memory.NewDB()
+	}
+	if fixtures != "" {
+		MustSeed(t, db, fixtures)
+	}
 	api, _, httpserver := SetUpRoutes(db)
 	return api, httpserver, db
 }
+
+// requestDeleteToken sends the "delete" request and returns the confirmation token
+func requestDeleteToken(t *testing.T, req *http.Request, httpserver *http.Server) string {
+	response := executeRequest(req, httpserver)
+	checkResponseCode(t, http.StatusOK, response.Code)
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil || body.Token == "" {
+		t.Fatalf("Expected confirmation token. Got %s", response.Body.String())
+	}
+	return body.Token
+}
+
+// confirmDelete sends the "delete" request at path, then confirms it with "confirmdelete"
+func confirmDelete(t *testing.T, path string, httpserver *http.Server) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("DELETE", path, nil)
+	token := requestDeleteToken(t, req, httpserver)
+	confirmPath := strings.Replace(path, "/delete/", "/confirmdelete/", 1)
+	req, _ = http.NewRequest("DELETE", confirmPath+"?token="+token, nil)
+	return executeRequest(req, httpserver)
+}
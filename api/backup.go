@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+)
+
+// API V2
+// POST /admin/backup
+// Backs up the database to the backup directory without stopping the server. Requires admin token.
+// Returns the backup's path, time, and size.
+func (a *API) Backup(w http.ResponseWriter, r *http.Request) {
+	if a.Backups == nil {
+		err := writeError(w, "Backups are only available with the sqlite storage", http.StatusNotImplemented)
+		logError(err)
+		return
+	}
+	backup, err := a.Backups.Backup(r.Context())
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	err = writeJSON(w, backup, http.StatusCreated)
+	logError(err)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// API V2
+// POST /{type}/correct
+// Retroactive correction. Same body as update, plus "validFrom": the past date the change took effect.
+// The correction is recorded as known now. Earlier records are left intact,
+// so getbydate/getbytimestamp before now still return the old answer.
+func (a *API) Correct(w http.ResponseWriter, r *http.Request) {
+	requestType := mux.Vars(r)["type"]
+	resource, err := resourceNameFromSynonym(requestType)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	ctx := r.Context()
+
+	var body map[string]*string
+	err = json.NewDecoder(r.Body).Decode(&body)
+
+	if err != nil {
+		err := writeError(w, "invalid input; could not parse json", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	recordMap := map[string]string{}
+	for key, value := range body {
+		if value != nil {
+			recordMap[key] = *value
+		}
+	}
+	var requestRecord entity.Record
+	requestRecord.Data = recordMap
+	newRecord, err := a.sqlite.CorrectResource(ctx, resource, requestRecord)
+
+	if err != nil {
+		var status int
+		if err == service.ErrRecordDoesNotExist {
+			status = http.StatusNotFound
+		} else if err == service.ErrInvalidRequest || err == service.ErrEntityIDInvalid || err == service.ErrInvalidAddressType || errors.Is(err, service.ErrInvalidAddress) || errors.Is(err, service.ErrInvalidPolicy) || errors.Is(err, service.ErrInvalidClaim) || errors.Is(err, service.ErrInvalidEmployee) ||
+			err == service.ErrCorrectionRequiresValidFrom || err == service.ErrCorrectionNotInPast || err == service.ErrValidToNotAfterValidFrom {
+			status = http.StatusBadRequest
+		} else if err == service.ErrNonexistentParentRecord || err == service.ErrRecordAlreadyExists || err == service.ErrRecordUpdateRequireChange {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		errInWriting := writeError(w, err.Error(), status)
+		logError(err)
+		logError(errInWriting)
+		return
+	}
+	err = writeJSON(w, newRecord, http.StatusCreated)
+	logError(err)
+}
@@ -2,10 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
 	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/service"
 )
 
 // API V2
@@ -45,12 +47,18 @@ func (a *API) Create(w http.ResponseWriter, r *http.Request) {
 	newRecord, err := a.sqlite.CreateResource(ctx, resource, requestRecord)
 
 	if err != nil {
-		if err.Error() == entity.ErrRecordAlreadyExists {
+		if err == service.ErrRecordAlreadyExists {
 			errInWriting := writeError(w, err.Error(), http.StatusConflict)
 			logError(err)
 			logError(errInWriting)
 			return
 		}
+		if err == service.ErrInvalidRequest || err == service.ErrInvalidAddressType || errors.Is(err, service.ErrInvalidAddress) || errors.Is(err, service.ErrInvalidPolicy) || errors.Is(err, service.ErrInvalidClaim) || errors.Is(err, service.ErrInvalidEmployee) || err == service.ErrValidToNotAfterValidFrom {
+			errInWriting := writeError(w, err.Error(), http.StatusBadRequest)
+			logError(err)
+			logError(errInWriting)
+			return
+		}
 		errInWriting := writeError(w, err.Error(), http.StatusInternalServerError)
 		logError(err)
 		logError(errInWriting)
@@ -4,18 +4,18 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/entity"
 	"github.com/nickcoast/timetravel/service"
 )
 
 // API V2
 // DELETE /{type}/delete/{id:[0-9]+}
-// if the record exists, the record is updated.
-// if the record doesn't exist, the record is created.
-// note "Record" is used here but its for the "sqlite" service that currently acts on Insureds only
+// Does not delete. Returns a preview of what would be deleted, and a short-lived, single-use token
+// to send to "confirmdelete" to delete it.
 func (a *API) Delete(w http.ResponseWriter, r *http.Request) {
-
 	insuredObject, err := a.NewInsuredObjectFromRequest(r)
 	if err != nil {
 		err := writeError(w, err.Error(), http.StatusBadRequest)
@@ -25,26 +25,88 @@ func (a *API) Delete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	id := mux.Vars(r)["id"]
 	idNumber, err := strconv.ParseInt(id, 10, 32)
-	// first retrieve the record
-	record, err := a.sqlite.GetResourceById( // This is also done by DB with deleted, err := db.GetById(ctx, tableName, id)
-		ctx,
-		insuredObject, // TODO: change to InsuredInterface
-		int(idNumber),
-	)
+	if err != nil {
+		err := writeError(w, service.ErrRecordIDInvalid.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	preview, err := a.sqlite.PreviewDeleteResource(ctx, insuredObject, idNumber)
+	if errors.Is(err, service.ErrRecordDoesNotExist) {
+		err = writeError(w, "Cannot delete. Record does not exist.", http.StatusNotFound)
+		logError(err)
+		return
+	} else if errors.Is(err, service.ErrInvalidClaim) {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	} else if err != nil {
+		err := writeError(w, "Bad request or server error", http.StatusBadRequest)
+		logError(err)
+		return
+	}
 
-	if errors.Is(err, service.ErrRecordDoesNotExist) { // record exists
-		err = writeError(w, "Cannot delete. Record does not exist.", http.StatusNotFound)		
+	resource, _ := resourceNameFromSynonym(mux.Vars(r)["type"])
+	expires := time.Now().Add(a.DeleteTokenTTL)
+	token, err := a.deleteTokens.issue(service.TenantFromContext(ctx), resource, idNumber, expires)
+	if err != nil {
+		err := writeError(w, ErrInternal.Error(), http.StatusInternalServerError)
+		logError(err)
 		return
 	}
+	err = writeJSON(w, struct {
+		Token   string               `json:"token"`
+		Expires string               `json:"expires"`
+		Preview entity.DeletePreview `json:"preview"`
+	}{
+		Token:   token,
+		Expires: strconv.FormatInt(expires.Unix(), 10),
+		Preview: preview,
+	}, http.StatusOK)
+	logError(err)
+}
 
-	deletedRecord, err := a.sqlite.DeleteResource(ctx, record, idNumber)
+// API V2
+// DELETE /{type}/confirmdelete/{id:[0-9]+}?token=...
+// Soft deletes record (insured, employee, or insured address) using a token from "delete".
+// Returns the deleted record.
+func (a *API) ConfirmDelete(w http.ResponseWriter, r *http.Request) {
+	insuredObject, err := a.NewInsuredObjectFromRequest(r)
 	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		err := writeError(w, service.ErrRecordIDInvalid.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	resource, _ := resourceNameFromSynonym(mux.Vars(r)["type"])
+	if err := a.deleteTokens.redeem(r.URL.Query().Get("token"), service.TenantFromContext(ctx), resource, idNumber); err != nil {
+		err := writeError(w, err.Error(), http.StatusForbidden)
+		logError(err)
+		return
+	}
+
+	deletedRecord, err := a.sqlite.DeleteResource(ctx, insuredObject, idNumber)
+	if errors.Is(err, service.ErrRecordDoesNotExist) {
+		err = writeError(w, "Cannot delete. Record does not exist.", http.StatusNotFound)
+		logError(err)
+		return
+	} else if errors.Is(err, service.ErrInvalidClaim) {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	} else if err != nil {
 		err := writeError(w, "Bad request or server error", http.StatusBadRequest)
 		logError(err)
 		return
 	}
 	err = writeJSON(w, deletedRecord, http.StatusOK)
-
 	logError(err)
-	return
 }
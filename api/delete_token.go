@@ -0,0 +1,67 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultDeleteTokenTTL is how long a delete confirmation token is valid
+const DefaultDeleteTokenTTL = 2 * time.Minute
+
+var ErrInvalidDeleteToken = errors.New("Invalid, expired, or already used confirmation token. Use 'delete' to get a new one")
+
+// deleteTokens holds issued delete confirmation tokens. Tokens are single-use.
+type deleteTokens struct {
+	mu     sync.Mutex
+	tokens map[string]deleteToken
+}
+
+// deleteToken confirms deletion of one resource of one tenant until it expires
+type deleteToken struct {
+	tenant   string // empty without tenants
+	resource string
+	id       int64
+	expires  time.Time
+}
+
+func newDeleteTokens() *deleteTokens {
+	return &deleteTokens{tokens: make(map[string]deleteToken)}
+}
+
+// issue returns a new token for deleting the tenant's resource, valid until expires
+func (d *deleteTokens) issue(tenant string, resource string, id int64, expires time.Time) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for t, issued := range d.tokens { // drop expired tokens
+		if now.After(issued.expires) {
+			delete(d.tokens, t)
+		}
+	}
+	d.tokens[token] = deleteToken{tenant: tenant, resource: resource, id: id, expires: expires}
+	return token, nil
+}
+
+// redeem uses up the token if it is unexpired and was issued for this resource of this tenant
+func (d *deleteTokens) redeem(token string, tenant string, resource string, id int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	issued, ok := d.tokens[token]
+	if !ok || issued.tenant != tenant || issued.resource != resource || issued.id != id {
+		return ErrInvalidDeleteToken
+	}
+	delete(d.tokens, token)
+	if time.Now().After(issued.expires) {
+		return ErrInvalidDeleteToken
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// API V2
+// GET /insured/diff/{insuredId}?from={date}&to={date}
+// What changed for the insured between "from" and "to": employees added, removed and modified, and address changes.
+// Either may be a date or a timestamp. "to" defaults to now.
+// Add "format=text" for a human-readable report.
+func (a *API) GetInsuredDiff(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	insuredId := mux.Vars(r)["insuredId"]
+	idNumber, err := strconv.ParseInt(insuredId, 10, 32)
+	if err != nil || idNumber <= 0 {
+		err := writeError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("from") == "" {
+		err := writeError(w, "'from' is required. "+ErrInvalidInstant.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	from, err := parseInstant(query.Get("from"), time.Time{})
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	to, err := parseInstant(query.Get("to"), time.Now())
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "text" {
+		err := writeError(w, "format must be 'json' or 'text'", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	diff, err := a.sqlite.DiffInsured(ctx, idNumber, from, to)
+	if err == service.ErrRecordDoesNotExist {
+		err := writeError(w, fmt.Sprintf("No record for Insured %v exists", idNumber), http.StatusNotFound)
+		logError(err)
+		return
+	} else if err != nil {
+		err := writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+
+	if format == "text" {
+		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write([]byte(diff.Report()))
+		logError(err)
+		return
+	}
+	err = writeJSON(w, diff, http.StatusOK)
+	logError(err)
+}
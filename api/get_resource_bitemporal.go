@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// API V2
+// GET /{type}/bitemporal/{insuredId}?valid={date}&known={date}
+// Get records that were true at "valid", as the system knew them at "known".
+// Either may be a date or a timestamp. Both default to now.
+func (a *API) GetResourceByBitemporalDate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	insuredObject, err := a.NewInsuredObjectFromRequest(r)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	insuredId := mux.Vars(r)["insuredId"]
+	idNumber, err := strconv.ParseInt(insuredId, 10, 32)
+	if err != nil || idNumber <= 0 {
+		err := writeError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	now := time.Now()
+	asOfValid, err := parseInstant(r.URL.Query().Get("valid"), now)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	asOfRecorded, err := parseInstant(r.URL.Query().Get("known"), now)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	_, ok := insuredObject.(*entity.Insured)
+	if ok {
+		insured, err := a.sqlite.GetInsuredByBitemporalDate(ctx, idNumber, asOfValid, asOfRecorded)
+		if err != nil {
+			err := writeError(w, fmt.Sprintf("No record for Insured %v exists", idNumber), http.StatusNotFound)
+			logError(err)
+			return
+		}
+		err = writeJSON(w, insured, http.StatusOK)
+		logError(err)
+		return
+	}
+
+	records, err := a.sqlite.GetResourceByBitemporalDate(ctx, insuredObject, idNumber, asOfValid, asOfRecorded)
+	if err != nil || len(records) == 0 {
+		err := writeError(w, fmt.Sprintf("No record for Insured %v and these dates exist", idNumber), http.StatusNotFound)
+		logError(err)
+		return
+	}
+	err = writeJSON(w, records, http.StatusOK)
+	logError(err)
+}
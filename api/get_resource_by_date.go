@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/nickcoast/timetravel/entity"
@@ -27,14 +26,7 @@ func (a *API) GetResourceByDate(w http.ResponseWriter, r *http.Request) {
 	insuredId := mux.Vars(r)["insuredId"]
 	idNumber, err := strconv.ParseInt(insuredId, 10, 32)
 
-	t := time.Now()
-	zone, offset := t.Zone()
-	fmt.Println(zone, offset)
-
-	dateTime, err := time.Parse("2006-01-02", date)
-	dateTime = dateTime.Add(time.Hour*24 - time.Second*time.Duration(offset)) // Set to midnight of system timezone
-	/* timestamp := dateTime.Unix()
-	fmt.Println(timestamp) */
+	dateTime, err := parseEndOfLocalDay(date)
 	if err != nil {
 		err := writeError(w, fmt.Sprintf("Please submit date in format: 2006-01-02. Or submit timestamp"), http.StatusBadRequest)
 		logError(err)
@@ -54,6 +46,19 @@ func (a *API) GetResourceByDate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// an insured may have several policies in force
+	if _, ok := insuredObject.(*entity.Policy); ok {
+		records, err := a.sqlite.GetResourceByBitemporalDate(ctx, insuredObject, idNumber, dateTime, dateTime)
+		if err != nil || len(records) == 0 {
+			err := writeError(w, fmt.Sprintf("No policy in force for Insured %v at date %v", idNumber, date), http.StatusNotFound)
+			logError(err)
+			return
+		}
+		err = writeJSON(w, records, http.StatusOK)
+		logError(err)
+		return
+	}
+
 	record, err := a.sqlite.GetResourceByDate(
 		ctx,
 		insuredObject,
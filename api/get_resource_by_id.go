@@ -29,11 +29,16 @@ func (a *API) GetResourceById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	record, err := a.sqlite.GetResourceById(
-		ctx,
-		insuredObject,
-		int(idNumber), // TODO: get id from insuredObject
-	)
+	var record entity.InsuredInterface
+	if _, ok := insuredObject.(*entity.Claim); ok { // with the insured at the loss date
+		record, err = a.sqlite.GetClaim(ctx, int(idNumber))
+	} else {
+		record, err = a.sqlite.GetResourceById(
+			ctx,
+			insuredObject,
+			int(idNumber), // TODO: get id from insuredObject
+		)
+	}
 	if err != nil {
 		err := writeError(w, fmt.Sprintf("record of id %v does not exist", idNumber), http.StatusNotFound)
 		logError(err)
@@ -40,7 +40,7 @@ func (a *API) GetResourceByTimestamp(w http.ResponseWriter, r *http.Request) {
 	if ok {
 		insured, err := a.sqlite.GetInsuredByDate(ctx, idNumber, timestampDate)
 		if err != nil || insured.ID == 0 {
-			err := writeError(w, fmt.Sprintf("No record for Insured %v and date %v exist", idNumber, date), http.StatusBadRequest)
+			err := writeError(w, fmt.Sprintf("No record for Insured %v and date %v exist", idNumber, date), http.StatusNotFound)
 			logError(err)
 			return
 		}
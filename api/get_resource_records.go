@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"sort"
 	"strconv"
 
 	"github.com/gorilla/mux"
@@ -33,6 +34,12 @@ func (a *API) GetResourceRecords(w http.ResponseWriter, r *http.Request) {
 		logError(err)
 		return
 	}
-	m := maps.Values(entities) // convert map to slice for json array
+	// convert map to slice for json array, oldest record first
+	keys := maps.Keys(entities)
+	sort.Ints(keys)
+	m := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		m = append(m, entities[k])
+	}
 	err = writeJSON(w, m, http.StatusOK)
 }
@@ -5,11 +5,15 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
 )
 
 var (
 	ErrInternal        = errors.New("internal error")
-	ErrInvalidEndpoint = errors.New("Please use 'insured', 'address', or 'employee'. No endpoint for: ")
+	ErrInvalidEndpoint = errors.New("Please use 'insured', 'address', 'employee', 'policy', or 'claim'. No endpoint for: ")
+	ErrInvalidInstant  = errors.New("Please submit date in format: 2006-01-02. Or submit timestamp")
 )
 
 // logs an error if it's not nil
@@ -48,6 +52,10 @@ func resourceNameFromSynonym(resourceSynonym string) (resourceName string, err e
 		"employees":         "employee",
 		"insureds":          "insured",
 		"insured":           "insured",
+		"policy":            "policy",
+		"policies":          "policy",
+		"claim":             "claim",
+		"claims":            "claim",
 	}
 	resourceName, ok := synonyms[resourceSynonym]
 	if !ok {
@@ -55,3 +63,39 @@ func resourceNameFromSynonym(resourceSynonym string) (resourceName string, err e
 	}
 	return resourceName, nil
 }
+
+// parseEndOfLocalDay parses a getbydate date ("2006-01-02") as the midnight ending it in the system timezone
+func parseEndOfLocalDay(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, offset := time.Now().Zone()
+	return t.Add(time.Hour*24 - time.Second*time.Duration(offset)), nil
+}
+
+// parseInstant parses a query value to read as of: an integer timestamp, or a date ("2006-01-02") at 23:59:59 UTC.
+// Returns fallback if value is empty.
+func parseInstant(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	t, err := entity.ParseAsOf(value)
+	if err != nil {
+		return time.Time{}, ErrInvalidInstant
+	}
+	return t, nil
+}
+
+// parseStart parses a query value that starts a time window: an integer timestamp, or a date ("2006-01-02") at start of day UTC.
+// Returns zero time if value is empty.
+func parseStart(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := entity.ParseValidTime(value)
+	if err != nil {
+		return time.Time{}, ErrInvalidInstant
+	}
+	return t, nil
+}
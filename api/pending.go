@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// API V2
+// GET /insured/pending/{insuredId}
+// List the insured's scheduled changes (employee and address) that have not taken effect yet.
+func (a *API) GetPendingChanges(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	insuredId := mux.Vars(r)["insuredId"]
+	idNumber, err := strconv.ParseInt(insuredId, 10, 32)
+	if err != nil || idNumber <= 0 {
+		err := writeError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	changes, err := a.sqlite.GetPendingChanges(ctx, idNumber)
+	if err == service.ErrRecordDoesNotExist {
+		err := writeError(w, fmt.Sprintf("No record for Insured %v exists", idNumber), http.StatusNotFound)
+		logError(err)
+		return
+	} else if err != nil {
+		err := writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	if changes == nil {
+		changes = []entity.PendingChange{}
+	}
+	err = writeJSON(w, changes, http.StatusOK)
+	logError(err)
+}
+
+// API V2
+// DELETE /{type}/pending/{recordId}
+// Cancel a scheduled employee or address change before it takes effect.
+// The cancelled record is kept, so earlier answers by "known" date are unchanged.
+func (a *API) CancelPendingChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	insuredObject, err := a.NewInsuredObjectFromRequest(r)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	if _, ok := insuredObject.(*entity.Insured); ok {
+		err := writeError(w, "insured has no scheduled changes. Use 'employee' or 'address'", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	recordId := mux.Vars(r)["recordId"]
+	idNumber, err := strconv.ParseInt(recordId, 10, 32)
+	if err != nil || idNumber <= 0 {
+		err := writeError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	change, err := a.sqlite.CancelPendingChange(ctx, insuredObject, idNumber)
+	if err != nil {
+		var status int
+		if err == service.ErrRecordDoesNotExist {
+			status = http.StatusNotFound
+		} else if err == service.ErrChangeNotPending {
+			status = http.StatusConflict
+		} else {
+			status = http.StatusInternalServerError
+		}
+		errInWriting := writeError(w, err.Error(), status)
+		logError(err)
+		logError(errInWriting)
+		return
+	}
+	err = writeJSON(w, change, http.StatusOK)
+	logError(err)
+}
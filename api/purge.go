@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// API V2
+// DELETE /{type}/purge/{id:[0-9]+}
+// Permanently deletes the record and all of its history, including soft deleted records.
+// Requires admin token. Use "delete" to delete while keeping history.
+func (a *API) Purge(w http.ResponseWriter, r *http.Request) {
+	insuredObject, err := a.NewInsuredObjectFromRequest(r)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+	idNumber, err := strconv.ParseInt(id, 10, 32)
+	if err != nil || idNumber <= 0 {
+		err := writeError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	err = a.sqlite.PurgeResource(ctx, insuredObject, idNumber)
+	if err == service.ErrRecordDoesNotExist {
+		err = writeError(w, "Cannot purge. Record does not exist.", http.StatusNotFound)
+		logError(err)
+		return
+	} else if err != nil {
+		err := writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	err = writeJSON(w, map[string]string{"id": id, "purged": "true"}, http.StatusOK)
+	logError(err)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// API V2
+// POST /policy/renew
+// Adds the next term of "policyId", starting when its latest term expires and as long as it.
+// Limits and premium stay the same, unless the body has "occurrenceLimit", "aggregateLimit", or "premium".
+// "expirationDate" ends the new term at another date.
+func (a *API) Renew(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var body map[string]*string
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		err := writeError(w, "invalid input; could not parse json", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	recordMap := map[string]string{}
+	for key, value := range body {
+		if value != nil {
+			recordMap[key] = *value
+		}
+	}
+	var requestRecord entity.Record
+	requestRecord.Data = recordMap
+	newRecord, err := a.sqlite.RenewPolicy(ctx, requestRecord)
+
+	if err != nil {
+		var status int
+		if err == service.ErrRecordDoesNotExist {
+			status = http.StatusNotFound
+		} else if err == service.ErrEntityIDInvalid || errors.Is(err, service.ErrInvalidPolicy) {
+			status = http.StatusBadRequest
+		} else {
+			status = http.StatusInternalServerError
+		}
+		errInWriting := writeError(w, err.Error(), status)
+		logError(err)
+		logError(errInWriting)
+		return
+	}
+	err = writeJSON(w, newRecord, http.StatusCreated)
+	logError(err)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// API V2
+// POST /{type}/restore/{id:[0-9]+}?asOf=T
+// Restores the insured, employee, or address as it was at asOf by appending new records effective now.
+// Works for deleted records and for records changed by bad updates. Old records are not modified.
+// asOf is a timestamp or date (end of day). For address, id is any address record id of the insured.
+func (a *API) Restore(w http.ResponseWriter, r *http.Request) {
+	insuredObject, err := a.NewInsuredObjectFromRequest(r)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	ctx := r.Context()
+	idNumber, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 32)
+	if err != nil || idNumber <= 0 {
+		err := writeError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	asOfValue := r.URL.Query().Get("asOf")
+	if asOfValue == "" {
+		err := writeError(w, "Restore requires 'asOf': the time to restore to", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	asOf, err := parseInstant(asOfValue, time.Time{})
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	restored, err := a.sqlite.RestoreResource(ctx, insuredObject, idNumber, asOf)
+	switch err {
+	case nil:
+	case service.ErrRecordDoesNotExist, service.ErrNothingToRestore:
+		err = writeError(w, err.Error(), http.StatusNotFound)
+		logError(err)
+		return
+	case service.ErrRecordUpdateRequireChange:
+		err = writeError(w, "Nothing to restore: record is already as it was at that time", http.StatusConflict)
+		logError(err)
+		return
+	case service.ErrRestoreRequiresInsured:
+		err = writeError(w, err.Error(), http.StatusConflict)
+		logError(err)
+		return
+	default:
+		err = writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	err = writeJSON(w, restored, http.StatusOK)
+	logError(err)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// API V2
+// GET /insured/snapshot?timestamp={T}&name={name}&policyNumber={n}&limit={n}&offset={n}
+// Every insured, with employees and address, as it was at T (a timestamp or date; default now).
+// Insureds not yet created or deleted at T are left out.
+func (a *API) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	asOf, filter, err := snapshotQuery(r)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	insureds, n, err := a.sqlite.GetSnapshot(ctx, asOf, filter)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	err = writeJSON(w, struct {
+		Timestamp string           `json:"timestamp"`
+		Total     int              `json:"total"`
+		Insureds  []entity.Insured `json:"insureds"`
+	}{
+		Timestamp: strconv.FormatInt(asOf.Unix(), 10),
+		Total:     n,
+		Insureds:  insureds,
+	}, http.StatusOK)
+	logError(err)
+}
+
+// API V2
+// GET /insured/snapshot/stream?timestamp={T}&...
+// Same as snapshot, streamed as newline-delimited JSON, one insured per line.
+// The total count of matching insureds is in the X-Total-Count header.
+func (a *API) StreamSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	asOf, filter, err := snapshotQuery(r)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+	start := func(total int) {
+		w.Header().Add("Content-Type", "application/x-ndjson; charset=utf-8")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		w.WriteHeader(http.StatusOK)
+		started = true
+	}
+	total, err := a.sqlite.StreamSnapshot(ctx, asOf, filter, func(insured entity.Insured, total int) error {
+		if !started {
+			start(total)
+		}
+		if err := encoder.Encode(insured); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		err := writeError(w, ErrInternal.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	logError(err) // too late to change the response
+	if !started {
+		start(total)
+	}
+}
+
+// snapshotQuery reads the snapshot time and insured filter from the query string
+func snapshotQuery(r *http.Request) (asOf time.Time, filter entity.InsuredFilter, err error) {
+	query := r.URL.Query()
+	if asOf, err = parseInstant(query.Get("timestamp"), time.Now()); err != nil {
+		return asOf, filter, err
+	}
+	if name := query.Get("name"); name != "" {
+		filter.Name = &name
+	}
+	if policyNumber := query.Get("policyNumber"); policyNumber != "" {
+		n, err := strconv.Atoi(policyNumber)
+		if err != nil {
+			return asOf, filter, fmt.Errorf("policyNumber must be a number")
+		}
+		filter.PolicyNumber = &n
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			return asOf, filter, fmt.Errorf("limit must be a positive number")
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			return asOf, filter, fmt.Errorf("offset must be a positive number")
+		}
+	}
+	return asOf, filter, nil
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/seed"
+	"github.com/nickcoast/timetravel/service"
+	"github.com/nickcoast/timetravel/tenant"
+)
+
+// TenantHeader is the request header naming the tenant whose database the request uses.
+// Without it, the tenant is the subdomain of the API's Domain, e.g. "acme" for "acme.example.com".
+const TenantHeader = "X-Tenant"
+
+// withTenant resolves the request's tenant and adds it to the request's context, so the service uses its database.
+// Does nothing if there are no tenants.
+func (a *API) withTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.Tenants == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name := a.tenantName(r)
+		if name == "" {
+			err := writeError(w, tenant.ErrNoTenant.Error(), http.StatusBadRequest)
+			logError(err)
+			return
+		}
+		if _, err := a.Tenants.DB(name); err == tenant.ErrUnknownTenant {
+			err := writeError(w, err.Error(), http.StatusNotFound)
+			logError(err)
+			return
+		} else if err != nil {
+			err := writeError(w, err.Error(), http.StatusInternalServerError)
+			logError(err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(service.NewContextWithTenant(r.Context(), name)))
+	})
+}
+
+// tenantName returns the TenantHeader, or else the subdomain of Domain in the request's host. Empty if neither.
+func (a *API) tenantName(r *http.Request) string {
+	if name := r.Header.Get(TenantHeader); name != "" {
+		return name
+	}
+	if a.Domain == "" {
+		return ""
+	}
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	name := strings.TrimSuffix(host, "."+strings.ToLower(a.Domain))
+	if name == host || strings.Contains(name, ".") {
+		return ""
+	}
+	return name
+}
+
+// API V2
+// GET /admin/tenants
+// Lists the tenants. Requires admin token.
+func (a *API) ListTenants(w http.ResponseWriter, r *http.Request) {
+	if a.Tenants == nil {
+		err := writeError(w, "Tenants are not configured", http.StatusNotImplemented)
+		logError(err)
+		return
+	}
+	tenants, err := a.Tenants.List()
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	if tenants == nil {
+		tenants = []tenant.Tenant{}
+	}
+	err = writeJSON(w, tenants, http.StatusOK)
+	logError(err)
+}
+
+// API V2
+// POST /admin/tenants
+// Creates a tenant with an empty database, e.g. {"name": "acme"}. Requires admin token.
+// "seed" adds a fixture set, e.g. "demo".
+func (a *API) CreateTenant(w http.ResponseWriter, r *http.Request) {
+	if a.Tenants == nil {
+		err := writeError(w, "Tenants are not configured", http.StatusNotImplemented)
+		logError(err)
+		return
+	}
+	var body struct {
+		Name string `json:"name"`
+		Seed string `json:"seed"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		err := writeError(w, "invalid input; could not parse json", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+	var set seed.Set
+	if body.Seed != "" {
+		var err error
+		// only the embedded sets: a file name would read the server's files
+		if strings.HasSuffix(body.Seed, ".json") {
+			err = seed.ErrUnknownSet
+		} else {
+			set, err = seed.Load(body.Seed)
+		}
+		if err != nil {
+			err := writeError(w, err.Error(), http.StatusBadRequest)
+			logError(err)
+			return
+		}
+	}
+
+	created, err := a.Tenants.Create(body.Name)
+	if err == tenant.ErrInvalidName {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	} else if err == tenant.ErrTenantExists {
+		err := writeError(w, err.Error(), http.StatusConflict)
+		logError(err)
+		return
+	} else if err != nil {
+		err := writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	if body.Seed != "" {
+		db, err := a.Tenants.DB(created.Name)
+		if err == nil {
+			s := service.NewSqliteRecordService(db)
+			err = s.Seed(r.Context(), set)
+		}
+		if err != nil {
+			err := writeError(w, err.Error(), http.StatusInternalServerError)
+			logError(err)
+			return
+		}
+	}
+	err = writeJSON(w, created, http.StatusCreated)
+	logError(err)
+}
+
+// API V2
+// DELETE /admin/tenants/{name}
+// Drops the tenant and deletes its database. This cannot be undone. Requires admin token.
+func (a *API) DropTenant(w http.ResponseWriter, r *http.Request) {
+	if a.Tenants == nil {
+		err := writeError(w, "Tenants are not configured", http.StatusNotImplemented)
+		logError(err)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	err := a.Tenants.Drop(name)
+	if err == tenant.ErrUnknownTenant {
+		err := writeError(w, err.Error(), http.StatusNotFound)
+		logError(err)
+		return
+	} else if err != nil {
+		err := writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	err = writeJSON(w, map[string]string{"name": name, "dropped": "true"}, http.StatusOK)
+	logError(err)
+}
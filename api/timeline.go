@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// API V2
+// GET /insured/timeline/{insuredId}?from={date}&to={date}&order=desc&limit={n}&offset={n}
+// Every event for the insured (creation, each employee record, each address record), sorted by
+// the time it was recorded. "from" and "to" bound the time window and may be a date or a timestamp.
+// "order" is "asc" (default) or "desc".
+func (a *API) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	insuredId := mux.Vars(r)["insuredId"]
+	idNumber, err := strconv.ParseInt(insuredId, 10, 32)
+	if err != nil || idNumber <= 0 {
+		err := writeError(w, "invalid id; id must be a positive number", http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	filter, err := timelineFilterFromQuery(r)
+	if err != nil {
+		err := writeError(w, err.Error(), http.StatusBadRequest)
+		logError(err)
+		return
+	}
+
+	events, n, err := a.sqlite.GetTimeline(ctx, idNumber, filter)
+	if err == service.ErrRecordDoesNotExist {
+		err := writeError(w, fmt.Sprintf("No record for Insured %v exists", idNumber), http.StatusNotFound)
+		logError(err)
+		return
+	} else if err != nil {
+		err := writeError(w, err.Error(), http.StatusInternalServerError)
+		logError(err)
+		return
+	}
+	err = writeJSON(w, struct {
+		InsuredId string                 `json:"insuredId"`
+		Total     int                    `json:"total"`
+		Events    []entity.TimelineEvent `json:"events"`
+	}{
+		InsuredId: strconv.Itoa(int(idNumber)),
+		Total:     n,
+		Events:    events,
+	}, http.StatusOK)
+	logError(err)
+}
+
+func timelineFilterFromQuery(r *http.Request) (filter entity.TimelineFilter, err error) {
+	query := r.URL.Query()
+	if filter.From, err = parseStart(query.Get("from")); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseInstant(query.Get("to"), time.Time{}); err != nil {
+		return filter, err
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, fmt.Errorf("order must be 'asc' or 'desc'")
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			return filter, fmt.Errorf("limit must be a positive number")
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			return filter, fmt.Errorf("offset must be a positive number")
+		}
+	}
+	return filter, nil
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -54,7 +55,7 @@ func (a *API) Update(w http.ResponseWriter, r *http.Request) {
 			return */
 		} else if err == service.ErrNonexistentParentRecord {
 			status = http.StatusConflict
-		} else if err == service.ErrInvalidRequest || err == service.ErrEntityIDInvalid {
+		} else if err == service.ErrInvalidRequest || err == service.ErrEntityIDInvalid || err == service.ErrInvalidAddressType || errors.Is(err, service.ErrInvalidAddress) || errors.Is(err, service.ErrInvalidPolicy) || errors.Is(err, service.ErrInvalidClaim) || errors.Is(err, service.ErrInvalidEmployee) || err == service.ErrScheduledChangeNotInFuture || err == service.ErrValidToNotAfterValidFrom {
 			status = http.StatusBadRequest
 		} else if err == service.ErrRecordAlreadyExists || err == service.ErrRecordUpdateRequireChange { // test
 			status = http.StatusConflict
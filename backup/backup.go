@@ -0,0 +1,174 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backups of the database to files in a directory, named for the time they were taken,
+// e.g. "timetravel-20230102T150405Z.db". Taken on demand or on a schedule. The newest Keep are kept.
+
+// DefaultKeep is the number of backups kept
+const DefaultKeep = 7
+
+const (
+	prefix     = "timetravel-"
+	suffix     = ".db"
+	timeFormat = "20060102T150405Z"
+)
+
+var ErrNoBackup = errors.New("no backup taken at or before that time")
+var ErrClosed = errors.New("backups are closed")
+
+// DB is a database that can copy itself to a file while in use, e.g. *sqlite.DB
+type DB interface {
+	Backup(ctx context.Context, path string) error
+}
+
+// Backup is a backup file
+type Backup struct {
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+type Manager struct {
+	db DB
+
+	Dir  string
+	Keep int // backups kept. 0 keeps all.
+	Now  func() time.Time
+
+	mu     sync.Mutex // one backup at a time
+	closed bool
+}
+
+// NewManager returns a Manager backing up db to dir
+func NewManager(db DB, dir string) *Manager {
+	return &Manager{
+		db:   db,
+		Dir:  dir,
+		Keep: DefaultKeep,
+		Now:  time.Now,
+	}
+}
+
+// Backup takes a backup now, then removes the oldest backups over Keep
+func (m *Manager) Backup(ctx context.Context) (Backup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return Backup{}, ErrClosed
+	}
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return Backup{}, err
+	}
+	t := m.Now().UTC().Truncate(time.Second)
+	path := filepath.Join(m.Dir, prefix+t.Format(timeFormat)+suffix)
+	if err := m.db.Backup(ctx, path); err != nil {
+		return Backup{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Backup{}, err
+	}
+	if err := m.prune(); err != nil {
+		return Backup{}, err
+	}
+	return Backup{Path: path, Time: t, Size: info.Size()}, nil
+}
+
+// List returns the backups in Dir, oldest first
+func (m *Manager) List() ([]Backup, error) {
+	entries, err := os.ReadDir(m.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		t, err := time.Parse(timeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix))
+		if err != nil {
+			continue // not a backup
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, Backup{Path: filepath.Join(m.Dir, name), Time: t, Size: info.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+	return backups, nil
+}
+
+// Find returns the newest backup taken at or before t
+func (m *Manager) Find(t time.Time) (Backup, error) {
+	backups, err := m.List()
+	if err != nil {
+		return Backup{}, err
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		if !backups[i].Time.After(t) {
+			return backups[i], nil
+		}
+	}
+	return Backup{}, ErrNoBackup
+}
+
+// prune removes the oldest backups over Keep
+func (m *Manager) prune() error {
+	if m.Keep <= 0 {
+		return nil
+	}
+	backups, err := m.List()
+	if err != nil {
+		return err
+	}
+	for len(backups) > m.Keep {
+		if err := os.Remove(backups[0].Path); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Run takes a backup every interval until ctx is done. Errors are logged.
+func (m *Manager) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if b, err := m.Backup(ctx); err == ErrClosed {
+				return
+			} else if err != nil {
+				log.Printf("error: backup: %v", err)
+			} else {
+				log.Printf("backup %s (%v bytes)", b.Path, b.Size)
+			}
+		}
+	}
+}
+
+// Close waits for a backup in progress, and stops new ones, so the database can be closed
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
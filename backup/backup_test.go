@@ -0,0 +1,82 @@
+package backup_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nickcoast/timetravel/backup"
+)
+
+// fileDB "backs up" by writing its name
+type fileDB string
+
+func (db fileDB) Backup(ctx context.Context, path string) error {
+	return os.WriteFile(path, []byte(db), 0644)
+}
+
+// MustBackup takes a backup at t. Fatal on error.
+func MustBackup(tb testing.TB, m *backup.Manager, t time.Time) backup.Backup {
+	tb.Helper()
+	m.Now = func() time.Time { return t }
+	b, err := m.Backup(context.Background())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func date(value string) time.Time {
+	t, _ := time.Parse("2006-01-02", value)
+	return t
+}
+
+// Only the newest Keep backups are kept
+func TestManager_Backup(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	m := backup.NewManager(fileDB("db"), dir)
+	m.Keep = 2
+	for _, day := range []string{"2001-01-01", "2001-01-02", "2001-01-03"} {
+		if b := MustBackup(t, m, date(day)); b.Size != 2 || !b.Time.Equal(date(day)) {
+			t.Fatalf("backup=%+v", b)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(backups) != 2 || !backups[0].Time.Equal(date("2001-01-02")) || !backups[1].Time.Equal(date("2001-01-03")) {
+		t.Fatalf("backups=%+v", backups)
+	}
+
+	m.Close()
+	if _, err := m.Backup(context.Background()); err != backup.ErrClosed {
+		t.Fatalf("err=%v, want %v", err, backup.ErrClosed)
+	}
+}
+
+// Find returns the newest backup at or before a time
+func TestManager_Find(t *testing.T) {
+	m := backup.NewManager(fileDB("db"), t.TempDir())
+	MustBackup(t, m, date("2001-01-01"))
+	MustBackup(t, m, date("2001-02-01"))
+
+	if b, err := m.Find(date("2001-01-15")); err != nil {
+		t.Fatal(err)
+	} else if !b.Time.Equal(date("2001-01-01")) {
+		t.Fatalf("Time=%v", b.Time)
+	}
+	if b, err := m.Find(date("2001-02-01")); err != nil {
+		t.Fatal(err)
+	} else if !b.Time.Equal(date("2001-02-01")) {
+		t.Fatalf("Time=%v", b.Time)
+	}
+	if _, err := m.Find(date("2000-01-01")); err != backup.ErrNoBackup {
+		t.Fatalf("err=%v, want %v", err, backup.ErrNoBackup)
+	}
+}
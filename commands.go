@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nickcoast/timetravel/eventlog"
+	"github.com/nickcoast/timetravel/migrate"
+	"github.com/nickcoast/timetravel/postgres"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// RunCommand runs a maintenance command instead of the server:
+//
+//	timetravel migrate status|up|down|to N [-dry-run] [-seed name]
+//	timetravel compact [-log path]
+//	timetravel replay -until 2006-01-02T15:04:05Z -out path [-log path]
+//	timetravel backup [-dir path] [-list]
+//	timetravel restore -from file | -at 2006-01-02T15:04:05Z [-dir path]
+//	timetravel archive [-years N | -before 2006-01-02] [-path file]
+//
+// migrate, backup, restore, and archive use the config's database. compact and replay use the event log, as with driver "eventlog".
+// The server must not be running, except for backup.
+func (m *Main) RunCommand(name string, args []string) error {
+	switch name {
+	case "migrate":
+		return m.runMigrate(args)
+	case "compact", "replay":
+		return m.runEventLogCommand(name, args)
+	case "backup", "restore":
+		return m.runBackupCommand(name, args)
+	case "archive":
+		return m.runArchive(args)
+	}
+	return fmt.Errorf("unknown command %q. Use \"migrate\", \"compact\", \"replay\", \"backup\", \"restore\", or \"archive\"", name)
+}
+
+// runMigrate shows, applies, or rolls back migrations. With -dry-run, prints their SQL instead.
+func (m *Main) runMigrate(args []string) error {
+	usage := fmt.Errorf("usage: timetravel migrate status|up|down|to N [-dry-run] [-seed name]")
+	if len(args) == 0 {
+		return usage
+	}
+	action, args := args[0], args[1:]
+	version := 0
+	if action == "to" {
+		if len(args) == 0 {
+			return usage
+		}
+		var err error
+		if version, err = strconv.Atoi(args[0]); err != nil {
+			return usage
+		}
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("timetravel migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print the SQL instead of running it")
+	seedName := fs.String("seed", m.Config.DB.Seed, "fixture set to add after migrating, if the database is empty, e.g. demo")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+	migrator.DryRun = *dryRun
+
+	switch action {
+	case "status":
+		return printStatus(migrator)
+	case "up":
+		err = migrator.Up()
+	case "down":
+		err = migrator.Down()
+	case "to":
+		err = migrator.To(version)
+	default:
+		return usage
+	}
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		return nil
+	}
+	if *seedName != "" && action != "down" {
+		s := service.NewSqliteRecordService(db)
+		if err := seedStore(context.Background(), &s, *seedName); err != nil {
+			return fmt.Errorf("seed %s: %w", *seedName, err)
+		}
+	}
+	return printStatus(migrator)
+}
+
+// migratable is a database with migrations
+type migratable interface {
+	service.Store
+	Migrator() (*migrate.Migrator, error)
+	Close() error
+}
+
+// connect connects to the config's database without migrating it
+func (m *Main) connect() (migratable, error) {
+	switch m.Config.DB.Driver {
+	case "postgres":
+		db := postgres.NewDB(m.Config.DB.DSN)
+		return db, db.Connect()
+	case "", "sqlite", "sqlite3":
+		var err error
+		if m.DB.DSN, err = expandDSN(m.Config.DB.DSN); err != nil {
+			return nil, fmt.Errorf("cannot expand dsn: %w", err)
+		}
+		if m.DB.ArchivePath, err = m.archivePath(); err != nil {
+			return nil, err
+		}
+		return m.DB, m.DB.Connect()
+	}
+	return nil, fmt.Errorf("db driver %q has no migrations", m.Config.DB.Driver)
+}
+
+func printStatus(migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tAPPLIED\tNAME")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.Applied {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Changed {
+			applied += " (CHANGED SINCE)"
+		}
+		fmt.Fprintf(w, "%v\t%s\t%s\n", s.Version, applied, s.Name)
+	}
+	return w.Flush()
+}
+
+// runEventLogCommand compacts or replays the event log
+func (m *Main) runEventLogCommand(name string, args []string) error {
+	path, err := m.eventLogPath()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("timetravel "+name, flag.ContinueOnError)
+	fs.StringVar(&path, "log", path, "event log file")
+
+	switch name {
+	case "compact":
+		// Rewrites the log as it is now. History, including purged rows, is removed from the file.
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if err := eventlog.Compact(path); err != nil {
+			return fmt.Errorf("compact %s: %w", path, err)
+		}
+		fmt.Println("compacted", path)
+		return nil
+	default:
+		// Writes the log's DB as it was at a time to a new log, e.g. to recover from a bad purge.
+		until := fs.String("until", "", "time to replay the log to (RFC 3339)")
+		out := fs.String("out", "", "new event log file")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		t, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			return fmt.Errorf("-until: %w", err)
+		} else if *out == "" || *out == path {
+			return fmt.Errorf("-out must be a new file")
+		}
+		db, err := eventlog.Replay(path, t)
+		if err != nil {
+			return fmt.Errorf("replay %s: %w", path, err)
+		}
+		if err := eventlog.WriteLog(*out, db.Events()); err != nil {
+			return err
+		}
+		fmt.Println("replayed", path, "to", t.Format(time.RFC3339), "in", *out)
+		return nil
+	}
+}
+
+// runBackupCommand backs up the sqlite database to the backup directory, or restores it from a backup
+func (m *Main) runBackupCommand(name string, args []string) error {
+	fs := flag.NewFlagSet("timetravel "+name, flag.ContinueOnError)
+	fs.StringVar(&m.Config.Backup.Dir, "dir", m.Config.Backup.Dir, "backup directory")
+	list := fs.Bool("list", false, "list the backups instead")
+	from := fs.String("from", "", "backup file to restore")
+	at := fs.String("at", "", "restore the newest backup taken at or before this time (RFC 3339)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch m.Config.DB.Driver {
+	case "", "sqlite", "sqlite3":
+	default:
+		return fmt.Errorf("db driver %q has no backups. Only sqlite does", m.Config.DB.Driver)
+	}
+	backups, err := m.backups()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch {
+	case name == "backup" && *list:
+		all, err := backups.List()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tSIZE\tPATH")
+		for _, b := range all {
+			fmt.Fprintf(w, "%s\t%v\t%s\n", b.Time.Format(time.RFC3339), b.Size, b.Path)
+		}
+		return w.Flush()
+	case name == "backup":
+		// the server may be running: the online backup does not stop it
+		if _, err := m.connect(); err != nil {
+			return err
+		}
+		defer m.DB.Close()
+		b, err := backups.Backup(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backed up to", b.Path)
+		return nil
+	}
+
+	path := *from
+	if path == "" && *at != "" {
+		t, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			return fmt.Errorf("-at: %w", err)
+		}
+		b, err := backups.Find(t)
+		if err != nil {
+			return err
+		}
+		path = b.Path
+	} else if path == "" || *at != "" {
+		return fmt.Errorf("usage: timetravel restore -from file | -at 2006-01-02T15:04:05Z [-dir path]")
+	}
+	if _, err := m.connect(); err != nil {
+		return err
+	}
+	defer m.DB.Close()
+	if err := m.DB.Restore(ctx, path); err != nil {
+		return fmt.Errorf("restore %s: %w", path, err)
+	}
+	fmt.Println("restored", path)
+	return nil
+}
+
+// runArchive moves sqlite record versions replaced more than -years ago, or before -before, to the archive database,
+// and reports what was moved and the space reclaimed
+func (m *Main) runArchive(args []string) error {
+	fs := flag.NewFlagSet("timetravel archive", flag.ContinueOnError)
+	fs.StringVar(&m.Config.Archive.Path, "path", m.Config.Archive.Path, "archive database")
+	years := fs.Int("years", m.Config.Archive.Years, "archive versions replaced more than this many years ago")
+	before := fs.String("before", "", "archive versions replaced before this date (2006-01-02) instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch m.Config.DB.Driver {
+	case "", "sqlite", "sqlite3":
+	default:
+		return fmt.Errorf("db driver %q has no archive. Only sqlite does", m.Config.DB.Driver)
+	}
+	if m.Config.Archive.Path == "" {
+		return fmt.Errorf("no archive path. Set [archive] path in the config, or -path")
+	}
+	cutoff := time.Now().AddDate(-*years, 0, 0)
+	if *before != "" {
+		var err error
+		if cutoff, err = time.Parse("2006-01-02", *before); err != nil {
+			return fmt.Errorf("-before: %w", err)
+		}
+	} else if *years <= 0 {
+		return fmt.Errorf("-years must be at least 1")
+	}
+
+	if _, err := m.connect(); err != nil {
+		return err
+	}
+	defer m.DB.Close()
+	result, err := m.DB.Archive(context.Background(), cutoff)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("archived %v employee and %v address record versions from before %s to %s\n",
+		result.EmployeeRecords, result.AddressRecords, result.Cutoff.Format(time.RFC3339), m.DB.ArchivePath)
+	fmt.Printf("reclaimed %v bytes\n", result.Reclaimed)
+	return nil
+}
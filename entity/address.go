@@ -7,17 +7,40 @@ import (
 	"time"
 )
 
+// Address types. An insured has at most one mailing and one billing address, and any number of (risk) locations.
+const (
+	AddressMailing  = "mailing"
+	AddressBilling  = "billing"
+	AddressLocation = "location"
+)
+
 // Address represents a address in the system.
 // addresses can also be created directly for testing.
+// ID is the id of the record; AddressId is the address whose history the record is part of.
+// Address is the fields below it on one line (see Normalize).
 type Address struct {
 	ID int `json:"id"`
 
-	Address string `json:"address"`
+	AddressId int    `json:"addressId"`
+	Type      string `json:"type"` // AddressMailing, AddressBilling, or AddressLocation. Mailing if empty.
+
+	Address    string `json:"address"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`     // state or province
+	PostalCode string `json:"postalCode"` // validated for the countries in postalFormats
+	Country    string `json:"country"`    // ISO 3166 code, e.g. "US"
 
 	InsuredId int `json:"insuredId"`
 
 	// Timestamps for address creation & last update.
 	RecordTimestamp time.Time `json:"recordTimestamp"`
+
+	// Valid time: when this record is true in the real world.
+	// Zero ValidTo means the record is valid until superseded.
+	ValidFrom time.Time `json:"validFrom"`
+	ValidTo   time.Time `json:"validTo"`
 }
 
 var _ InsuredInterface = (*Address)(nil)
@@ -41,17 +64,39 @@ func (u *Address) GetInsertFields() map[string]string {
 }
 
 // Validate returns an error if the address contains invalid fields.
-// This only performs basic validation.
+// Call Normalize first: the country and postal code are checked in their standard form.
 func (u *Address) Validate() error {
-	if u.Address == "" {
+	if u.Address == "" && !u.hasFields() {
 		return Errorf(EINVALID, "Address required.")
 	}
+	if u.hasFields() && u.Line1 == "" {
+		return Errorf(EINVALID, "Address line1 required.")
+	}
+	if u.Country != "" && !countryCode.MatchString(u.Country) {
+		return Errorf(EINVALID, "Country must be a two-letter ISO 3166 code.")
+	}
+	if err := u.validatePostalCode(); err != nil {
+		return err
+	}
 	if u.InsuredId < 1 {
 		return Errorf(EINVALID, "Address must have an insured_id")
 	}
+	if u.Type != "" && !ValidAddressType(u.Type) {
+		return Errorf(EINVALID, "Address type must be %s, %s, or %s.", AddressMailing, AddressBilling, AddressLocation)
+	}
 	return nil
 }
 
+// ValidAddressType returns true if t is an address type
+func ValidAddressType(t string) bool {
+	return t == AddressMailing || t == AddressBilling || t == AddressLocation
+}
+
+// UniqueAddressType returns true if an insured can have only one current address of type t
+func UniqueAddressType(t string) bool {
+	return t == AddressMailing || t == AddressBilling
+}
+
 // AddressService represents a service for managing addresses.
 type AddressService interface {
 	// Retrieves a address by ID
@@ -97,7 +142,15 @@ func (e *Address) ToRecord() Record {
 		ID: e.ID,
 		Data: map[string]string{
 			"id":               idString,
+			"addressId":        strconv.Itoa(e.AddressId),
+			"type":             e.Type,
 			"address":          e.Address,
+			"line1":            e.Line1,
+			"line2":            e.Line2,
+			"city":             e.City,
+			"region":           e.Region,
+			"postalCode":       e.PostalCode,
+			"country":          e.Country,
 			"insuredId":       strconv.Itoa(e.InsuredId),
 			"recordTimestamp": strconv.Itoa(int(e.RecordTimestamp.Unix())),
 		},
@@ -108,6 +161,14 @@ func (e *Address) ToRecord() Record {
 func (e *Address) FromRecord(r Record) (err error) {
 	e.ID = r.ID
 	e.Address = r.Data["address"]
+	e.Line1, e.Line2, e.City = r.Data["line1"], r.Data["line2"], r.Data["city"]
+	e.Region, e.PostalCode, e.Country = r.Data["region"], r.Data["postalCode"], r.Data["country"]
+	e.Type = r.Data["type"]
+	if addressId := r.Data["addressId"]; addressId != "" {
+		if e.AddressId, err = strconv.Atoi(addressId); err != nil {
+			return err
+		}
+	}
 	e.InsuredId, err = strconv.Atoi(r.Data["insured_id"])
 	timestampInt, err := strconv.Atoi(r.Data["recordTimestamp"])
 	e.RecordTimestamp = time.Unix(int64(timestampInt), 0)
@@ -150,13 +211,33 @@ func (a Address) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(&struct {
 		ID              string `json:"id"`
+		AddressId       string `json:"addressId"`
+		Type            string `json:"type"`
 		Address         string `json:"address"`
+		Line1           string `json:"line1"`
+		Line2           string `json:"line2"`
+		City            string `json:"city"`
+		Region          string `json:"region"`
+		PostalCode      string `json:"postalCode"`
+		Country         string `json:"country"`
 		RecordTimestamp string `json:"recordTimestamp"`
 		RecordDateTime  string `json:"recordDateTime"`
+		ValidFrom       string `json:"validFrom"`
+		ValidTo         string `json:"validTo"`
 	}{
 		ID:              strconv.Itoa(a.ID),
+		AddressId:       strconv.Itoa(a.AddressId),
+		Type:            a.Type,
 		Address:         a.Address,
+		Line1:           a.Line1,
+		Line2:           a.Line2,
+		City:            a.City,
+		Region:          a.Region,
+		PostalCode:      a.PostalCode,
+		Country:         a.Country,
 		RecordTimestamp: strconv.Itoa(int(a.RecordTimestamp.Unix())),
 		RecordDateTime:  a.RecordTimestamp.Format("Mon, 02 Jan 2006 15:04:05 MST"),
+		ValidFrom:       FormatValidTime(a.ValidFrom),
+		ValidTo:         FormatValidTime(a.ValidTo),
 	})
 }
@@ -0,0 +1,169 @@
+package entity
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Claim statuses. A claim is opened, investigated, then paid or denied, then closed.
+const (
+	ClaimOpen          = "open"
+	ClaimInvestigating = "investigating"
+	ClaimPaid          = "paid"
+	ClaimDenied        = "denied"
+	ClaimClosed        = "closed"
+)
+
+// claimTransitions are the statuses a claim may change to from each status
+var claimTransitions = map[string][]string{
+	ClaimOpen:          {ClaimInvestigating},
+	ClaimInvestigating: {ClaimPaid, ClaimDenied},
+	ClaimPaid:          {ClaimClosed},
+	ClaimDenied:        {ClaimClosed},
+	ClaimClosed:        {},
+}
+
+// Claim represents a claim against an insured in the system.
+// ID is the claim's; each change to the claim (e.g. of its status) is a record of the claim.
+type Claim struct {
+	ID int `json:"id"`
+
+	LossDate    time.Time `json:"lossDate"` // date of loss
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+
+	InsuredId int `json:"insuredId"`
+
+	// Insured as it was at the loss date. Only in the claim's detail view
+	Insured *Insured `json:"insured,omitempty"`
+
+	// Timestamps for claim creation & last update.
+	RecordTimestamp time.Time `json:"recordTimestamp"`
+
+	// Valid time: when this record is true in the real world.
+	// Zero ValidTo means the record is valid until superseded.
+	ValidFrom time.Time `json:"validFrom"`
+	ValidTo   time.Time `json:"validTo"`
+}
+
+var _ InsuredInterface = (*Claim)(nil)
+
+func (u *Claim) GetId() int64 {
+	return int64(u.ID)
+}
+func (u *Claim) GetInsuredId() int64 {
+	return int64(u.InsuredId)
+}
+func (u *Claim) GetDataTableName() string {
+	return "claims_records"
+}
+func (u *Claim) GetIdentTableName() string {
+	return "claims"
+}
+func (u *Claim) GetInsertFields() map[string]string {
+	return map[string]string{
+		"loss_date":   u.LossDate.Format("2006-01-02"),
+		"description": u.Description,
+		"status":      u.Status,
+	}
+}
+
+// Validate returns an error if the claim contains invalid fields.
+func (u *Claim) Validate() error {
+	if u.InsuredId < 1 {
+		return Errorf(EINVALID, "Claim must have an insured_id")
+	}
+	if u.LossDate.IsZero() {
+		return Errorf(EINVALID, "Claim loss date required.")
+	}
+	if u.Description == "" {
+		return Errorf(EINVALID, "Claim description required.")
+	}
+	if _, ok := claimTransitions[u.Status]; !ok {
+		return Errorf(EINVALID, "Claim status must be 'open', 'investigating', 'paid', 'denied', or 'closed'.")
+	}
+	return nil
+}
+
+// CanBecome returns true if the claim may change from its status to status
+func (u *Claim) CanBecome(status string) bool {
+	for _, next := range claimTransitions[u.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// SameClaim returns true if the claims have the same loss date, description, and status
+func (u *Claim) SameClaim(b *Claim) bool {
+	return u.LossDate.Format("2006-01-02") == b.LossDate.Format("2006-01-02") &&
+		u.Description == b.Description &&
+		u.Status == b.Status
+}
+
+// LossTime returns the end of the loss date, so the insured as of the loss includes that day's changes
+func (u *Claim) LossTime() time.Time {
+	return u.LossDate.AddDate(0, 0, 1).Add(-time.Second)
+}
+
+func (e *Claim) ToRecord() Record {
+	r := Record{
+		ID: e.ID,
+		Data: map[string]string{
+			"id":              strconv.Itoa(e.ID),
+			"lossDate":        e.LossDate.Format("2006-01-02"),
+			"description":     e.Description,
+			"status":          e.Status,
+			"insuredId":       strconv.Itoa(e.InsuredId),
+			"recordTimestamp": strconv.Itoa(int(e.RecordTimestamp.Unix())),
+		},
+	}
+	return r
+}
+
+// Returns Claim map. Skips any non-claims
+func ClaimsFromInsuredInterface(insuredIfaceObjs map[int]InsuredInterface) (map[int]Claim, error) {
+	claims := make(map[int]Claim)
+	for i, obj := range insuredIfaceObjs {
+		c, ok := obj.(*Claim)
+		if ok {
+			claims[i] = *c
+		}
+	}
+	return claims, nil
+}
+
+func (c Claim) MarshalJSON() ([]byte, error) {
+	if c.ID == 0 {
+		return json.Marshal(&struct {
+			ID string `json:"id"`
+		}{
+			ID: "",
+		})
+	}
+	return json.Marshal(&struct {
+		ID              string   `json:"id"`
+		LossDate        string   `json:"lossDate"`
+		Description     string   `json:"description"`
+		Status          string   `json:"status"`
+		InsuredId       string   `json:"insuredId"`
+		RecordTimestamp string   `json:"recordTimestamp"`
+		RecordDateTime  string   `json:"recordDateTime"`
+		ValidFrom       string   `json:"validFrom"`
+		ValidTo         string   `json:"validTo"`
+		Insured         *Insured `json:"insured,omitempty"`
+	}{
+		ID:              strconv.Itoa(c.ID),
+		LossDate:        c.LossDate.Format("2006-01-02"),
+		Description:     c.Description,
+		Status:          c.Status,
+		InsuredId:       strconv.Itoa(c.InsuredId),
+		RecordTimestamp: strconv.Itoa(int(c.RecordTimestamp.Unix())),
+		RecordDateTime:  c.RecordTimestamp.Format("Mon, 02 Jan 2006 15:04:05 MST"),
+		ValidFrom:       FormatValidTime(c.ValidFrom),
+		ValidTo:         FormatValidTime(c.ValidTo),
+		Insured:         c.Insured,
+	})
+}
@@ -0,0 +1,23 @@
+package entity
+
+import "encoding/json"
+
+// DeletePreview is what deleting a resource would remove: the resource itself,
+// and the current employee and address records deleted with it
+type DeletePreview struct {
+	Resource        InsuredInterface
+	EmployeeRecords int
+	AddressRecords  int
+}
+
+func (p DeletePreview) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Resource        InsuredInterface `json:"resource"`
+		EmployeeRecords int              `json:"employeeRecords"`
+		AddressRecords  int              `json:"addressRecords"`
+	}{
+		Resource:        p.Resource,
+		EmployeeRecords: p.EmployeeRecords,
+		AddressRecords:  p.AddressRecords,
+	})
+}
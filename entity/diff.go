@@ -0,0 +1,266 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InsuredDiff is what changed for an insured between two instants:
+// employees added, removed, and modified, and address changes.
+type InsuredDiff struct {
+	InsuredId int
+	From      time.Time
+	To        time.Time
+
+	EmployeesAdded    []Employee
+	EmployeesRemoved  []Employee
+	EmployeesModified []EmployeeChange
+	AddressChanges    []AddressChange
+}
+
+// EmployeeChange is the field-level change of an employee present at both instants
+type EmployeeChange struct {
+	EmployeeId int           `json:"employeeId,string"`
+	Name       string        `json:"name"` // name at "to"
+	Fields     []FieldChange `json:"fields"`
+}
+
+// AddressChange is an address's value before and after. Before is "" if the address was added, after if it was removed.
+// Fields are the changes not seen in the value: its type and validTo, if the address is present at both instants.
+type AddressChange struct {
+	AddressId int           `json:"addressId,string"`
+	Type      string        `json:"type"`
+	Before    string        `json:"before"`
+	After     string        `json:"after"`
+	Fields    []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a single field's value before and after
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// DiffInsured compares the insured as it was at "from" with the insured as it was at "to"
+func DiffInsured(from Insured, to Insured, fromTime time.Time, toTime time.Time) InsuredDiff {
+	diff := InsuredDiff{
+		InsuredId:         to.ID,
+		From:              fromTime,
+		To:                toTime,
+		EmployeesAdded:    []Employee{},
+		EmployeesRemoved:  []Employee{},
+		EmployeesModified: []EmployeeChange{},
+		AddressChanges:    []AddressChange{},
+	}
+	if diff.InsuredId == 0 {
+		diff.InsuredId = from.ID
+	}
+
+	before := employeesById(from.Employees)
+	after := employeesById(to.Employees)
+	for _, id := range sortedIds(before, after) {
+		b, inBefore := before[id]
+		a, inAfter := after[id]
+		switch {
+		case !inBefore:
+			diff.EmployeesAdded = append(diff.EmployeesAdded, a)
+		case !inAfter:
+			diff.EmployeesRemoved = append(diff.EmployeesRemoved, b)
+		default:
+			fields := diffValues(b.diffValues(), a.diffValues())
+			if len(fields) > 0 {
+				diff.EmployeesModified = append(diff.EmployeesModified, EmployeeChange{EmployeeId: id, Name: a.Name, Fields: fields})
+			}
+		}
+	}
+
+	beforeAddresses := addressesById(from.Addresses)
+	afterAddresses := addressesById(to.Addresses)
+	for _, id := range sortedIds(beforeAddresses, afterAddresses) {
+		b, inBefore := beforeAddresses[id]
+		a, inAfter := afterAddresses[id]
+		var fields []FieldChange
+		if inBefore && inAfter {
+			fields = diffValues(b.diffValues(), a.diffValues())
+			if len(fields) == 0 && b.SameAddress(a) {
+				continue
+			}
+		}
+		addressType := a.Type
+		if addressType == "" {
+			addressType = b.Type
+		}
+		diff.AddressChanges = append(diff.AddressChanges, AddressChange{AddressId: id, Type: addressType, Before: b.Address, After: a.Address, Fields: fields})
+	}
+	return diff
+}
+
+// HasChanges is false if the insured was the same at both instants
+func (d InsuredDiff) HasChanges() bool {
+	return len(d.EmployeesAdded)+len(d.EmployeesRemoved)+len(d.EmployeesModified)+len(d.AddressChanges) > 0
+}
+
+func (d InsuredDiff) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		InsuredId string `json:"insuredId"`
+		From      string `json:"from"`
+		To        string `json:"to"`
+		Employees struct {
+			Added    []Employee       `json:"added"`
+			Removed  []Employee       `json:"removed"`
+			Modified []EmployeeChange `json:"modified"`
+		} `json:"employees"`
+		Addresses []AddressChange `json:"insuredAddresses"`
+	}{
+		InsuredId: strconv.Itoa(d.InsuredId),
+		From:      strconv.Itoa(int(d.From.Unix())),
+		To:        strconv.Itoa(int(d.To.Unix())),
+		Employees: struct {
+			Added    []Employee       `json:"added"`
+			Removed  []Employee       `json:"removed"`
+			Modified []EmployeeChange `json:"modified"`
+		}{d.EmployeesAdded, d.EmployeesRemoved, d.EmployeesModified},
+		Addresses: d.AddressChanges,
+	})
+}
+
+// Report is the diff as a human-readable text report
+func (d InsuredDiff) Report() string {
+	var b strings.Builder
+	timeFormat := "Mon, 02 Jan 2006 15:04:05 MST"
+	fmt.Fprintf(&b, "Insured %d changes\n", d.InsuredId)
+	fmt.Fprintf(&b, "From: %s\n", d.From.Format(timeFormat))
+	fmt.Fprintf(&b, "To:   %s\n", d.To.Format(timeFormat))
+	if !d.HasChanges() {
+		b.WriteString("\nNo changes\n")
+		return b.String()
+	}
+	if len(d.EmployeesAdded) > 0 {
+		b.WriteString("\nEmployees added:\n")
+		for _, e := range d.EmployeesAdded {
+			fmt.Fprintf(&b, "  + [%d] %s (%s)\n", e.ID, e.Name, e.employmentPeriod())
+		}
+	}
+	if len(d.EmployeesRemoved) > 0 {
+		b.WriteString("\nEmployees removed:\n")
+		for _, e := range d.EmployeesRemoved {
+			fmt.Fprintf(&b, "  - [%d] %s (%s)\n", e.ID, e.Name, e.employmentPeriod())
+		}
+	}
+	if len(d.EmployeesModified) > 0 {
+		b.WriteString("\nEmployees modified:\n")
+		for _, c := range d.EmployeesModified {
+			fmt.Fprintf(&b, "  ~ [%d] %s\n", c.EmployeeId, c.Name)
+			for _, f := range c.Fields {
+				fmt.Fprintf(&b, "      %s: %q -> %q\n", f.Field, f.Before, f.After)
+			}
+		}
+	}
+	if len(d.AddressChanges) > 0 {
+		b.WriteString("\nAddresses changed:\n")
+		for _, c := range d.AddressChanges {
+			fmt.Fprintf(&b, "  [%d] %s: %q -> %q\n", c.AddressId, c.Type, c.Before, c.After)
+			for _, f := range c.Fields {
+				fmt.Fprintf(&b, "      %s: %q -> %q\n", f.Field, f.Before, f.After)
+			}
+		}
+	}
+	return b.String()
+}
+
+// diffValues returns the employee's compared fields and their values, in report order
+func (e Employee) diffValues() [][2]string {
+	return [][2]string{
+		{"name", e.Name},
+		{"startDate", formatDate(e.StartDate)},
+		{"endDate", formatDate(e.EndDate)},
+		{"jobClassCode", e.JobClassCode},
+		{"annualPayroll", FormatAmount(e.AnnualPayroll)},
+		{"workLocation", e.WorkLocation},
+	}
+}
+
+// diffValues returns the address's compared fields not in Address, in report order
+func (a Address) diffValues() [][2]string {
+	addressType := a.Type
+	if addressType == "" {
+		addressType = AddressMailing
+	}
+	return [][2]string{
+		{"type", addressType},
+		{"validTo", FormatValidTime(a.ValidTo)},
+	}
+}
+
+func (e Employee) employmentPeriod() string {
+	end := formatDate(e.EndDate)
+	if end == "" {
+		end = "present"
+	}
+	return formatDate(e.StartDate) + " to " + end
+}
+
+func diffValues(before [][2]string, after [][2]string) (changes []FieldChange) {
+	for i := range before {
+		if before[i][1] != after[i][1] {
+			changes = append(changes, FieldChange{Field: before[i][0], Before: before[i][1], After: after[i][1]})
+		}
+	}
+	return changes
+}
+
+// formatDate formats a date as 2006-01-02. Zero date is "".
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+func employeesById(employees *map[int]Employee) map[int]Employee {
+	byId := make(map[int]Employee)
+	if employees == nil {
+		return byId
+	}
+	for _, e := range *employees {
+		if e.ID != 0 {
+			byId[e.ID] = e
+		}
+	}
+	return byId
+}
+
+// sortedIds returns the keys of the maps, once each, in order
+func sortedIds[T any](maps ...map[int]T) []int {
+	seen := make(map[int]bool)
+	ids := []int{}
+	for _, m := range maps {
+		for id := range m {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// addressesById returns the addresses by address id
+func addressesById(addresses *map[int]Address) map[int]Address {
+	byId := make(map[int]Address)
+	if addresses == nil {
+		return byId
+	}
+	for _, a := range *addresses {
+		if a.ID != 0 {
+			byId[a.AddressId] = a
+		}
+	}
+	return byId
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
 	"time"
 )
@@ -19,10 +20,21 @@ type Employee struct {
 	StartDate time.Time `json:"startDate"`
 	EndDate   time.Time `json:"endDate"`
 
+	// Workers' comp rating: job classification (e.g. "8810"), annual payroll in cents, and where they work.
+	// Each is optional, and has a history like the fields above.
+	JobClassCode  string `json:"jobClassCode"`
+	AnnualPayroll int64  `json:"annualPayroll"`
+	WorkLocation  string `json:"workLocation"`
+
 	InsuredId int `json:"insuredId"`
 
 	// Timestamps for employee creation & last update.
 	RecordTimestamp time.Time `json:"recordTimestamp"`
+
+	// Valid time: when this record is true in the real world.
+	// Zero ValidTo means the record is valid until superseded.
+	ValidFrom time.Time `json:"validFrom"`
+	ValidTo   time.Time `json:"validTo"`
 }
 
 var _ InsuredInterface = (*Employee)(nil)
@@ -44,6 +56,10 @@ func (u *Employee) GetInsertFields() map[string]string {
 		"name":       u.Name,
 		"start_date": u.StartDate.Format("2006-01-02"),
 		"end_date":   u.EndDate.Format("2006-01-02"),
+
+		"job_class_code": u.JobClassCode,
+		"annual_payroll": strconv.FormatInt(u.AnnualPayroll, 10),
+		"work_location":  u.WorkLocation,
 	}
 }
 
@@ -56,9 +72,27 @@ func (u *Employee) Validate() error {
 	if u.InsuredId < 1 {
 		return Errorf(EINVALID, "Employee must have an insured_id")
 	}
+	if u.JobClassCode != "" && !jobClassCodePattern.MatchString(u.JobClassCode) {
+		return Errorf(EINVALID, "Employee job class code must be 4 digits, e.g. '8810'.")
+	}
+	if u.AnnualPayroll < 0 {
+		return Errorf(EINVALID, "Employee annual payroll cannot be negative.")
+	}
 	return nil
 }
 
+var jobClassCodePattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// SameEmployee returns true if the employees have the same name, dates, job class code, payroll, and work location
+func (u *Employee) SameEmployee(b *Employee) bool {
+	return u.Name == b.Name &&
+		u.StartDate.Format("2006-01-02") == b.StartDate.Format("2006-01-02") &&
+		u.EndDate.Format("2006-01-02") == b.EndDate.Format("2006-01-02") &&
+		u.JobClassCode == b.JobClassCode &&
+		u.AnnualPayroll == b.AnnualPayroll &&
+		u.WorkLocation == b.WorkLocation
+}
+
 // EmployeeService represents a service for managing employees.
 type EmployeeService interface {
 	// Retrieves a employee by ID
@@ -145,6 +179,9 @@ func (e *Employee) ToRecord() Record {
 			"name":            e.Name,
 			"startDate":       e.StartDate.Format("2006-01-02"),
 			"endDate":         endDateString,
+			"jobClassCode":    e.JobClassCode,
+			"annualPayroll":   FormatAmount(e.AnnualPayroll),
+			"workLocation":    e.WorkLocation,
 			"insuredId":       strconv.Itoa(e.InsuredId),
 			"recordTimestamp": strconv.Itoa(int(e.RecordTimestamp.Unix())),
 		},
@@ -157,6 +194,9 @@ func (e *Employee) FromRecord(r Record) (err error) {
 	e.Name = r.Data["name"]
 	e.StartDate, err = time.Parse("2006-01-02", r.Data["start_date"])
 	e.EndDate, _ = time.Parse("2006-01-02", r.Data["end_date"])
+	e.JobClassCode = r.Data["job_class_code"]
+	e.AnnualPayroll, _ = strconv.ParseInt(r.Data["annual_payroll"], 10, 64)
+	e.WorkLocation = r.Data["work_location"]
 	e.InsuredId, err = strconv.Atoi(r.Data["insured_id"])
 	timestampInt, err := strconv.Atoi(r.Data["record_timestamp"])
 	e.RecordTimestamp = time.Unix(int64(timestampInt), 0)
@@ -206,16 +246,26 @@ func (e Employee) MarshalJSON() ([]byte, error) {
 		Name            string `json:"name"`
 		StartDate       string `json:"startDate"`
 		EndDate         string `json:"endDate"`
+		JobClassCode    string `json:"jobClassCode"`
+		AnnualPayroll   string `json:"annualPayroll"`
+		WorkLocation    string `json:"workLocation"`
 		InsuredId       string `json:"insuredId"`
 		RecordTimestamp string `json:"recordTimestamp"`
 		RecordDateTime  string `json:"recordDateTime"`
+		ValidFrom       string `json:"validFrom"`
+		ValidTo         string `json:"validTo"`
 	}{
 		ID:              strconv.Itoa(e.ID),
 		Name:            e.Name,
 		StartDate:       e.StartDate.Format("2006-01-02"),
 		EndDate:         endDate,
+		JobClassCode:    e.JobClassCode,
+		AnnualPayroll:   FormatAmount(e.AnnualPayroll),
+		WorkLocation:    e.WorkLocation,
 		InsuredId:       strconv.Itoa(e.InsuredId),
 		RecordTimestamp: strconv.Itoa(int(e.RecordTimestamp.Unix())),
 		RecordDateTime:  e.RecordTimestamp.Format("Mon, 02 Jan 2006 15:04:05 MST"),
+		ValidFrom:       FormatValidTime(e.ValidFrom),
+		ValidTo:         FormatValidTime(e.ValidTo),
 	})
 }
@@ -19,10 +19,17 @@ const (
 	ENOTFOUND       = "not_found"
 	ENOTIMPLEMENTED = "not_implemented"
 	EUNAUTHORIZED   = "unauthorized"
+)
 
-	ErrRecordDoesNotExist  = "record with that id does not exist"
-	ErrRecordIDInvalid     = "record id must >= 0"
-	ErrRecordAlreadyExists = "Record already exists. Use 'update' to update"
+// Errors returned by every storage backend, so callers need not know which one they use
+var (
+	ErrRecordDoesNotExist                 = errors.New("record with that id does not exist")
+	ErrRecordIDInvalid                    = errors.New("record id must >= 0")
+	ErrRecordAlreadyExists                = errors.New("record already exists")
+	ErrRecordMatchingCriteriaDoesNotExist = errors.New("no records matched your search")
+	ErrUpdateMustChangeAValue             = errors.New("update must modify at least one value")
+	ErrRecordNotPending                   = errors.New("record has already taken effect or was cancelled")
+	ErrInsuredDeleted                     = errors.New("insured is deleted. Restore the insured instead")
 )
 
 // Error represents an application-specific error. Application errors can be
@@ -20,7 +20,7 @@ type Insured struct {
 
 var _ InsuredInterface = (*Insured)(nil)
 
-// InsuredInterface for methods related to Insured objects (Insured, Employee, Address, and collections thereof)
+// InsuredInterface for methods related to Insured objects (Insured, Employee, Address, Policy, Claim, and collections thereof)
 type InsuredInterface interface {
 	/* New() InsuredInterface // TODO: */
 	// TODO: check why naming this "GetId() int" caused error "type has no field or method GetId"
@@ -91,6 +91,10 @@ func GetEntity(entityType string) (InsuredInterface, error) {
 		return &Employee{}, nil
 	} else if entityType == "address" || entityType == "Address" {
 		return &Address{}, nil
+	} else if entityType == "policy" || entityType == "Policy" {
+		return &Policy{}, nil
+	} else if entityType == "claim" || entityType == "Claim" {
+		return &Claim{}, nil
 	}
 	return nil, fmt.Errorf("Non-existent entity type %v", entityType)
 }
@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// PendingChange is a scheduled (future-dated) change: a record already known to the system
+// whose valid time has not started yet. It can be cancelled until it takes effect.
+type PendingChange struct {
+	// Id of the record in the resource's data table. Used to cancel the change.
+	RecordId int `json:"recordId"`
+
+	// Employee or Address as it will be once the change takes effect
+	Resource InsuredInterface `json:"resource"`
+
+	ValidFrom       time.Time `json:"validFrom"`
+	RecordTimestamp time.Time `json:"recordTimestamp"`
+}
+
+func (p PendingChange) MarshalJSON() ([]byte, error) {
+	resourceType := ""
+	switch p.Resource.(type) {
+	case *Employee:
+		resourceType = "employee"
+	case *Address:
+		resourceType = "address"
+	}
+	return json.Marshal(&struct {
+		Type            string           `json:"type"`
+		RecordId        string           `json:"recordId"`
+		ValidFrom       string           `json:"validFrom"`
+		RecordTimestamp string           `json:"recordTimestamp"`
+		Resource        InsuredInterface `json:"resource"`
+	}{
+		Type:            resourceType,
+		RecordId:        strconv.Itoa(p.RecordId),
+		ValidFrom:       FormatValidTime(p.ValidFrom),
+		RecordTimestamp: strconv.Itoa(int(p.RecordTimestamp.Unix())),
+		Resource:        p.Resource,
+	})
+}
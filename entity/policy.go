@@ -0,0 +1,215 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy represents a term of an insured's policy in the system.
+// ID is the policy's; each term and each change to a term is a record of the policy.
+// Renewing a policy adds its next term (see Renew). The policy number stays the same.
+// Limits and premium are in cents.
+type Policy struct {
+	ID int `json:"id"`
+
+	PolicyNumber int `json:"policyNumber"`
+	Term         int `json:"term"` // 1 for the first term, one more for each renewal
+
+	// Coverage period: from the start of EffectiveDate until the start of ExpirationDate
+	EffectiveDate  time.Time `json:"effectiveDate"`
+	ExpirationDate time.Time `json:"expirationDate"`
+
+	OccurrenceLimit int64 `json:"occurrenceLimit"` // per occurrence
+	AggregateLimit  int64 `json:"aggregateLimit"`  // for the term
+	Premium         int64 `json:"premium"`
+
+	InsuredId int `json:"insuredId"`
+
+	// Timestamps for policy creation & last update.
+	RecordTimestamp time.Time `json:"recordTimestamp"`
+
+	// Valid time: when this record is true in the real world.
+	// Zero ValidTo means the record is valid until superseded.
+	ValidFrom time.Time `json:"validFrom"`
+	ValidTo   time.Time `json:"validTo"`
+}
+
+var _ InsuredInterface = (*Policy)(nil)
+
+func (u *Policy) GetId() int64 {
+	return int64(u.ID)
+}
+func (u *Policy) GetInsuredId() int64 {
+	return int64(u.InsuredId)
+}
+func (u *Policy) GetDataTableName() string {
+	return "policies_records"
+}
+func (u *Policy) GetIdentTableName() string {
+	return "policies"
+}
+func (u *Policy) GetInsertFields() map[string]string {
+	return map[string]string{
+		"term":             strconv.Itoa(u.Term),
+		"effective_date":   u.EffectiveDate.Format("2006-01-02"),
+		"expiration_date":  u.ExpirationDate.Format("2006-01-02"),
+		"occurrence_limit": strconv.FormatInt(u.OccurrenceLimit, 10),
+		"aggregate_limit":  strconv.FormatInt(u.AggregateLimit, 10),
+		"premium":          strconv.FormatInt(u.Premium, 10),
+	}
+}
+
+// Validate returns an error if the policy contains invalid fields.
+func (u *Policy) Validate() error {
+	if u.InsuredId < 1 {
+		return Errorf(EINVALID, "Policy must have an insured_id")
+	}
+	if u.EffectiveDate.IsZero() {
+		return Errorf(EINVALID, "Policy effective date required.")
+	}
+	if !u.ExpirationDate.After(u.EffectiveDate) {
+		return Errorf(EINVALID, "Policy expiration date must be after its effective date.")
+	}
+	if u.OccurrenceLimit <= 0 {
+		return Errorf(EINVALID, "Policy occurrence limit must be more than 0.")
+	}
+	if u.AggregateLimit < u.OccurrenceLimit {
+		return Errorf(EINVALID, "Policy aggregate limit must be at least its occurrence limit.")
+	}
+	if u.Premium < 0 {
+		return Errorf(EINVALID, "Policy premium cannot be negative.")
+	}
+	return nil
+}
+
+// InForce returns true if t is in the policy's coverage period
+func (u *Policy) InForce(t time.Time) bool {
+	date := t.UTC().Format("2006-01-02")
+	return u.EffectiveDate.Format("2006-01-02") <= date && date < u.ExpirationDate.Format("2006-01-02")
+}
+
+// SameTerms returns true if the policies have the same term, coverage period, limits, and premium
+func (u *Policy) SameTerms(b *Policy) bool {
+	return u.Term == b.Term &&
+		u.EffectiveDate.Format("2006-01-02") == b.EffectiveDate.Format("2006-01-02") &&
+		u.ExpirationDate.Format("2006-01-02") == b.ExpirationDate.Format("2006-01-02") &&
+		u.OccurrenceLimit == b.OccurrenceLimit &&
+		u.AggregateLimit == b.AggregateLimit &&
+		u.Premium == b.Premium
+}
+
+// Renew returns the policy's next term. It starts when this term expires and is as long:
+// the same number of months if this term is a whole number of months, else the same number of days.
+// Limits and premium stay the same.
+func (u *Policy) Renew() Policy {
+	next := *u
+	next.Term = u.Term + 1
+	next.EffectiveDate = u.ExpirationDate
+	months := (u.ExpirationDate.Year()-u.EffectiveDate.Year())*12 + int(u.ExpirationDate.Month()-u.EffectiveDate.Month())
+	if months > 0 && u.EffectiveDate.AddDate(0, months, 0).Equal(u.ExpirationDate) {
+		next.ExpirationDate = u.ExpirationDate.AddDate(0, months, 0)
+	} else {
+		next.ExpirationDate = u.ExpirationDate.Add(u.ExpirationDate.Sub(u.EffectiveDate))
+	}
+	next.RecordTimestamp, next.ValidFrom, next.ValidTo = time.Time{}, time.Time{}, time.Time{}
+	return next
+}
+
+var amountPattern = regexp.MustCompile(`^\d+(\.\d{1,2})?$`)
+
+// ParseAmount parses an amount of money, e.g. "1000000" or "1,250.50", into cents
+func ParseAmount(value string) (int64, error) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), ",", "")
+	if !amountPattern.MatchString(value) {
+		return 0, Errorf(EINVALID, "Amount must be a number with at most 2 decimals, e.g. '1250.50'")
+	}
+	whole, fraction, _ := strings.Cut(value, ".")
+	cents, err := strconv.ParseInt(whole+(fraction + "00")[:2], 10, 64)
+	if err != nil {
+		return 0, Errorf(EINVALID, "Amount is too large")
+	}
+	return cents, nil
+}
+
+// FormatAmount formats cents as an amount of money, e.g. "1250.50"
+func FormatAmount(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (e *Policy) ToRecord() Record {
+	r := Record{
+		ID: e.ID,
+		Data: map[string]string{
+			"id":              strconv.Itoa(e.ID),
+			"policyNumber":    strconv.Itoa(e.PolicyNumber),
+			"term":            strconv.Itoa(e.Term),
+			"effectiveDate":   e.EffectiveDate.Format("2006-01-02"),
+			"expirationDate":  e.ExpirationDate.Format("2006-01-02"),
+			"occurrenceLimit": FormatAmount(e.OccurrenceLimit),
+			"aggregateLimit":  FormatAmount(e.AggregateLimit),
+			"premium":         FormatAmount(e.Premium),
+			"insuredId":       strconv.Itoa(e.InsuredId),
+			"recordTimestamp": strconv.Itoa(int(e.RecordTimestamp.Unix())),
+		},
+	}
+	return r
+}
+
+// Returns Policy map. Skips any non-policies
+func PoliciesFromInsuredInterface(insuredIfaceObjs map[int]InsuredInterface) (map[int]Policy, error) {
+	policies := make(map[int]Policy)
+	for i, obj := range insuredIfaceObjs {
+		p, ok := obj.(*Policy)
+		if ok {
+			policies[i] = *p
+		}
+	}
+	return policies, nil
+}
+
+func (p Policy) MarshalJSON() ([]byte, error) {
+	if p.ID == 0 {
+		return json.Marshal(&struct {
+			ID string `json:"id"`
+		}{
+			ID: "",
+		})
+	}
+	return json.Marshal(&struct {
+		ID              string `json:"id"`
+		PolicyNumber    string `json:"policyNumber"`
+		Term            string `json:"term"`
+		EffectiveDate   string `json:"effectiveDate"`
+		ExpirationDate  string `json:"expirationDate"`
+		OccurrenceLimit string `json:"occurrenceLimit"`
+		AggregateLimit  string `json:"aggregateLimit"`
+		Premium         string `json:"premium"`
+		InsuredId       string `json:"insuredId"`
+		RecordTimestamp string `json:"recordTimestamp"`
+		RecordDateTime  string `json:"recordDateTime"`
+		ValidFrom       string `json:"validFrom"`
+		ValidTo         string `json:"validTo"`
+	}{
+		ID:              strconv.Itoa(p.ID),
+		PolicyNumber:    strconv.Itoa(p.PolicyNumber),
+		Term:            strconv.Itoa(p.Term),
+		EffectiveDate:   p.EffectiveDate.Format("2006-01-02"),
+		ExpirationDate:  p.ExpirationDate.Format("2006-01-02"),
+		OccurrenceLimit: FormatAmount(p.OccurrenceLimit),
+		AggregateLimit:  FormatAmount(p.AggregateLimit),
+		Premium:         FormatAmount(p.Premium),
+		InsuredId:       strconv.Itoa(p.InsuredId),
+		RecordTimestamp: strconv.Itoa(int(p.RecordTimestamp.Unix())),
+		RecordDateTime:  p.RecordTimestamp.Format("Mon, 02 Jan 2006 15:04:05 MST"),
+		ValidFrom:       FormatValidTime(p.ValidFrom),
+		ValidTo:         FormatValidTime(p.ValidTo),
+	})
+}
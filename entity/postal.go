@@ -0,0 +1,248 @@
+package entity
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Addresses are stored as fields (street lines, city, region, postal code, country) in a standard form,
+// and shown on one line as Address. An address given only as one line is split into fields on a best-effort basis.
+
+// postalFormat is a country's postal code format. A code given without its separator,
+// e.g. "K1A0B1", gets sep inserted fromEnd characters before its end if it has at least minLen characters.
+type postalFormat struct {
+	pattern *regexp.Regexp
+	sep     string
+	fromEnd int
+	minLen  int
+}
+
+// postalFormats are the postal code formats of the countries whose codes are validated, by ISO 3166 code.
+// Addresses in other countries may have any postal code, or none.
+var postalFormats = map[string]postalFormat{
+	"AU": {pattern: regexp.MustCompile(`^\d{4}$`)},
+	"CA": {pattern: regexp.MustCompile(`^[A-Z]\d[A-Z] \d[A-Z]\d$`), sep: " ", fromEnd: 3, minLen: 6},
+	"DE": {pattern: regexp.MustCompile(`^\d{5}$`)},
+	"FR": {pattern: regexp.MustCompile(`^\d{5}$`)},
+	"GB": {pattern: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? \d[A-Z]{2}$`), sep: " ", fromEnd: 3, minLen: 5},
+	"JP": {pattern: regexp.MustCompile(`^\d{3}-\d{4}$`), sep: "-", fromEnd: 4, minLen: 7},
+	"MX": {pattern: regexp.MustCompile(`^\d{5}$`)},
+	"NL": {pattern: regexp.MustCompile(`^\d{4} [A-Z]{2}$`), sep: " ", fromEnd: 2, minLen: 6},
+	"US": {pattern: regexp.MustCompile(`^\d{5}(-\d{4})?$`), sep: "-", fromEnd: 4, minLen: 9},
+}
+
+// anyPostalCode is what a postal code of a country without a format is taken to look like, when splitting one line
+var anyPostalCode = regexp.MustCompile(`^\d{3,}(-\d{3,})?$`)
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// countryNames are country names and abbreviations, upper case, and their ISO 3166 codes
+var countryNames = map[string]string{
+	"USA": "US", "U.S.A.": "US", "UNITED STATES": "US", "UNITED STATES OF AMERICA": "US",
+	"CANADA": "CA", "MEXICO": "MX", "AUSTRALIA": "AU", "GERMANY": "DE", "FRANCE": "FR", "JAPAN": "JP",
+	"UK": "GB", "UNITED KINGDOM": "GB", "GREAT BRITAIN": "GB", "NETHERLANDS": "NL", "THE NETHERLANDS": "NL",
+}
+
+// regionCodes are the states and provinces of countries that use two-letter region codes, upper case, by country
+var regionCodes = map[string]map[string]string{
+	"US": {
+		"ALABAMA": "AL", "ALASKA": "AK", "ARIZONA": "AZ", "ARKANSAS": "AR", "CALIFORNIA": "CA", "COLORADO": "CO",
+		"CONNECTICUT": "CT", "DELAWARE": "DE", "DISTRICT OF COLUMBIA": "DC", "FLORIDA": "FL", "GEORGIA": "GA",
+		"HAWAII": "HI", "IDAHO": "ID", "ILLINOIS": "IL", "INDIANA": "IN", "IOWA": "IA", "KANSAS": "KS",
+		"KENTUCKY": "KY", "LOUISIANA": "LA", "MAINE": "ME", "MARYLAND": "MD", "MASSACHUSETTS": "MA",
+		"MICHIGAN": "MI", "MINNESOTA": "MN", "MISSISSIPPI": "MS", "MISSOURI": "MO", "MONTANA": "MT",
+		"NEBRASKA": "NE", "NEVADA": "NV", "NEW HAMPSHIRE": "NH", "NEW JERSEY": "NJ", "NEW MEXICO": "NM",
+		"NEW YORK": "NY", "NORTH CAROLINA": "NC", "NORTH DAKOTA": "ND", "OHIO": "OH", "OKLAHOMA": "OK",
+		"OREGON": "OR", "PENNSYLVANIA": "PA", "RHODE ISLAND": "RI", "SOUTH CAROLINA": "SC", "SOUTH DAKOTA": "SD",
+		"TENNESSEE": "TN", "TEXAS": "TX", "UTAH": "UT", "VERMONT": "VT", "VIRGINIA": "VA", "WASHINGTON": "WA",
+		"WEST VIRGINIA": "WV", "WISCONSIN": "WI", "WYOMING": "WY",
+	},
+	"CA": {
+		"ALBERTA": "AB", "BRITISH COLUMBIA": "BC", "MANITOBA": "MB", "NEW BRUNSWICK": "NB",
+		"NEWFOUNDLAND AND LABRADOR": "NL", "NORTHWEST TERRITORIES": "NT", "NOVA SCOTIA": "NS", "NUNAVUT": "NU",
+		"ONTARIO": "ON", "PRINCE EDWARD ISLAND": "PE", "QUEBEC": "QC", "SASKATCHEWAN": "SK", "YUKON": "YT",
+	},
+}
+
+// streetAbbreviations are the standard abbreviations of words in street lines, by the word in upper case.
+// Used for addresses in English-speaking countries, or with no country.
+var streetAbbreviations = map[string]string{
+	"STREET": "St", "ST": "St", "AVENUE": "Ave", "AVE": "Ave", "ROAD": "Rd", "RD": "Rd",
+	"BOULEVARD": "Blvd", "BLVD": "Blvd", "DRIVE": "Dr", "DR": "Dr", "LANE": "Ln", "LN": "Ln",
+	"COURT": "Ct", "CT": "Ct", "PLACE": "Pl", "PL": "Pl", "TERRACE": "Ter", "TER": "Ter",
+	"HIGHWAY": "Hwy", "HWY": "Hwy", "PARKWAY": "Pkwy", "PKWY": "Pkwy", "CIRCLE": "Cir", "CIR": "Cir",
+	"SQUARE": "Sq", "SQ": "Sq", "APARTMENT": "Apt", "APT": "Apt", "SUITE": "Ste", "STE": "Ste",
+	"BUILDING": "Bldg", "BLDG": "Bldg", "FLOOR": "Fl", "FL": "Fl",
+}
+
+var abbreviatingCountries = map[string]bool{"": true, "US": true, "CA": true, "GB": true, "AU": true}
+
+// ParseAddress splits an address on one line, e.g. "123 Main Street, Springfield, OR 97477, USA", into fields:
+// the last part is the country if it names one, a postal code ends the region, and the parts before are
+// the street lines and city. A single part is the first street line. The fields are not normalized.
+func ParseAddress(s string) Address {
+	var parts []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	var a Address
+	if len(parts) > 1 {
+		if code, ok := countryNames[strings.ToUpper(parts[len(parts)-1])]; ok {
+			a.Country = code
+			parts = parts[:len(parts)-1]
+		}
+	}
+	if len(parts) > 1 {
+		if region, postalCode, ok := splitPostalCode(a.Country, parts[len(parts)-1]); ok {
+			a.PostalCode = postalCode
+			if region == "" {
+				parts = parts[:len(parts)-1]
+			} else {
+				parts[len(parts)-1] = region
+			}
+		}
+	}
+	switch n := len(parts); n {
+	case 0:
+	case 1:
+		a.Line1 = parts[0]
+	case 2:
+		a.Line1, a.City = parts[0], parts[1]
+	default:
+		a.Line1, a.City, a.Region = parts[0], parts[n-2], parts[n-1]
+		a.Line2 = strings.Join(parts[1:n-2], ", ")
+	}
+	return a
+}
+
+// splitPostalCode splits a postal code off the end of s, e.g. "OR 97477" into "OR" and "97477"
+func splitPostalCode(country string, s string) (rest string, postalCode string, ok bool) {
+	words := strings.Fields(s)
+	for n := 2; n >= 1; n-- {
+		if n > len(words) {
+			continue
+		}
+		candidate := strings.Join(words[len(words)-n:], " ")
+		if format, known := postalFormats[country]; known {
+			ok = format.pattern.MatchString(normalizePostalCode(country, candidate))
+		} else {
+			ok = n == 1 && anyPostalCode.MatchString(candidate)
+		}
+		if ok {
+			return strings.Join(words[:len(words)-n], " "), candidate, true
+		}
+	}
+	return s, "", false
+}
+
+// Normalize puts the address's fields in a standard form: single spaces, standard abbreviations in street lines,
+// and upper case country codes, region codes, and postal codes, with their separators.
+// If the fields are all empty, they are first parsed from Address. Sets Address to the fields on one line.
+func (a *Address) Normalize() {
+	if !a.hasFields() {
+		parsed := ParseAddress(a.Address)
+		a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country =
+			parsed.Line1, parsed.Line2, parsed.City, parsed.Region, parsed.PostalCode, parsed.Country
+	}
+	a.Country = normalizeCountry(a.Country)
+	a.Line1 = normalizeStreet(a.Country, a.Line1)
+	a.Line2 = normalizeStreet(a.Country, a.Line2)
+	a.City = collapseSpaces(a.City)
+	a.Region = normalizeRegion(a.Country, a.Region)
+	a.PostalCode = normalizePostalCode(a.Country, a.PostalCode)
+	a.Address = a.Format()
+}
+
+// Format returns the address's fields on one line, e.g. "123 Main St, Springfield, OR 97477, US"
+func (a *Address) Format() string {
+	var parts []string
+	for _, part := range []string{a.Line1, a.Line2, a.City, strings.TrimSpace(a.Region + " " + a.PostalCode), a.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SameAddress returns true if the addresses are the same once normalized, ignoring case
+func (a Address) SameAddress(b Address) bool {
+	a.Normalize()
+	b.Normalize()
+	return strings.EqualFold(a.Line1, b.Line1) && strings.EqualFold(a.Line2, b.Line2) &&
+		strings.EqualFold(a.City, b.City) && strings.EqualFold(a.Region, b.Region) &&
+		a.PostalCode == b.PostalCode && a.Country == b.Country
+}
+
+// hasFields returns true if any of the address's fields are set
+func (a *Address) hasFields() bool {
+	return a.Line1 != "" || a.Line2 != "" || a.City != "" || a.Region != "" || a.PostalCode != "" || a.Country != ""
+}
+
+// validatePostalCode returns an error if the country has a postal code format that the address's postal code does not match
+func (a *Address) validatePostalCode() error {
+	format, ok := postalFormats[a.Country]
+	if !ok {
+		return nil
+	}
+	if a.PostalCode == "" {
+		return Errorf(EINVALID, "Postal code required for %s.", a.Country)
+	}
+	if !format.pattern.MatchString(a.PostalCode) {
+		return Errorf(EINVALID, "Postal code %q is not valid for %s.", a.PostalCode, a.Country)
+	}
+	return nil
+}
+
+func normalizeCountry(s string) string {
+	s = strings.ToUpper(collapseSpaces(s))
+	if code, ok := countryNames[s]; ok {
+		return code
+	}
+	return s
+}
+
+func normalizeRegion(country string, s string) string {
+	s = collapseSpaces(s)
+	codes, ok := regionCodes[country]
+	if !ok {
+		return s
+	}
+	if code, ok := codes[strings.ToUpper(s)]; ok {
+		return code
+	}
+	if len(s) == 2 {
+		return strings.ToUpper(s)
+	}
+	return s
+}
+
+func normalizePostalCode(country string, s string) string {
+	s = strings.ToUpper(collapseSpaces(s))
+	format, ok := postalFormats[country]
+	if !ok || format.sep == "" || format.pattern.MatchString(s) {
+		return s
+	}
+	compact := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	if len(compact) < format.minLen {
+		return s
+	}
+	return compact[:len(compact)-format.fromEnd] + format.sep + compact[len(compact)-format.fromEnd:]
+}
+
+func normalizeStreet(country string, s string) string {
+	words := strings.Fields(s)
+	if abbreviatingCountries[country] {
+		for i, word := range words {
+			if abbreviation, ok := streetAbbreviations[strings.ToUpper(strings.TrimSuffix(word, "."))]; ok {
+				words[i] = abbreviation
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
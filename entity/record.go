@@ -1,6 +1,10 @@
 package entity
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
 
 type Record struct {
 	ID   int               `json:"id"`
@@ -32,3 +36,35 @@ func (d *Record) SetID(id int) {
 	d.ID = id
 	fmt.Println("Record.SetID", d.ID)
 }
+
+// FormatValidTime formats a valid-time bound as a unix timestamp string.
+// Zero (open-ended) bounds are returned as an empty string.
+func FormatValidTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.Itoa(int(t.Unix()))
+}
+
+// ParseValidTime parses a valid-time bound from an integer timestamp or a date ("2006-01-02", start of day UTC).
+func ParseValidTime(value string) (time.Time, error) {
+	return parseTime(value, 0)
+}
+
+// ParseAsOf parses an instant to read as of, from an integer timestamp or a date ("2006-01-02").
+// A date is its last second, 23:59:59 UTC, so reading as of a date includes everything on that date.
+func ParseAsOf(value string) (time.Time, error) {
+	return parseTime(value, 24*time.Hour-time.Second)
+}
+
+// parseTime parses an integer timestamp, or a date at start of day UTC plus sinceMidnight
+func parseTime(value string, sinceMidnight time.Duration) (time.Time, error) {
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(timestamp, 0).UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, Errorf(EINVALID, "Time must be a timestamp or in format '2006-01-02'")
+	}
+	return t.Add(sinceMidnight), nil
+}
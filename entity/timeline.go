@@ -0,0 +1,76 @@
+package entity
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Timeline event types
+const (
+	EventInsuredCreated    = "insured.created"
+	EventInsuredDeleted    = "insured.deleted"
+	EventInsuredRestored   = "insured.restored"
+	EventEmployeeCreated   = "employee.created"
+	EventEmployeeUpdated   = "employee.updated"
+	EventEmployeeCancelled = "employee.cancelled" // scheduled change cancelled before it took effect
+	EventEmployeeDeleted   = "employee.deleted"
+	EventAddressCreated    = "address.created"
+	EventAddressUpdated    = "address.updated"
+	EventAddressCancelled  = "address.cancelled"
+	EventAddressDeleted    = "address.deleted"
+)
+
+// TimelineEvent is one change to an insured, its employees, or its address
+type TimelineEvent struct {
+	Type string
+
+	// When the system recorded the event (transaction time)
+	Timestamp time.Time
+
+	// Id of the record in the resource's data table
+	RecordId int
+
+	// Insured, Employee, or Address as recorded by this event
+	Resource InsuredInterface
+}
+
+// TimelineFilter represents a filter passed to GetTimeline().
+type TimelineFilter struct {
+	// Time window. Zero From/To is unbounded.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	Descending bool `json:"descending"`
+
+	// Restrict to subset of results.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// Includes returns true if t is in the filter's time window
+func (f TimelineFilter) Includes(t time.Time) bool {
+	if !f.From.IsZero() && t.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && t.After(f.To) {
+		return false
+	}
+	return true
+}
+
+func (e TimelineEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Type      string           `json:"type"`
+		Timestamp string           `json:"timestamp"`
+		DateTime  string           `json:"dateTime"`
+		RecordId  string           `json:"recordId"`
+		Resource  InsuredInterface `json:"resource"`
+	}{
+		Type:      e.Type,
+		Timestamp: strconv.Itoa(int(e.Timestamp.Unix())),
+		DateTime:  e.Timestamp.Format("Mon, 02 Jan 2006 15:04:05 MST"),
+		RecordId:  strconv.Itoa(e.RecordId),
+		Resource:  e.Resource,
+	})
+}
@@ -0,0 +1,190 @@
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/nickcoast/timetravel/memory"
+)
+
+// Event-sourced backend. Every write is appended to a log file as events (see memory.Event),
+// one JSON object per line, and never changed, except by a purge. Reads are served by a projection: a memory.DB
+// built by applying the events in order. Open replays the log.
+// A snapshot of the projection, saved next to the log, lets Open skip the events before it.
+// Compact rewrites the log as a single snapshot, and Replay rebuilds the DB at any time the log covers.
+// PurgeById compacts the log, so purged rows are removed from the file, not only from the projection.
+// A new log starts empty. Seed data is logged as any other write.
+
+// DefaultSnapshotEvery is the number of events between snapshots
+const DefaultSnapshotEvery = 1000
+
+type DB struct {
+	*memory.DB // the projection. Has every method service.Store needs.
+
+	Path          string
+	SnapshotEvery int // events written between snapshots. 0 only snapshots on Close.
+
+	mu            sync.Mutex // guards the fields below
+	file          *os.File
+	seq           int64           // Seq of the last event in the log
+	size          int64           // length of the log
+	offsets       map[int64]int64 // length of the log after each write since the last snapshot, by the write's last Seq
+	sinceSnapshot int             // events written since the last snapshot
+	snapshotting  bool
+	compacting    bool // no snapshot starts while set
+
+	wg sync.WaitGroup // background snapshots
+}
+
+// NewDB returns a DB for the log file at path. Open reads it.
+func NewDB(path string) *DB {
+	return &DB{
+		DB:            memory.NewDB(),
+		Path:          path,
+		SnapshotEvery: DefaultSnapshotEvery,
+	}
+}
+
+// Errors are entity's, as in package memory
+var ErrRecordDoesNotExist = memory.ErrRecordDoesNotExist
+var ErrRecordIDInvalid = memory.ErrRecordIDInvalid
+var ErrRecordAlreadyExists = memory.ErrRecordAlreadyExists
+var ErrRecordMatchingCriteriaDoesNotExist = memory.ErrRecordMatchingCriteriaDoesNotExist
+var ErrUpdateMustChangeAValue = memory.ErrUpdateMustChangeAValue
+var ErrRecordNotPending = memory.ErrRecordNotPending
+var ErrInsuredDeleted = memory.ErrInsuredDeleted
+
+var ErrCorruptLog = errors.New("event log line is not an event")
+var ErrCompacted = errors.New("event log was compacted after that time")
+
+// Open replays the log into the projection, starting from the snapshot if there is a usable one.
+// Creates the log if it does not exist. A last line left incomplete by a crash is removed.
+func (db *DB) Open() (err error) {
+	if db.Path == "" {
+		return fmt.Errorf("path required")
+	}
+	if db.file, err = os.OpenFile(db.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+
+	var offset int64
+	if s, ok := db.readSnapshot(); ok {
+		if err := db.DB.Apply(s.Events...); err != nil {
+			return err
+		}
+		offset, db.seq = s.Offset, s.Events[0].Seq
+	}
+	if _, err := db.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	end, err := readEvents(db.file, offset, func(e memory.Event) error {
+		if e.Seq > db.seq {
+			db.seq = e.Seq
+		}
+		return db.DB.Apply(e)
+	})
+	if err != nil {
+		return fmt.Errorf("replay %s: %w", db.Path, err)
+	}
+	if err := db.file.Truncate(end); err != nil { // incomplete last line, if any
+		return err
+	}
+	db.size = end
+	db.offsets = map[int64]int64{db.seq: end}
+	db.DB.Journal = db.journal
+	return nil
+}
+
+// Close waits for snapshots in progress, saves a snapshot if there were writes since the last one, and closes the log
+func (db *DB) Close() error {
+	if db.file == nil {
+		return nil
+	}
+	db.wg.Wait()
+	db.mu.Lock()
+	written := db.sinceSnapshot > 0
+	db.mu.Unlock()
+	if written {
+		if err := db.Snapshot(); err != nil {
+			return err
+		}
+	}
+	err := db.file.Close()
+	db.file = nil
+	return err
+}
+
+// journal appends the events of a write to the log, and numbers them. The projection applies them after.
+func (db *DB) journal(events []memory.Event) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.file == nil {
+		return fmt.Errorf("event log is closed")
+	}
+	at := db.DB.Now().Unix()
+	seq := db.seq
+	var buf bytes.Buffer
+	for i := range events {
+		seq++
+		events[i].Seq, events[i].At = seq, at
+		line, err := json.Marshal(events[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if _, err := db.file.Write(buf.Bytes()); err != nil {
+		db.file.Truncate(db.size) // remove a partial write
+		return err
+	}
+	if err := db.file.Sync(); err != nil {
+		return err
+	}
+	db.seq = seq
+	db.size += int64(buf.Len())
+	db.offsets[seq] = db.size
+
+	db.sinceSnapshot += len(events)
+	if db.SnapshotEvery > 0 && db.sinceSnapshot >= db.SnapshotEvery && !db.snapshotting && !db.compacting {
+		// the projection is locked until this write is applied, so snapshot after
+		db.snapshotting = true
+		db.wg.Add(1)
+		go func() {
+			defer db.wg.Done()
+			if err := db.Snapshot(); err != nil {
+				log.Printf("error: event log snapshot: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// readEvents calls fn with each event read from r, which starts at offset in the log.
+// Returns the offset after the last complete line.
+func readEvents(r io.Reader, offset int64, fn func(e memory.Event) error) (int64, error) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return offset, nil // a line without "\n" was not completely written
+		} else if err != nil {
+			return offset, err
+		}
+		var e memory.Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return offset, fmt.Errorf("%w offset=%v: %v", ErrCorruptLog, offset, err)
+		}
+		if err := fn(e); err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+	}
+}
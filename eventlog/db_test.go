@@ -0,0 +1,322 @@
+package eventlog_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/eventlog"
+	"github.com/nickcoast/timetravel/seed"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// Ensure the test log can open & close.
+func TestDB(t *testing.T) {
+	db := MustOpenDB(t, filepath.Join(t.TempDir(), "test.log"), "")
+	MustCloseDB(t, db)
+}
+
+// MustOpenDB opens the log at path, and adds the fixture set named, e.g. "demo". None if empty.
+// The fixtures are logged in 2000, so the tests' writes come after them.
+func MustOpenDB(tb testing.TB, path string, fixtures string) *eventlog.DB {
+	tb.Helper()
+	db := eventlog.NewDB(path)
+	if err := db.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	if fixtures != "" {
+		db.Now = func() time.Time { return date("2000-06-01") }
+		MustSeed(tb, db, fixtures)
+		db.Now = time.Now
+	}
+	return db
+}
+
+// MustSeed adds the fixture set named, e.g. "demo", through the service. Fatal on error.
+func MustSeed(tb testing.TB, db service.Store, name string) {
+	tb.Helper()
+	set, err := seed.Load(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := service.NewSqliteRecordService(db)
+	if err := s.Seed(context.Background(), set); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// MustCloseDB closes the log. Fatal on error.
+func MustCloseDB(tb testing.TB, db *eventlog.DB) {
+	tb.Helper()
+	if err := db.Close(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// MustDeleteInsured deletes the insured at deletedAt. Fatal on error.
+func MustDeleteInsured(tb testing.TB, db *eventlog.DB, id int64, deletedAt time.Time) {
+	tb.Helper()
+	db.Now = func() time.Time { return deletedAt }
+	if _, err := db.DeleteById(context.Background(), &entity.Insured{}, id); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func date(value string) time.Time {
+	t, _ := time.Parse("2006-01-02", value)
+	return t
+}
+
+// Writes are replayed when the log is opened again
+func TestDB_Open(tb *testing.T) {
+	path := filepath.Join(tb.TempDir(), "test.log")
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second).Add(-time.Minute)
+
+	db := MustOpenDB(tb, path, "demo")
+	if _, err := db.CreateInsured(ctx, &entity.Insured{Name: "sue", RecordTimestamp: now}); err != nil {
+		tb.Fatal(err)
+	}
+	MustDeleteInsured(tb, db, 1, date("2010-01-01"))
+	MustCloseDB(tb, db)
+
+	db = MustOpenDB(tb, path, "")
+	defer MustCloseDB(tb, db)
+	if insured, err := db.GetInsuredByDate(ctx, 3, now); err != nil {
+		tb.Fatal(err)
+	} else if got, want := insured.Name, "sue"; got != want {
+		tb.Fatalf("Name=%v, want %v", got, want)
+	}
+	if _, err := db.GetInsuredByDate(ctx, 1, date("2011-01-01")); err != eventlog.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, eventlog.ErrRecordDoesNotExist)
+	}
+	if insured, err := db.GetInsuredByDate(ctx, 1, date("2009-01-01")); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(*insured.Employees), 2; got != want {
+		tb.Fatalf("len(Employees)=%v, want %v", got, want)
+	}
+	// ids continue after the replayed writes
+	insured := &entity.Insured{Name: "bob", RecordTimestamp: now}
+	if _, err := db.CreateInsured(ctx, insured); err != nil {
+		tb.Fatal(err)
+	} else if got, want := insured.ID, 4; got != want {
+		tb.Fatalf("ID=%v, want %v", got, want)
+	}
+}
+
+// Open starts from the snapshot, and does not read the events before it
+func TestDB_Snapshot(tb *testing.T) {
+	path := filepath.Join(tb.TempDir(), "test.log")
+	db := MustOpenDB(tb, path, "demo")
+	MustDeleteInsured(tb, db, 1, date("2010-01-01"))
+	MustCloseDB(tb, db) // takes a snapshot
+
+	// blank out every event before the snapshot
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i := range buf {
+		if buf[i] != '\n' {
+			buf[i] = ' '
+		}
+	}
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	db = MustOpenDB(tb, path, "")
+	if _, err := db.GetInsuredByDate(context.Background(), 1, date("2011-01-01")); err != eventlog.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, eventlog.ErrRecordDoesNotExist)
+	}
+	MustCloseDB(tb, db)
+
+	// without the snapshot, the whole log is replayed
+	if err := os.Remove(eventlog.SnapshotPath(path)); err != nil {
+		tb.Fatal(err)
+	}
+	if err := eventlog.NewDB(path).Open(); !errors.Is(err, eventlog.ErrCorruptLog) {
+		tb.Fatalf("err=%v, want %v", err, eventlog.ErrCorruptLog)
+	}
+}
+
+// A last event left incomplete by a crash is removed
+func TestDB_Open_IncompleteEvent(tb *testing.T) {
+	path := filepath.Join(tb.TempDir(), "test.log")
+	db := MustOpenDB(tb, path, "demo")
+	MustDeleteInsured(tb, db, 1, date("2010-01-01"))
+	MustCloseDB(tb, db)
+
+	buf, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, append(append([]byte(nil), buf...), []byte(`{"seq":99,"type":"Dele`)...), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	db = MustOpenDB(tb, path, "")
+	MustCloseDB(tb, db)
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, buf) {
+		tb.Fatalf("log=%q, want %q", got, buf)
+	}
+}
+
+// Compact rewrites the log as it is now, without the history of purged rows
+func TestCompact(tb *testing.T) {
+	path := filepath.Join(tb.TempDir(), "test.log")
+	ctx := context.Background()
+	db := MustOpenDB(tb, path, "demo")
+	MustDeleteInsured(tb, db, 2, date("2010-01-01"))
+	if err := db.PurgeById(ctx, &entity.Insured{}, 2); err != nil {
+		tb.Fatal(err)
+	}
+	MustCloseDB(tb, db)
+
+	if err := eventlog.Compact(path); err != nil {
+		tb.Fatal(err)
+	}
+	if buf, _ := os.ReadFile(path); bytes.Contains(buf, []byte("Grant Tombly")) {
+		tb.Fatal("purged employee is still in the log")
+	}
+	if _, err := os.Stat(eventlog.SnapshotPath(path)); !os.IsNotExist(err) {
+		tb.Fatalf("snapshot err=%v, want not exist", err)
+	}
+	if _, err := eventlog.Replay(path, date("2009-01-01")); err != eventlog.ErrCompacted {
+		tb.Fatalf("err=%v, want %v", err, eventlog.ErrCompacted)
+	}
+
+	db = MustOpenDB(tb, path, "")
+	defer MustCloseDB(tb, db)
+	if insured, err := db.GetInsuredByDate(ctx, 1, date("2001-01-01")); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(*insured.Employees), 2; got != want {
+		tb.Fatalf("len(Employees)=%v, want %v", got, want)
+	}
+	if _, err := db.GetInsuredByDate(ctx, 2, date("2001-01-01")); err != eventlog.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, eventlog.ErrRecordDoesNotExist)
+	}
+	insured := &entity.Insured{Name: "sue", RecordTimestamp: date("2012-01-01")}
+	if _, err := db.CreateInsured(ctx, insured); err != nil {
+		tb.Fatal(err)
+	} else if got, want := insured.ID, 3; got != want { // purged ids are not reused
+		tb.Fatalf("ID=%v, want %v", got, want)
+	}
+}
+
+// Replay rebuilds the DB as it was at any time the log covers
+func TestReplay(tb *testing.T) {
+	path := filepath.Join(tb.TempDir(), "test.log")
+	ctx := context.Background()
+	db := MustOpenDB(tb, path, "demo")
+	MustDeleteInsured(tb, db, 1, date("2010-01-01"))
+	MustCloseDB(tb, db)
+
+	for _, tt := range []struct {
+		until string
+		err   error // now
+	}{
+		{"2009-01-01", nil},
+		{"2010-06-01", eventlog.ErrRecordDoesNotExist},
+	} {
+		replayed, err := eventlog.Replay(path, date(tt.until))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := replayed.GetInsuredByDate(ctx, 1, date("2012-01-01")); err != tt.err {
+			tb.Fatalf("until %v: err=%v, want %v", tt.until, err, tt.err)
+		}
+		// a deleted insured can still be seen before the deletion
+		if _, err := replayed.GetInsuredByDate(ctx, 1, date("2009-01-01")); err != nil {
+			tb.Fatalf("until %v: before deletion err=%v", tt.until, err)
+		}
+	}
+}
+
+// A purge removes the purged rows from the log file, not only from the DB. The log can be written and opened after.
+func TestDB_PurgeById(tb *testing.T) {
+	path := filepath.Join(tb.TempDir(), "test.log")
+	ctx := context.Background()
+	db := MustOpenDB(tb, path, "demo")
+	MustDeleteInsured(tb, db, 1, date("2010-01-01"))
+	db.Now = func() time.Time { return date("2011-01-01") }
+	if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, purged := range []string{"Jimmy Temelpa", "Mister Bungle", "Mars"} {
+		if bytes.Contains(buf, []byte(purged)) {
+			tb.Fatalf("purged %q is still in the log", purged)
+		}
+	}
+	if !bytes.Contains(buf, []byte("Grant Tombly")) {
+		tb.Fatal("insured 2 is not in the log")
+	}
+	if _, err := eventlog.Replay(path, date("2009-01-01")); err != eventlog.ErrCompacted {
+		tb.Fatalf("err=%v, want %v", err, eventlog.ErrCompacted)
+	}
+
+	insured := &entity.Insured{Name: "sue", RecordTimestamp: date("2012-01-01")}
+	if _, err := db.CreateInsured(ctx, insured); err != nil {
+		tb.Fatal(err)
+	}
+	MustCloseDB(tb, db)
+
+	db = MustOpenDB(tb, path, "")
+	defer MustCloseDB(tb, db)
+	if _, err := db.GetInsuredByDate(ctx, 1, date("2009-01-01")); err != eventlog.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, eventlog.ErrRecordDoesNotExist)
+	}
+	if got, err := db.GetInsuredByDate(ctx, int64(insured.ID), date("2012-01-01")); err != nil {
+		tb.Fatal(err)
+	} else if got.Name != "sue" {
+		tb.Fatalf("Name=%v, want sue", got.Name)
+	}
+}
+
+// Writes during a purge are in the log after it, and compaction does not wait on them forever
+func TestDB_PurgeById_ConcurrentWrites(tb *testing.T) {
+	path := filepath.Join(tb.TempDir(), "test.log")
+	ctx := context.Background()
+	db := MustOpenDB(tb, path, "demo")
+	db.SnapshotEvery = 2
+
+	var wg sync.WaitGroup
+	ids := make(chan int, 40)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				insured := &entity.Insured{Name: "sue", RecordTimestamp: date("2012-01-01")}
+				if _, err := db.CreateInsured(ctx, insured); err != nil {
+					tb.Error(err)
+					return
+				}
+				ids <- insured.ID
+			}
+		}()
+	}
+	if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	wg.Wait()
+	close(ids)
+	MustCloseDB(tb, db)
+
+	db = MustOpenDB(tb, path, "")
+	defer MustCloseDB(tb, db)
+	for id := range ids {
+		if _, err := db.GetInsuredByDate(ctx, int64(id), date("2012-01-01")); err != nil {
+			tb.Fatalf("insured %v: %v", id, err)
+		}
+	}
+	if _, err := db.GetInsuredByDate(ctx, 1, date("2009-01-01")); err != eventlog.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, eventlog.ErrRecordDoesNotExist)
+	}
+}
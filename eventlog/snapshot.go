@@ -0,0 +1,224 @@
+package eventlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/memory"
+)
+
+// snapshot is the projection as of a position in the log. Saved as JSON in SnapshotPath.
+type snapshot struct {
+	Offset int64          `json:"offset"` // length of the log when the snapshot was taken
+	Events []memory.Event `json:"events"` // memory.DB.Events. The Base event has the Seq of the last event in the log.
+}
+
+// SnapshotPath returns the path of the snapshot of the log at path
+func SnapshotPath(path string) string {
+	return path + ".snapshot"
+}
+
+// Snapshot saves the projection, so Open only replays the events written after it
+func (db *DB) Snapshot() error {
+	defer func() {
+		db.mu.Lock()
+		db.snapshotting = false
+		db.mu.Unlock()
+	}()
+	events := db.DB.Events()
+	seq := events[0].Seq
+
+	db.mu.Lock()
+	offset, ok := db.offsets[seq]
+	for s := range db.offsets {
+		if s < seq {
+			delete(db.offsets, s)
+		}
+	}
+	db.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no log offset for seq %v", seq)
+	}
+
+	buf, err := json.Marshal(snapshot{Offset: offset, Events: events})
+	if err != nil {
+		return err
+	}
+	if err := writeFile(SnapshotPath(db.Path), buf); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	db.sinceSnapshot = int(db.seq - seq)
+	db.mu.Unlock()
+	return nil
+}
+
+// readSnapshot returns the snapshot if there is one that matches the log:
+// the log is at least as long, and the event after it has the next Seq.
+// Otherwise the whole log is replayed.
+func (db *DB) readSnapshot() (s snapshot, ok bool) {
+	buf, err := os.ReadFile(SnapshotPath(db.Path))
+	if err != nil {
+		return s, false
+	}
+	if err := json.Unmarshal(buf, &s); err != nil || len(s.Events) == 0 || s.Events[0].Type != memory.EventBase {
+		return s, false
+	}
+	info, err := db.file.Stat()
+	if err != nil || s.Offset > info.Size() {
+		return s, false
+	}
+	line, err := bufio.NewReader(io.NewSectionReader(db.file, s.Offset, info.Size()-s.Offset)).ReadBytes('\n')
+	if err != nil {
+		return s, true // nothing written after the snapshot
+	}
+	var next memory.Event
+	if err := json.Unmarshal(line, &next); err != nil || next.Seq != s.Events[0].Seq+1 {
+		return s, false
+	}
+	return s, true
+}
+
+// Compact rewrites the log at path as a snapshot of its DB: a Base event, then one event per row.
+// Removes the history of the log, including purged rows, so Replay cannot go back before now.
+// The log must not be open.
+func Compact(path string) error {
+	db := NewDB(path)
+	db.SnapshotEvery = 0
+	if err := db.Open(); err != nil {
+		return err
+	}
+	events := db.DB.Events()
+	if err := db.file.Close(); err != nil {
+		return err
+	}
+	db.file = nil
+	if err := WriteLog(path, events); err != nil {
+		return err
+	}
+	if err := os.Remove(SnapshotPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// PurgeById permanently deletes the row and all of its history, as memory.DB.PurgeById does,
+// then compacts the log so the purged rows are no longer in the file. Replay cannot go back before the purge.
+func (db *DB) PurgeById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) error {
+	if err := db.DB.PurgeById(ctx, insuredObj, id); err != nil {
+		return err
+	}
+	return db.compact()
+}
+
+// compact rewrites the open log as a snapshot of the projection, as Compact does.
+// Writes wait until it is done: the projection is read locked, so it is the whole log.
+// Snapshots in progress are waited for, as they read the old log's offsets, and no others start.
+func (db *DB) compact() error {
+	db.mu.Lock()
+	db.compacting = true
+	db.mu.Unlock()
+	defer func() {
+		db.mu.Lock()
+		db.compacting = false
+		db.mu.Unlock()
+	}()
+	db.wg.Wait()
+	return db.DB.WithEvents(func(events []memory.Event) error {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		return db.rewrite(events)
+	})
+}
+
+// rewrite replaces the open log with events, and removes the snapshot. db.mu must be held.
+func (db *DB) rewrite(events []memory.Event) (err error) {
+	if err := WriteLog(db.Path, events); err != nil { // the old log stays open until replaced
+		return err
+	}
+	if err := db.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(SnapshotPath(db.Path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if db.file, err = os.OpenFile(db.Path, os.O_RDWR|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	info, err := db.file.Stat()
+	if err != nil {
+		return err
+	}
+	db.size = info.Size()
+	db.offsets = map[int64]int64{db.seq: db.size}
+	db.sinceSnapshot = len(events)
+	return nil
+}
+
+// Replay returns the DB of the log at path as it was at until, replaying the log from its start.
+// The snapshot is not used. Returns ErrCompacted if the log was compacted after until, e.g. by a purge.
+func Replay(path string, until time.Time) (*memory.DB, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	projection := memory.NewDB()
+	if _, err := readEvents(file, 0, func(e memory.Event) error {
+		if e.At > until.Unix() { // events are in the order they were logged
+			if e.Type == memory.EventBase {
+				return ErrCompacted
+			}
+			return errStop
+		}
+		return projection.Apply(e)
+	}); err != nil && err != errStop {
+		return nil, err
+	}
+	return projection, nil
+}
+
+var errStop = errors.New("stop")
+
+// WriteLog writes events as a new log at path, replacing the file if there is one
+func WriteLog(path string, events []memory.Event) error {
+	var buf []byte
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	return writeFile(path, buf)
+}
+
+// writeFile replaces the file at path with buf, so that it is never partly written
+func writeFile(path string, buf []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
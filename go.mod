@@ -17,6 +17,13 @@ require (
 	github.com/gorilla/handlers v1.5.1
 )
 
+require (
+	github.com/fergusstrange/embedded-postgres v1.25.0
+	github.com/lib/pq v1.10.9
+)
+
+require github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
+
 require (
 	github.com/felixge/httpsnoop v1.0.1 // indirect
 	golang.org/x/exp v0.0.0-20230203172020-98cc5a0785f9
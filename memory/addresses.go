@@ -0,0 +1,136 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreateAddress creates an address of the insured, with its first record. Sets the new record id to address.ID
+func (db *DB) CreateAddress(ctx context.Context, address *entity.Address) (record entity.Record, err error) {
+	address.Normalize()
+	if err := address.Validate(); err != nil {
+		return record, err
+	}
+	db.mu.Lock()
+	defer db.unlock()
+	if err := db.createAddress(address); err != nil {
+		return record, err
+	}
+	if err := db.commit(); err != nil {
+		return record, err
+	}
+	return address.ToRecord(), nil
+}
+
+// createAddress adds an address record for the insured. Sets the new record id to address.ID.
+// If address.AddressId is 0, the record starts a new address of address.Type.
+func (db *DB) createAddress(address *entity.Address) error {
+	address.Normalize()
+	if err := address.Validate(); err != nil {
+		return err
+	}
+	if _, ok := db.findInsured(int64(address.InsuredId)); !ok {
+		return ErrRecordDoesNotExist
+	}
+	if address.Type == "" {
+		address.Type = entity.AddressMailing
+	}
+	if address.AddressId == 0 {
+		address.AddressId = db.nextId("insured_addresses")
+		db.emit(addressRow{id: address.AddressId, insuredId: address.InsuredId, addressType: address.Type}.event())
+	}
+	address.ID = db.nextId("insured_addresses_records")
+	db.emit(addressRecord{
+		version: version{
+			id:              address.ID,
+			recordTimestamp: unixTime(address.RecordTimestamp),
+			validFrom:       validFrom(address.ValidFrom, address.RecordTimestamp),
+			validTo:         validTo(address.ValidTo),
+		},
+		addressId:  address.AddressId,
+		address:    address.Address,
+		line1:      address.Line1,
+		line2:      address.Line2,
+		city:       address.City,
+		region:     address.Region,
+		postalCode: address.PostalCode,
+		country:    address.Country,
+		insuredId:  address.InsuredId,
+	}.event())
+	return nil
+}
+
+// CountInsuredAddresses returns the number of address records of the insured that are not deleted
+func (db *DB) CountInsuredAddresses(ctx context.Context, insured entity.Insured) (count int, err error) {
+	if err := insured.Validate(); err != nil {
+		return count, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.countInsuredAddresses(insured.ID), nil
+}
+
+func (db *DB) countInsuredAddresses(insuredId int) (count int) {
+	for _, r := range db.addressRecords {
+		if r.insuredId == insuredId && db.addressNotDeleted(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// UpdateAddress adds a record to the address with address.AddressId, unless the address did not change.
+// No address id updates the insured's only address.
+func (db *DB) UpdateAddress(ctx context.Context, address *entity.Address) (record entity.Record, err error) {
+	db.mu.Lock()
+	defer db.unlock()
+
+	// compare with the address valid when this change takes effect
+	asOfRecorded := address.RecordTimestamp
+	if asOfRecorded.IsZero() {
+		asOfRecorded = db.Now()
+	}
+	asOfValid := address.ValidFrom
+	if asOfValid.IsZero() {
+		asOfValid = asOfRecorded
+	}
+	insured, err := db.getInsuredByBitemporalDate(int64(address.InsuredId), asOfValid, asOfRecorded)
+	if err != nil {
+		return record, err
+	}
+	if db.countInsuredAddresses(insured.ID) == 0 {
+		return record, ErrRecordAlreadyExists
+	}
+	if address.AddressId == 0 {
+		if len(*insured.Addresses) != 1 {
+			return record, ErrRecordIDInvalid
+		}
+		for _, current := range *insured.Addresses {
+			address.AddressId, address.Type = current.AddressId, current.Type
+		}
+	}
+	for _, current := range *insured.Addresses {
+		if current.AddressId == address.AddressId && address.SameAddress(current) {
+			return record, ErrUpdateMustChangeAValue
+		}
+	}
+	if err := db.createAddress(address); err != nil {
+		return record, err
+	}
+	if err := db.commit(); err != nil {
+		return record, err
+	}
+	return address.ToRecord(), nil
+}
+
+// restoreAddress appends a copy of the address record, effective now.
+// Sets the address's ID to the new record id.
+func (db *DB) restoreAddress(address *entity.Address, now time.Time) error {
+	db.cancelPendingAddress(address.AddressId, now)
+	address.RecordTimestamp = now
+	address.ValidFrom = now
+	address.ValidTo = time.Time{}
+	return db.createAddress(address)
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreateClaim creates a claim against the insured and its first record. Sets the new claim id to claim.ID.
+// A claim without a status is open.
+func (db *DB) CreateClaim(ctx context.Context, claim *entity.Claim) (record entity.Record, err error) {
+	if claim.Status == "" {
+		claim.Status = entity.ClaimOpen
+	}
+	if err := claim.Validate(); err != nil {
+		return record, err
+	}
+	db.mu.Lock()
+	defer db.unlock()
+
+	if _, ok := db.findInsured(int64(claim.InsuredId)); !ok {
+		return record, ErrRecordDoesNotExist
+	}
+	claim.ID = db.nextId("claims")
+	db.emit(claimRow{id: claim.ID, insuredId: claim.InsuredId}.event())
+	db.updateClaim(claim)
+	if err := db.commit(); err != nil {
+		return record, err
+	}
+	return claim.ToRecord(), nil
+}
+
+// UpdateClaim adds a new record for the claim, unless nothing changed. The insured is the claim's.
+// Status transitions are not checked here: see entity.Claim.CanBecome.
+func (db *DB) UpdateClaim(ctx context.Context, claim *entity.Claim) (record entity.Record, err error) {
+	db.mu.Lock()
+	defer db.unlock()
+
+	current := db.getClaimByBitemporalDate(int64(claim.ID), claim.RecordTimestamp, claim.RecordTimestamp)
+	if current.ID == 0 {
+		return record, ErrRecordDoesNotExist
+	}
+	if current.SameClaim(claim) {
+		return record, ErrUpdateMustChangeAValue
+	}
+	claim.InsuredId = current.InsuredId
+	if err := claim.Validate(); err != nil {
+		return record, err
+	}
+	db.updateClaim(claim)
+	if err := db.commit(); err != nil {
+		return record, err
+	}
+	return claim.ToRecord(), nil
+}
+
+// updateClaim adds a record for the claim
+func (db *DB) updateClaim(claim *entity.Claim) {
+	db.emit(claimRecord{
+		version: version{
+			id:              db.nextId("claims_records"),
+			recordTimestamp: unixTime(claim.RecordTimestamp),
+			validFrom:       validFrom(claim.ValidFrom, claim.RecordTimestamp),
+			validTo:         validTo(claim.ValidTo),
+		},
+		claimId:     claim.ID,
+		lossDate:    shortDate(claim.LossDate),
+		description: claim.Description,
+		status:      claim.Status,
+	}.event())
+}
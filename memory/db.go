@@ -0,0 +1,736 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// In-memory backend. Same tables and behaviour as package sqlite, kept in slices,
+// so the service can run without a database, e.g. in tests and demos. Nothing is saved.
+// Timestamps are kept to the second, as the databases store unix seconds.
+
+type DB struct {
+	mu sync.RWMutex
+
+	// rows of each table, in id order
+	insureds        []insuredRow
+	employees       []employeeRow
+	employeeRecords []employeeRecord
+	addresses       []addressRow
+	addressRecords  []addressRecord
+	policies        []policyRow
+	policyRecords   []policyRecord
+	claims          []claimRow
+	claimRecords    []claimRecord
+	tombstones      []insuredTombstone
+	cancellations   []cancellation
+
+	lastIds map[string]int // last id used in each table. Ids are never reused, as with AUTOINCREMENT
+	lastSeq int64          // Seq of the last event applied
+
+	batch []Event // events of the write in progress
+
+	Now func() time.Time
+
+	// Journal, if set, is passed the events of each write before they are applied.
+	// If it returns an error, the write is not applied. It may set the events' Seq and At.
+	Journal func(events []Event) error
+}
+
+// NewDB returns an empty DB
+func NewDB() *DB {
+	return &DB{
+		lastIds: make(map[string]int),
+		Now:     time.Now,
+	}
+}
+
+// Close does nothing. DB has the same methods as the other backends.
+func (db *DB) Close() error {
+	return nil
+}
+
+// Errors are entity's, as in the other backends, so callers handle errors from any backend alike
+var ErrRecordDoesNotExist = entity.ErrRecordDoesNotExist
+var ErrRecordIDInvalid = entity.ErrRecordIDInvalid
+var ErrRecordAlreadyExists = entity.ErrRecordAlreadyExists
+var ErrRecordMatchingCriteriaDoesNotExist = entity.ErrRecordMatchingCriteriaDoesNotExist
+var ErrUpdateMustChangeAValue = entity.ErrUpdateMustChangeAValue
+var ErrRecordNotPending = entity.ErrRecordNotPending
+var ErrInsuredDeleted = entity.ErrInsuredDeleted
+
+// insured table
+type insuredRow struct {
+	id              int
+	name            string
+	policyNumber    int
+	recordTimestamp time.Time
+}
+
+// employees table. Employees have no values of their own, only records.
+type employeeRow struct {
+	id        int
+	insuredId int
+}
+
+// version is the bitemporal part of an employee or address record
+type version struct {
+	id              int
+	recordTimestamp time.Time
+	validFrom       time.Time
+	validTo         time.Time // zero until superseded
+	tombstone       bool
+}
+
+// the cancellations of employee, address, and policy records, by records table.
+// A cancelled record is kept as it was, so earlier answers can still be reproduced.
+type cancellation struct {
+	table           string
+	recordId        int
+	recordTimestamp time.Time
+}
+
+// employees_records table. insuredId is the employee's, copied for reads.
+type employeeRecord struct {
+	version
+	employeeId int
+	insuredId  int
+	name       string
+	startDate  time.Time
+	endDate    time.Time
+
+	jobClassCode  string
+	annualPayroll int64 // cents
+	workLocation  string
+}
+
+// insured_addresses table. Addresses have a type, and their values in records.
+type addressRow struct {
+	id          int
+	insuredId   int
+	addressType string
+}
+
+// insured_addresses_records table. addressType is the address's, copied for reads.
+type addressRecord struct {
+	version
+	addressId   int
+	addressType string
+	address     string
+	line1       string
+	line2       string
+	city        string
+	region      string
+	postalCode  string
+	country     string
+	insuredId   int
+}
+
+// policies table. Policies have a number, and their terms in records.
+type policyRow struct {
+	id           int
+	insuredId    int
+	policyNumber int
+}
+
+// policies_records table. insuredId and policyNumber are the policy's, copied for reads.
+type policyRecord struct {
+	version
+	policyId        int
+	insuredId       int
+	policyNumber    int
+	term            int
+	effectiveDate   time.Time
+	expirationDate  time.Time
+	occurrenceLimit int64
+	aggregateLimit  int64
+	premium         int64
+}
+
+// claims table. Claims have no values of their own, only records.
+type claimRow struct {
+	id        int
+	insuredId int
+}
+
+// claims_records table. insuredId is the claim's, copied for reads.
+type claimRecord struct {
+	version
+	claimId     int
+	insuredId   int
+	lossDate    time.Time
+	description string
+	status      string
+}
+
+// insured_tombstones table
+type insuredTombstone struct {
+	id              int
+	insuredId       int
+	recordTimestamp time.Time
+	restore         bool
+}
+
+func (r insuredRow) insured() *entity.Insured {
+	return &entity.Insured{
+		ID:              r.id,
+		Name:            r.name,
+		PolicyNumber:    r.policyNumber,
+		RecordTimestamp: r.recordTimestamp,
+	}
+}
+
+func (r employeeRecord) employee() *entity.Employee {
+	return &entity.Employee{
+		ID:              r.employeeId,
+		Name:            r.name,
+		StartDate:       r.startDate,
+		EndDate:         r.endDate,
+		JobClassCode:    r.jobClassCode,
+		AnnualPayroll:   r.annualPayroll,
+		WorkLocation:    r.workLocation,
+		InsuredId:       r.insuredId,
+		RecordTimestamp: r.recordTimestamp,
+		ValidFrom:       r.validFrom,
+		ValidTo:         r.validTo,
+	}
+}
+
+func (r addressRecord) toAddress() *entity.Address {
+	return &entity.Address{
+		ID:              r.id,
+		AddressId:       r.addressId,
+		Type:            r.addressType,
+		Address:         r.address,
+		Line1:           r.line1,
+		Line2:           r.line2,
+		City:            r.city,
+		Region:          r.region,
+		PostalCode:      r.postalCode,
+		Country:         r.country,
+		InsuredId:       r.insuredId,
+		RecordTimestamp: r.recordTimestamp,
+		ValidFrom:       r.validFrom,
+		ValidTo:         r.validTo,
+	}
+}
+
+func (r policyRecord) toPolicy() *entity.Policy {
+	return &entity.Policy{
+		ID:              r.policyId,
+		PolicyNumber:    r.policyNumber,
+		Term:            r.term,
+		EffectiveDate:   r.effectiveDate,
+		ExpirationDate:  r.expirationDate,
+		OccurrenceLimit: r.occurrenceLimit,
+		AggregateLimit:  r.aggregateLimit,
+		Premium:         r.premium,
+		InsuredId:       r.insuredId,
+		RecordTimestamp: r.recordTimestamp,
+		ValidFrom:       r.validFrom,
+		ValidTo:         r.validTo,
+	}
+}
+
+func (r claimRecord) toClaim() *entity.Claim {
+	return &entity.Claim{
+		ID:              r.claimId,
+		LossDate:        r.lossDate,
+		Description:     r.description,
+		Status:          r.status,
+		InsuredId:       r.insuredId,
+		RecordTimestamp: r.recordTimestamp,
+		ValidFrom:       r.validFrom,
+		ValidTo:         r.validTo,
+	}
+}
+
+// inForce returns true if the date of t is in the record's coverage period
+func (r policyRecord) inForce(t time.Time) bool {
+	date := shortDate(t.UTC())
+	return !r.effectiveDate.After(date) && r.expirationDate.After(date)
+}
+
+// covers returns true if the record is valid at asOfValid, as known at asOfRecorded, and not cancelled by then.
+// cancelled is when the record was cancelled, zero if it was not.
+func (v version) covers(asOfValid time.Time, asOfRecorded time.Time, cancelled time.Time) bool {
+	recorded, valid := asOfRecorded.Unix(), asOfValid.Unix()
+	return v.recordTimestamp.Unix() <= recorded &&
+		(cancelled.IsZero() || cancelled.Unix() > recorded) &&
+		v.validFrom.Unix() <= valid &&
+		(v.validTo.IsZero() || v.validTo.Unix() > valid)
+}
+
+// supersedes returns true if v wins over w when both cover a time:
+// the latest valid_from wins, then the latest record_timestamp, then the latest id
+func (v version) supersedes(w version) bool {
+	if !v.validFrom.Equal(w.validFrom) {
+		return v.validFrom.After(w.validFrom)
+	}
+	if !v.recordTimestamp.Equal(w.recordTimestamp) {
+		return v.recordTimestamp.After(w.recordTimestamp)
+	}
+	return v.id > w.id
+}
+
+// pending returns true if the record was recorded by asOf, takes effect after asOf, and is not cancelled.
+// cancelled is when the record was cancelled, zero if it was not.
+func (v version) pending(asOf time.Time, cancelled time.Time) bool {
+	return v.recordTimestamp.Unix() <= asOf.Unix() && v.validFrom.Unix() > asOf.Unix() && cancelled.IsZero()
+}
+
+// cancelledAt returns when the record of the records table was first cancelled, zero if it was not
+func (db *DB) cancelledAt(table string, recordId int) (cancelled time.Time) {
+	for _, c := range db.cancellations {
+		if c.table == table && c.recordId == recordId && (cancelled.IsZero() || c.recordTimestamp.Before(cancelled)) {
+			cancelled = c.recordTimestamp
+		}
+	}
+	return cancelled
+}
+
+func (db *DB) GetById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (record entity.InsuredInterface, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.getById(insuredObj, id)
+}
+
+func (db *DB) getById(insuredObj entity.InsuredInterface, id int64) (record entity.InsuredInterface, err error) {
+	if id == 0 {
+		return record, ErrRecordDoesNotExist
+	}
+	switch insuredObj.(type) {
+	case *entity.Insured:
+		return db.getInsuredById(id)
+	case *entity.Employee:
+		now := db.Now()
+		return db.getEmployeeByBitemporalDate(id, now, now), nil
+	case *entity.Address:
+		return db.getAddressById(id), nil
+	case *entity.Policy:
+		now := db.Now()
+		policy := db.getPolicyByBitemporalDate(id, now, now)
+		if policy.ID != 0 && db.insuredDeletedAt(int64(policy.InsuredId), now, now) {
+			return &entity.Policy{}, nil
+		}
+		return policy, nil
+	case *entity.Claim:
+		now := db.Now()
+		return db.getClaimByBitemporalDate(id, now, now), nil
+	}
+	return nil, err
+}
+
+// GetInsuredById returns the insured record for this Id. Deleted insureds do not exist.
+func (db *DB) GetInsuredById(ctx context.Context, insured entity.Insured, id int64) (*entity.Insured, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.getInsuredById(id)
+}
+
+func (db *DB) getInsuredById(id int64) (*entity.Insured, error) {
+	row, ok := db.findInsured(id)
+	if !ok {
+		return &entity.Insured{}, ErrRecordDoesNotExist
+	}
+	now := db.Now()
+	if db.insuredDeletedAt(id, now, now) {
+		return &entity.Insured{}, ErrRecordDoesNotExist
+	}
+	return row.insured(), nil
+}
+
+// findInsured returns the insured row for this Id, deleted or not
+func (db *DB) findInsured(id int64) (insuredRow, bool) {
+	for _, row := range db.insureds {
+		if int64(row.id) == id {
+			return row, true
+		}
+	}
+	return insuredRow{}, false
+}
+
+// GetEmployeeById returns the employee record for this Id that is valid now
+func (db *DB) GetEmployeeById(ctx context.Context, employee entity.Employee, id int64) (*entity.Employee, error) {
+	now := db.Now()
+	return db.GetEmployeeByBitemporalDate(ctx, employee, id, now, now)
+}
+
+// GetEmployeeByBitemporalDate returns the employee record for this Id valid at asOfValid, as known at asOfRecorded
+// Returned employee has ID 0 if there is no such record.
+func (db *DB) GetEmployeeByBitemporalDate(ctx context.Context, employee entity.Employee, id int64, asOfValid time.Time, asOfRecorded time.Time) (*entity.Employee, error) {
+	if id == 0 {
+		return &entity.Employee{}, ErrRecordDoesNotExist
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.getEmployeeByBitemporalDate(id, asOfValid, asOfRecorded), nil
+}
+
+func (db *DB) getEmployeeByBitemporalDate(id int64, asOfValid time.Time, asOfRecorded time.Time) *entity.Employee {
+	records := db.employeesAt(asOfValid, asOfRecorded, func(r employeeRecord) bool {
+		return int64(r.employeeId) == id
+	})
+	if len(records) == 0 {
+		return &entity.Employee{}
+	}
+	return records[0].employee()
+}
+
+// GetPolicyByBitemporalDate returns the policy's record valid at asOfValid, as known at asOfRecorded.
+// Returned policy has ID 0 if there is no such record.
+func (db *DB) GetPolicyByBitemporalDate(ctx context.Context, policy entity.Policy, id int64, asOfValid time.Time, asOfRecorded time.Time) (*entity.Policy, error) {
+	if id == 0 {
+		return &entity.Policy{}, ErrRecordDoesNotExist
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.getPolicyByBitemporalDate(id, asOfValid, asOfRecorded), nil
+}
+
+func (db *DB) getPolicyByBitemporalDate(id int64, asOfValid time.Time, asOfRecorded time.Time) *entity.Policy {
+	records := db.policiesAt(asOfValid, asOfRecorded, func(r policyRecord) bool {
+		return int64(r.policyId) == id
+	})
+	if len(records) == 0 {
+		return &entity.Policy{}
+	}
+	return records[0].toPolicy()
+}
+
+// GetClaimByBitemporalDate returns the claim's record valid at asOfValid, as known at asOfRecorded.
+// Returned claim has ID 0 if there is no such record.
+func (db *DB) GetClaimByBitemporalDate(ctx context.Context, claim entity.Claim, id int64, asOfValid time.Time, asOfRecorded time.Time) (*entity.Claim, error) {
+	if id == 0 {
+		return &entity.Claim{}, ErrRecordDoesNotExist
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.getClaimByBitemporalDate(id, asOfValid, asOfRecorded), nil
+}
+
+func (db *DB) getClaimByBitemporalDate(id int64, asOfValid time.Time, asOfRecorded time.Time) *entity.Claim {
+	records := db.claimsAt(asOfValid, asOfRecorded, func(r claimRecord) bool {
+		return int64(r.claimId) == id
+	})
+	if len(records) == 0 {
+		return &entity.Claim{}
+	}
+	return records[0].toClaim()
+}
+
+// GetAddressById returns the address record for this Id, if the address is not deleted.
+// Returned address has ID 0 if there is no such record.
+func (db *DB) GetAddressById(ctx context.Context, address entity.Address, id int64) (*entity.Address, error) {
+	if id == 0 {
+		return &entity.Address{}, ErrRecordDoesNotExist
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.getAddressById(id), nil
+}
+
+func (db *DB) getAddressById(id int64) *entity.Address {
+	for _, r := range db.addressRecords {
+		if int64(r.id) == id && db.addressNotDeleted(r) {
+			return r.toAddress()
+		}
+	}
+	return &entity.Address{}
+}
+
+// employeesAt returns the record of each employee that covers asOfValid, as known at asOfRecorded, in employee id order.
+// Deleted employees are left out. keep restricts the records, and may be nil.
+func (db *DB) employeesAt(asOfValid time.Time, asOfRecorded time.Time, keep func(r employeeRecord) bool) []employeeRecord {
+	latest := make(map[int]employeeRecord)
+	for _, r := range db.employeeRecords {
+		if (keep != nil && !keep(r)) || !r.covers(asOfValid, asOfRecorded, db.cancelledAt("employees_records", r.id)) {
+			continue
+		}
+		if l, ok := latest[r.employeeId]; !ok || r.supersedes(l.version) {
+			latest[r.employeeId] = r
+		}
+	}
+	records := []employeeRecord{}
+	for _, r := range latest {
+		if !r.tombstone {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].employeeId < records[j].employeeId
+	})
+	return records
+}
+
+// addressesAt returns the record of each address that covers asOfValid, as known at asOfRecorded, in address id order.
+// Deleted addresses are left out. keep restricts the records, and may be nil.
+func (db *DB) addressesAt(asOfValid time.Time, asOfRecorded time.Time, keep func(r addressRecord) bool) []addressRecord {
+	latest := make(map[int]addressRecord)
+	for _, r := range db.addressRecords {
+		if (keep != nil && !keep(r)) || !r.covers(asOfValid, asOfRecorded, db.cancelledAt("insured_addresses_records", r.id)) {
+			continue
+		}
+		if l, ok := latest[r.addressId]; !ok || r.supersedes(l.version) {
+			latest[r.addressId] = r
+		}
+	}
+	records := []addressRecord{}
+	for _, r := range latest {
+		if !r.tombstone {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].addressId < records[j].addressId
+	})
+	return records
+}
+
+// policiesAt returns the record of each policy that covers asOfValid, as known at asOfRecorded, in policy id order.
+// Deleted policies are left out. keep restricts the records, and may be nil.
+func (db *DB) policiesAt(asOfValid time.Time, asOfRecorded time.Time, keep func(r policyRecord) bool) []policyRecord {
+	latest := make(map[int]policyRecord)
+	for _, r := range db.policyRecords {
+		if (keep != nil && !keep(r)) || !r.covers(asOfValid, asOfRecorded, db.cancelledAt("policies_records", r.id)) {
+			continue
+		}
+		if l, ok := latest[r.policyId]; !ok || r.supersedes(l.version) {
+			latest[r.policyId] = r
+		}
+	}
+	records := []policyRecord{}
+	for _, r := range latest {
+		if !r.tombstone {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].policyId < records[j].policyId
+	})
+	return records
+}
+
+// claimsAt returns the record of each claim that covers asOfValid, as known at asOfRecorded, in claim id order.
+// keep restricts the records, and may be nil.
+func (db *DB) claimsAt(asOfValid time.Time, asOfRecorded time.Time, keep func(r claimRecord) bool) []claimRecord {
+	latest := make(map[int]claimRecord)
+	for _, r := range db.claimRecords {
+		if (keep != nil && !keep(r)) || !r.covers(asOfValid, asOfRecorded, time.Time{}) { // claims are not cancelled
+			continue
+		}
+		if l, ok := latest[r.claimId]; !ok || r.supersedes(l.version) {
+			latest[r.claimId] = r
+		}
+	}
+	records := []claimRecord{}
+	for _, r := range latest {
+		if !r.tombstone {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].claimId < records[j].claimId
+	})
+	return records
+}
+
+// Get Insured entity with component employees and addresses valid at a particular date.
+func (db *DB) GetInsuredByDate(ctx context.Context, insuredId int64, date time.Time) (insured entity.Insured, err error) {
+	return db.GetInsuredByBitemporalDate(ctx, insuredId, date, date)
+}
+
+// GetInsuredByBitemporalDate is GetInsuredByDate with separate valid time and transaction time.
+func (db *DB) GetInsuredByBitemporalDate(ctx context.Context, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (insured entity.Insured, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.getInsuredByBitemporalDate(insuredId, asOfValid, asOfRecorded)
+}
+
+func (db *DB) getInsuredByBitemporalDate(insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (insured entity.Insured, err error) {
+	if insuredId == 0 {
+		return insured, ErrRecordDoesNotExist
+	}
+	row, ok := db.findInsured(insuredId)
+	if !ok || db.insuredDeletedAt(insuredId, asOfValid, asOfRecorded) {
+		return entity.Insured{}, ErrRecordDoesNotExist
+	}
+	insured = *row.insured()
+	employees, err := entity.EmployeesFromInsuredInterface(db.getByBitemporalDate(&entity.Employee{}, insuredId, asOfValid, asOfRecorded))
+	if err != nil {
+		return entity.Insured{}, err
+	}
+	addresses, err := entity.AddressesFromInsuredInterface(db.getByBitemporalDate(&entity.Address{}, insuredId, asOfValid, asOfRecorded))
+	if err != nil {
+		return entity.Insured{}, err
+	}
+	insured.Employees = &employees
+	insured.Addresses = &addresses
+	return insured, nil
+}
+
+// GetAll returns all insureds or address records. Employees and policies are returned as they are now,
+// so scheduled and cancelled employee and policy records are not included.
+func (db *DB) GetAll(ctx context.Context, entityType entity.InsuredInterface) (records map[int]entity.InsuredInterface, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	records = make(map[int]entity.InsuredInterface)
+	switch entityType.(type) {
+	case *entity.Insured:
+		for _, row := range db.insureds {
+			if db.insuredNotDeleted(row.id) {
+				records[len(records)] = row.insured()
+			}
+		}
+	case *entity.Address:
+		for _, r := range db.addressRecords {
+			if db.addressNotDeleted(r) {
+				records[len(records)] = r.toAddress()
+			}
+		}
+	case *entity.Employee:
+		now := db.Now()
+		for _, r := range db.employeesAt(now, now, nil) {
+			records[len(records)] = r.employee()
+		}
+	case *entity.Policy:
+		now := db.Now()
+		for _, r := range db.policiesAt(now, now, func(r policyRecord) bool { return db.insuredNotDeleted(r.insuredId) }) {
+			records[len(records)] = r.toPolicy()
+		}
+	default:
+		return nil, fmt.Errorf("Query failed")
+	}
+	return records, nil
+}
+
+// GetAllByEntityId returns every record of the entity, except tombstones
+func (db *DB) GetAllByEntityId(ctx context.Context, entityType entity.InsuredInterface, entityId int64) (records map[int]entity.InsuredInterface, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	records = make(map[int]entity.InsuredInterface)
+	switch entityType.(type) {
+	case *entity.Employee:
+		for _, r := range db.employeeRecords {
+			if int64(r.employeeId) == entityId && !r.tombstone {
+				records[len(records)] = r.employee()
+			}
+		}
+	case *entity.Insured:
+		if row, ok := db.findInsured(entityId); ok {
+			records[0] = row.insured()
+		}
+	case *entity.Address:
+		for _, r := range db.addressRecords {
+			if int64(r.id) == entityId && !r.tombstone {
+				records[len(records)] = r.toAddress()
+			}
+		}
+	case *entity.Policy:
+		for _, r := range db.policyRecords {
+			if int64(r.policyId) == entityId && !r.tombstone {
+				records[len(records)] = r.toPolicy()
+			}
+		}
+	case *entity.Claim:
+		for _, r := range db.claimRecords {
+			if int64(r.claimId) == entityId && !r.tombstone {
+				records[len(records)] = r.toClaim()
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Query failed")
+	}
+	return records, nil
+}
+
+// GetByDate returns the records for insuredId valid at date, as they were known at date.
+func (db *DB) GetByDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, naturalKey string, insuredId int64, date time.Time) (records map[int]entity.InsuredInterface, err error) {
+	return db.GetByBitemporalDate(ctx, insuredIfaceObj, insuredId, date, date)
+}
+
+// GetByBitemporalDate returns the records for insuredId that were true at asOfValid (valid time),
+// as the system knew them at asOfRecorded (transaction time).
+// Of the records covering asOfValid, the one with the latest valid_from wins, then the latest record_timestamp.
+// Policies are returned if they are in force at asOfValid, and the insured is not deleted.
+func (db *DB) GetByBitemporalDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (records map[int]entity.InsuredInterface, err error) {
+	if insuredId == 0 {
+		return records, ErrRecordDoesNotExist
+	}
+	switch insuredIfaceObj.(type) {
+	case *entity.Employee, *entity.Address, *entity.Policy, *entity.Claim:
+	default:
+		return records, fmt.Errorf("Query failed")
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.getByBitemporalDate(insuredIfaceObj, insuredId, asOfValid, asOfRecorded), nil
+}
+
+// getByBitemporalDate returns the insured's employees, addresses, policies in force, or claims at asOfValid, as known at asOfRecorded
+func (db *DB) getByBitemporalDate(insuredIfaceObj entity.InsuredInterface, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) map[int]entity.InsuredInterface {
+	records := make(map[int]entity.InsuredInterface)
+	switch insuredIfaceObj.(type) {
+	case *entity.Employee:
+		for _, r := range db.employeesAt(asOfValid, asOfRecorded, func(r employeeRecord) bool { return int64(r.insuredId) == insuredId }) {
+			records[len(records)] = r.employee()
+		}
+	case *entity.Address:
+		for _, r := range db.addressesAt(asOfValid, asOfRecorded, func(r addressRecord) bool { return int64(r.insuredId) == insuredId }) {
+			records[len(records)] = r.toAddress()
+		}
+	case *entity.Policy:
+		if db.insuredDeletedAt(insuredId, asOfValid, asOfRecorded) {
+			break
+		}
+		for _, r := range db.policiesAt(asOfValid, asOfRecorded, func(r policyRecord) bool { return int64(r.insuredId) == insuredId }) {
+			if r.inForce(asOfValid) {
+				records[len(records)] = r.toPolicy()
+			}
+		}
+	case *entity.Claim:
+		for _, r := range db.claimsAt(asOfValid, asOfRecorded, func(r claimRecord) bool { return int64(r.insuredId) == insuredId }) {
+			records[len(records)] = r.toClaim()
+		}
+	}
+	return records
+}
+
+// nextId returns the next id of the table
+func (db *DB) nextId(table string) int {
+	db.lastIds[table]++
+	return db.lastIds[table]
+}
+
+// unixTime returns t to the second, in UTC, as the databases return it
+func unixTime(t time.Time) time.Time {
+	return time.Unix(t.Unix(), 0).UTC()
+}
+
+// shortDate returns the date of t, as the databases return a date stored as "2006-01-02"
+func shortDate(t time.Time) time.Time {
+	date, _ := time.Parse("2006-01-02", t.Format("2006-01-02"))
+	return date
+}
+
+// validFrom returns the valid_from value for a new record.
+// Records without an explicit valid time become valid when they are recorded.
+func validFrom(validFrom time.Time, recordTimestamp time.Time) time.Time {
+	if validFrom.IsZero() {
+		return unixTime(recordTimestamp)
+	}
+	return unixTime(validFrom)
+}
+
+// validTo returns the valid_to value for a new record. Zero if open-ended.
+func validTo(validTo time.Time) time.Time {
+	if validTo.IsZero() {
+		return time.Time{}
+	}
+	return unixTime(validTo)
+}
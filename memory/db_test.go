@@ -0,0 +1,745 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/memory"
+	"github.com/nickcoast/timetravel/seed"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// Ensure the test database can open & close.
+func TestDB(t *testing.T) {
+	db := MustOpenDB(t, "demo")
+	MustCloseDB(t, db)
+}
+
+// MustOpenDB returns a new DB with the fixture set named, e.g. "demo". None if empty.
+func MustOpenDB(tb testing.TB, fixtures string) *memory.DB {
+	tb.Helper()
+	db := memory.NewDB()
+	if fixtures != "" {
+		MustSeed(tb, db, fixtures)
+	}
+	return db
+}
+
+// MustSeed adds the fixture set named, e.g. "demo", through the service. Fatal on error.
+func MustSeed(tb testing.TB, db service.Store, name string) {
+	tb.Helper()
+	set, err := seed.Load(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := service.NewSqliteRecordService(db)
+	if err := s.Seed(context.Background(), set); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// MustCloseDB closes the DB. Fatal on error.
+func MustCloseDB(tb testing.TB, db *memory.DB) {
+	tb.Helper()
+	if err := db.Close(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// MustCreateInsured creates an insured in the database. Fatal on error.
+func MustCreateInsured(tb testing.TB, ctx context.Context, db *memory.DB, insured *entity.Insured) entity.Insured {
+	tb.Helper()
+	if _, err := db.CreateInsured(ctx, insured); err != nil {
+		tb.Fatal(err)
+	}
+	return *insured
+}
+
+// MustCreateAddress creates an address in the database. Fatal on error.
+func MustCreateAddress(tb testing.TB, ctx context.Context, db *memory.DB, address *entity.Address) {
+	tb.Helper()
+	if _, err := db.CreateAddress(ctx, address); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// Temporal reads give the same results for the fixtures as in package sqlite
+func TestQuery_Fixtures(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	tb.Run("GetAll", func(tb *testing.T) {
+		for _, tt := range []struct {
+			obj  entity.InsuredInterface
+			want int
+		}{
+			{&entity.Insured{}, 2},
+			{&entity.Employee{}, 5},
+			{&entity.Address{}, 4},
+		} {
+			records, err := db.GetAll(ctx, tt.obj)
+			if err != nil {
+				tb.Fatal(err)
+			} else if got := len(records); got != tt.want {
+				tb.Fatalf("%T: len=%v, want %v", tt.obj, got, tt.want)
+			}
+		}
+	})
+	tb.Run("GetAllByEntityId", func(tb *testing.T) {
+		records, err := db.GetAllByEntityId(ctx, &entity.Employee{}, 2)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := len(records), 3; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		}
+	})
+	tb.Run("GetById", func(tb *testing.T) {
+		address, err := db.GetAddressById(ctx, entity.Address{}, 3)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := address.InsuredId, 1; got != want {
+			tb.Fatalf("InsuredId=%v, want %v", got, want)
+		}
+		insured, err := db.GetInsuredById(ctx, entity.Insured{}, 2)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := insured.PolicyNumber, 1001; got != want {
+			tb.Fatalf("PolicyNumber=%v, want %v", got, want)
+		}
+	})
+	tb.Run("GetByDate", func(tb *testing.T) {
+		for _, tt := range []struct {
+			timestamp int64
+			employees []string
+			address   string
+		}{
+			{468072000, []string{"1984-10-01 0001-01-01"}, "123 Fake St, Springfield, Oregon"},
+			{469368001, []string{"1984-10-01 0001-01-01", "1984-11-10 0001-01-01"}, "123 REAL St, Springfield, Oregon"},
+			{820584000, []string{"1984-10-01 0001-01-01", "1984-11-10 1996-01-02"}, ""},
+			{852206401, []string{"1984-10-01 0001-01-01", "1984-11-10 1996-06-01"}, "Mars"},
+		} {
+			date := time.Unix(tt.timestamp, 0)
+			records, err := db.GetByDate(ctx, &entity.Employee{}, "", 1, date)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			var employees []string
+			for _, record := range records {
+				employee := record.(*entity.Employee)
+				employees = append(employees, employee.StartDate.Format("2006-01-02")+" "+employee.EndDate.Format("2006-01-02"))
+			}
+			sort.Strings(employees)
+			if got, want := strings.Join(employees, ","), strings.Join(tt.employees, ","); got != want {
+				tb.Fatalf("%v: Employees=%v, want %v", tt.timestamp, got, want)
+			}
+			if tt.address == "" {
+				continue
+			}
+			records, err = db.GetByDate(ctx, &entity.Address{}, "", 1, date)
+			if err != nil {
+				tb.Fatal(err)
+			} else if got, want := len(records), 1; got != want {
+				tb.Fatalf("%v: len(Addresses)=%v, want %v", tt.timestamp, got, want)
+			} else if got := records[0].(*entity.Address).Address; got != tt.address {
+				tb.Fatalf("%v: Address=%v, want %v", tt.timestamp, got, tt.address)
+			}
+		}
+	})
+}
+
+func TestDB_Create(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second).Add(-time.Minute) // so the update a second later is not in the future
+
+	insured := MustCreateInsured(tb, ctx, db, &entity.Insured{Name: "sue", RecordTimestamp: now})
+	if got, want := insured.ID, 3; got != want {
+		tb.Fatalf("ID=%v, want %v", got, want)
+	} else if got, want := insured.PolicyNumber, 1002; got != want {
+		tb.Fatalf("PolicyNumber=%v, want %v", got, want)
+	}
+
+	startDate, _ := time.Parse("2006-01-02", "2020-01-01")
+	employee := &entity.Employee{Name: "Sue", StartDate: startDate, InsuredId: insured.ID, RecordTimestamp: now}
+	if _, err := db.CreateEmployee(ctx, employee); err != nil {
+		tb.Fatal(err)
+	} else if got, want := employee.ID, 6; got != want {
+		tb.Fatalf("ID=%v, want %v", got, want)
+	}
+	if _, err := db.UpdateEmployee(ctx, employee); err != memory.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrUpdateMustChangeAValue)
+	}
+	updated := *employee
+	updated.Name = "Sue Smith"
+	updated.RecordTimestamp = now.Add(time.Second)
+	if _, err := db.UpdateEmployee(ctx, &updated); err != nil {
+		tb.Fatal(err)
+	}
+	current, err := db.GetEmployeeById(ctx, entity.Employee{}, int64(employee.ID))
+	if err != nil {
+		tb.Fatal(err)
+	} else if got, want := current.Name, "Sue Smith"; got != want {
+		tb.Fatalf("Name=%v, want %v", got, want)
+	}
+
+	MustCreateAddress(tb, ctx, db, &entity.Address{Address: "1 Main Street", InsuredId: insured.ID, RecordTimestamp: now})
+	if count, err := db.CountInsuredAddresses(ctx, insured); err != nil {
+		tb.Fatal(err)
+	} else if count != 1 {
+		tb.Fatalf("count=%v, want 1", count)
+	}
+}
+
+func TestDB_GetByBitemporalDate(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	// Learned today that insured 1 was at a different address from 1990 on
+	validFrom, _ := time.Parse("2006-01-02", "1990-01-01")
+	now := time.Now().UTC().Truncate(time.Second)
+	MustCreateAddress(tb, ctx, db, &entity.Address{AddressId: 1, Address: "742 Evergreen Terrace", InsuredId: 1, RecordTimestamp: now, ValidFrom: validFrom})
+
+	asOfValid, _ := time.Parse("2006-01-02", "1995-01-01")
+	known, _ := time.Parse("2006-01-02", "2000-01-01")
+	for _, tt := range []struct {
+		known time.Time
+		want  string
+	}{
+		{known, "123 REAL St, Springfield, Oregon"},
+		{now, "742 Evergreen Ter"},
+	} {
+		records, err := db.GetByBitemporalDate(ctx, &entity.Address{}, 1, asOfValid, tt.known)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		addresses, _ := entity.AddressesFromInsuredInterface(records)
+		if got, want := len(addresses), 1; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		} else if got := addresses[0].Address; got != tt.want {
+			tb.Fatalf("known %v: Address=%v, want %v", tt.known, got, tt.want)
+		}
+	}
+}
+
+// Job class code, payroll, and work location are compared by updates, and replayed from events
+func TestDB_EmployeeRating(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	date := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02", value)
+		return t
+	}
+	hired, raised := date("2000-01-01"), date("2001-01-01")
+	employee := &entity.Employee{Name: "Estimator", StartDate: hired, InsuredId: 1, JobClassCode: "8810", AnnualPayroll: 5200000, WorkLocation: "Springfield", RecordTimestamp: hired}
+	if _, err := db.CreateEmployee(ctx, employee); err != nil {
+		tb.Fatal(err)
+	}
+	same := *employee
+	same.RecordTimestamp = raised
+	if _, err := db.UpdateEmployee(ctx, &same); err != memory.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrUpdateMustChangeAValue)
+	}
+	raise := same
+	raise.AnnualPayroll = 6000000
+	if _, err := db.UpdateEmployee(ctx, &raise); err != nil {
+		tb.Fatal(err)
+	}
+
+	replayed := MustOpenDB(tb, "")
+	defer MustCloseDB(tb, replayed)
+	if err := replayed.Apply(db.Events()...); err != nil {
+		tb.Fatal(err)
+	}
+	for _, db := range []*memory.DB{db, replayed} {
+		history, err := db.GetAllByEntityId(ctx, &entity.Employee{}, int64(employee.ID))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		got := []string{}
+		for i := 0; i < len(history); i++ {
+			e := history[i].(*entity.Employee)
+			got = append(got, fmt.Sprintf("%s %d %s", e.JobClassCode, e.AnnualPayroll, e.WorkLocation))
+		}
+		if want := "[8810 5200000 Springfield 8810 6000000 Springfield]"; fmt.Sprint(got) != want {
+			tb.Fatalf("history=%v, want %v", got, want)
+		}
+	}
+}
+
+// An insured's addresses of different types have independent histories
+func TestDB_Addresses(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	created, _ := time.Parse("2006-01-02", "2000-01-01")
+	moved, _ := time.Parse("2006-01-02", "2001-01-01")
+	deleted, _ := time.Parse("2006-01-02", "2002-01-01")
+	billing := entity.Address{Type: entity.AddressBilling, Address: "1 Billing Lane", InsuredId: 1, RecordTimestamp: created}
+	MustCreateAddress(tb, ctx, db, &billing)
+	if got, want := billing.AddressId, 2; got != want {
+		tb.Fatalf("AddressId=%v, want %v", got, want)
+	}
+	if _, err := db.UpdateAddress(ctx, &entity.Address{AddressId: billing.AddressId, Address: "2 Billing Lane", InsuredId: 1, RecordTimestamp: moved}); err != nil {
+		tb.Fatal(err)
+	}
+	// which address?
+	if _, err := db.UpdateAddress(ctx, &entity.Address{Address: "Venus", InsuredId: 1, RecordTimestamp: moved}); err != memory.ErrRecordIDInvalid {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrRecordIDInvalid)
+	}
+	db.Now = func() time.Time { return deleted }
+	if _, err := db.DeleteById(ctx, &entity.Address{}, int64(billing.ID)); err != nil {
+		tb.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		asOf time.Time
+		want map[string]string
+	}{
+		{created.Add(-time.Second), map[string]string{entity.AddressMailing: "Mars"}},
+		{created, map[string]string{entity.AddressMailing: "Mars", entity.AddressBilling: "1 Billing Ln"}},
+		{moved, map[string]string{entity.AddressMailing: "Mars", entity.AddressBilling: "2 Billing Ln"}},
+		{deleted, map[string]string{entity.AddressMailing: "Mars"}},
+	} {
+		insured, err := db.GetInsuredByDate(ctx, 1, tt.asOf)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		got := map[string]string{}
+		for _, address := range *insured.Addresses {
+			got[address.Type] = address.Address
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			tb.Fatalf("%v: addresses=%v, want %v", tt.asOf, got, tt.want)
+		}
+	}
+}
+
+// Addresses are stored as normalized fields. Events from before addresses had fields are split when applied.
+func TestDB_StructuredAddress(tb *testing.T) {
+	db := MustOpenDB(tb, "")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	created, _ := time.Parse("2006-01-02", "2000-01-01")
+	if err := db.Apply(
+		memory.Event{Type: memory.EventInsuredCreated, Id: 1, Name: "Jimmy Temelpa", PolicyNumber: 1000, RecordTimestamp: created.Unix()},
+		memory.Event{Type: memory.EventAddressChanged, Id: 1, InsuredId: 1, Address: "123 Fake Street, Springfield, OR 97477", RecordTimestamp: created.Unix(), ValidFrom: created.Unix()},
+	); err != nil {
+		tb.Fatal(err)
+	}
+	insured, err := db.GetInsuredByDate(ctx, 1, created)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, address := range *insured.Addresses {
+		if got, want := fmt.Sprint(address.Line1, "|", address.City, "|", address.Region, "|", address.PostalCode), "123 Fake Street|Springfield|OR|97477"; got != want {
+			tb.Fatalf("fields=%v, want %v", got, want)
+		}
+	}
+
+	// the same address, written differently
+	same := &entity.Address{Address: "123 fake st., springfield, or 97477", InsuredId: 1, RecordTimestamp: created.Add(time.Hour)}
+	if _, err := db.UpdateAddress(ctx, same); err != memory.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrUpdateMustChangeAValue)
+	}
+	moved := &entity.Address{Line1: "24 Sussex Drive", City: "Ottawa", Region: "ontario", PostalCode: "k1m1m4", Country: "Canada", InsuredId: 1, RecordTimestamp: created.Add(time.Hour)}
+	if _, err := db.UpdateAddress(ctx, moved); err != nil {
+		tb.Fatal(err)
+	}
+	if got, want := moved.Address, "24 Sussex Dr, Ottawa, ON K1M 1M4, CA"; got != want {
+		tb.Fatalf("Address=%v, want %v", got, want)
+	}
+	invalid := &entity.Address{Line1: "24 Sussex Dr", City: "Ottawa", Region: "ON", PostalCode: "12345", Country: "CA", InsuredId: 1}
+	if _, err := db.CreateAddress(ctx, invalid); entity.ErrorCode(err) != entity.EINVALID {
+		tb.Fatalf("err=%v, want %v", err, entity.EINVALID)
+	}
+}
+
+// Renewals are records of the next term. Policies replay from their events.
+func TestDB_Policies(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	date := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02", value)
+		return t
+	}
+	created, endorsed, renewed, deleted := date("2000-01-01"), date("2000-07-01"), date("2000-12-01"), date("2001-06-01")
+	policy := &entity.Policy{InsuredId: 1, EffectiveDate: created, ExpirationDate: date("2001-01-01"), OccurrenceLimit: 100000000, AggregateLimit: 200000000, Premium: 125000, RecordTimestamp: created}
+	if _, err := db.CreatePolicy(ctx, policy); err != nil {
+		tb.Fatal(err)
+	}
+	if got, want := policy.PolicyNumber, 1000; got != want {
+		tb.Fatalf("PolicyNumber=%v, want %v", got, want)
+	}
+	same := *policy
+	same.RecordTimestamp = endorsed
+	if _, err := db.UpdatePolicy(ctx, &same); err != memory.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrUpdateMustChangeAValue)
+	}
+	endorsement := *policy
+	endorsement.Premium, endorsement.RecordTimestamp = 150000, endorsed
+	if _, err := db.UpdatePolicy(ctx, &endorsement); err != nil {
+		tb.Fatal(err)
+	}
+	renewal := endorsement.Renew()
+	renewal.RecordTimestamp, renewal.ValidFrom = renewed, renewal.EffectiveDate
+	if _, err := db.UpdatePolicy(ctx, &renewal); err != nil {
+		tb.Fatal(err)
+	}
+
+	replayed := MustOpenDB(tb, "")
+	defer MustCloseDB(tb, replayed)
+	if err := replayed.Apply(db.Events()...); err != nil {
+		tb.Fatal(err)
+	}
+	for _, db := range []*memory.DB{db, replayed} {
+		for _, tt := range []struct {
+			asOf time.Time
+			want string
+		}{
+			{created.Add(-time.Second), "[]"},
+			{date("2000-03-01"), "[1:125000]"},
+			{date("2000-08-01"), "[1:150000]"},
+			{date("2001-03-01"), "[2:150000]"},
+			{date("2002-03-01"), "[]"},
+		} {
+			records, err := db.GetByBitemporalDate(ctx, &entity.Policy{}, 1, tt.asOf, tt.asOf)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			got := []string{}
+			for _, record := range records {
+				p := record.(*entity.Policy)
+				got = append(got, fmt.Sprintf("%d:%d", p.Term, p.Premium))
+			}
+			if fmt.Sprint(got) != tt.want {
+				tb.Fatalf("%v: policies=%v, want %v", tt.asOf, got, tt.want)
+			}
+		}
+	}
+
+	db.Now = func() time.Time { return deleted }
+	if _, err := db.DeleteById(ctx, &entity.Policy{}, int64(policy.ID)); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := db.UpdatePolicy(ctx, &endorsement); err != memory.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrRecordDoesNotExist)
+	}
+	if history, err := db.GetAllByEntityId(ctx, &entity.Policy{}, int64(policy.ID)); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(history), 3; got != want {
+		tb.Fatalf("len(history)=%v, want %v", got, want)
+	}
+	if err := db.PurgeById(ctx, &entity.Policy{}, int64(policy.ID)); err != nil {
+		tb.Fatal(err)
+	}
+	if history, err := db.GetAllByEntityId(ctx, &entity.Policy{}, int64(policy.ID)); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(history), 0; got != want {
+		tb.Fatalf("len(history)=%v, want %v", got, want)
+	}
+}
+
+// Each change to a claim is a record. Claims replay from their events.
+func TestDB_Claims(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	date := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02", value)
+		return t
+	}
+	reported, investigated, denied := date("2000-01-02"), date("2000-02-01"), date("2000-03-01")
+	claim := &entity.Claim{InsuredId: 1, LossDate: date("2000-01-01"), Description: "Fire", RecordTimestamp: reported}
+	if _, err := db.CreateClaim(ctx, claim); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := db.CreateClaim(ctx, &entity.Claim{InsuredId: 9, LossDate: date("2000-01-01"), Description: "Flood", RecordTimestamp: reported}); err != memory.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrRecordDoesNotExist)
+	}
+	same := *claim
+	same.RecordTimestamp = investigated
+	if _, err := db.UpdateClaim(ctx, &same); err != memory.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrUpdateMustChangeAValue)
+	}
+	for _, change := range []struct {
+		status string
+		at     time.Time
+	}{
+		{entity.ClaimInvestigating, investigated},
+		{entity.ClaimDenied, denied},
+	} {
+		update := *claim
+		update.Status, update.RecordTimestamp = change.status, change.at
+		if _, err := db.UpdateClaim(ctx, &update); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	replayed := MustOpenDB(tb, "")
+	defer MustCloseDB(tb, replayed)
+	if err := replayed.Apply(db.Events()...); err != nil {
+		tb.Fatal(err)
+	}
+	for _, db := range []*memory.DB{db, replayed} {
+		for _, tt := range []struct {
+			asOf time.Time
+			want string
+		}{
+			{reported.Add(-time.Second), "[]"},
+			{reported, "[open]"},
+			{investigated, "[investigating]"},
+			{denied, "[denied]"},
+		} {
+			records, err := db.GetByBitemporalDate(ctx, &entity.Claim{}, 1, tt.asOf, tt.asOf)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			got := []string{}
+			for _, record := range records {
+				got = append(got, record.(*entity.Claim).Status)
+			}
+			if fmt.Sprint(got) != tt.want {
+				tb.Fatalf("%v: statuses=%v, want %v", tt.asOf, got, tt.want)
+			}
+		}
+		if history, err := db.GetAllByEntityId(ctx, &entity.Claim{}, int64(claim.ID)); err != nil {
+			tb.Fatal(err)
+		} else if got, want := len(history), 3; got != want {
+			tb.Fatalf("len(history)=%v, want %v", got, want)
+		}
+	}
+
+	if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	if history, err := db.GetAllByEntityId(ctx, &entity.Claim{}, int64(claim.ID)); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(history), 0; got != want {
+		tb.Fatalf("len(history)=%v, want %v", got, want)
+	}
+}
+
+func TestDB_DeleteById(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	deletedAt, _ := time.Parse("2006-01-02", "2010-01-01")
+	db.Now = func() time.Time { return deletedAt }
+	before, _ := time.Parse("2006-01-02", "2009-01-01")
+	after, _ := time.Parse("2006-01-02", "2011-01-01")
+
+	if _, err := db.DeleteById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	if insured, err := db.GetInsuredByDate(ctx, 1, before); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(*insured.Employees), 2; got != want {
+		tb.Fatalf("len(Employees)=%v, want %v", got, want)
+	}
+	if _, err := db.GetInsuredByDate(ctx, 1, after); err != memory.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrRecordDoesNotExist)
+	}
+	if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != memory.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrRecordDoesNotExist)
+	}
+}
+
+// Purging an address removes every record of it and its tombstones, as of any time
+func TestDB_PurgeAddress(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	created, _ := time.Parse("2006-01-02", "2000-01-01")
+	moved, _ := time.Parse("2006-01-02", "2001-01-01")
+	deleted, _ := time.Parse("2006-01-02", "2002-01-01")
+	billing := &entity.Address{Type: entity.AddressBilling, Address: "1 Billing Lane", InsuredId: 1, RecordTimestamp: created}
+	if _, err := db.CreateAddress(ctx, billing); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := db.UpdateAddress(ctx, &entity.Address{AddressId: billing.AddressId, Address: "2 Billing Lane", InsuredId: 1, RecordTimestamp: moved}); err != nil {
+		tb.Fatal(err)
+	}
+	db.Now = func() time.Time { return deleted }
+	if _, err := db.DeleteById(ctx, &entity.Address{}, int64(billing.ID)); err != nil {
+		tb.Fatal(err)
+	}
+
+	if err := db.PurgeById(ctx, &entity.Address{}, int64(billing.ID)); err != nil {
+		tb.Fatal(err)
+	}
+	for _, asOf := range []time.Time{created, moved, deleted} {
+		insured, err := db.GetInsuredByDate(ctx, 1, asOf)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for _, address := range *insured.Addresses {
+			if address.AddressId == billing.AddressId {
+				tb.Fatalf("%v: purged address %v", asOf, address.Address)
+			}
+		}
+	}
+	if err := db.PurgeById(ctx, &entity.Address{}, int64(billing.ID)); err != memory.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrRecordDoesNotExist)
+	}
+}
+
+// Cancelling a scheduled change adds a cancellation. The record's event is not changed, and replays the same.
+func TestDB_CancelPendingChange(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	recorded, _ := time.Parse("2006-01-02", "2005-01-01")
+	validFrom, _ := time.Parse("2006-01-02", "2006-01-01")
+	cancelledAt, _ := time.Parse("2006-01-02", "2005-06-01")
+	scheduled := &entity.Address{AddressId: 1, Address: "742 Evergreen Terrace", InsuredId: 1, RecordTimestamp: recorded, ValidFrom: validFrom}
+	if _, err := db.UpdateAddress(ctx, scheduled); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := db.CancelPendingChange(ctx, &entity.Address{}, int64(scheduled.ID), cancelledAt); err != nil {
+		tb.Fatal(err)
+	}
+
+	cancellations := 0
+	for _, e := range db.Events() {
+		if e.Type == memory.EventAddressChanged && e.Id == scheduled.ID && e.Cancelled != 0 {
+			tb.Fatalf("record event changed: %+v", e)
+		} else if e.Type == memory.EventCancelled && e.Id == scheduled.ID {
+			cancellations++
+		}
+	}
+	if got, want := cancellations, 1; got != want {
+		tb.Fatalf("cancellations=%v, want %v", got, want)
+	}
+
+	replayed := MustOpenDB(tb, "")
+	defer MustCloseDB(tb, replayed)
+	if err := replayed.Apply(db.Events()...); err != nil {
+		tb.Fatal(err)
+	}
+	for _, db := range []*memory.DB{db, replayed} {
+		for _, tt := range []struct {
+			asOfRecorded time.Time
+			want         string
+		}{
+			{recorded, "742 Evergreen Ter"}, // known before the cancellation
+			{cancelledAt, "Mars"},
+		} {
+			insured, err := db.GetInsuredByBitemporalDate(ctx, 1, validFrom, tt.asOfRecorded)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			if got := (*insured.Addresses)[0].Address; got != tt.want {
+				tb.Fatalf("%v: Address=%v, want %v", tt.asOfRecorded, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestDB_RestoreById(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	deletedAt, _ := time.Parse("2006-01-02", "2010-01-01")
+	db.Now = func() time.Time { return deletedAt }
+	before, _ := time.Parse("2006-01-02", "2009-01-01")
+	if _, err := db.DeleteById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	restoredAt, _ := time.Parse("2006-01-02", "2011-01-01")
+	db.Now = func() time.Time { return restoredAt }
+
+	if _, err := db.RestoreById(ctx, &entity.Employee{}, 2, before); err != memory.ErrInsuredDeleted {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrInsuredDeleted)
+	}
+	restored, err := db.RestoreById(ctx, &entity.Insured{}, 1, before)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	insured := restored.(*entity.Insured)
+	if got, want := len(*insured.Employees), 2; got != want {
+		tb.Fatalf("len(Employees)=%v, want %v", got, want)
+	} else if got, want := (*insured.Addresses)[0].Address, "Mars"; got != want {
+		tb.Fatalf("Address=%v, want %v", got, want)
+	}
+	if _, err := db.RestoreById(ctx, &entity.Insured{}, 1, before); err != memory.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, memory.ErrUpdateMustChangeAValue)
+	}
+}
+
+func TestDB_GetSnapshot(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	asOf, _ := time.Parse("2006-01-02", "2001-01-01")
+
+	insureds, total, err := db.GetSnapshot(ctx, asOf, entity.InsuredFilter{Limit: 1, Offset: 1})
+	if err != nil {
+		tb.Fatal(err)
+	} else if got, want := total, 2; got != want {
+		tb.Fatalf("total=%v, want %v", got, want)
+	} else if got, want := insureds[0].Name, "John Smith"; got != want {
+		tb.Fatalf("Name=%v, want %v", got, want)
+	} else if got, want := len(*insureds[0].Employees), 3; got != want {
+		tb.Fatalf("len(Employees)=%v, want %v", got, want)
+	}
+
+	// past the last page, the total is still known
+	if insureds, total, err := db.GetSnapshot(ctx, asOf, entity.InsuredFilter{Limit: 1, Offset: 5}); err != nil {
+		tb.Fatal(err)
+	} else if got, want := total, 2; got != want {
+		tb.Fatalf("total=%v, want %v", got, want)
+	} else if got, want := len(insureds), 0; got != want {
+		tb.Fatalf("len=%v, want %v", got, want)
+	}
+}
+
+func TestDB_GetTimeline(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	// insured created, 1 employee record, 3 employee records, 4 address records
+	events, n, err := db.GetTimeline(ctx, 1, entity.TimelineFilter{})
+	if err != nil {
+		tb.Fatal(err)
+	} else if got, want := n, 9; got != want {
+		tb.Fatalf("n=%v, want %v", got, want)
+	} else if got, want := events[0].Type, entity.EventInsuredCreated; got != want {
+		tb.Fatalf("Type=%v, want %v", got, want)
+	}
+
+	// descending, events recorded at the same time keep their order, one page at a time
+	tied, _ := time.Parse("2006-01-02", "2030-01-01")
+	MustCreateAddress(tb, ctx, db, &entity.Address{AddressId: 1, Address: "1 Main St", InsuredId: 1, RecordTimestamp: tied, ValidFrom: tied})
+	MustCreateAddress(tb, ctx, db, &entity.Address{AddressId: 1, Address: "2 Main St", InsuredId: 1, RecordTimestamp: tied, ValidFrom: tied})
+	for offset, want := range []string{"1 Main St", "2 Main St"} {
+		events, _, err := db.GetTimeline(ctx, 1, entity.TimelineFilter{Descending: true, Limit: 1, Offset: offset})
+		if err != nil {
+			tb.Fatal(err)
+		} else if got := events[0].Resource.(*entity.Address).Address; got != want {
+			tb.Fatalf("offset %v: Address=%v, want %v", offset, got, want)
+		}
+	}
+}
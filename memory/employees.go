@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreateEmployee creates a new employee and its first record. Sets the new employee id to employee.ID.
+func (db *DB) CreateEmployee(ctx context.Context, employee *entity.Employee) (record entity.Record, err error) {
+	if err := employee.Validate(); err != nil {
+		return record, err
+	}
+	db.mu.Lock()
+	defer db.unlock()
+
+	if _, ok := db.findInsured(int64(employee.InsuredId)); !ok {
+		return record, ErrRecordDoesNotExist
+	}
+	employee.ID = db.nextId("employees")
+	db.emit(Event{Type: EventEmployeeCreated, Id: employee.ID, InsuredId: employee.InsuredId})
+	if err := db.updateEmployee(employee, employee.InsuredId); err != nil {
+		return record, err
+	}
+	if err := db.commit(); err != nil {
+		return record, err
+	}
+	return employee.ToRecord(), nil
+}
+
+// UpdateEmployee adds a new record for the employee, unless its values did not change
+func (db *DB) UpdateEmployee(ctx context.Context, employee *entity.Employee) (record entity.Record, err error) {
+	if err := employee.Validate(); err != nil {
+		return record, err
+	}
+	db.mu.Lock()
+	defer db.unlock()
+
+	if db.countEmployeeRecords(employee.ID) == 0 {
+		return entity.Record{}, fmt.Errorf("Employee '%v' for Insured ID '%v' does not exist. Use 'new' to update it.", employee.Name, employee.InsuredId)
+	}
+	// compare with the record valid when this change takes effect
+	asOfValid := employee.ValidFrom
+	if asOfValid.IsZero() {
+		asOfValid = employee.RecordTimestamp
+	}
+	current := db.getEmployeeByBitemporalDate(int64(employee.ID), asOfValid, employee.RecordTimestamp)
+	if current.ID != 0 && current.SameEmployee(employee) {
+		return record, ErrUpdateMustChangeAValue
+	}
+	if err := db.updateEmployee(employee, db.employeeInsuredId(employee.ID)); err != nil {
+		return record, err
+	}
+	if err := db.commit(); err != nil {
+		return record, err
+	}
+	return employee.ToRecord(), nil
+}
+
+// updateEmployee adds a record for the employee of the insured
+func (db *DB) updateEmployee(employee *entity.Employee, insuredId int) error {
+	if err := employee.Validate(); err != nil {
+		return err
+	}
+	if insuredId == 0 {
+		return ErrRecordDoesNotExist
+	}
+	db.emit(employeeRecord{
+		version: version{
+			id:              db.nextId("employees_records"),
+			recordTimestamp: unixTime(employee.RecordTimestamp),
+			validFrom:       validFrom(employee.ValidFrom, employee.RecordTimestamp),
+			validTo:         validTo(employee.ValidTo),
+		},
+		employeeId: employee.ID,
+		insuredId:  insuredId,
+		name:       employee.Name,
+		startDate:  shortDate(employee.StartDate),
+		endDate:    shortDate(employee.EndDate),
+
+		jobClassCode:  employee.JobClassCode,
+		annualPayroll: employee.AnnualPayroll,
+		workLocation:  employee.WorkLocation,
+	}.event())
+	return nil
+}
+
+// employeeInsuredId returns the id of the employee's insured, or 0 if there is no such employee
+func (db *DB) employeeInsuredId(employeeId int) int {
+	for _, row := range db.employees {
+		if row.id == employeeId {
+			return row.insuredId
+		}
+	}
+	return 0
+}
+
+// CountEmployeeRecords returns 1 if the employee exists and is not deleted, else 0
+func (db *DB) CountEmployeeRecords(ctx context.Context, employee entity.Employee) (count int, err error) {
+	if err := employee.Validate(); err != nil {
+		return 0, err
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.countEmployeeRecords(employee.ID), nil
+}
+
+// countEmployeeRecords returns 1 if the employee exists and its latest record is not a tombstone, else 0
+func (db *DB) countEmployeeRecords(employeeId int) int {
+	exists := false
+	for _, row := range db.employees {
+		if row.id == employeeId {
+			exists = true
+		}
+	}
+	if !exists {
+		return 0
+	}
+	deleted := false
+	for _, r := range db.employeeRecords {
+		if r.employeeId == employeeId {
+			deleted = r.tombstone
+		}
+	}
+	if deleted {
+		return 0
+	}
+	return 1
+}
+
+// restoreEmployee appends a copy of the employee record, effective now
+func (db *DB) restoreEmployee(employee *entity.Employee, now time.Time) error {
+	db.cancelPendingEmployee(employee.ID, now)
+	restored := *employee
+	restored.RecordTimestamp = now
+	restored.ValidFrom = now
+	restored.ValidTo = time.Time{}
+	return db.updateEmployee(&restored, db.employeeInsuredId(employee.ID))
+}
@@ -0,0 +1,444 @@
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// Every write to a DB is made of events, one per row written, so that a DB can be rebuilt
+// by applying the same events in order. See package eventlog, which saves them to a file.
+
+// Event types
+const (
+	EventBase            = "Base"            // empties the DB. Starts a snapshot.
+	EventInsuredCreated  = "InsuredCreated"  // insured row
+	EventEmployeeCreated = "EmployeeCreated" // employees row
+	EventEmployeeChanged = "EmployeeChanged" // employees_records row, or tombstone
+	EventAddressCreated  = "AddressCreated"  // insured_addresses row
+	EventAddressChanged  = "AddressChanged"  // insured_addresses_records row, or tombstone
+	EventPolicyCreated   = "PolicyCreated"   // policies row
+	EventPolicyChanged   = "PolicyChanged"   // policies_records row, or tombstone
+	EventClaimCreated    = "ClaimCreated"    // claims row
+	EventClaimChanged    = "ClaimChanged"    // claims_records row
+	EventDeleted         = "Deleted"         // insured_tombstones row
+	EventRestored        = "Restored"        // insured_tombstones restore row
+	EventCancelled       = "Cancelled"       // a pending record is cancelled. The record is not changed.
+	EventPurged          = "Purged"          // a row and the rows that belong to it are removed
+)
+
+// Event is one change to the DB's tables. Times are unix seconds, 0 if none.
+type Event struct {
+	Seq  int64  `json:"seq,omitempty"` // position in the log, set by the Journal
+	At   int64  `json:"at,omitempty"`  // when the event was logged, set by the Journal
+	Type string `json:"type"`
+
+	Table string `json:"table,omitempty"` // Cancelled and Purged: table of the row
+	Id    int    `json:"id,omitempty"`    // id of the row in its table
+
+	InsuredId    int    `json:"insuredId,omitempty"`
+	EmployeeId   int    `json:"employeeId,omitempty"`
+	Name         string `json:"name,omitempty"`
+	PolicyNumber int    `json:"policyNumber,omitempty"`
+	StartDate    string `json:"startDate,omitempty"` // 2006-01-02
+	EndDate      string `json:"endDate,omitempty"`
+	AddressId    int    `json:"addressId,omitempty"` // 0 in logs from before insureds had several addresses
+	AddressType  string `json:"addressType,omitempty"`
+	Address      string `json:"address,omitempty"`
+	Line1        string `json:"line1,omitempty"` // address fields. Empty in logs from before addresses had fields
+	Line2        string `json:"line2,omitempty"`
+	City         string `json:"city,omitempty"`
+	Region       string `json:"region,omitempty"`
+	PostalCode   string `json:"postalCode,omitempty"`
+	Country      string `json:"country,omitempty"`
+
+	JobClassCode  string `json:"jobClassCode,omitempty"`  // employee rating fields. Empty in logs from before employees had them
+	AnnualPayroll int64  `json:"annualPayroll,omitempty"` // cents
+	WorkLocation  string `json:"workLocation,omitempty"`
+
+	PolicyId        int    `json:"policyId,omitempty"`
+	Term            int    `json:"term,omitempty"`
+	EffectiveDate   string `json:"effectiveDate,omitempty"` // 2006-01-02
+	ExpirationDate  string `json:"expirationDate,omitempty"`
+	OccurrenceLimit int64  `json:"occurrenceLimit,omitempty"` // cents
+	AggregateLimit  int64  `json:"aggregateLimit,omitempty"`
+	Premium         int64  `json:"premium,omitempty"`
+
+	ClaimId     int    `json:"claimId,omitempty"`
+	LossDate    string `json:"lossDate,omitempty"` // 2006-01-02
+	Description string `json:"description,omitempty"`
+	Status      string `json:"status,omitempty"`
+
+	RecordTimestamp int64 `json:"recordTimestamp,omitempty"`
+	ValidFrom       int64 `json:"validFrom,omitempty"`
+	ValidTo         int64 `json:"validTo,omitempty"`
+	Cancelled       int64 `json:"cancelled,omitempty"`
+	Tombstone       bool  `json:"tombstone,omitempty"`
+
+	LastIds map[string]int `json:"lastIds,omitempty"` // Base: last id used in each table
+}
+
+// Apply applies events to the DB, in order, without passing them to the Journal.
+// Used to rebuild a DB from saved events.
+func (db *DB) Apply(events ...Event) error {
+	db.mu.Lock()
+	defer db.unlock()
+	for _, e := range events {
+		if err := db.apply(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events returns events that rebuild the DB as it is now: a Base event, then one event per row.
+// The Base event has the Seq of the last event applied.
+func (db *DB) Events() []Event {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.events()
+}
+
+// WithEvents calls fn with Events. No write is journaled or applied until fn returns,
+// so fn may act on the events knowing they are the whole of the DB. fn must not write to the DB.
+func (db *DB) WithEvents(fn func(events []Event) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return fn(db.events())
+}
+
+// events is Events. db.mu must be held.
+func (db *DB) events() []Event {
+	lastIds := make(map[string]int, len(db.lastIds))
+	for table, id := range db.lastIds {
+		lastIds[table] = id
+	}
+	events := []Event{{Seq: db.lastSeq, At: db.Now().Unix(), Type: EventBase, LastIds: lastIds}}
+	for _, row := range db.insureds {
+		events = append(events, Event{Type: EventInsuredCreated, Id: row.id, Name: row.name, PolicyNumber: row.policyNumber, RecordTimestamp: row.recordTimestamp.Unix()})
+	}
+	for _, row := range db.employees {
+		events = append(events, Event{Type: EventEmployeeCreated, Id: row.id, InsuredId: row.insuredId})
+	}
+	for _, r := range db.employeeRecords {
+		events = append(events, r.event())
+	}
+	for _, row := range db.addresses {
+		events = append(events, row.event())
+	}
+	for _, r := range db.addressRecords {
+		events = append(events, r.event())
+	}
+	for _, row := range db.policies {
+		events = append(events, row.event())
+	}
+	for _, r := range db.policyRecords {
+		events = append(events, r.event())
+	}
+	for _, row := range db.claims {
+		events = append(events, row.event())
+	}
+	for _, r := range db.claimRecords {
+		events = append(events, r.event())
+	}
+	for _, t := range db.tombstones {
+		events = append(events, t.event())
+	}
+	for _, c := range db.cancellations {
+		events = append(events, Event{Type: EventCancelled, Table: c.table, Id: c.recordId, Cancelled: c.recordTimestamp.Unix()})
+	}
+	return events
+}
+
+// emit adds an event to the write in progress. It is applied by commit.
+func (db *DB) emit(e Event) {
+	db.batch = append(db.batch, e)
+}
+
+// commit passes the events of the write in progress to the Journal, if any, then applies them
+func (db *DB) commit() error {
+	batch := db.batch
+	db.batch = nil
+	if len(batch) == 0 {
+		return nil
+	}
+	if db.Journal != nil {
+		if err := db.Journal(batch); err != nil {
+			return err
+		}
+	}
+	for _, e := range batch {
+		if err := db.apply(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlock discards the events of a write that was not committed, and unlocks the DB
+func (db *DB) unlock() {
+	db.batch = nil
+	db.mu.Unlock()
+}
+
+// apply changes the tables by one event
+func (db *DB) apply(e Event) error {
+	switch e.Type {
+	case EventBase:
+		db.insureds, db.employees, db.employeeRecords, db.addresses, db.addressRecords, db.tombstones = nil, nil, nil, nil, nil, nil
+		db.policies, db.policyRecords, db.claims, db.claimRecords, db.cancellations = nil, nil, nil, nil, nil
+		db.lastIds = make(map[string]int, len(e.LastIds))
+		for table, id := range e.LastIds {
+			db.lastIds[table] = id
+		}
+		db.lastSeq = 0
+	case EventInsuredCreated:
+		db.insureds = append(db.insureds, insuredRow{id: e.Id, name: e.Name, policyNumber: e.PolicyNumber, recordTimestamp: fromUnix(e.RecordTimestamp)})
+		db.usedId("insured", e.Id)
+	case EventEmployeeCreated:
+		db.employees = append(db.employees, employeeRow{id: e.Id, insuredId: e.InsuredId})
+		db.usedId("employees", e.Id)
+	case EventEmployeeChanged:
+		startDate, _ := time.Parse("2006-01-02", e.StartDate)
+		endDate, _ := time.Parse("2006-01-02", e.EndDate)
+		db.employeeRecords = append(db.employeeRecords, employeeRecord{
+			version:    e.version(),
+			employeeId: e.EmployeeId,
+			insuredId:  e.InsuredId,
+			name:       e.Name,
+			startDate:  startDate,
+			endDate:    endDate,
+
+			jobClassCode:  e.JobClassCode,
+			annualPayroll: e.AnnualPayroll,
+			workLocation:  e.WorkLocation,
+		})
+		db.usedId("employees_records", e.Id)
+		db.cancelledBefore("employees_records", e)
+	case EventAddressCreated:
+		db.addresses = append(db.addresses, addressRow{id: e.Id, insuredId: e.InsuredId, addressType: e.AddressType})
+		db.usedId("insured_addresses", e.Id)
+	case EventAddressChanged:
+		address := db.addressOf(e)
+		fields := entity.Address{Line1: e.Line1, Line2: e.Line2, City: e.City, Region: e.Region, PostalCode: e.PostalCode, Country: e.Country}
+		if fields.Line1 == "" && e.Address != "" { // from an older log: split, as sqlite migration 8 does
+			fields = entity.ParseAddress(e.Address)
+		}
+		db.addressRecords = append(db.addressRecords, addressRecord{
+			version:     e.version(),
+			addressId:   address.id,
+			addressType: address.addressType,
+			address:     e.Address,
+			line1:       fields.Line1,
+			line2:       fields.Line2,
+			city:        fields.City,
+			region:      fields.Region,
+			postalCode:  fields.PostalCode,
+			country:     fields.Country,
+			insuredId:   e.InsuredId,
+		})
+		db.usedId("insured_addresses_records", e.Id)
+		db.cancelledBefore("insured_addresses_records", e)
+	case EventPolicyCreated:
+		db.policies = append(db.policies, policyRow{id: e.Id, insuredId: e.InsuredId, policyNumber: e.PolicyNumber})
+		db.usedId("policies", e.Id)
+	case EventPolicyChanged:
+		policy := db.policyOf(e.PolicyId)
+		effectiveDate, _ := time.Parse("2006-01-02", e.EffectiveDate)
+		expirationDate, _ := time.Parse("2006-01-02", e.ExpirationDate)
+		db.policyRecords = append(db.policyRecords, policyRecord{
+			version:         e.version(),
+			policyId:        e.PolicyId,
+			insuredId:       policy.insuredId,
+			policyNumber:    policy.policyNumber,
+			term:            e.Term,
+			effectiveDate:   effectiveDate,
+			expirationDate:  expirationDate,
+			occurrenceLimit: e.OccurrenceLimit,
+			aggregateLimit:  e.AggregateLimit,
+			premium:         e.Premium,
+		})
+		db.usedId("policies_records", e.Id)
+		db.cancelledBefore("policies_records", e)
+	case EventClaimCreated:
+		db.claims = append(db.claims, claimRow{id: e.Id, insuredId: e.InsuredId})
+		db.usedId("claims", e.Id)
+	case EventClaimChanged:
+		lossDate, _ := time.Parse("2006-01-02", e.LossDate)
+		db.claimRecords = append(db.claimRecords, claimRecord{
+			version:     e.version(),
+			claimId:     e.ClaimId,
+			insuredId:   db.claimOf(e.ClaimId).insuredId,
+			lossDate:    lossDate,
+			description: e.Description,
+			status:      e.Status,
+		})
+		db.usedId("claims_records", e.Id)
+	case EventDeleted, EventRestored:
+		db.tombstones = append(db.tombstones, insuredTombstone{id: e.Id, insuredId: e.InsuredId, recordTimestamp: fromUnix(e.RecordTimestamp), restore: e.Type == EventRestored})
+		db.usedId("insured_tombstones", e.Id)
+	case EventCancelled:
+		db.cancel(e.Table, e.Id, fromUnix(e.Cancelled))
+	case EventPurged:
+		db.purge(e.Table, e.Id)
+	default:
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if e.Seq > db.lastSeq {
+		db.lastSeq = e.Seq
+	}
+	return nil
+}
+
+// usedId keeps the table's last id at least id, so ids are not reused
+func (db *DB) usedId(table string, id int) {
+	if id > db.lastIds[table] {
+		db.lastIds[table] = id
+	}
+}
+
+func (r employeeRecord) event() Event {
+	e := r.version.event(EventEmployeeChanged)
+	e.EmployeeId = r.employeeId
+	e.InsuredId = r.insuredId
+	e.Name = r.name
+	e.StartDate = r.startDate.Format("2006-01-02")
+	e.EndDate = r.endDate.Format("2006-01-02")
+	e.JobClassCode = r.jobClassCode
+	e.AnnualPayroll = r.annualPayroll
+	e.WorkLocation = r.workLocation
+	return e
+}
+
+// addressOf returns the address of an AddressChanged event. An event without an address id, from an older log,
+// is a record of the insured's first address, which is added as a mailing address if the insured has none.
+func (db *DB) addressOf(e Event) addressRow {
+	for _, row := range db.addresses {
+		if row.id == e.AddressId || (e.AddressId == 0 && row.insuredId == e.InsuredId) {
+			return row
+		}
+	}
+	row := addressRow{id: e.AddressId, insuredId: e.InsuredId, addressType: entity.AddressMailing}
+	if row.id == 0 {
+		row.id = db.lastIds["insured_addresses"] + 1
+	}
+	db.addresses = append(db.addresses, row)
+	db.usedId("insured_addresses", row.id)
+	return row
+}
+
+func (r addressRow) event() Event {
+	return Event{Type: EventAddressCreated, Id: r.id, InsuredId: r.insuredId, AddressType: r.addressType}
+}
+
+func (r addressRecord) event() Event {
+	e := r.version.event(EventAddressChanged)
+	e.AddressId = r.addressId
+	e.Address = r.address
+	e.Line1, e.Line2, e.City, e.Region, e.PostalCode, e.Country = r.line1, r.line2, r.city, r.region, r.postalCode, r.country
+	e.InsuredId = r.insuredId
+	return e
+}
+
+// policyOf returns the policy row for this Id
+func (db *DB) policyOf(policyId int) policyRow {
+	for _, row := range db.policies {
+		if row.id == policyId {
+			return row
+		}
+	}
+	return policyRow{}
+}
+
+func (r policyRow) event() Event {
+	return Event{Type: EventPolicyCreated, Id: r.id, InsuredId: r.insuredId, PolicyNumber: r.policyNumber}
+}
+
+func (r policyRecord) event() Event {
+	e := r.version.event(EventPolicyChanged)
+	e.PolicyId = r.policyId
+	e.Term = r.term
+	e.EffectiveDate = r.effectiveDate.Format("2006-01-02")
+	e.ExpirationDate = r.expirationDate.Format("2006-01-02")
+	e.OccurrenceLimit, e.AggregateLimit, e.Premium = r.occurrenceLimit, r.aggregateLimit, r.premium
+	return e
+}
+
+// claimOf returns the claim row for this Id
+func (db *DB) claimOf(claimId int) claimRow {
+	for _, row := range db.claims {
+		if row.id == claimId {
+			return row
+		}
+	}
+	return claimRow{}
+}
+
+func (r claimRow) event() Event {
+	return Event{Type: EventClaimCreated, Id: r.id, InsuredId: r.insuredId}
+}
+
+func (r claimRecord) event() Event {
+	e := r.version.event(EventClaimChanged)
+	e.ClaimId = r.claimId
+	e.LossDate = r.lossDate.Format("2006-01-02")
+	e.Description, e.Status = r.description, r.status
+	return e
+}
+
+func (t insuredTombstone) event() Event {
+	eventType := EventDeleted
+	if t.restore {
+		eventType = EventRestored
+	}
+	return Event{Type: eventType, Id: t.id, InsuredId: t.insuredId, RecordTimestamp: t.recordTimestamp.Unix()}
+}
+
+// cancelledBefore adds the cancellation of a record event from an older log, which kept it on the record
+func (db *DB) cancelledBefore(table string, e Event) {
+	if e.Cancelled != 0 {
+		db.cancel(table, e.Id, fromUnix(e.Cancelled))
+	}
+}
+
+func (v version) event(eventType string) Event {
+	return Event{
+		Type:            eventType,
+		Id:              v.id,
+		RecordTimestamp: v.recordTimestamp.Unix(),
+		ValidFrom:       v.validFrom.Unix(),
+		ValidTo:         toUnix(v.validTo),
+		Tombstone:       v.tombstone,
+	}
+}
+
+func (e Event) version() version {
+	return version{
+		id:              e.Id,
+		recordTimestamp: fromUnix(e.RecordTimestamp),
+		validFrom:       fromUnix(e.ValidFrom),
+		validTo:         fromNullUnix(e.ValidTo),
+		tombstone:       e.Tombstone,
+	}
+}
+
+func fromUnix(seconds int64) time.Time {
+	return time.Unix(seconds, 0).UTC()
+}
+
+// fromNullUnix is fromUnix, with 0 as the zero time
+func fromNullUnix(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return fromUnix(seconds)
+}
+
+// toUnix returns t as unix seconds, with the zero time as 0
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreateInsured creates a new insured with the next policy number, unless insured has one. Sets the new ID to insured.ID.
+func (db *DB) CreateInsured(ctx context.Context, insured *entity.Insured) (record entity.Record, err error) {
+	if err := insured.Validate(); err != nil {
+		return record, err
+	}
+	db.mu.Lock()
+	defer db.unlock()
+
+	policyNumber := 1000 // policy numbers start at 1001
+	for _, row := range db.insureds {
+		if insured.PolicyNumber != 0 && row.policyNumber == insured.PolicyNumber {
+			return record, ErrRecordAlreadyExists // UNIQUE in sqlite
+		} else if row.policyNumber > policyNumber {
+			policyNumber = row.policyNumber
+		}
+	}
+	for _, row := range db.policies {
+		if row.policyNumber > policyNumber {
+			policyNumber = row.policyNumber
+		}
+	}
+	if insured.PolicyNumber == 0 { // else set by seed data
+		insured.PolicyNumber = policyNumber + 1
+	}
+	insured.ID = db.nextId("insured")
+	db.emit(Event{
+		Type:            EventInsuredCreated,
+		Id:              insured.ID,
+		Name:            insured.Name,
+		PolicyNumber:    insured.PolicyNumber,
+		RecordTimestamp: insured.RecordTimestamp.Unix(),
+	})
+	if err := db.commit(); err != nil {
+		return record, err
+	}
+	return insured.ToRecord(), nil
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// GetPendingChanges returns the scheduled changes for insuredId as of asOf:
+// records already recorded that take effect after asOf and have not been cancelled.
+// Sorted by the date they take effect.
+func (db *DB) GetPendingChanges(ctx context.Context, insuredId int64, asOf time.Time) (changes []entity.PendingChange, err error) {
+	if insuredId == 0 {
+		return changes, ErrRecordDoesNotExist
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	changes = append(db.pendingEmployees(asOf, func(r employeeRecord) bool { return int64(r.insuredId) == insuredId }),
+		db.pendingAddresses(asOf, func(r addressRecord) bool { return int64(r.insuredId) == insuredId })...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].ValidFrom.Before(changes[j].ValidFrom)
+	})
+	return changes, nil
+}
+
+// CancelPendingChange cancels the scheduled change with this record id, as of asOf.
+// The record is kept as it was, and the cancellation added, so earlier answers can still be reproduced.
+// Returns ErrRecordNotPending if the change has already taken effect or was already cancelled.
+func (db *DB) CancelPendingChange(ctx context.Context, insuredIfaceObj entity.InsuredInterface, recordId int64, asOf time.Time) (change entity.PendingChange, err error) {
+	if recordId == 0 {
+		return change, ErrRecordDoesNotExist
+	}
+	db.mu.Lock()
+	defer db.unlock()
+
+	var pending []entity.PendingChange
+	exists := false
+	switch insuredIfaceObj.(type) {
+	case *entity.Employee:
+		pending = db.pendingEmployees(asOf, func(r employeeRecord) bool { return int64(r.id) == recordId })
+		for _, r := range db.employeeRecords {
+			if int64(r.id) == recordId {
+				exists = true
+				if len(pending) > 0 {
+					db.emit(Event{Type: EventCancelled, Table: "employees_records", Id: r.id, Cancelled: asOf.Unix()})
+				}
+			}
+		}
+	case *entity.Address:
+		pending = db.pendingAddresses(asOf, func(r addressRecord) bool { return int64(r.id) == recordId })
+		for _, r := range db.addressRecords {
+			if int64(r.id) == recordId {
+				exists = true
+				if len(pending) > 0 {
+					db.emit(Event{Type: EventCancelled, Table: "insured_addresses_records", Id: r.id, Cancelled: asOf.Unix()})
+				}
+			}
+		}
+	default:
+		return change, fmt.Errorf("Query failed")
+	}
+	if !exists {
+		return change, ErrRecordDoesNotExist
+	} else if len(pending) == 0 {
+		return change, ErrRecordNotPending
+	}
+	if err := db.commit(); err != nil {
+		return change, err
+	}
+	return pending[0], nil
+}
+
+// pendingEmployees returns the employee records matching keep that are pending at asOf, by the date they take effect
+func (db *DB) pendingEmployees(asOf time.Time, keep func(r employeeRecord) bool) (changes []entity.PendingChange) {
+	records := []employeeRecord{}
+	for _, r := range db.employeeRecords {
+		if keep(r) && r.pending(asOf, db.cancelledAt("employees_records", r.id)) {
+			records = append(records, r)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].validFrom.Before(records[j].validFrom)
+	})
+	for _, r := range records {
+		changes = append(changes, entity.PendingChange{
+			RecordId:        r.id,
+			Resource:        r.employee(),
+			ValidFrom:       r.validFrom,
+			RecordTimestamp: r.recordTimestamp,
+		})
+	}
+	return changes
+}
+
+// pendingAddresses returns the address records matching keep that are pending at asOf, by the date they take effect
+func (db *DB) pendingAddresses(asOf time.Time, keep func(r addressRecord) bool) (changes []entity.PendingChange) {
+	records := []addressRecord{}
+	for _, r := range db.addressRecords {
+		if keep(r) && r.pending(asOf, db.cancelledAt("insured_addresses_records", r.id)) {
+			records = append(records, r)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].validFrom.Before(records[j].validFrom)
+	})
+	for _, r := range records {
+		changes = append(changes, entity.PendingChange{
+			RecordId:        r.id,
+			Resource:        r.toAddress(),
+			ValidFrom:       r.validFrom,
+			RecordTimestamp: r.recordTimestamp,
+		})
+	}
+	return changes
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreatePolicy creates a policy of the insured and its first record. Sets the new policy id to policy.ID.
+// A policy without a policy number gets the insured's, if no policy has it yet, else the next policy number.
+func (db *DB) CreatePolicy(ctx context.Context, policy *entity.Policy) (record entity.Record, err error) {
+	if policy.Term == 0 {
+		policy.Term = 1
+	}
+	if err := policy.Validate(); err != nil {
+		return record, err
+	}
+	db.mu.Lock()
+	defer db.unlock()
+
+	insured, ok := db.findInsured(int64(policy.InsuredId))
+	if !ok {
+		return record, ErrRecordDoesNotExist
+	}
+	if policy.PolicyNumber == 0 {
+		policy.PolicyNumber = db.nextPolicyNumber(insured)
+	}
+	for _, row := range db.policies {
+		if row.policyNumber == policy.PolicyNumber {
+			return record, ErrRecordAlreadyExists // UNIQUE in sqlite
+		}
+	}
+	policy.ID = db.nextId("policies")
+	db.emit(policyRow{id: policy.ID, insuredId: policy.InsuredId, policyNumber: policy.PolicyNumber}.event())
+	db.updatePolicy(policy)
+	if err := db.commit(); err != nil {
+		return record, err
+	}
+	return policy.ToRecord(), nil
+}
+
+// nextPolicyNumber returns the insured's policy number if no policy has it, else the next unused policy number
+func (db *DB) nextPolicyNumber(insured insuredRow) int {
+	max, used := 1000, false
+	for _, row := range db.policies {
+		used = used || row.policyNumber == insured.policyNumber
+		if row.policyNumber > max {
+			max = row.policyNumber
+		}
+	}
+	if !used {
+		return insured.policyNumber
+	}
+	for _, row := range db.insureds {
+		if row.policyNumber > max {
+			max = row.policyNumber
+		}
+	}
+	return max + 1
+}
+
+// UpdatePolicy adds a new record for the policy, unless its terms did not change.
+// A renewal is a record of the next term. The policy number and insured are the policy's.
+func (db *DB) UpdatePolicy(ctx context.Context, policy *entity.Policy) (record entity.Record, err error) {
+	db.mu.Lock()
+	defer db.unlock()
+
+	row := db.policyOf(policy.ID)
+	if row.id == 0 || db.policyDeleted(policy.ID) {
+		return record, ErrRecordDoesNotExist
+	}
+	policy.InsuredId, policy.PolicyNumber = row.insuredId, row.policyNumber
+	if err := policy.Validate(); err != nil {
+		return record, err
+	}
+	// compare with the record valid when this change takes effect
+	asOfValid := policy.ValidFrom
+	if asOfValid.IsZero() {
+		asOfValid = policy.RecordTimestamp
+	}
+	current := db.getPolicyByBitemporalDate(int64(policy.ID), asOfValid, policy.RecordTimestamp)
+	if current.ID != 0 && current.SameTerms(policy) {
+		return record, ErrUpdateMustChangeAValue
+	}
+	db.updatePolicy(policy)
+	if err := db.commit(); err != nil {
+		return record, err
+	}
+	return policy.ToRecord(), nil
+}
+
+// updatePolicy adds a record for the policy
+func (db *DB) updatePolicy(policy *entity.Policy) {
+	db.emit(policyRecord{
+		version: version{
+			id:              db.nextId("policies_records"),
+			recordTimestamp: unixTime(policy.RecordTimestamp),
+			validFrom:       validFrom(policy.ValidFrom, policy.RecordTimestamp),
+			validTo:         validTo(policy.ValidTo),
+		},
+		policyId:        policy.ID,
+		term:            policy.Term,
+		effectiveDate:   shortDate(policy.EffectiveDate),
+		expirationDate:  shortDate(policy.ExpirationDate),
+		occurrenceLimit: policy.OccurrenceLimit,
+		aggregateLimit:  policy.AggregateLimit,
+		premium:         policy.Premium,
+	}.event())
+}
+
+// policyDeleted returns true if the policy's latest record is a tombstone
+func (db *DB) policyDeleted(policyId int) bool {
+	deleted := false
+	for _, r := range db.policyRecords {
+		if r.policyId == policyId {
+			deleted = r.tombstone
+		}
+	}
+	return deleted
+}
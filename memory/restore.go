@@ -0,0 +1,187 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// RestoreById re-materializes the insured, employee, or address as it was valid at asOf (as known now)
+// by appending new records effective now. Existing records are never modified, except that
+// pending (future-dated) changes to restored entities are cancelled.
+// Works for deleted entities and for entities changed by bad updates since asOf.
+// Restoring an insured also restores its employees and addresses, and deletes employees and addresses added after asOf.
+// For addresses, id is any record id of the address.
+func (db *DB) RestoreById(ctx context.Context, insuredObj entity.InsuredInterface, id int64, asOf time.Time) (restored entity.InsuredInterface, err error) {
+	if id == 0 {
+		return insuredObj, ErrRecordIDInvalid
+	}
+	now := db.Now()
+	if asOf.After(now) {
+		return insuredObj, ErrRecordMatchingCriteriaDoesNotExist
+	}
+	db.mu.Lock()
+	defer db.unlock()
+
+	switch insuredObj.(type) {
+	case *entity.Employee:
+		then := db.getEmployeeByBitemporalDate(id, asOf, now)
+		if then.ID == 0 {
+			return insuredObj, ErrRecordMatchingCriteriaDoesNotExist
+		}
+		current := db.getEmployeeByBitemporalDate(id, now, now)
+		if db.insuredDeletedAt(int64(then.InsuredId), now, now) {
+			return insuredObj, ErrInsuredDeleted
+		}
+		if sameEmployee(then, current) {
+			return insuredObj, ErrUpdateMustChangeAValue
+		}
+		if err := db.restoreEmployee(then, now); err != nil {
+			return insuredObj, err
+		}
+		if err := db.commit(); err != nil {
+			return insuredObj, err
+		}
+		return db.getEmployeeByBitemporalDate(id, now, now), nil
+	case *entity.Address:
+		insuredId, addressId, err := db.addressOfRecord(id)
+		if err != nil {
+			return insuredObj, err
+		}
+		if db.insuredDeletedAt(insuredId, now, now) {
+			return insuredObj, ErrInsuredDeleted
+		}
+		then, current := db.addressAt(addressId, asOf, now), db.addressAt(addressId, now, now)
+		if then == nil {
+			return insuredObj, ErrRecordMatchingCriteriaDoesNotExist
+		}
+		if current != nil && current.SameAddress(*then) {
+			return insuredObj, ErrUpdateMustChangeAValue
+		}
+		if err := db.restoreAddress(then, now); err != nil {
+			return insuredObj, err
+		}
+		if err := db.commit(); err != nil {
+			return insuredObj, err
+		}
+		return then, nil
+	case *entity.Insured:
+		return db.restoreInsured(id, asOf, now)
+	}
+	return insuredObj, fmt.Errorf("Server error.")
+}
+
+// restoreInsured restores the insured, its employees, and its addresses as they were at asOf
+func (db *DB) restoreInsured(id int64, asOf time.Time, now time.Time) (*entity.Insured, error) {
+	then, err := db.getInsuredByBitemporalDate(id, asOf, now)
+	if err != nil {
+		return &entity.Insured{}, err
+	}
+	// current employees and addresses. A deleted insured has none.
+	deleted := db.insuredDeletedAt(id, now, now)
+	current := map[int]entity.Employee{}
+	currentAddress := map[int]entity.Address{}
+	if !deleted {
+		for _, r := range db.employeesAt(now, now, func(r employeeRecord) bool { return int64(r.insuredId) == id }) {
+			current[r.employeeId] = *r.employee()
+		}
+		for _, r := range db.addressesAt(now, now, func(r addressRecord) bool { return int64(r.insuredId) == id }) {
+			currentAddress[r.addressId] = *r.toAddress()
+		}
+	}
+
+	// check for changes before writing, so nothing is written if there are none
+	changed := deleted
+	remaining := len(current) + len(currentAddress)
+	for _, address := range *then.Addresses {
+		if currentAddress, ok := currentAddress[address.AddressId]; ok {
+			remaining--
+			if currentAddress.SameAddress(address) {
+				continue
+			}
+		}
+		changed = true
+	}
+	for _, employee := range *then.Employees {
+		employee := employee
+		if currentEmployee, ok := current[employee.ID]; ok {
+			remaining--
+			if sameEmployee(&employee, &currentEmployee) {
+				continue
+			}
+		}
+		changed = true
+	}
+	if !changed && remaining == 0 {
+		return &entity.Insured{}, ErrUpdateMustChangeAValue
+	}
+
+	if deleted {
+		db.emit(Event{Type: EventRestored, Id: db.nextId("insured_tombstones"), InsuredId: int(id), RecordTimestamp: now.Unix()})
+	}
+	for _, employee := range *then.Employees {
+		employee := employee
+		if currentEmployee, ok := current[employee.ID]; ok {
+			delete(current, employee.ID)
+			if sameEmployee(&employee, &currentEmployee) {
+				continue
+			}
+		}
+		if err := db.restoreEmployee(&employee, now); err != nil {
+			return &entity.Insured{}, err
+		}
+	}
+	for _, employee := range current { // added after asOf
+		employee := employee
+		db.deleteEmployee(&employee, now)
+	}
+	for _, address := range *then.Addresses {
+		address := address
+		if current, ok := currentAddress[address.AddressId]; ok {
+			delete(currentAddress, address.AddressId)
+			if current.SameAddress(address) {
+				continue
+			}
+		}
+		if err := db.restoreAddress(&address, now); err != nil {
+			return &entity.Insured{}, err
+		}
+	}
+	for _, address := range currentAddress { // added after asOf
+		address := address
+		db.deleteAddress(&address, now)
+	}
+	if err := db.commit(); err != nil {
+		return &entity.Insured{}, err
+	}
+	restored, err := db.getInsuredByBitemporalDate(id, now, now)
+	return &restored, err
+}
+
+// addressAt returns the address valid at asOfValid, as known at asOfRecorded, or nil
+func (db *DB) addressAt(addressId int, asOfValid time.Time, asOfRecorded time.Time) *entity.Address {
+	for _, r := range db.addressesAt(asOfValid, asOfRecorded, func(r addressRecord) bool { return r.addressId == addressId }) {
+		return r.toAddress()
+	}
+	return nil
+}
+
+// addressOfRecord returns the insured id and address id of an address record, including tombstones
+func (db *DB) addressOfRecord(recordId int64) (insuredId int64, addressId int, err error) {
+	for _, r := range db.addressRecords {
+		if int64(r.id) == recordId {
+			return int64(r.insuredId), r.addressId, nil
+		}
+	}
+	return 0, 0, ErrRecordDoesNotExist
+}
+
+// sameEmployee returns true if the employees' time-travelable values are equal. A nil or zero employee is deleted.
+func sameEmployee(a *entity.Employee, b *entity.Employee) bool {
+	if a == nil || b == nil || a.ID == 0 || b.ID == 0 {
+		return false
+	}
+	return a.SameEmployee(b)
+}
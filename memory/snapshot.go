@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// GetSnapshot returns every insured matching filter as it was at asOf, with its employees and addresses.
+// Also returns the total count of matching insureds, which may differ if filter.Limit is set.
+func (db *DB) GetSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter) (insureds []entity.Insured, total int, err error) {
+	insureds = make([]entity.Insured, 0)
+	total, err = db.StreamSnapshot(ctx, asOf, filter, func(insured entity.Insured, _ int) error {
+		insureds = append(insureds, insured)
+		return nil
+	})
+	return insureds, total, err
+}
+
+// StreamSnapshot is GetSnapshot calling fn with each insured, in id order.
+// fn also receives the total count of matching insureds. An error from fn stops the stream.
+// Insureds are included if created by asOf and not deleted at asOf.
+func (db *DB) StreamSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter, fn func(insured entity.Insured, total int) error) (total int, err error) {
+	db.mu.RLock()
+	matching := []insuredRow{}
+	for _, row := range db.insureds {
+		if row.recordTimestamp.Unix() <= asOf.Unix() && !db.insuredDeletedAt(int64(row.id), asOf, asOf) && matches(row, filter) {
+			matching = append(matching, row)
+		}
+	}
+	page := matching
+	if filter.Offset > 0 {
+		if filter.Offset >= len(page) {
+			page = nil
+		} else {
+			page = page[filter.Offset:]
+		}
+	}
+	if filter.Limit > 0 && filter.Limit < len(page) {
+		page = page[:filter.Limit]
+	}
+	insureds := make([]entity.Insured, 0, len(page))
+	for _, row := range page {
+		insured, err := db.getInsuredByBitemporalDate(int64(row.id), asOf, asOf)
+		if err != nil {
+			db.mu.RUnlock()
+			return 0, err
+		}
+		insureds = append(insureds, insured)
+	}
+	db.mu.RUnlock()
+
+	total = len(matching) // also for a page past the last insured
+
+	for _, insured := range insureds { // fn is called without the lock, so it may read the DB
+		if err := fn(insured, total); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// matches returns true if the insured matches the filter's fields
+func matches(row insuredRow, filter entity.InsuredFilter) bool {
+	if v := filter.ID; v != nil && row.id != *v {
+		return false
+	}
+	if v := filter.PolicyNumber; v != nil && row.policyNumber != *v {
+		return false
+	}
+	if v := filter.RecordTimestamp; v != nil && row.recordTimestamp.Unix() >= int64(*v) {
+		return false
+	}
+	if v := filter.Name; v != nil && row.name != *v {
+		return false
+	}
+	return true
+}
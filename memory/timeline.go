@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// GetTimeline merges the insured's creation and every employee and address record into one
+// stream of events, sorted by the time they were recorded. Also returns total count of events
+// in the filter's window, which may differ from returned results if filter.Limit is specified.
+func (db *DB) GetTimeline(ctx context.Context, insuredId int64, filter entity.TimelineFilter) (events []entity.TimelineEvent, n int, err error) {
+	if insuredId == 0 {
+		return nil, 0, ErrRecordDoesNotExist
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	row, ok := db.findInsured(insuredId) // deleted insureds have a timeline too
+	if !ok {
+		return nil, 0, ErrRecordDoesNotExist
+	}
+	// timeline shows the insured as created, without employees or addresses
+	insured := row.insured()
+	insured.Employees = &map[int]entity.Employee{}
+	insured.Addresses = &map[int]entity.Address{}
+
+	all := []entity.TimelineEvent{{
+		Type:      entity.EventInsuredCreated,
+		Timestamp: insured.RecordTimestamp,
+		RecordId:  insured.ID,
+		Resource:  insured,
+	}}
+	all = append(all, db.employeeTimeline(insured.ID)...)
+	all = append(all, db.addressTimeline(insured.ID)...)
+	// after its employees and address, which are deleted with it
+	for _, t := range db.tombstones {
+		if t.insuredId != insured.ID {
+			continue
+		}
+		eventType := entity.EventInsuredDeleted
+		if t.restore {
+			eventType = entity.EventInsuredRestored
+		}
+		all = append(all, entity.TimelineEvent{Type: eventType, Timestamp: t.recordTimestamp, RecordId: t.id, Resource: insured})
+	}
+
+	// stable, so events recorded at the same time keep the order above, descending too
+	sort.SliceStable(all, func(i, j int) bool {
+		if filter.Descending {
+			return all[i].Timestamp.After(all[j].Timestamp)
+		}
+		return all[i].Timestamp.Before(all[j].Timestamp)
+	})
+
+	events = []entity.TimelineEvent{}
+	for _, event := range all {
+		if filter.Includes(event.Timestamp) {
+			events = append(events, event)
+		}
+	}
+	n = len(events)
+	if filter.Offset > 0 {
+		if filter.Offset >= len(events) {
+			return []entity.TimelineEvent{}, n, nil
+		}
+		events = events[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(events) {
+		events = events[:filter.Limit]
+	}
+	return events, n, nil
+}
+
+// employeeTimeline returns an event for every employee record of the insured, plus an event for each cancellation
+func (db *DB) employeeTimeline(insuredId int) (events []entity.TimelineEvent) {
+	records := []employeeRecord{}
+	for _, r := range db.employeeRecords {
+		if r.insuredId == insuredId {
+			records = append(records, r)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].recordTimestamp.Before(records[j].recordTimestamp)
+	})
+
+	seen := make(map[int]bool) // created, and not deleted since
+	for _, r := range records {
+		employee := r.employee()
+		eventType := entity.EventEmployeeUpdated
+		if r.tombstone {
+			eventType = entity.EventEmployeeDeleted
+			seen[r.employeeId] = false
+		} else if !seen[r.employeeId] {
+			eventType = entity.EventEmployeeCreated
+			seen[r.employeeId] = true
+		}
+		events = append(events, entity.TimelineEvent{Type: eventType, Timestamp: r.recordTimestamp, RecordId: r.id, Resource: employee})
+		if cancelled := db.cancelledAt("employees_records", r.id); !cancelled.IsZero() {
+			events = append(events, entity.TimelineEvent{Type: entity.EventEmployeeCancelled, Timestamp: cancelled, RecordId: r.id, Resource: employee})
+		}
+	}
+	return events
+}
+
+// addressTimeline returns an event for every address record of the insured, plus an event for each cancellation
+func (db *DB) addressTimeline(insuredId int) (events []entity.TimelineEvent) {
+	records := []addressRecord{}
+	for _, r := range db.addressRecords {
+		if r.insuredId == insuredId {
+			records = append(records, r)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].recordTimestamp.Before(records[j].recordTimestamp)
+	})
+
+	created := map[int]bool{} // by address id
+	for _, r := range records {
+		address := r.toAddress()
+		eventType := entity.EventAddressUpdated
+		if r.tombstone {
+			eventType = entity.EventAddressDeleted
+			created[r.addressId] = false // a new address after deletion is created again
+		} else if !created[r.addressId] {
+			eventType = entity.EventAddressCreated
+			created[r.addressId] = true
+		}
+		events = append(events, entity.TimelineEvent{Type: eventType, Timestamp: r.recordTimestamp, RecordId: r.id, Resource: address})
+		if cancelled := db.cancelledAt("insured_addresses_records", r.id); !cancelled.IsZero() {
+			events = append(events, entity.TimelineEvent{Type: entity.EventAddressCancelled, Timestamp: cancelled, RecordId: r.id, Resource: address})
+		}
+	}
+	return events
+}
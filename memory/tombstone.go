@@ -0,0 +1,431 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// DeleteById soft deletes the insured, employee, address, or policy by writing a tombstone recorded now.
+// History is kept: the entity can still be seen as of any time before the deletion.
+// Deleting an insured also deletes its employees and addresses. Deleting an address record deletes its address.
+// Pending (future-dated) changes to deleted entities are cancelled.
+func (db *DB) DeleteById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (deletedRecord entity.InsuredInterface, err error) {
+	if id == 0 {
+		return deletedRecord, ErrRecordIDInvalid
+	}
+	db.mu.Lock()
+	defer db.unlock()
+	deletedRecord, err = db.getById(insuredObj, id)
+	if err != nil || deletedRecord == nil || deletedRecord.GetId() == 0 {
+		return insuredObj, ErrRecordDoesNotExist
+	}
+
+	now := db.Now()
+	switch obj := deletedRecord.(type) {
+	case *entity.Employee:
+		db.deleteEmployee(obj, now)
+	case *entity.Address:
+		db.deleteAddress(obj, now)
+	case *entity.Policy:
+		db.deletePolicy(obj, now)
+	case *entity.Insured:
+		err = db.deleteInsured(obj, now)
+	default:
+		return deletedRecord, fmt.Errorf("Server error.")
+	}
+	if err != nil {
+		return deletedRecord, err
+	}
+	return deletedRecord, db.commit()
+}
+
+// DeletePreviewById returns what DeleteById would delete now, without deleting anything
+func (db *DB) DeletePreviewById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (preview entity.DeletePreview, err error) {
+	if id == 0 {
+		return preview, ErrRecordIDInvalid
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	record, err := db.getById(insuredObj, id)
+	if err != nil || record == nil || record.GetId() == 0 {
+		return preview, ErrRecordDoesNotExist
+	}
+	preview.Resource = record
+	switch obj := record.(type) {
+	case *entity.Employee:
+		preview.EmployeeRecords = 1
+	case *entity.Address:
+		preview.AddressRecords = 1
+	case *entity.Insured:
+		now := db.Now()
+		current, err := db.getInsuredByBitemporalDate(int64(obj.ID), now, now)
+		if err != nil {
+			return preview, err
+		}
+		preview.EmployeeRecords = len(*current.Employees)
+		preview.AddressRecords = len(*current.Addresses)
+	}
+	return preview, nil
+}
+
+// PurgeById permanently deletes the insured, employee, address, policy, or claim record and all of its history.
+// Unlike DeleteById, this cannot be undone and earlier times can no longer be seen.
+func (db *DB) PurgeById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) error {
+	if id == 0 {
+		return ErrRecordIDInvalid
+	}
+	db.mu.Lock()
+	defer db.unlock()
+
+	var table string
+	found := false
+	switch insuredObj.(type) {
+	case *entity.Insured:
+		table = "insured"
+		_, found = db.findInsured(id)
+	case *entity.Employee:
+		table = "employees"
+		found = db.employeeInsuredId(int(id)) != 0
+	case *entity.Address:
+		table = "insured_addresses_records"
+		for _, r := range db.addressRecords {
+			found = found || int64(r.id) == id
+		}
+	case *entity.Policy:
+		table = "policies"
+		found = db.policyOf(int(id)).id != 0
+	case *entity.Claim:
+		table = "claims"
+		found = db.claimOf(int(id)).id != 0
+	default:
+		return fmt.Errorf("Server error.")
+	}
+	if !found {
+		return ErrRecordDoesNotExist
+	}
+	db.emit(Event{Type: EventPurged, Table: table, Id: int(id)})
+	return db.commit()
+}
+
+// purge removes the row of the table, and the records and tombstones that belong to it, as ON DELETE CASCADE does
+func (db *DB) purge(table string, id int) {
+	switch table {
+	case "insured":
+		insureds := db.insureds[:0]
+		for _, row := range db.insureds {
+			if row.id != id {
+				insureds = append(insureds, row)
+			}
+		}
+		db.insureds = insureds
+		db.purgeInsuredRows(id)
+	case "employees":
+		employees := db.employees[:0]
+		for _, row := range db.employees {
+			if row.id != id {
+				employees = append(employees, row)
+			}
+		}
+		db.employees = employees
+		db.purgeEmployeeRecords(func(r employeeRecord) bool { return r.employeeId == id })
+	case "insured_addresses_records": // id is a record's: purge its address, with every record and tombstone
+		addressId := 0
+		for _, r := range db.addressRecords {
+			if r.id == id {
+				addressId = r.addressId
+			}
+		}
+		if addressId == 0 {
+			return
+		}
+		addresses := db.addresses[:0]
+		for _, row := range db.addresses {
+			if row.id != addressId {
+				addresses = append(addresses, row)
+			}
+		}
+		db.addresses = addresses
+		records := db.addressRecords[:0]
+		for _, r := range db.addressRecords {
+			if r.addressId != addressId {
+				records = append(records, r)
+			}
+		}
+		db.addressRecords = records
+	case "policies":
+		policies := db.policies[:0]
+		for _, row := range db.policies {
+			if row.id != id {
+				policies = append(policies, row)
+			}
+		}
+		db.policies = policies
+		db.purgePolicyRecords(func(r policyRecord) bool { return r.policyId == id })
+	case "claims":
+		claims := db.claims[:0]
+		for _, row := range db.claims {
+			if row.id != id {
+				claims = append(claims, row)
+			}
+		}
+		db.claims = claims
+		db.purgeClaimRecords(func(r claimRecord) bool { return r.claimId == id })
+	}
+	db.purgeCancellations()
+}
+
+// cancel adds a cancellation of the employee, address, or policy record. The record is not changed.
+func (db *DB) cancel(table string, id int, cancelled time.Time) {
+	db.cancellations = append(db.cancellations, cancellation{table: table, recordId: id, recordTimestamp: cancelled})
+}
+
+// purgeCancellations removes the cancellations of records that were purged
+func (db *DB) purgeCancellations() {
+	exists := map[string]map[int]bool{"employees_records": {}, "insured_addresses_records": {}, "policies_records": {}}
+	for _, r := range db.employeeRecords {
+		exists["employees_records"][r.id] = true
+	}
+	for _, r := range db.addressRecords {
+		exists["insured_addresses_records"][r.id] = true
+	}
+	for _, r := range db.policyRecords {
+		exists["policies_records"][r.id] = true
+	}
+	cancellations := db.cancellations[:0]
+	for _, c := range db.cancellations {
+		if exists[c.table][c.recordId] {
+			cancellations = append(cancellations, c)
+		}
+	}
+	db.cancellations = cancellations
+}
+
+// purgeInsuredRows removes the rows of every table that belong to the insured
+func (db *DB) purgeInsuredRows(insuredId int) {
+	employees := db.employees[:0]
+	for _, row := range db.employees {
+		if row.insuredId != insuredId {
+			employees = append(employees, row)
+		}
+	}
+	db.employees = employees
+	db.purgeEmployeeRecords(func(r employeeRecord) bool { return r.insuredId == insuredId })
+
+	addresses := db.addresses[:0]
+	for _, row := range db.addresses {
+		if row.insuredId != insuredId {
+			addresses = append(addresses, row)
+		}
+	}
+	db.addresses = addresses
+	addressRecords := db.addressRecords[:0]
+	for _, r := range db.addressRecords {
+		if r.insuredId != insuredId {
+			addressRecords = append(addressRecords, r)
+		}
+	}
+	db.addressRecords = addressRecords
+
+	policies := db.policies[:0]
+	for _, row := range db.policies {
+		if row.insuredId != insuredId {
+			policies = append(policies, row)
+		}
+	}
+	db.policies = policies
+	db.purgePolicyRecords(func(r policyRecord) bool { return r.insuredId == insuredId })
+
+	claims := db.claims[:0]
+	for _, row := range db.claims {
+		if row.insuredId != insuredId {
+			claims = append(claims, row)
+		}
+	}
+	db.claims = claims
+	db.purgeClaimRecords(func(r claimRecord) bool { return r.insuredId == insuredId })
+
+	tombstones := db.tombstones[:0]
+	for _, t := range db.tombstones {
+		if t.insuredId != insuredId {
+			tombstones = append(tombstones, t)
+		}
+	}
+	db.tombstones = tombstones
+}
+
+// purgeEmployeeRecords removes the employee records matching purge
+func (db *DB) purgeEmployeeRecords(purge func(r employeeRecord) bool) {
+	records := db.employeeRecords[:0]
+	for _, r := range db.employeeRecords {
+		if !purge(r) {
+			records = append(records, r)
+		}
+	}
+	db.employeeRecords = records
+}
+
+// purgePolicyRecords removes the policy records matching purge
+func (db *DB) purgePolicyRecords(purge func(r policyRecord) bool) {
+	records := db.policyRecords[:0]
+	for _, r := range db.policyRecords {
+		if !purge(r) {
+			records = append(records, r)
+		}
+	}
+	db.policyRecords = records
+}
+
+// purgeClaimRecords removes the claim records matching purge
+func (db *DB) purgeClaimRecords(purge func(r claimRecord) bool) {
+	records := db.claimRecords[:0]
+	for _, r := range db.claimRecords {
+		if !purge(r) {
+			records = append(records, r)
+		}
+	}
+	db.claimRecords = records
+}
+
+// deleteEmployee writes a tombstone employee record, effective now
+func (db *DB) deleteEmployee(employee *entity.Employee, now time.Time) {
+	db.cancelPendingEmployee(employee.ID, now)
+	db.emit(employeeRecord{
+		version: version{
+			id:              db.nextId("employees_records"),
+			recordTimestamp: unixTime(now),
+			validFrom:       unixTime(now),
+			tombstone:       true,
+		},
+		employeeId: employee.ID,
+		insuredId:  employee.InsuredId,
+		name:       employee.Name,
+		startDate:  shortDate(employee.StartDate),
+		endDate:    shortDate(employee.EndDate),
+	}.event())
+}
+
+// deleteAddress writes a tombstone record for the address, effective now
+func (db *DB) deleteAddress(address *entity.Address, now time.Time) {
+	db.cancelPendingAddress(address.AddressId, now)
+	db.emit(addressRecord{
+		version: version{
+			id:              db.nextId("insured_addresses_records"),
+			recordTimestamp: unixTime(now),
+			validFrom:       unixTime(now),
+			tombstone:       true,
+		},
+		addressId:  address.AddressId,
+		address:    address.Address,
+		line1:      address.Line1,
+		line2:      address.Line2,
+		city:       address.City,
+		region:     address.Region,
+		postalCode: address.PostalCode,
+		country:    address.Country,
+		insuredId:  address.InsuredId,
+	}.event())
+}
+
+// deletePolicy writes a tombstone policy record, effective now
+func (db *DB) deletePolicy(policy *entity.Policy, now time.Time) {
+	db.cancelPendingPolicy(policy.ID, now)
+	db.emit(policyRecord{
+		version: version{
+			id:              db.nextId("policies_records"),
+			recordTimestamp: unixTime(now),
+			validFrom:       unixTime(now),
+			tombstone:       true,
+		},
+		policyId:        policy.ID,
+		term:            policy.Term,
+		effectiveDate:   shortDate(policy.EffectiveDate),
+		expirationDate:  shortDate(policy.ExpirationDate),
+		occurrenceLimit: policy.OccurrenceLimit,
+		aggregateLimit:  policy.AggregateLimit,
+		premium:         policy.Premium,
+	}.event())
+}
+
+// deleteInsured writes an insured tombstone, and tombstones for its current employees and addresses
+func (db *DB) deleteInsured(insured *entity.Insured, now time.Time) error {
+	current, err := db.getInsuredByBitemporalDate(int64(insured.ID), now, now)
+	if err != nil {
+		return err
+	}
+	for _, employee := range *current.Employees {
+		employee := employee
+		db.deleteEmployee(&employee, now)
+	}
+	for _, address := range *current.Addresses {
+		address := address
+		db.deleteAddress(&address, now)
+	}
+	db.emit(Event{Type: EventDeleted, Id: db.nextId("insured_tombstones"), InsuredId: insured.ID, RecordTimestamp: now.Unix()})
+	return nil
+}
+
+// insuredDeletedAt returns true if the insured was deleted (and not restored) by asOfValid, as known at asOfRecorded.
+// Deletion and restore take effect when they are recorded.
+func (db *DB) insuredDeletedAt(insuredId int64, asOfValid time.Time, asOfRecorded time.Time) bool {
+	deleted := false
+	for _, t := range db.tombstones {
+		if int64(t.insuredId) == insuredId && t.recordTimestamp.Unix() <= asOfValid.Unix() && t.recordTimestamp.Unix() <= asOfRecorded.Unix() {
+			deleted = !t.restore
+		}
+	}
+	return deleted
+}
+
+// insuredNotDeleted returns true if the insured has no tombstone, or was restored since
+func (db *DB) insuredNotDeleted(insuredId int) bool {
+	notDeleted := true
+	for _, t := range db.tombstones {
+		if t.insuredId == insuredId {
+			notDeleted = t.restore
+		}
+	}
+	return notDeleted
+}
+
+// addressNotDeleted returns true if the record is not a tombstone, and no tombstone for its address was written after it
+func (db *DB) addressNotDeleted(r addressRecord) bool {
+	if r.tombstone {
+		return false
+	}
+	for _, d := range db.addressRecords {
+		if d.addressId == r.addressId && d.tombstone && d.id > r.id {
+			return false
+		}
+	}
+	return true
+}
+
+// cancelPendingEmployee cancels the employee's pending (future-dated) records, as of now
+func (db *DB) cancelPendingEmployee(employeeId int, now time.Time) {
+	for _, r := range db.employeeRecords {
+		if r.employeeId == employeeId && r.validFrom.Unix() > now.Unix() && db.cancelledAt("employees_records", r.id).IsZero() {
+			db.emit(Event{Type: EventCancelled, Table: "employees_records", Id: r.id, Cancelled: now.Unix()})
+		}
+	}
+}
+
+// cancelPendingAddress cancels the address's pending (future-dated) records, as of now
+func (db *DB) cancelPendingAddress(addressId int, now time.Time) {
+	for _, r := range db.addressRecords {
+		if r.addressId == addressId && r.validFrom.Unix() > now.Unix() && db.cancelledAt("insured_addresses_records", r.id).IsZero() {
+			db.emit(Event{Type: EventCancelled, Table: "insured_addresses_records", Id: r.id, Cancelled: now.Unix()})
+		}
+	}
+}
+
+// cancelPendingPolicy cancels the policy's pending (future-dated) records, as of now
+func (db *DB) cancelPendingPolicy(policyId int, now time.Time) {
+	for _, r := range db.policyRecords {
+		if r.policyId == policyId && r.validFrom.Unix() > now.Unix() && db.cancelledAt("policies_records", r.id).IsZero() {
+			db.emit(Event{Type: EventCancelled, Table: "policies_records", Id: r.id, Cancelled: now.Unix()})
+		}
+	}
+}
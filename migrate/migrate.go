@@ -0,0 +1,379 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Versioned migrations for packages sqlite and postgres.
+// A backend embeds "migration/{version}.up.sql" and "migration/{version}.down.sql" files.
+// A file name may add a description: "2_valid_time.up.sql".
+// Applied versions are kept in the schema_migrations table with the checksum of their up SQL,
+// so a migration edited after it was applied is detected. Migrations change the schema only: seed data is in package seed.
+
+// Migration is a numbered schema change and its rollback
+type Migration struct {
+	Version  int
+	Name     string // up file name
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up
+}
+
+// Status is a migration and whether it is applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Changed   bool // applied with a different checksum: the file was edited since
+}
+
+var ErrChecksumMismatch = errors.New("migration was changed after it was applied")
+var ErrUnknownVersion = errors.New("database has a migration this version does not have")
+var ErrNoDownMigration = errors.New("migration has no down migration")
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration // by version
+	rebind     func(query string) string
+
+	// DryRun prints the SQL that would run to Out, instead of running it
+	DryRun bool
+	Out    io.Writer
+
+	Now func() time.Time
+}
+
+// New returns a Migrator for db, with the migrations in fsys.
+// rebind rewrites the "?" placeholders of the Migrator's queries for the database; nil for none.
+func New(db *sql.DB, fsys fs.FS, rebind func(query string) string) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if rebind == nil {
+		rebind = func(query string) string { return query }
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		rebind:     rebind,
+		Out:        os.Stdout,
+		Now:        time.Now,
+	}, nil
+}
+
+var migrationFile = regexp.MustCompile(`^([0-9]+)(_[A-Za-z0-9_]+)?\.(up|down)\.sql$`)
+
+// Load reads the migrations in the "migration" directory of fsys, in version order.
+// Versions are numbers, so "10.up.sql" comes after "2.up.sql".
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migration")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %q: want {version}.up.sql or {version}.down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		buf, err := fs.ReadFile(fsys, path.Join("migration", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+		if match[3] == "up" {
+			if m.Name != "" {
+				return nil, fmt.Errorf("migration %v: %q and %q", version, m.Name, entry.Name())
+			}
+			m.Name, m.Up = entry.Name(), string(buf)
+			m.Checksum = checksum(buf)
+		} else {
+			m.Down = string(buf)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Name == "" {
+			return nil, fmt.Errorf("migration %v has a down file but no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func checksum(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// applied is a row of schema_migrations
+type applied struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// Status returns every migration, applied or not, by version. Creates the tracking table if needed.
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	done, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i].Migration = migration
+		if a, ok := done[migration.Version]; ok {
+			statuses[i].Applied, statuses[i].AppliedAt = true, a.appliedAt
+			statuses[i].Changed = a.checksum != migration.Checksum
+		}
+	}
+	return statuses, nil
+}
+
+// Version returns the highest applied version, 0 if none
+func (m *Migrator) Version() (int, error) {
+	done, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range done {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Up applies every migration not applied yet, in order
+func (m *Migrator) Up() error {
+	return m.To(m.latest())
+}
+
+// Down rolls back the highest applied migration
+func (m *Migrator) Down() error {
+	version, err := m.Version()
+	if err != nil || version == 0 {
+		return err
+	}
+	done, err := m.applied()
+	if err != nil {
+		return err
+	}
+	to := 0
+	for v := range done {
+		if v < version && v > to {
+			to = v
+		}
+	}
+	return m.To(to)
+}
+
+// To applies the migrations up to version, and rolls back those after it, newest first.
+// Applied migrations must match their checksums.
+func (m *Migrator) To(version int) error {
+	if version != 0 && m.migration(version).Version == 0 {
+		return fmt.Errorf("no migration %v", version)
+	}
+	if err := m.init(); err != nil {
+		return err
+	}
+	done, err := m.verify()
+	if err != nil {
+		return err
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := done[migration.Version]; ok && migration.Version > version {
+			if err := m.down(migration); err != nil {
+				return fmt.Errorf("migration %v down: %w", migration.Version, err)
+			}
+		}
+	}
+	for _, migration := range m.migrations {
+		if _, ok := done[migration.Version]; !ok && migration.Version <= version {
+			if err := m.up(migration); err != nil {
+				return fmt.Errorf("migration %v (%s): %w", migration.Version, migration.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) up(migration Migration) error {
+	return m.exec(fmt.Sprintf("%v up (%s)", migration.Version, migration.Name), migration.Up,
+		`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+		migration.Version, migration.Name, migration.Checksum, m.Now().Unix())
+}
+
+func (m *Migrator) down(migration Migration) error {
+	if migration.Down == "" {
+		return ErrNoDownMigration
+	}
+	return m.exec(fmt.Sprintf("%v down", migration.Version), migration.Down,
+		`DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+}
+
+// exec runs the SQL of a migration and records it, in one transaction.
+// In a dry run it prints the SQL instead.
+func (m *Migrator) exec(title string, query string, record string, args ...interface{}) error {
+	if m.DryRun {
+		_, err := fmt.Fprintf(m.Out, "-- %s\n%s\n", title, query)
+		return err
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(m.rebind(record), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// init creates the schema_migrations table, and moves the versions of the old migrations table to schema_migrations
+func (m *Migrator) init() error {
+	if m.DryRun {
+		return nil
+	}
+	if _, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, checksum TEXT NOT NULL, applied_at BIGINT NOT NULL);`); err != nil {
+		return fmt.Errorf("cannot create schema_migrations table: %w", err)
+	}
+	var n int
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&n); err != nil || n != 0 {
+		return err
+	}
+	legacy := m.legacy()
+	if len(legacy) == 0 {
+		return nil
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for version, a := range legacy {
+		if _, err := tx.Exec(m.rebind(`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`),
+			version, m.migration(version).Name, a.checksum, a.appliedAt.Unix()); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DROP TABLE migrations`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// legacy returns the versions recorded in the old migrations table ("migration/{version}.sql"), if there is one.
+// They are taken to match the current files.
+func (m *Migrator) legacy() map[int]applied {
+	rows, err := m.db.Query(`SELECT name FROM migrations`)
+	if err != nil {
+		return nil // no old table
+	}
+	defer rows.Close()
+	legacy := map[int]applied{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil
+		}
+		var version int
+		if _, err := fmt.Sscanf(path.Base(name), "%d.sql", &version); err != nil {
+			continue
+		}
+		if migration := m.migration(version); migration.Version != 0 {
+			legacy[version] = applied{checksum: migration.Checksum, appliedAt: m.Now()}
+		}
+	}
+	return legacy
+}
+
+// applied returns the applied versions. Before init (as in a dry run), those of the old migrations table.
+func (m *Migrator) applied() (map[int]applied, error) {
+	rows, err := m.db.Query(`SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		if m.DryRun {
+			return m.legacy(), nil // no schema_migrations table yet
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	done := map[int]applied{}
+	for rows.Next() {
+		var version int
+		var a applied
+		var appliedAt int64
+		if err := rows.Scan(&version, &a.checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		a.appliedAt = time.Unix(appliedAt, 0).UTC()
+		done[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(done) == 0 {
+		return m.legacy(), nil
+	}
+	return done, nil
+}
+
+// verify returns the applied versions. Error if one was changed since, or is not one of the migrations.
+func (m *Migrator) verify() (map[int]applied, error) {
+	done, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	for version, a := range done {
+		migration := m.migration(version)
+		if migration.Version == 0 {
+			return nil, fmt.Errorf("%w: %v", ErrUnknownVersion, version)
+		} else if a.checksum != migration.Checksum {
+			return nil, fmt.Errorf("%w: %v (%s)", ErrChecksumMismatch, version, migration.Name)
+		}
+	}
+	return done, nil
+}
+
+// migration returns the migration with the version, or a zero Migration
+func (m *Migrator) migration(version int) Migration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return Migration{}
+}
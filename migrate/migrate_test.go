@@ -0,0 +1,200 @@
+package migrate_test
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/nickcoast/timetravel/migrate"
+)
+
+// testFS has migrations 1, 2, and 10
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"migration/1.up.sql":            {Data: []byte(`CREATE TABLE a (id INTEGER PRIMARY KEY, name TEXT);`)},
+		"migration/1.down.sql":          {Data: []byte(`DROP TABLE a;`)},
+		"migration/2_b.up.sql":          {Data: []byte(`CREATE TABLE b (id INTEGER PRIMARY KEY);`)},
+		"migration/2_b.down.sql":        {Data: []byte(`DROP TABLE b;`)},
+		"migration/10_a_email.up.sql":   {Data: []byte(`ALTER TABLE a ADD COLUMN email TEXT;`)},
+		"migration/10_a_email.down.sql": {Data: []byte(`ALTER TABLE a DROP COLUMN email;`)},
+	}
+}
+
+// MustOpen returns a new in-memory database. Fatal on error.
+func MustOpen(tb testing.TB) *sql.DB {
+	tb.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // one connection, one database
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// MustNew returns a Migrator for db and fsys. Fatal on error.
+func MustNew(tb testing.TB, db *sql.DB, fsys fstest.MapFS) *migrate.Migrator {
+	tb.Helper()
+	migrator, err := migrate.New(db, fsys, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return migrator
+}
+
+// applied returns the applied versions, in order
+func applied(tb testing.TB, migrator *migrate.Migrator) (versions []int) {
+	tb.Helper()
+	statuses, err := migrator.Status()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+	return versions
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := migrate.Load(testFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	// numeric order: "10" after "2"
+	if got, want := versions, []int{1, 2, 10}; !equal(got, want) {
+		t.Fatalf("versions=%v, want %v", got, want)
+	}
+
+	fsys := testFS()
+	fsys["migration/3.sql"] = &fstest.MapFile{Data: []byte(`SELECT 1;`)}
+	if _, err := migrate.Load(fsys); err == nil {
+		t.Fatal("expected error for a file without up or down")
+	}
+}
+
+func TestMigrator_UpDownTo(t *testing.T) {
+	db := MustOpen(t)
+	migrator := MustNew(t, db, testFS())
+
+	if err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	} else if got, want := applied(t, migrator), []int{1, 2, 10}; !equal(got, want) {
+		t.Fatalf("applied=%v, want %v", got, want)
+	}
+	if _, err := db.Exec(`INSERT INTO a (name, email) VALUES ('x', 'x@example.com')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrator.Down(); err != nil {
+		t.Fatal(err)
+	} else if got, want := applied(t, migrator), []int{1, 2}; !equal(got, want) {
+		t.Fatalf("applied=%v, want %v", got, want)
+	}
+	if _, err := db.Exec(`SELECT email FROM a`); err == nil {
+		t.Fatal("expected column email to be dropped")
+	}
+
+	if err := migrator.To(1); err != nil {
+		t.Fatal(err)
+	} else if got, want := applied(t, migrator), []int{1}; !equal(got, want) {
+		t.Fatalf("applied=%v, want %v", got, want)
+	}
+	if err := migrator.To(10); err != nil {
+		t.Fatal(err)
+	} else if got, want := applied(t, migrator), []int{1, 2, 10}; !equal(got, want) {
+		t.Fatalf("applied=%v, want %v", got, want)
+	}
+	if err := migrator.To(3); err == nil {
+		t.Fatal("expected error for an unknown version")
+	}
+	if err := migrator.To(0); err != nil {
+		t.Fatal(err)
+	} else if got := applied(t, migrator); len(got) != 0 {
+		t.Fatalf("applied=%v, want none", got)
+	}
+}
+
+// A migration edited after it was applied is detected
+func TestMigrator_Checksum(t *testing.T) {
+	db := MustOpen(t)
+	if err := MustNew(t, db, testFS()).To(2); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := testFS()
+	fsys["migration/1.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE a (id INTEGER PRIMARY KEY, name TEXT NOT NULL);`)}
+	migrator := MustNew(t, db, fsys)
+	if err := migrator.Up(); !errors.Is(err, migrate.ErrChecksumMismatch) {
+		t.Fatalf("err=%v, want %v", err, migrate.ErrChecksumMismatch)
+	}
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	} else if !statuses[0].Changed || statuses[1].Changed || statuses[2].Applied {
+		t.Fatalf("statuses=%+v", statuses)
+	}
+}
+
+// A dry run prints the SQL, and changes nothing
+func TestMigrator_DryRun(t *testing.T) {
+	db := MustOpen(t)
+	migrator := MustNew(t, db, testFS())
+	if err := migrator.To(1); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	migrator.DryRun, migrator.Out = true, &out
+	if err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "CREATE TABLE b") || !strings.Contains(got, "ADD COLUMN email") || strings.Contains(got, "CREATE TABLE a") {
+		t.Fatalf("out=%q", got)
+	}
+	migrator.DryRun = false
+	if got, want := applied(t, migrator), []int{1}; !equal(got, want) {
+		t.Fatalf("applied=%v, want %v", got, want)
+	}
+}
+
+// Versions applied with the old migrations table are not applied again
+func TestMigrator_Legacy(t *testing.T) {
+	db := MustOpen(t)
+	if _, err := db.Exec(`CREATE TABLE migrations (name TEXT PRIMARY KEY);
+		INSERT INTO migrations (name) VALUES ('migration/1.sql');
+		CREATE TABLE a (id INTEGER PRIMARY KEY, name TEXT);`); err != nil {
+		t.Fatal(err)
+	}
+	migrator := MustNew(t, db, testFS())
+	if err := migrator.Up(); err != nil { // would fail creating table a again
+		t.Fatal(err)
+	} else if got, want := applied(t, migrator), []int{1, 2, 10}; !equal(got, want) {
+		t.Fatalf("applied=%v, want %v", got, want)
+	}
+	if _, err := db.Exec(`SELECT name FROM migrations`); err == nil {
+		t.Fatal("expected the old migrations table to be dropped")
+	}
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
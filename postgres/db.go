@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/nickcoast/timetravel/migrate"
+	"github.com/nickcoast/timetravel/sqlstore"
+)
+
+// PostgreSQL backend. Same schema as package sqlite, and the same reads and writes (sqlstore.DB's),
+// so the service can use either. Timestamps are stored as unix seconds in both.
+
+//go:embed migration/*.sql
+var migrationFS embed.FS
+
+type DB struct {
+	sqlstore.DB
+	ctx    context.Context
+	cancel func()
+	DSN    string
+}
+
+func NewDB(dsn string) *DB {
+	db := &DB{
+		DB:  sqlstore.DB{Dialect: dialect{}, Now: time.Now},
+		DSN: dsn,
+	}
+	db.ctx, db.cancel = context.WithCancel(context.Background())
+	return db
+}
+
+// Errors are sqlstore's, so callers handle errors from every SQL backend alike
+var ErrRecordDoesNotExist = sqlstore.ErrRecordDoesNotExist
+var ErrRecordIDInvalid = sqlstore.ErrRecordIDInvalid
+var ErrRecordAlreadyExists = sqlstore.ErrRecordAlreadyExists
+var ErrRecordMatchingCriteriaDoesNotExist = sqlstore.ErrRecordMatchingCriteriaDoesNotExist
+var ErrUpdateMustChangeAValue = sqlstore.ErrUpdateMustChangeAValue
+var ErrRecordNotPending = sqlstore.ErrRecordNotPending
+var ErrInsuredDeleted = sqlstore.ErrInsuredDeleted
+
+// Open connects to the database and applies pending migrations. Seed data is added by service.SqliteRecordService.Seed.
+func (db *DB) Open() (err error) {
+	if err := db.Connect(); err != nil {
+		return err
+	}
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+	if err := migrator.Up(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+// Connect connects to the database without migrating it, e.g. to run migrations by hand
+func (db *DB) Connect() (err error) {
+	if db.DSN == "" {
+		return fmt.Errorf("dsn required")
+	}
+	if db.SQL, err = sql.Open("postgres", db.DSN); err != nil {
+		return err
+	}
+	if err := db.SQL.PingContext(db.ctx); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	return nil
+}
+
+// Migrator returns the migrations of the database, in migration/
+func (db *DB) Migrator() (*migrate.Migrator, error) {
+	migrator, err := migrate.New(db.SQL, migrationFS, dialect{}.Rebind)
+	if err != nil {
+		return nil, err
+	}
+	migrator.Now = db.Now
+	return migrator, nil
+}
+
+// Close closes the database connection.
+func (db *DB) Close() error {
+	db.cancel()
+	if db.SQL != nil {
+		return db.SQL.Close()
+	}
+	return nil
+}
+
+// dialect is PostgreSQL's sqlstore.Dialect
+type dialect struct{}
+
+// Rebind numbers the "?" placeholders in query: $1, $2, ...
+// Queries in sqlstore have no other "?".
+func (dialect) Rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(`$` + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Insert runs the INSERT with RETURNING id: lib/pq has no LastInsertId
+func (dialect) Insert(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (id int64, err error) {
+	err = tx.QueryRowContext(ctx, strings.TrimRight(query, " \t\n")+"\n"+`RETURNING id`, args...).Scan(&id)
+	return id, err
+}
+
+// LockPolicyNumbers locks the insured table, which policy numbers are read from with policies, until tx ends
+func (dialect) LockPolicyNumbers(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `LOCK TABLE insured IN SHARE ROW EXCLUSIVE MODE`)
+	return err
+}
+
+func (dialect) ForUpdate() string {
+	return `FOR UPDATE`
+}
+
+// FormatError returns err as one of sqlstore's errors, if possible.
+// Otherwise returns the original error.
+func (dialect) FormatError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		return ErrRecordAlreadyExists
+	}
+	return err
+}
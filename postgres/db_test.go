@@ -0,0 +1,421 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/postgres"
+	"github.com/nickcoast/timetravel/seed"
+	"github.com/nickcoast/timetravel/service"
+)
+
+// Tests run against an embedded PostgreSQL server, downloaded on first use, or against the server named, e.g.
+// TIMETRAVEL_POSTGRES_TEST_DSN="postgres://postgres@localhost/postgres?sslmode=disable" go test ./postgres
+// Each test gets a new schema, with the fixture set it asks for.
+const dsnEnv = "TIMETRAVEL_POSTGRES_TEST_DSN"
+
+// dsn is the server the tests use
+var dsn = os.Getenv(dsnEnv)
+
+// noServer is why there is no server to test against, e.g. the embedded one cannot be downloaded offline.
+// Tests are skipped if it is set.
+var noServer string
+
+// TestMain starts the embedded server, if no server is named, and stops it when the tests end
+func TestMain(m *testing.M) {
+	if dsn != "" {
+		os.Exit(m.Run())
+	}
+	stop, err := startEmbedded()
+	if err != nil {
+		noServer = fmt.Sprintf("cannot start embedded postgres (set %s to use another server): %v", dsnEnv, err)
+		fmt.Fprintln(os.Stderr, noServer)
+		os.Exit(m.Run())
+	}
+	code := m.Run()
+	if err := stop(); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot stop embedded postgres: %v\n", err)
+	}
+	os.Exit(code)
+}
+
+// startEmbedded starts an embedded server on a free port, and sets dsn to it.
+// Returns a function that stops the server and removes its files.
+func startEmbedded() (stop func() error, err error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	port := uint32(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+	runtime, err := os.MkdirTemp("", "timetravel-postgres-")
+	if err != nil {
+		return nil, err
+	}
+	config := embeddedpostgres.DefaultConfig().Port(port).RuntimePath(runtime).Logger(io.Discard)
+	server := embeddedpostgres.NewDatabase(config)
+	if err := server.Start(); err != nil {
+		os.RemoveAll(runtime)
+		return nil, err
+	}
+	dsn = config.GetConnectionURL() + "?sslmode=disable"
+	return func() error {
+		defer os.RemoveAll(runtime)
+		return server.Stop()
+	}, nil
+}
+
+// Ensure the test database can open & close.
+func TestDB(t *testing.T) {
+	db := MustOpenDB(t, "demo")
+	MustCloseDB(t, db)
+}
+
+// MustOpenDB returns a new, open DB with the fixture set named, e.g. "demo", in its own schema, dropped when the test ends.
+func MustOpenDB(tb testing.TB, fixtures string) *postgres.DB {
+	tb.Helper()
+	if noServer != "" {
+		tb.Skip(noServer)
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	schema := fmt.Sprintf("timetravel_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	db := postgres.NewDB(withSearchPath(tb, dsn, schema))
+	if err := db.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	if fixtures != "" {
+		MustSeed(tb, db, fixtures)
+	}
+	return db
+}
+
+// MustSeed adds the fixture set named, e.g. "demo", through the service. Fatal on error.
+func MustSeed(tb testing.TB, db service.Store, name string) {
+	tb.Helper()
+	set, err := seed.Load(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := service.NewSqliteRecordService(db)
+	if err := s.Seed(context.Background(), set); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// withSearchPath sets the schema of a URL or key=value DSN
+func withSearchPath(tb testing.TB, dsn string, schema string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// MustCloseDB closes the DB. Fatal on error.
+func MustCloseDB(tb testing.TB, db *postgres.DB) {
+	tb.Helper()
+	if err := db.Close(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// MustCreateInsured creates an insured in the database. Fatal on error.
+func MustCreateInsured(tb testing.TB, ctx context.Context, db *postgres.DB, insured *entity.Insured) entity.Insured {
+	tb.Helper()
+	if _, err := db.CreateInsured(ctx, insured); err != nil {
+		tb.Fatal(err)
+	}
+	return *insured
+}
+
+// MustCreateAddress creates an address in the database. Fatal on error.
+func MustCreateAddress(tb testing.TB, ctx context.Context, db *postgres.DB, address *entity.Address) {
+	tb.Helper()
+	if _, err := db.CreateAddress(ctx, address); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// Temporal reads give the same results for the fixtures as in package sqlite
+func TestQuery_Fixtures(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	tb.Run("GetAll", func(tb *testing.T) {
+		for _, tt := range []struct {
+			obj  entity.InsuredInterface
+			want int
+		}{
+			{&entity.Insured{}, 2},
+			{&entity.Employee{}, 5},
+			{&entity.Address{}, 4},
+		} {
+			records, err := db.GetAll(ctx, tt.obj)
+			if err != nil {
+				tb.Fatal(err)
+			} else if got := len(records); got != tt.want {
+				tb.Fatalf("%T: len=%v, want %v", tt.obj, got, tt.want)
+			}
+		}
+	})
+	tb.Run("GetAllByEntityId", func(tb *testing.T) {
+		records, err := db.GetAllByEntityId(ctx, &entity.Employee{}, 2)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := len(records), 3; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		}
+	})
+	tb.Run("GetById", func(tb *testing.T) {
+		address, err := db.GetAddressById(ctx, entity.Address{}, 3)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := address.InsuredId, 1; got != want {
+			tb.Fatalf("InsuredId=%v, want %v", got, want)
+		}
+		insured, err := db.GetInsuredById(ctx, entity.Insured{}, 2)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := insured.PolicyNumber, 1001; got != want {
+			tb.Fatalf("PolicyNumber=%v, want %v", got, want)
+		}
+	})
+	tb.Run("GetByDate", func(tb *testing.T) {
+		for _, tt := range []struct {
+			timestamp int64
+			employees []string
+			address   string
+		}{
+			{468072000, []string{"1984-10-01 0001-01-01"}, "123 Fake St, Springfield, Oregon"},
+			{469368001, []string{"1984-10-01 0001-01-01", "1984-11-10 0001-01-01"}, "123 REAL St, Springfield, Oregon"},
+			{820584000, []string{"1984-10-01 0001-01-01", "1984-11-10 1996-01-02"}, ""},
+			{852206401, []string{"1984-10-01 0001-01-01", "1984-11-10 1996-06-01"}, "Mars"},
+		} {
+			date := time.Unix(tt.timestamp, 0)
+			records, err := db.GetByDate(ctx, &entity.Employee{}, "", 1, date)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			var employees []string
+			for _, record := range records {
+				employee := record.(*entity.Employee)
+				employees = append(employees, employee.StartDate.Format("2006-01-02")+" "+employee.EndDate.Format("2006-01-02"))
+			}
+			sort.Strings(employees)
+			if got, want := strings.Join(employees, ","), strings.Join(tt.employees, ","); got != want {
+				tb.Fatalf("%v: Employees=%v, want %v", tt.timestamp, got, want)
+			}
+			if tt.address == "" {
+				continue
+			}
+			records, err = db.GetByDate(ctx, &entity.Address{}, "", 1, date)
+			if err != nil {
+				tb.Fatal(err)
+			} else if got, want := len(records), 1; got != want {
+				tb.Fatalf("%v: len(Addresses)=%v, want %v", tt.timestamp, got, want)
+			} else if got := records[0].(*entity.Address).Address; got != tt.address {
+				tb.Fatalf("%v: Address=%v, want %v", tt.timestamp, got, tt.address)
+			}
+		}
+	})
+}
+
+func TestDB_Create(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second).Add(-time.Minute) // so the update a second later is not in the future
+
+	insured := MustCreateInsured(tb, ctx, db, &entity.Insured{Name: "sue", RecordTimestamp: now})
+	if got, want := insured.ID, 3; got != want {
+		tb.Fatalf("ID=%v, want %v", got, want)
+	} else if got, want := insured.PolicyNumber, 1002; got != want {
+		tb.Fatalf("PolicyNumber=%v, want %v", got, want)
+	}
+
+	startDate, _ := time.Parse("2006-01-02", "2020-01-01")
+	employee := &entity.Employee{Name: "Sue", StartDate: startDate, InsuredId: insured.ID, RecordTimestamp: now}
+	if _, err := db.CreateEmployee(ctx, employee); err != nil {
+		tb.Fatal(err)
+	} else if got, want := employee.ID, 6; got != want {
+		tb.Fatalf("ID=%v, want %v", got, want)
+	}
+	if _, err := db.UpdateEmployee(ctx, employee); err != postgres.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, postgres.ErrUpdateMustChangeAValue)
+	}
+	updated := *employee
+	updated.Name = "Sue Smith"
+	updated.RecordTimestamp = now.Add(time.Second)
+	if _, err := db.UpdateEmployee(ctx, &updated); err != nil {
+		tb.Fatal(err)
+	}
+	current, err := db.GetEmployeeById(ctx, entity.Employee{}, int64(employee.ID))
+	if err != nil {
+		tb.Fatal(err)
+	} else if got, want := current.Name, "Sue Smith"; got != want {
+		tb.Fatalf("Name=%v, want %v", got, want)
+	}
+
+	MustCreateAddress(tb, ctx, db, &entity.Address{Address: "1 Main Street", InsuredId: insured.ID, RecordTimestamp: now})
+	if count, err := db.CountInsuredAddresses(ctx, insured); err != nil {
+		tb.Fatal(err)
+	} else if count != 1 {
+		tb.Fatalf("count=%v, want 1", count)
+	}
+}
+
+func TestDB_GetByBitemporalDate(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	// Learned today that insured 1 was at a different address from 1990 on
+	validFrom, _ := time.Parse("2006-01-02", "1990-01-01")
+	now := time.Now().UTC().Truncate(time.Second)
+	MustCreateAddress(tb, ctx, db, &entity.Address{AddressId: 1, Address: "742 Evergreen Terrace", InsuredId: 1, RecordTimestamp: now, ValidFrom: validFrom})
+
+	asOfValid, _ := time.Parse("2006-01-02", "1995-01-01")
+	known, _ := time.Parse("2006-01-02", "2000-01-01")
+	for _, tt := range []struct {
+		known time.Time
+		want  string
+	}{
+		{known, "123 REAL St, Springfield, Oregon"},
+		{now, "742 Evergreen Ter"},
+	} {
+		records, err := db.GetByBitemporalDate(ctx, &entity.Address{}, 1, asOfValid, tt.known)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		addresses, _ := entity.AddressesFromInsuredInterface(records)
+		if got, want := len(addresses), 1; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		} else if got := addresses[0].Address; got != tt.want {
+			tb.Fatalf("known %v: Address=%v, want %v", tt.known, got, tt.want)
+		}
+	}
+}
+
+func TestDB_DeleteById(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	deletedAt, _ := time.Parse("2006-01-02", "2010-01-01")
+	db.Now = func() time.Time { return deletedAt }
+	before, _ := time.Parse("2006-01-02", "2009-01-01")
+	after, _ := time.Parse("2006-01-02", "2011-01-01")
+
+	if _, err := db.DeleteById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	if insured, err := db.GetInsuredByDate(ctx, 1, before); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(*insured.Employees), 2; got != want {
+		tb.Fatalf("len(Employees)=%v, want %v", got, want)
+	}
+	if _, err := db.GetInsuredByDate(ctx, 1, after); err != postgres.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, postgres.ErrRecordDoesNotExist)
+	}
+	if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != postgres.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, postgres.ErrRecordDoesNotExist)
+	}
+}
+
+func TestDB_RestoreById(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	deletedAt, _ := time.Parse("2006-01-02", "2010-01-01")
+	db.Now = func() time.Time { return deletedAt }
+	before, _ := time.Parse("2006-01-02", "2009-01-01")
+	if _, err := db.DeleteById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	restoredAt, _ := time.Parse("2006-01-02", "2011-01-01")
+	db.Now = func() time.Time { return restoredAt }
+
+	if _, err := db.RestoreById(ctx, &entity.Employee{}, 2, before); err != postgres.ErrInsuredDeleted {
+		tb.Fatalf("err=%v, want %v", err, postgres.ErrInsuredDeleted)
+	}
+	restored, err := db.RestoreById(ctx, &entity.Insured{}, 1, before)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	insured := restored.(*entity.Insured)
+	if got, want := len(*insured.Employees), 2; got != want {
+		tb.Fatalf("len(Employees)=%v, want %v", got, want)
+	} else if got, want := (*insured.Addresses)[0].Address, "Mars"; got != want {
+		tb.Fatalf("Address=%v, want %v", got, want)
+	}
+	if _, err := db.RestoreById(ctx, &entity.Insured{}, 1, before); err != postgres.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, postgres.ErrUpdateMustChangeAValue)
+	}
+}
+
+func TestDB_GetSnapshot(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	asOf, _ := time.Parse("2006-01-02", "2001-01-01")
+
+	insureds, total, err := db.GetSnapshot(ctx, asOf, entity.InsuredFilter{Limit: 1, Offset: 1})
+	if err != nil {
+		tb.Fatal(err)
+	} else if got, want := total, 2; got != want {
+		tb.Fatalf("total=%v, want %v", got, want)
+	} else if got, want := insureds[0].Name, "John Smith"; got != want {
+		tb.Fatalf("Name=%v, want %v", got, want)
+	} else if got, want := len(*insureds[0].Employees), 3; got != want {
+		tb.Fatalf("len(Employees)=%v, want %v", got, want)
+	}
+}
+
+func TestDB_GetTimeline(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	// insured created, 1 employee record, 3 employee records, 4 address records
+	events, n, err := db.GetTimeline(ctx, 1, entity.TimelineFilter{})
+	if err != nil {
+		tb.Fatal(err)
+	} else if got, want := n, 9; got != want {
+		tb.Fatalf("n=%v, want %v", got, want)
+	} else if got, want := events[0].Type, entity.EventInsuredCreated; got != want {
+		tb.Fatalf("Type=%v, want %v", got, want)
+	}
+}
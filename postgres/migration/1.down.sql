@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS insured_tombstones;
+DROP TABLE IF EXISTS insured_addresses_records;
+DROP TABLE IF EXISTS employees_records;
+DROP TABLE IF EXISTS employees;
+DROP TABLE IF EXISTS insured;
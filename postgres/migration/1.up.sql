@@ -0,0 +1,46 @@
+/* Schema of sqlite/migration/1.sql to 5.sql, in one migration. Timestamps are unix seconds, as in SQLite. */
+CREATE TABLE IF NOT EXISTS insured (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	policy_number INTEGER NOT NULL UNIQUE,
+	record_timestamp BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS employees (
+	id SERIAL PRIMARY KEY,
+	insured_id INTEGER NOT NULL REFERENCES insured (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+/* record_timestamp is when the system learned of a record (transaction time).
+   valid_from/valid_to is when the record is true in the real world (valid time). */
+CREATE TABLE IF NOT EXISTS employees_records (
+	id SERIAL PRIMARY KEY, /* *record* id */
+	employee_id INTEGER NOT NULL REFERENCES employees (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	name TEXT NOT NULL,
+	start_date TEXT NOT NULL,
+	end_date TEXT NOT NULL DEFAULT '0001-01-01',
+	record_timestamp BIGINT NOT NULL,
+	valid_from BIGINT NOT NULL DEFAULT 0,
+	valid_to BIGINT, /* NULL until superseded */
+	cancelled_timestamp BIGINT,
+	tombstone INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS insured_addresses_records (
+	id SERIAL PRIMARY KEY,
+	address TEXT NOT NULL,
+	insured_id INTEGER NOT NULL REFERENCES insured (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	record_timestamp BIGINT NOT NULL,
+	valid_from BIGINT NOT NULL DEFAULT 0,
+	valid_to BIGINT, /* NULL until superseded */
+	cancelled_timestamp BIGINT,
+	tombstone INTEGER NOT NULL DEFAULT 0
+);
+
+/* The insured is deleted if its latest row is a tombstone (restore = 0) */
+CREATE TABLE IF NOT EXISTS insured_tombstones (
+	id SERIAL PRIMARY KEY,
+	insured_id INTEGER NOT NULL REFERENCES insured (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	record_timestamp BIGINT NOT NULL,
+	restore INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,6 @@
+/* Only the first address of each insured is kept */
+DELETE FROM insured_addresses_records WHERE address_id NOT IN (
+	SELECT MIN(id) FROM insured_addresses GROUP BY insured_id
+);
+ALTER TABLE insured_addresses_records DROP COLUMN address_id;
+DROP TABLE IF EXISTS insured_addresses;
@@ -0,0 +1,17 @@
+/* Addresses, as sqlite/migration/7.sql. An insured has any number of addresses, each with a type
+   (mailing, billing, or location) and a history of its own in insured_addresses_records.
+   Existing records become the history of one mailing address per insured. */
+CREATE TABLE IF NOT EXISTS insured_addresses (
+	id SERIAL PRIMARY KEY,
+	insured_id INTEGER NOT NULL REFERENCES insured (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	type TEXT NOT NULL DEFAULT 'mailing'
+);
+CREATE INDEX IF NOT EXISTS insured_addresses_insured_id ON insured_addresses (insured_id);
+
+INSERT INTO insured_addresses (insured_id, type)
+SELECT DISTINCT insured_id, 'mailing' FROM insured_addresses_records ORDER BY insured_id;
+
+ALTER TABLE insured_addresses_records ADD COLUMN address_id INTEGER REFERENCES insured_addresses (id) ON DELETE CASCADE ON UPDATE CASCADE;
+UPDATE insured_addresses_records r SET address_id = a.id FROM insured_addresses a WHERE a.insured_id = r.insured_id;
+ALTER TABLE insured_addresses_records ALTER COLUMN address_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS insured_addresses_records_address_id_valid_from ON insured_addresses_records (address_id, valid_from, record_timestamp);
@@ -0,0 +1,7 @@
+ALTER TABLE insured_addresses_records
+	DROP COLUMN country,
+	DROP COLUMN postal_code,
+	DROP COLUMN region,
+	DROP COLUMN city,
+	DROP COLUMN line2,
+	DROP COLUMN line1;
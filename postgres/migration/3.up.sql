@@ -0,0 +1,19 @@
+/* Structured addresses, as sqlite/migration/8.sql. "address" stays as the fields on one line.
+   Existing addresses are split on commas, best-effort: "line1, city, region" with a trailing US ZIP code
+   moved from the region to postal_code. Parts after the third stay in the region. Country is left empty. */
+ALTER TABLE insured_addresses_records
+	ADD COLUMN line1 TEXT NOT NULL DEFAULT '',
+	ADD COLUMN line2 TEXT NOT NULL DEFAULT '',
+	ADD COLUMN city TEXT NOT NULL DEFAULT '',
+	ADD COLUMN region TEXT NOT NULL DEFAULT '',
+	ADD COLUMN postal_code TEXT NOT NULL DEFAULT '',
+	ADD COLUMN country TEXT NOT NULL DEFAULT '';
+
+UPDATE insured_addresses_records SET
+	line1 = trim(split_part(address, ',', 1)),
+	city = trim(split_part(address, ',', 2)),
+	region = CASE WHEN address ~ '^[^,]*,[^,]*,' THEN trim(regexp_replace(address, '^[^,]*,[^,]*,', '')) ELSE '' END;
+UPDATE insured_addresses_records SET
+	region = trim(substring(region from '^(.*) [0-9]{5}(-[0-9]{4})?$')),
+	postal_code = substring(region from ' ([0-9]{5}(-[0-9]{4})?)$')
+WHERE region ~ ' [0-9]{5}(-[0-9]{4})?$';
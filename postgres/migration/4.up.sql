@@ -0,0 +1,25 @@
+/* Policies, as sqlite/migration/9.sql. Each term, and each change to a term, is a record in policies_records.
+   Dates are "2006-01-02", amounts in cents. */
+CREATE TABLE IF NOT EXISTS policies (
+	id SERIAL PRIMARY KEY,
+	insured_id INTEGER NOT NULL REFERENCES insured (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	policy_number INTEGER NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS policies_insured_id ON policies (insured_id);
+
+CREATE TABLE IF NOT EXISTS policies_records (
+	id SERIAL PRIMARY KEY, /* *record* id */
+	policy_id INTEGER NOT NULL REFERENCES policies (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	term INTEGER NOT NULL DEFAULT 1,
+	effective_date TEXT NOT NULL,
+	expiration_date TEXT NOT NULL,
+	occurrence_limit BIGINT NOT NULL,
+	aggregate_limit BIGINT NOT NULL,
+	premium BIGINT NOT NULL,
+	record_timestamp BIGINT NOT NULL,
+	valid_from BIGINT NOT NULL DEFAULT 0,
+	valid_to BIGINT, /* NULL until superseded */
+	cancelled_timestamp BIGINT,
+	tombstone INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS policies_records_policy_id_valid_from ON policies_records (policy_id, valid_from, record_timestamp);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS claims_records_claim_id_valid_from;
+DROP TABLE IF EXISTS claims_records;
+DROP INDEX IF EXISTS claims_insured_id;
+DROP TABLE IF EXISTS claims;
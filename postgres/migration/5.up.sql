@@ -0,0 +1,21 @@
+/* Claims, as sqlite/migration/10.sql. Each change to a claim, e.g. of its status, is a record in claims_records.
+   Loss dates are "2006-01-02". */
+CREATE TABLE IF NOT EXISTS claims (
+	id SERIAL PRIMARY KEY,
+	insured_id INTEGER NOT NULL REFERENCES insured (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS claims_insured_id ON claims (insured_id);
+
+CREATE TABLE IF NOT EXISTS claims_records (
+	id SERIAL PRIMARY KEY, /* *record* id */
+	claim_id INTEGER NOT NULL REFERENCES claims (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	loss_date TEXT NOT NULL,
+	description TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'investigating', 'paid', 'denied', 'closed')),
+	record_timestamp BIGINT NOT NULL,
+	valid_from BIGINT NOT NULL DEFAULT 0,
+	valid_to BIGINT, /* NULL until superseded */
+	cancelled_timestamp BIGINT,
+	tombstone INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS claims_records_claim_id_valid_from ON claims_records (claim_id, valid_from, record_timestamp);
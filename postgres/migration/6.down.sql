@@ -0,0 +1,4 @@
+ALTER TABLE employees_records
+	DROP COLUMN work_location,
+	DROP COLUMN annual_payroll,
+	DROP COLUMN job_class_code;
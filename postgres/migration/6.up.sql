@@ -0,0 +1,6 @@
+/* Employee attributes for workers' comp rating, as sqlite/migration/11.sql:
+   job class code (e.g. "8810"), annual payroll in cents, and work location. Existing records have none. */
+ALTER TABLE employees_records
+	ADD COLUMN job_class_code TEXT NOT NULL DEFAULT '',
+	ADD COLUMN annual_payroll BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN work_location TEXT NOT NULL DEFAULT '';
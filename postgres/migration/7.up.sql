@@ -0,0 +1,34 @@
+/* Cancellations of scheduled (future-dated) records are rows of their own, as sqlite/migration/12.sql,
+   so records are never changed once written. A record is cancelled as of the earliest of its cancellations. */
+CREATE TABLE IF NOT EXISTS employees_records_cancellations (
+	id SERIAL PRIMARY KEY,
+	record_id INTEGER NOT NULL REFERENCES employees_records (id) ON DELETE CASCADE,
+	record_timestamp BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS employees_records_cancellations_record_id ON employees_records_cancellations (record_id, record_timestamp);
+
+CREATE TABLE IF NOT EXISTS insured_addresses_records_cancellations (
+	id SERIAL PRIMARY KEY,
+	record_id INTEGER NOT NULL REFERENCES insured_addresses_records (id) ON DELETE CASCADE,
+	record_timestamp BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS insured_addresses_records_cancellations_record_id ON insured_addresses_records_cancellations (record_id, record_timestamp);
+
+CREATE TABLE IF NOT EXISTS policies_records_cancellations (
+	id SERIAL PRIMARY KEY,
+	record_id INTEGER NOT NULL REFERENCES policies_records (id) ON DELETE CASCADE,
+	record_timestamp BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS policies_records_cancellations_record_id ON policies_records_cancellations (record_id, record_timestamp);
+
+INSERT INTO employees_records_cancellations (record_id, record_timestamp)
+SELECT id, cancelled_timestamp FROM employees_records WHERE cancelled_timestamp IS NOT NULL;
+INSERT INTO insured_addresses_records_cancellations (record_id, record_timestamp)
+SELECT id, cancelled_timestamp FROM insured_addresses_records WHERE cancelled_timestamp IS NOT NULL;
+INSERT INTO policies_records_cancellations (record_id, record_timestamp)
+SELECT id, cancelled_timestamp FROM policies_records WHERE cancelled_timestamp IS NOT NULL;
+
+ALTER TABLE employees_records DROP COLUMN cancelled_timestamp;
+ALTER TABLE insured_addresses_records DROP COLUMN cancelled_timestamp;
+ALTER TABLE policies_records DROP COLUMN cancelled_timestamp;
+ALTER TABLE claims_records DROP COLUMN cancelled_timestamp; /* claims are not cancelled */
@@ -0,0 +1,89 @@
+package seed
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Named fixture sets: insureds, with the history of their employees and addresses, to add to a new database,
+// e.g. for a demo or a test. A set is a JSON file, embedded here as "{name}.json".
+// Sets are written through the service layer, with the same validation as the API (see service.SqliteRecordService.Seed),
+// so every backend gets the same rows and ids.
+
+//go:embed *.json
+var setFS embed.FS
+
+var ErrUnknownSet = errors.New("no fixture set with that name")
+
+// Set is a fixture set
+type Set struct {
+	Name     string    `json:"-"`
+	Insureds []Insured `json:"insureds"`
+}
+
+// Insured is an insured and its history, created in order
+type Insured struct {
+	Name         string     `json:"name"`
+	PolicyNumber int        `json:"policyNumber,omitempty"` // the next one if 0
+	Recorded     time.Time  `json:"recorded"`
+	Employees    []Employee `json:"employees,omitempty"`
+	Addresses    []Address  `json:"addresses,omitempty"` // the first of each type creates the address, the others update it
+}
+
+// Employee is an employee's records. The first creates the employee, the others update it.
+type Employee struct {
+	Records []EmployeeRecord `json:"records"`
+}
+
+type EmployeeRecord struct {
+	Name      string    `json:"name"`
+	StartDate string    `json:"startDate"`         // 2006-01-02
+	EndDate   string    `json:"endDate,omitempty"` // 2006-01-02. None if empty.
+	Recorded  time.Time `json:"recorded"`
+}
+
+type Address struct {
+	Address  string    `json:"address"`
+	Type     string    `json:"type,omitempty"` // mailing if empty
+	Recorded time.Time `json:"recorded"`
+}
+
+// Load returns the embedded set named, e.g. "demo". A name ending in ".json" is read from that file instead.
+func Load(name string) (Set, error) {
+	var buf []byte
+	var err error
+	if strings.HasSuffix(name, ".json") {
+		buf, err = os.ReadFile(name)
+	} else {
+		buf, err = fs.ReadFile(setFS, name+".json")
+		if errors.Is(err, fs.ErrNotExist) {
+			return Set{}, fmt.Errorf("%w: %q. Use one of %s", ErrUnknownSet, name, strings.Join(Names(), ", "))
+		}
+	}
+	if err != nil {
+		return Set{}, err
+	}
+	set := Set{Name: name}
+	if err := json.Unmarshal(buf, &set); err != nil {
+		return Set{}, fmt.Errorf("fixture set %s: %w", name, err)
+	}
+	return set, nil
+}
+
+// Names returns the names of the embedded sets, sorted
+func Names() []string {
+	matches, _ := fs.Glob(setFS, "*.json")
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = strings.TrimSuffix(match, ".json")
+	}
+	sort.Strings(names)
+	return names
+}
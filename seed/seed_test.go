@@ -0,0 +1,73 @@
+package seed_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nickcoast/timetravel/memory"
+	"github.com/nickcoast/timetravel/seed"
+	"github.com/nickcoast/timetravel/service"
+)
+
+func TestLoad(t *testing.T) {
+	set, err := seed.Load("demo")
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := len(set.Insureds), 2; got != want {
+		t.Fatalf("len(Insureds)=%v, want %v", got, want)
+	} else if got, want := set.Insureds[0].Recorded, time.Date(1984, 10, 31, 12, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("Recorded=%v, want %v", got, want)
+	}
+	if names := seed.Names(); len(names) == 0 || names[0] != "demo" {
+		t.Fatalf("Names()=%v", names)
+	}
+	if _, err := seed.Load("nope"); !errors.Is(err, seed.ErrUnknownSet) {
+		t.Fatalf("err=%v, want %v", err, seed.ErrUnknownSet)
+	}
+
+	// a set in a file
+	path := filepath.Join(t.TempDir(), "one.json")
+	if err := os.WriteFile(path, []byte(`{"insureds": [{"name": "sue", "recorded": "2001-01-01T00:00:00Z"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if set, err := seed.Load(path); err != nil {
+		t.Fatal(err)
+	} else if got, want := set.Insureds[0].Name, "sue"; got != want {
+		t.Fatalf("Name=%v, want %v", got, want)
+	}
+}
+
+// Seed data is validated as the API's writes are, and only added to an empty database
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	set, err := seed.Load("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := memory.NewDB()
+	s := service.NewSqliteRecordService(db)
+	if err := s.Seed(ctx, set); err != nil {
+		t.Fatal(err)
+	}
+	if insured, err := db.GetInsuredByDate(ctx, 1, time.Date(1997, 6, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	} else if got, want := insured.PolicyNumber, 1000; got != want {
+		t.Fatalf("PolicyNumber=%v, want %v", got, want)
+	} else if got, want := len(*insured.Employees), 2; got != want {
+		t.Fatalf("len(Employees)=%v, want %v", got, want)
+	}
+	if err := s.Seed(ctx, set); err != service.ErrStoreNotEmpty {
+		t.Fatalf("err=%v, want %v", err, service.ErrStoreNotEmpty)
+	}
+
+	// an employee without a start date is rejected, as by the API
+	set.Insureds = []seed.Insured{{Name: "sue", Employees: []seed.Employee{{Records: []seed.EmployeeRecord{{Name: "bob"}}}}}}
+	s = service.NewSqliteRecordService(memory.NewDB())
+	if err := s.Seed(ctx, set); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -17,9 +18,15 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/nickcoast/timetravel/api"
+	"github.com/nickcoast/timetravel/backup"
 	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/eventlog"
+	"github.com/nickcoast/timetravel/memory"
+	"github.com/nickcoast/timetravel/postgres"
+	"github.com/nickcoast/timetravel/seed"
 	"github.com/nickcoast/timetravel/service"
 	"github.com/nickcoast/timetravel/sqlite"
+	"github.com/nickcoast/timetravel/tenant"
 	"github.com/pelletier/go-toml"
 )
 
@@ -39,6 +46,23 @@ func main() {
 	go func() { <-c; cancel() }()
 
 	m := NewMain()
+	// Read the configuration file, if there is one.
+	if err := m.ReadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		// e.g. "timetravel compact". Runs the command instead of the server.
+		if err := m.RunCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := m.ParseFlags(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	// Execute program.
 	fmt.Println("func main Run")
 	if err := m.Run(ctx); err != nil {
@@ -62,8 +86,15 @@ type Main struct {
 	Config     Config
 	ConfigPath string
 	DB         *sqlite.DB
+	Postgres   *postgres.DB    // set instead of DB if the config's db driver is "postgres"
+	EventLog   *eventlog.DB    // set instead of DB if the config's db driver is "eventlog"
+	Backups    *backup.Manager // backups of DB. Nil for the other drivers.
+	Tenants    *tenant.Pool    // set instead of DB if the config has a tenant dsn
 	HTTPServer *http.Server
 	Router     *mux.Router
+	API        *api.API
+
+	service *service.SqliteRecordService
 
 	//InsuredService entity.InsuredService
 }
@@ -77,11 +108,31 @@ func (m *Main) Close() error {
 			return err
 		}
 	}
+	if m.Backups != nil {
+		if err := m.Backups.Close(); err != nil {
+			return err
+		}
+	}
 	if m.DB != nil {
 		if err := m.DB.Close(); err != nil {
 			return err
 		}
 	}
+	if m.Tenants != nil {
+		if err := m.Tenants.Close(); err != nil {
+			return err
+		}
+	}
+	if m.Postgres != nil {
+		if err := m.Postgres.Close(); err != nil {
+			return err
+		}
+	}
+	if m.EventLog != nil {
+		if err := m.EventLog.Close(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -89,9 +140,12 @@ func NewMain() *Main {
 	fmt.Println("Main NewMain")
 	router := mux.NewRouter()
 
+	db := sqlite.NewDB("file:main.db?cache=shared&mode=rwc&locking_mode=NORMAL&_fk=1&synchronous=2")
 	memoryService := service.NewInMemoryRecordService()
-	sqliteService := service.NewSqliteRecordService()
+	// injects db into the sqlite service so it can interact with the database.
+	sqliteService := service.NewSqliteRecordService(db)
 	api := api.NewAPI(&memoryService, &sqliteService)
+	api.AdminToken = os.Getenv("TIMETRAVEL_ADMIN_TOKEN") // privileged operations are disabled if unset
 
 	apiRoute := router.PathPrefix("/api/v1").Subrouter()
 	apiRoute.Path("/health").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -111,7 +165,7 @@ func NewMain() *Main {
 	oG := os.Getenv("ORIGIN_ALLOWED")
 	originsOk := handlers.AllowedOrigins([]string{oG})
 	//originsOk := handlers.AllowedOrigins([]string{os.Getenv("ORIGIN_ALLOWED")})
-	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With"})
+	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With", "X-Admin-Token", "X-Tenant"})
 	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"})
 
 	hh := handlers.CORS(originsOk, headersOk, methodsOk)(router)
@@ -132,55 +186,168 @@ func NewMain() *Main {
 	log.Printf("listening on %s", address)
 	fmt.Println("Main NewMain after ListenAndServe")
 
-	db := sqlite.NewDB("file:main.db?cache=shared&mode=rwc&locking_mode=NORMAL&_fk=1&synchronous=2")
-	// injects db into the sqlite service so it can interact with the database.
-	sqliteService.SetService(db)
-
 	return &Main{
 		Config:     DefaultConfig(),
 		ConfigPath: DefaultConfigPath,
 		DB:         db,
 		HTTPServer: srv,
+		API:        api,
+		service:    &sqliteService,
 	}
 }
 
+// Storage backends the db driver chooses from
+var (
+	_ service.Store = (*sqlite.DB)(nil)
+	_ service.Store = (*postgres.DB)(nil)
+	_ service.Store = (*memory.DB)(nil)
+	_ service.Store = (*eventlog.DB)(nil)
+)
+
 // Run executes the program. The configuration should already be set up before
 // calling this function.
 func (m *Main) Run(ctx context.Context) (err error) {
 	fmt.Println("Main Run")
-	// Expand the DSN (in case it is in the user home directory ("~")).
-	// Then open the database. This will instantiate the SQLite connection
-	// and execute any pending migration files.
-	if m.DB.DSN, err = expandDSN(m.Config.DB.DSN); err != nil {
-		fmt.Println("Main.Run ERR m.DB.DSN", m.DB.DSN)
-		return fmt.Errorf("cannot expand dsn: %w", err)
+	switch m.Config.DB.Driver {
+	case "postgres":
+		// Open the PostgreSQL database instead, and execute any pending migrations.
+		m.DB = nil
+		m.Postgres = postgres.NewDB(m.Config.DB.DSN)
+		if err := m.Postgres.Open(); err != nil {
+			return fmt.Errorf("cannot open db: %w", err)
+		}
+		*m.service = service.NewSqliteRecordService(m.Postgres) // the API holds m.service
+	case "memory":
+		// Nothing is saved. Starts empty, unless seeded.
+		m.DB = nil
+		*m.service = service.NewSqliteRecordService(memory.NewDB())
+	case "eventlog":
+		// Append every change to the log file, and replay it to start.
+		m.DB = nil
+		path, err := m.eventLogPath()
+		if err != nil {
+			return err
+		}
+		m.EventLog = eventlog.NewDB(path)
+		if err := m.EventLog.Open(); err != nil {
+			return fmt.Errorf("cannot open event log: %w", err)
+		}
+		*m.service = service.NewSqliteRecordService(m.EventLog)
+	case "", "sqlite", "sqlite3":
+		if m.Config.Tenants.DSN != "" {
+			// A database per tenant, each opened and migrated when first used.
+			m.DB = nil
+			dsn, err := expandDSN(m.Config.Tenants.DSN)
+			if err != nil {
+				return fmt.Errorf("cannot expand tenant dsn: %w", err)
+			}
+			if m.Tenants, err = tenant.NewPool(dsn); err != nil {
+				return err
+			}
+			*m.service = service.NewSqliteRecordService(m.Tenants)
+			m.API.Tenants, m.API.Domain = m.Tenants, m.Config.HTTP.Domain
+			break
+		}
+		// Expand the DSN (in case it is in the user home directory ("~")).
+		// Then open the database. This will instantiate the SQLite connection
+		// and execute any pending migration files.
+		if m.DB.DSN, err = expandDSN(m.Config.DB.DSN); err != nil {
+			return fmt.Errorf("cannot expand dsn: %w", err)
+		}
+		if m.DB.ArchivePath, err = m.archivePath(); err != nil {
+			return err
+		}
+		if err := m.DB.Open(); err != nil {
+			return fmt.Errorf("cannot open db: %w", err)
+		}
+		if m.Backups, err = m.backups(); err != nil {
+			return err
+		}
+		m.API.Backups = m.Backups
+		if m.Config.Backup.Every != "" {
+			every, err := time.ParseDuration(m.Config.Backup.Every)
+			if err != nil || every <= 0 {
+				return fmt.Errorf("backup every %q: want a duration, e.g. \"24h\"", m.Config.Backup.Every)
+			}
+			go m.Backups.Run(ctx, every)
+		}
+	default:
+		return fmt.Errorf("unknown db driver %q. Use \"sqlite\", \"postgres\", \"memory\", or \"eventlog\"", m.Config.DB.Driver)
 	}
-	if err := m.DB.Open(); err != nil {
-		return fmt.Errorf("cannot open db: %w", err)
+	if m.Config.DB.Seed != "" && m.Tenants != nil {
+		log.Printf("not seeding %s: seed tenants when creating them", m.Config.DB.Seed)
+	} else if m.Config.DB.Seed != "" {
+		if err := seedStore(ctx, m.service, m.Config.DB.Seed); err != nil {
+			return fmt.Errorf("cannot seed db: %w", err)
+		}
 	}
-	fmt.Println("Main.Run after m.DB.Open. m.DB.DSN", m.DB.DSN)
 
 	//go func() { log.Fatal(http.ListenAndServe(":"+os.Getenv("PORT"), handlers.CORS(originsOk, headersOk, methodsOk)(m.Router))) }
-	go func() { log.Fatal(m.HTTPServer.ListenAndServe()) }()
+	go func() {
+		// ErrServerClosed is returned after Close. Close then closes the storage.
+		if err := m.HTTPServer.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 	fmt.Println("Server started in Main.Run")
 
 	return nil
 }
 
+// seedStore adds the fixture set named, e.g. "demo", through the service. Nothing is added to a database that has insureds.
+func seedStore(ctx context.Context, s *service.SqliteRecordService, name string) error {
+	set, err := seed.Load(name)
+	if err != nil {
+		return err
+	}
+	if err := s.Seed(ctx, set); err == service.ErrStoreNotEmpty {
+		log.Printf("not seeding %s: the database has insureds", name)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
 const (
 	// DefaultConfigPath is the default path to the application configuration.
 	DefaultConfigPath = "~/code/go/temelpa/wtfd.conf"
 
 	// DefaultDSN is the default datasource name.
 	DefaultDSN = "file:main.db?cache=shared&mode=rwc&locking_mode=NORMAL&_fk=1&synchronous=2"
+
+	// DefaultEventLogPath is the event log used if the dsn is left as DefaultDSN
+	DefaultEventLogPath = "main.log"
+
+	// DefaultBackupDir is the default directory of sqlite backups
+	DefaultBackupDir = "backups"
+
+	// DefaultArchiveYears is the age in years of the record versions archived
+	DefaultArchiveYears = 7
 )
 
 // Config represents the CLI configuration file.
 type Config struct {
 	DB struct {
-		DSN string `toml:"dsn"`
+		Driver string `toml:"driver"` // "sqlite" (default), "postgres", "memory", or "eventlog"
+		DSN    string `toml:"dsn"`
+		Seed   string `toml:"seed"` // fixture set added when the server starts, if the database is empty, e.g. "demo". None if empty.
 	} `toml:"db"`
 
+	Backup struct {
+		Dir   string `toml:"dir"`   // directory of the sqlite database's backups
+		Every string `toml:"every"` // interval between scheduled backups, e.g. "24h". None if empty.
+		Keep  int    `toml:"keep"`  // backups kept. 0 keeps all.
+	} `toml:"backup"`
+
+	Archive struct {
+		Path  string `toml:"path"`  // sqlite database of archived record versions. No archive if empty.
+		Years int    `toml:"years"` // versions replaced more than this many years ago are archived by "timetravel archive"
+	} `toml:"archive"`
+
+	Tenants struct {
+		DSN string `toml:"dsn"` // sqlite database of each tenant, with {tenant} for its name, e.g. "tenants/{tenant}.db". One database if empty.
+	} `toml:"tenants"`
+
 	HTTP struct {
 		Addr     string `toml:"addr"`
 		Domain   string `toml:"domain"`
@@ -193,6 +360,9 @@ type Config struct {
 func DefaultConfig() Config {
 	var config Config
 	config.DB.DSN = DefaultDSN
+	config.Backup.Dir = DefaultBackupDir
+	config.Backup.Keep = backup.DefaultKeep
+	config.Archive.Years = DefaultArchiveYears
 	return config
 }
 
@@ -207,6 +377,30 @@ func ReadConfigFile(filename string) (Config, error) {
 	return config, nil
 }
 
+// ReadConfig reads m.ConfigPath into m.Config. The defaults are kept if the file does not exist.
+func (m *Main) ReadConfig() error {
+	path, err := expand(m.ConfigPath)
+	if err != nil {
+		return err
+	}
+	config, err := ReadConfigFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot read config %s: %w", path, err)
+	}
+	m.Config = config
+	return nil
+}
+
+// ParseFlags parses the command line arguments. They override the config file.
+func (m *Main) ParseFlags(args []string) error {
+	fs := flag.NewFlagSet("timetravel", flag.ContinueOnError)
+	fs.StringVar(&m.Config.DB.Driver, "storage", m.Config.DB.Driver, `storage backend: "sqlite", "postgres", "memory", or "eventlog"`)
+	fs.StringVar(&m.Config.DB.Seed, "seed", m.Config.DB.Seed, `fixture set to add to an empty database, e.g. "demo"`)
+	return fs.Parse(args)
+}
+
 // expand returns path using tilde expansion. This means that a file path that
 // begins with the "~" will be expanded to prefix the user's home directory.
 func expand(path string) (string, error) {
@@ -229,6 +423,37 @@ func expand(path string) (string, error) {
 	return filepath.Join(u.HomeDir, strings.TrimPrefix(path, "~"+string(os.PathSeparator))), nil
 }
 
+// eventLogPath returns the path of the event log: the dsn, expanded
+func (m *Main) eventLogPath() (string, error) {
+	if m.Config.DB.DSN == DefaultDSN {
+		return DefaultEventLogPath, nil
+	}
+	return expand(m.Config.DB.DSN)
+}
+
+// backups returns the Manager of the sqlite database's backups, in the config's directory
+func (m *Main) backups() (*backup.Manager, error) {
+	dir, err := expand(m.Config.Backup.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot expand backup dir: %w", err)
+	}
+	backups := backup.NewManager(m.DB, dir)
+	backups.Keep = m.Config.Backup.Keep
+	return backups, nil
+}
+
+// archivePath returns the archive's path, expanded. Empty if there is none.
+func (m *Main) archivePath() (string, error) {
+	if m.Config.Archive.Path == "" {
+		return "", nil
+	}
+	path, err := expand(m.Config.Archive.Path)
+	if err != nil {
+		return "", fmt.Errorf("cannot expand archive path: %w", err)
+	}
+	return path, nil
+}
+
 // expandDSN expands a datasource name. Ignores in-memory databases.
 func expandDSN(dsn string) (string, error) {
 	if dsn == ":memory:" {
@@ -9,15 +9,23 @@ import (
 	"github.com/nickcoast/timetravel/entity"
 )
 
-func (s *SqliteRecordService) createAddress(ctx context.Context, timestamp time.Time, record entity.Record) (newRecord entity.Record, err error) {
-	addressString := record.DataVal("address")
-	if addressString == "" {
+// createAddress creates a new address of the record's "type" (mailing if none). Zero validFrom means it takes effect at timestamp.
+// An insured can have one mailing and one billing address, and any number of locations.
+func (s *SqliteRecordService) createAddress(ctx context.Context, timestamp time.Time, validFrom time.Time, record entity.Record) (newRecord entity.Record, err error) {
+	if record.DataVal("address") == "" && record.DataVal("line1") == "" {
 		return entity.Record{}, ErrServerError
 	}	
 	var address *entity.Address
 	address = &entity.Address{}
-	address.Address = addressString
+	setAddressFields(address, record)
 	address.RecordTimestamp = timestamp
+	address.ValidFrom = validFrom
+	if address.ValidTo, err = parseOptionalValidTo(record, timestamp, validFrom); err != nil {
+		return newRecord, err
+	}
+	if address.Type, err = addressType(record); err != nil {
+		return newRecord, err
+	}
 
 	if ii := record.DataVal("insuredId"); ii != "" { // SET INSURED ID
 		if address.InsuredId, err = strconv.Atoi(ii); err != nil {			
@@ -26,33 +34,44 @@ func (s *SqliteRecordService) createAddress(ctx context.Context, timestamp time.
 	} else {		
 		return newRecord, fmt.Errorf("Insured ID required to create Address: %v", err)
 	}
-	insuredIfaceObj, err := s.GetResourceById(ctx, &entity.Insured{}, address.InsuredId)
-	if err != nil {
-		return newRecord, ErrNonexistentParentRecord
-	}
-	insuredObj, ok := insuredIfaceObj.(*entity.Insured)
-	if !ok {
-		return newRecord, ErrServerError
+	if err := validateAddress(address); err != nil {
+		return newRecord, err
 	}
-	addressCount, err := s.service.CountInsuredAddresses(ctx, *insuredObj)
-	if err != nil {
-		return newRecord, ErrServerError
+	if _, err := s.GetResourceById(ctx, &entity.Insured{}, address.InsuredId); err != nil {
+		return newRecord, ErrNonexistentParentRecord
 	}
-	if addressCount > 0 {
-		return newRecord, ErrRecordAlreadyExists
+	if entity.UniqueAddressType(address.Type) {
+		current, err := s.addressesAt(ctx, address.InsuredId, validFrom, timestamp)
+		if err != nil {
+			return newRecord, ErrServerError
+		}
+		for _, a := range current {
+			if a.Type == address.Type {
+				return newRecord, ErrRecordAlreadyExists
+			}
+		}
 	}
 	newRecord, err = s.service.CreateAddress(ctx, address)
 	if err != nil {
 		return entity.Record{}, err
 	}
+	if !address.ValidTo.IsZero() {
+		newRecord.Data["validTo"] = entity.FormatValidTime(address.ValidTo)
+	}
 	return newRecord, err
 }
 
-func (s *SqliteRecordService) updateAddress(ctx context.Context, timestamp time.Time, record entity.Record) (newRecord entity.Record, err error) {
+// updateAddress adds a new record to one of the insured's addresses. Zero validFrom means the change takes effect at timestamp.
+// The address is the record's "addressId", else the insured's address of its "type", else the insured's only address.
+func (s *SqliteRecordService) updateAddress(ctx context.Context, timestamp time.Time, validFrom time.Time, record entity.Record) (newRecord entity.Record, err error) {
 	var address *entity.Address
 	address = &entity.Address{}
-	address.Address = record.DataVal("address")
+	setAddressFields(address, record)
 	address.RecordTimestamp = timestamp
+	address.ValidFrom = validFrom
+	if address.ValidTo, err = parseOptionalValidTo(record, timestamp, validFrom); err != nil {
+		return newRecord, err
+	}
 
 	if ii := record.DataVal("insuredId"); ii != "" {
 		if address.InsuredId, err = strconv.Atoi(ii); err != nil { // SET INSURED ID			
@@ -61,26 +80,104 @@ func (s *SqliteRecordService) updateAddress(ctx context.Context, timestamp time.
 	} else {		
 		return newRecord, fmt.Errorf("Insured ID required to create Address: %v", err)
 	}
-
-	insuredIfaceObj, err := s.GetResourceById(ctx, &entity.Insured{}, address.InsuredId)
-	if err != nil {
-		return newRecord, ErrRecordIDInvalid
+	if err := validateAddress(address); err != nil {
+		return newRecord, err
 	}
-	insuredObj, ok := insuredIfaceObj.(*entity.Insured)
-	if !ok {
-		return entity.Record{}, ErrServerError
+	if _, err := s.GetResourceById(ctx, &entity.Insured{}, address.InsuredId); err != nil {
+		return newRecord, ErrRecordIDInvalid
 	}
-	addressCount, err := s.service.CountInsuredAddresses(ctx, *insuredObj)
+	current, err := s.addressesAt(ctx, address.InsuredId, validFrom, timestamp)
 	if err != nil {
 		return newRecord, ErrServerError
 	}
-	if addressCount == 0 {
-		return newRecord, ErrRecordDoesNotExist
+	existing, err := findAddress(current, record)
+	if err != nil {
+		return newRecord, err
 	}
+	address.AddressId = existing.AddressId
+	address.Type = existing.Type
 
 	newRecord, err = s.service.UpdateAddress(ctx, address) // add record to DB indicating an address change
 	if err != nil {
 		return entity.Record{}, err
 	}
+	if !address.ValidTo.IsZero() {
+		newRecord.Data["validTo"] = entity.FormatValidTime(address.ValidTo)
+	}
 	return newRecord, err
 }
+
+// setAddressFields sets the address from the record: "address" on one line,
+// or its fields "line1", "line2", "city", "region", "postalCode", and "country"
+func setAddressFields(address *entity.Address, record entity.Record) {
+	address.Address = record.DataVal("address")
+	address.Line1, address.Line2, address.City = record.DataVal("line1"), record.DataVal("line2"), record.DataVal("city")
+	address.Region, address.PostalCode, address.Country = record.DataVal("region"), record.DataVal("postalCode"), record.DataVal("country")
+}
+
+// validateAddress normalizes the address and returns ErrInvalidAddress, with the reason, if it is not valid
+func validateAddress(address *entity.Address) error {
+	address.Normalize()
+	if err := address.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidAddress, entity.ErrorMessage(err))
+	}
+	return nil
+}
+
+// addressesAt returns the insured's addresses valid when a change takes effect, at validFrom (timestamp if zero), as known at timestamp
+func (s *SqliteRecordService) addressesAt(ctx context.Context, insuredId int, validFrom time.Time, timestamp time.Time) (map[int]entity.Address, error) {
+	asOfValid := validFrom
+	if asOfValid.IsZero() {
+		asOfValid = timestamp
+	}
+	records, err := s.service.GetByBitemporalDate(ctx, &entity.Address{}, int64(insuredId), asOfValid, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return entity.AddressesFromInsuredInterface(records)
+}
+
+// findAddress returns the address the record changes: its "addressId", else the address of its "type", else the only address.
+// Returns ErrEntityIDInvalid if that is more than one address.
+func findAddress(current map[int]entity.Address, record entity.Record) (entity.Address, error) {
+	if id := record.DataVal("addressId"); id != "" {
+		addressId, err := strconv.Atoi(id)
+		if err != nil {
+			return entity.Address{}, ErrEntityIDInvalid
+		}
+		for _, a := range current {
+			if a.AddressId == addressId {
+				return a, nil
+			}
+		}
+		return entity.Address{}, ErrRecordDoesNotExist
+	}
+	addressType := record.DataVal("type")
+	if addressType != "" && !entity.ValidAddressType(addressType) {
+		return entity.Address{}, ErrInvalidAddressType
+	}
+	var found []entity.Address
+	for _, a := range current {
+		if addressType == "" || a.Type == addressType {
+			found = append(found, a)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return entity.Address{}, ErrRecordDoesNotExist
+	case 1:
+		return found[0], nil
+	}
+	return entity.Address{}, ErrEntityIDInvalid
+}
+
+// addressType returns the record's "type", or mailing if it has none
+func addressType(record entity.Record) (string, error) {
+	t := record.DataVal("type")
+	if t == "" {
+		return entity.AddressMailing, nil
+	} else if !entity.ValidAddressType(t) {
+		return "", ErrInvalidAddressType
+	}
+	return t, nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// createClaim creates a new, open claim against the record's "insuredId", for a loss on its "lossDate".
+// Claims change when they are recorded, so validFrom must be zero.
+func (s *SqliteRecordService) createClaim(ctx context.Context, timestamp time.Time, validFrom time.Time, record entity.Record) (newRecord entity.Record, err error) {
+	if !validFrom.IsZero() {
+		return newRecord, fmt.Errorf("%w: a claim changes when it is recorded, without 'validFrom'", ErrInvalidClaim)
+	}
+	insuredId, err := strconv.Atoi(record.DataVal("insuredId"))
+	if err != nil || insuredId < 1 {
+		return newRecord, ErrRecordIDInvalid
+	}
+	if _, err := s.GetResourceById(ctx, &entity.Insured{}, insuredId); err != nil {
+		return newRecord, ErrNonexistentParentRecord
+	}
+	for _, key := range []string{"lossDate", "description"} {
+		if record.DataVal(key) == "" {
+			return newRecord, fmt.Errorf("%w: %s required", ErrInvalidClaim, key)
+		}
+	}
+	if status := record.DataVal("status"); status != "" && status != entity.ClaimOpen {
+		return newRecord, fmt.Errorf("%w: a new claim is '%s'", ErrInvalidClaim, entity.ClaimOpen)
+	}
+	claim := &entity.Claim{InsuredId: insuredId, Status: entity.ClaimOpen, RecordTimestamp: timestamp}
+	if err := setClaimFields(claim, record); err != nil {
+		return newRecord, err
+	}
+	if claim.LossDate.After(timestamp) {
+		return newRecord, fmt.Errorf("%w: the loss date cannot be in the future", ErrInvalidClaim)
+	}
+	if insured, err := s.service.GetInsuredByDate(ctx, int64(insuredId), claim.LossTime()); err != nil || insured.RecordTimestamp.After(claim.LossTime()) {
+		return newRecord, fmt.Errorf("%w: the insured did not exist on the loss date", ErrInvalidClaim)
+	}
+	if err := validateClaim(claim); err != nil {
+		return newRecord, err
+	}
+	newRecord, err = s.service.CreateClaim(ctx, claim)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return newRecord, nil
+}
+
+// updateClaim adds a record to the record's "claimId": a new "status", "description", or "lossDate".
+// The status may only move forward: open, investigating, paid or denied, closed. A closed claim cannot change.
+// Claims change when they are recorded, so validFrom must be zero.
+func (s *SqliteRecordService) updateClaim(ctx context.Context, timestamp time.Time, validFrom time.Time, record entity.Record) (newRecord entity.Record, err error) {
+	if !validFrom.IsZero() {
+		return newRecord, fmt.Errorf("%w: a claim changes when it is recorded, without 'validFrom'", ErrInvalidClaim)
+	}
+	current, err := s.currentClaim(ctx, record)
+	if err != nil {
+		return newRecord, err
+	}
+	if current.Status == entity.ClaimClosed {
+		return newRecord, fmt.Errorf("%w: the claim is closed", ErrInvalidClaim)
+	}
+	claim := *current
+	if err := setClaimFields(&claim, record); err != nil {
+		return newRecord, err
+	}
+	if status := record.DataVal("status"); status != "" {
+		claim.Status = status
+	}
+	claim.RecordTimestamp, claim.ValidFrom, claim.ValidTo = timestamp, time.Time{}, time.Time{}
+	if claim.LossDate.After(timestamp) {
+		return newRecord, fmt.Errorf("%w: the loss date cannot be in the future", ErrInvalidClaim)
+	}
+	if err := validateClaim(&claim); err != nil {
+		return newRecord, err
+	}
+	if claim.Status != current.Status && !current.CanBecome(claim.Status) {
+		return newRecord, fmt.Errorf("%w: a claim that is '%s' cannot become '%s'", ErrInvalidClaim, current.Status, claim.Status)
+	}
+	return s.service.UpdateClaim(ctx, &claim)
+}
+
+// GetClaim returns the claim's current record, with the insured as it was on the loss date
+func (s *SqliteRecordService) GetClaim(ctx context.Context, id int) (*entity.Claim, error) {
+	record, err := s.GetResourceById(ctx, &entity.Claim{}, id)
+	if err != nil {
+		return nil, err
+	}
+	claim := record.(*entity.Claim)
+	insured, err := s.service.GetInsuredByDate(ctx, int64(claim.InsuredId), claim.LossTime())
+	if err != nil {
+		return nil, ErrServerError
+	}
+	claim.Insured = &insured
+	return claim, nil
+}
+
+// currentClaim returns the current record of the record's "claimId"
+func (s *SqliteRecordService) currentClaim(ctx context.Context, record entity.Record) (*entity.Claim, error) {
+	claimId, err := strconv.Atoi(record.DataVal("claimId"))
+	if err != nil || claimId < 1 {
+		return nil, ErrEntityIDInvalid
+	}
+	current, err := s.GetResourceById(ctx, &entity.Claim{}, claimId)
+	if err != nil {
+		return nil, ErrRecordDoesNotExist
+	}
+	return current.(*entity.Claim), nil
+}
+
+// setClaimFields sets the claim's loss date ("2006-01-02") and description that the record has
+func setClaimFields(claim *entity.Claim, record entity.Record) error {
+	if value := record.DataVal("lossDate"); value != "" {
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return fmt.Errorf("%w: lossDate must be a date, e.g. '2006-01-02'", ErrInvalidClaim)
+		}
+		claim.LossDate = t
+	}
+	if value := record.DataVal("description"); value != "" {
+		claim.Description = value
+	}
+	return nil
+}
+
+// validateClaim returns ErrInvalidClaim, with the reason, if the claim is not valid
+func validateClaim(claim *entity.Claim) error {
+	if err := claim.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidClaim, entity.ErrorMessage(err))
+	}
+	return nil
+}
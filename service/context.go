@@ -21,6 +21,9 @@ const (
 	// related but both the "http" and "http/html" packages use it so it is
 	// easier to move it to the root.
 	flashContextKey
+
+	// Stores the tenant (agency) whose database the request uses.
+	tenantContextKey
 )
 
 // NewContextWithFlash returns a new context with the given flash value.
@@ -33,3 +36,14 @@ func FlashFromContext(ctx context.Context) string {
 	v, _ := ctx.Value(flashContextKey).(string)
 	return v
 }
+
+// NewContextWithTenant returns a new context with the given tenant name.
+func NewContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey, tenant)
+}
+
+// TenantFromContext returns the tenant of the current request. Empty if there is none.
+func TenantFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(tenantContextKey).(string)
+	return v
+}
@@ -10,7 +10,8 @@ import (
 	"github.com/nickcoast/timetravel/entity"
 )
 
-func (s *SqliteRecordService) createEmployee(ctx context.Context, timestamp time.Time, record entity.Record) (newRecord entity.Record, err error) {
+// createEmployee creates a new employee. Zero validFrom means it takes effect at timestamp.
+func (s *SqliteRecordService) createEmployee(ctx context.Context, timestamp time.Time, validFrom time.Time, record entity.Record) (newRecord entity.Record, err error) {
 	log.Println("SqliteRecordService createEmployee record:", record)
 	name := record.DataVal("name")
 	insuredIdStr := record.DataVal("insuredId")
@@ -33,6 +34,10 @@ func (s *SqliteRecordService) createEmployee(ctx context.Context, timestamp time
 	employee = &entity.Employee{}
 	employee.Name = name
 	employee.RecordTimestamp = timestamp
+	employee.ValidFrom = validFrom
+	if employee.ValidTo, err = parseOptionalValidTo(record, timestamp, validFrom); err != nil {
+		return newRecord, err
+	}
 	employee.InsuredId = insuredId
 
 	count, err := s.service.CountEmployeeRecords(ctx, *employee)
@@ -72,14 +77,24 @@ func (s *SqliteRecordService) createEmployee(ctx context.Context, timestamp time
 		}
 		employee.EndDate = t
 	}
+	if err := setEmployeeRating(employee, record); err != nil {
+		return newRecord, err
+	}
+	if err := validateEmployee(employee); err != nil {
+		return newRecord, err
+	}
 
 	newRecord, err = s.service.CreateEmployee(ctx, employee)
 	if err != nil {
 		return entity.Record{}, err
 	}
+	if !employee.ValidTo.IsZero() {
+		newRecord.Data["validTo"] = entity.FormatValidTime(employee.ValidTo)
+	}
 	return newRecord, err
 }
-func (s *SqliteRecordService) updateEmployee(ctx context.Context, timestamp time.Time, record entity.Record) (newRecord entity.Record, err error) {
+// updateEmployee adds a new employee record. Zero validFrom means the change takes effect at timestamp.
+func (s *SqliteRecordService) updateEmployee(ctx context.Context, timestamp time.Time, validFrom time.Time, record entity.Record) (newRecord entity.Record, err error) {
 	name := record.DataVal("name")
 	startDate := record.DataVal("startDate")
 	if startDate == "" { // TODO: allow missing startDate for updates
@@ -107,6 +122,10 @@ func (s *SqliteRecordService) updateEmployee(ctx context.Context, timestamp time
 	if err != nil {
 		return newRecord, ErrServerError
 	}
+	employee.ValidFrom = validFrom
+	if employee.ValidTo, err = parseOptionalValidTo(record, timestamp, validFrom); err != nil {
+		return newRecord, err
+	}
 
 	count, err := s.service.CountEmployeeRecords(ctx, *employee)
 	if err != nil {
@@ -114,6 +133,15 @@ func (s *SqliteRecordService) updateEmployee(ctx context.Context, timestamp time
 	} else if count == 0 {
 		return newRecord, ErrRecordDoesNotExist
 	}
+	if err := s.keepEmployeeRating(ctx, employee); err != nil {
+		return newRecord, err
+	}
+	if err := setEmployeeRating(employee, record); err != nil {
+		return newRecord, err
+	}
+	if err := validateEmployee(employee); err != nil {
+		return newRecord, err
+	}
 	newRecord, err = s.service.UpdateEmployee(ctx, employee)
 	ed := newRecord.DataVal("end_date")
 	if ed == "" || len(ed) != 10 || ed == "0001-01-01" {
@@ -122,5 +150,57 @@ func (s *SqliteRecordService) updateEmployee(ctx context.Context, timestamp time
 	if err != nil {
 		return entity.Record{}, err
 	}
+	if !employee.ValidTo.IsZero() {
+		newRecord.Data["validTo"] = entity.FormatValidTime(employee.ValidTo)
+	}
 	return newRecord, nil
 }
+
+// keepEmployeeRating copies the job class code, annual payroll, and work location of the employee's record
+// valid when the change takes effect, so an update only changes those the request has, including to empty
+func (s *SqliteRecordService) keepEmployeeRating(ctx context.Context, employee *entity.Employee) error {
+	asOfValid := employee.ValidFrom
+	if asOfValid.IsZero() {
+		asOfValid = employee.RecordTimestamp
+	}
+	employees, err := s.service.GetByBitemporalDate(ctx, &entity.Employee{}, int64(employee.InsuredId), asOfValid, employee.RecordTimestamp)
+	if err != nil {
+		return ErrServerError
+	}
+	for _, obj := range employees {
+		if current, ok := obj.(*entity.Employee); ok && current.ID == employee.ID {
+			employee.JobClassCode, employee.AnnualPayroll, employee.WorkLocation = current.JobClassCode, current.AnnualPayroll, current.WorkLocation
+		}
+	}
+	return nil
+}
+
+// setEmployeeRating sets the employee's job class code (e.g. "8810"), annual payroll (e.g. "52,000.00"), and work location that the record has.
+// A key sent empty clears its field; a key not sent keeps it.
+func setEmployeeRating(employee *entity.Employee, record entity.Record) error {
+	if value, ok := record.Data["jobClassCode"]; ok {
+		employee.JobClassCode = value
+	}
+	if value, ok := record.Data["annualPayroll"]; ok {
+		employee.AnnualPayroll = 0
+		if value != "" {
+			cents, err := entity.ParseAmount(value)
+			if err != nil {
+				return fmt.Errorf("%w: annualPayroll: %s", ErrInvalidEmployee, entity.ErrorMessage(err))
+			}
+			employee.AnnualPayroll = cents
+		}
+	}
+	if value, ok := record.Data["workLocation"]; ok {
+		employee.WorkLocation = value
+	}
+	return nil
+}
+
+// validateEmployee returns ErrInvalidEmployee, with the reason, if the employee is not valid
+func validateEmployee(employee *entity.Employee) error {
+	if err := employee.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidEmployee, entity.ErrorMessage(err))
+	}
+	return nil
+}
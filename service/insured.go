@@ -2,15 +2,15 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/nickcoast/timetravel/entity"
-	"github.com/nickcoast/timetravel/sqlite"
 )
 
 // ObjectResourceService - new interface to disentangle RDBMS from Record service interface
 //
-// returns "Insured" objects (Insured, Employee, Address, and collections thereof)
+// returns "Insured" objects (Insured, Employee, Address, Policy, Claim, and collections thereof)
 //
 // TODO: change each return type to entity.InsuredInterface
 type ObjectResourceService interface {
@@ -33,9 +33,35 @@ type ObjectResourceService interface {
 	UpdateResource(ctx context.Context, resource string, record entity.Record) (entity.Record, error)
 	//UpdateResource(ctx context.Context, insuredType entity.InsuredInterface) ( entity.InsuredInterface, error)
 
+	// CorrectResource records a change that took effect at a past date ("validFrom"), known as of now.
+	// Earlier records are kept, so previous answers can still be reproduced.
+	CorrectResource(ctx context.Context, resource string, record entity.Record) (entity.Record, error)
+
+	// RenewPolicy adds the next term of the record's "policyId", starting when its latest term expires
+	RenewPolicy(ctx context.Context, record entity.Record) (entity.Record, error)
+
+	// GetClaim returns the claim with the insured as it was at the loss date
+	GetClaim(ctx context.Context, id int) (*entity.Claim, error)
+
 	//DeleteResource(ctx context.Context, resource string, id int64) (entity.Record, error)
+	// DeleteResource soft deletes: history is kept, and the resource can still be seen at earlier times.
 	DeleteResource(ctx context.Context, insuredType entity.InsuredInterface, id int64) (entity.InsuredInterface, error)
 
+	// GetSnapshot returns every insured matching filter as it was at asOf, and the total count of matching insureds
+	GetSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter) ([]entity.Insured, int, error)
+
+	// StreamSnapshot is GetSnapshot calling fn with each insured as it is read
+	StreamSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter, fn func(insured entity.Insured, total int) error) (int, error)
+
+	// PreviewDeleteResource returns what DeleteResource would delete, without deleting anything
+	PreviewDeleteResource(ctx context.Context, insuredType entity.InsuredInterface, id int64) (entity.DeletePreview, error)
+
+	// PurgeResource permanently deletes the resource and all of its history. Privileged.
+	PurgeResource(ctx context.Context, insuredType entity.InsuredInterface, id int64) error
+
+	// RestoreResource re-materializes the resource as it was at asOf by appending new records
+	RestoreResource(ctx context.Context, insuredType entity.InsuredInterface, id int64, asOf time.Time) (entity.InsuredInterface, error)
+
 	//GetResourceByDate(ctx context.Context, resource string, naturalKey string, insuredId int64, date time.Time) (records entity.Record, err error)
 	// TODO: remove natural key. Maybe insuredId
 	GetResourceByDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, naturalKey string, insuredId int64, date time.Time) (entity.InsuredInterface, error)
@@ -43,6 +69,23 @@ type ObjectResourceService interface {
 	GetInsuredByDate(ctx context.Context, insuredId int64, date time.Time) (insured entity.Insured, err error)
 	//GetInsuredByDate(ctx context.Context, insuredType entity.InsuredInterface, date time.Time) (entity.InsuredInterface, error)
 
+	// GetResourceByBitemporalDate returns the insured's records valid at asOfValid as known at asOfRecorded
+	GetResourceByBitemporalDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (map[int]entity.InsuredInterface, error)
+
+	GetInsuredByBitemporalDate(ctx context.Context, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (insured entity.Insured, err error)
+
+	// DiffInsured returns what changed for the insured between two instants
+	DiffInsured(ctx context.Context, insuredId int64, from time.Time, to time.Time) (entity.InsuredDiff, error)
+
+	// GetTimeline returns every event for the insured in one stream, sorted by the time it was recorded
+	GetTimeline(ctx context.Context, insuredId int64, filter entity.TimelineFilter) ([]entity.TimelineEvent, int, error)
+
+	// GetPendingChanges returns the insured's scheduled changes that have not taken effect yet
+	GetPendingChanges(ctx context.Context, insuredId int64) ([]entity.PendingChange, error)
+
+	// CancelPendingChange cancels a scheduled change by the id of its record
+	CancelPendingChange(ctx context.Context, insuredType entity.InsuredInterface, recordId int64) (entity.PendingChange, error)
+
 	GetAll(ctx context.Context, entityType entity.InsuredInterface)  (map[int]entity.InsuredInterface, error)
 
 	GetAllByEntityId(ctx context.Context, entityType entity.InsuredInterface, entityId int64) (map[int]entity.InsuredInterface, error)
@@ -53,39 +96,48 @@ var _ ObjectResourceService = (*SqliteRecordService)(nil)
 // InMemoryRecordService is an in-memory implementation of RecordService.
 type SqliteRecordService struct {
 	data    map[int]entity.Record
-	service sqlite.InsuredService
+	service Store
 }
 
 //var _ ObjectResourceService = (*SqliteRecordService)(nil)
 
-func NewSqliteRecordService() SqliteRecordService {
+// NewSqliteRecordService returns a SqliteRecordService reading and writing with store, e.g. a *sqlite.DB
+func NewSqliteRecordService(store Store) SqliteRecordService {
 	return SqliteRecordService{
-		data: map[int]entity.Record{},
+		data:    map[int]entity.Record{},
+		service: store,
 	}
 }
 
-func (s *SqliteRecordService) SetService(db *sqlite.DB) {
-	s.service = *sqlite.NewInsuredService(db)
-}
-
 func (s *SqliteRecordService) CreateResource(ctx context.Context, resource string, record entity.Record) (newRecord entity.Record, err error) {
 	id := record.ID
 	if id != 0 {
 		return newRecord, ErrRecordIDInvalid
 	}
 	timestamp := time.Now() // for all new record creation
+	validFrom, err := parseOptionalValidFrom(record)
+	if err != nil {
+		return newRecord, err
+	}
 	if resource == "insured" {
 		return s.createInsured(ctx, timestamp, record)
 	} else if resource == "employee" || resource == "employees" {
-		return s.createEmployee(ctx, timestamp, record)
+		newRecord, err = s.createEmployee(ctx, timestamp, validFrom, record)
 	} else if resource == "address" || resource == "insured_addresses" || resource == "addresses" {
-		return s.createAddress(ctx, timestamp, record)
+		newRecord, err = s.createAddress(ctx, timestamp, validFrom, record)
+	} else if resource == "policy" || resource == "policies" {
+		newRecord, err = s.createPolicy(ctx, timestamp, validFrom, record)
+	} else if resource == "claim" || resource == "claims" {
+		newRecord, err = s.createClaim(ctx, timestamp, validFrom, record)
 	}
 	if err != nil {
 		return newRecord, err
 		// TODO: May want to use this here later
 		//return ErrRecordAlreadyExists
 	}
+	if !validFrom.IsZero() {
+		newRecord.Data["validFrom"] = entity.FormatValidTime(validFrom)
+	}
 	return newRecord, nil
 }
 
@@ -95,25 +147,122 @@ func (s *SqliteRecordService) UpdateResource(ctx context.Context, resource strin
 		return updateRecord, ErrRecordIDInvalid
 	} */
 	timestamp := time.Now() // for all new record creation
+	// optional "validFrom" schedules the change for a future date
+	validFrom, err := parseOptionalValidFrom(record)
+	if err != nil {
+		return updateRecord, err
+	}
+	if !validFrom.IsZero() && !validFrom.After(timestamp) {
+		return updateRecord, ErrScheduledChangeNotInFuture
+	}
 	if resource == "insured" {
 		return record, ErrRecordAlreadyExists // cannot update insured (name, policy id). Address and address data are updateable
 	} else if resource == "address" || resource == "addresses" || resource == "insured_addresses" || resource == "insured_address" {
-		return s.updateAddress(ctx, timestamp, record)
+		updateRecord, err = s.updateAddress(ctx, timestamp, validFrom, record)
+		if err == entity.ErrUpdateMustChangeAValue {
+			err = ErrRecordUpdateRequireChange
+		}
 	} else if resource == "employee" || resource == "employees" {
-		updateRecord, err := s.updateEmployee(ctx, timestamp, record)
-		if err == sqlite.ErrUpdateMustChangeAValue {
+		updateRecord, err = s.updateEmployee(ctx, timestamp, validFrom, record)
+		if err == entity.ErrUpdateMustChangeAValue {
+			err = ErrRecordUpdateRequireChange
+		}
+	} else if resource == "policy" || resource == "policies" {
+		updateRecord, err = s.updatePolicy(ctx, timestamp, validFrom, record)
+		if err == entity.ErrUpdateMustChangeAValue {
+			err = ErrRecordUpdateRequireChange
+		}
+	} else if resource == "claim" || resource == "claims" {
+		updateRecord, err = s.updateClaim(ctx, timestamp, validFrom, record)
+		if err == entity.ErrUpdateMustChangeAValue {
 			err = ErrRecordUpdateRequireChange
 		}
+	} else {
+		return updateRecord, ErrRecordAlreadyExists
+	}
+	if err != nil {
 		return updateRecord, err
 	}
-	return updateRecord, ErrRecordAlreadyExists
+	if !validFrom.IsZero() {
+		updateRecord.Data["validFrom"] = entity.FormatValidTime(validFrom)
+	}
+	return updateRecord, nil
+}
+
+func (s *SqliteRecordService) CorrectResource(ctx context.Context, resource string, record entity.Record) (correctionRecord entity.Record, err error) {
+	timestamp := time.Now() // correction is known as of now
+	vf := record.DataVal("validFrom")
+	if vf == "" {
+		return correctionRecord, ErrCorrectionRequiresValidFrom
+	}
+	validFrom, err := entity.ParseValidTime(vf)
+	if err != nil {
+		return correctionRecord, ErrInvalidRequest
+	}
+	if validFrom.After(timestamp) {
+		return correctionRecord, ErrCorrectionNotInPast
+	}
+
+	if resource == "insured" {
+		return record, ErrRecordAlreadyExists // insured core data cannot be updated, so cannot be corrected
+	} else if resource == "address" || resource == "addresses" || resource == "insured_addresses" || resource == "insured_address" {
+		correctionRecord, err = s.updateAddress(ctx, timestamp, validFrom, record)
+	} else if resource == "employee" || resource == "employees" {
+		correctionRecord, err = s.updateEmployee(ctx, timestamp, validFrom, record)
+	} else if resource == "policy" || resource == "policies" {
+		correctionRecord, err = s.updatePolicy(ctx, timestamp, validFrom, record)
+	} else if resource == "claim" || resource == "claims" {
+		correctionRecord, err = s.updateClaim(ctx, timestamp, validFrom, record) // claims cannot be back-dated
+	} else {
+		return correctionRecord, ErrRecordAlreadyExists
+	}
+	if err == entity.ErrUpdateMustChangeAValue {
+		return entity.Record{}, ErrRecordUpdateRequireChange
+	} else if err != nil {
+		return entity.Record{}, err
+	}
+	correctionRecord.Data["validFrom"] = entity.FormatValidTime(validFrom)
+	return correctionRecord, nil
+}
+
+// parseOptionalValidFrom returns the record's "validFrom", or zero time if none was sent
+func parseOptionalValidFrom(record entity.Record) (time.Time, error) {
+	vf := record.DataVal("validFrom")
+	if vf == "" {
+		return time.Time{}, nil
+	}
+	validFrom, err := entity.ParseValidTime(vf)
+	if err != nil {
+		return time.Time{}, ErrInvalidRequest
+	}
+	return validFrom, nil
+}
+
+// parseOptionalValidTo returns the record's "validTo", when the change stops being true (start of day UTC for a date),
+// or zero time if none was sent. It must be after the change takes effect: validFrom, or timestamp if validFrom is zero.
+func parseOptionalValidTo(record entity.Record, timestamp time.Time, validFrom time.Time) (time.Time, error) {
+	vt := record.DataVal("validTo")
+	if vt == "" {
+		return time.Time{}, nil
+	}
+	validTo, err := entity.ParseValidTime(vt)
+	if err != nil {
+		return time.Time{}, ErrInvalidRequest
+	}
+	if validFrom.IsZero() {
+		validFrom = timestamp
+	}
+	if !validTo.After(validFrom) {
+		return time.Time{}, ErrValidToNotAfterValidFrom
+	}
+	return validTo, nil
 }
 
 func (s *SqliteRecordService) GetResourceById(ctx context.Context, resource entity.InsuredInterface, id int) (entity.InsuredInterface, error) {
 	if id == 0 {
 		return nil, ErrRecordDoesNotExist
 	}
-	e, err := s.service.Db.GetById(ctx, resource, int64(id))
+	e, err := s.service.GetById(ctx, resource, int64(id))
 	if err != nil || e.GetId() == 0 {
 		return nil, ErrRecordDoesNotExist
 	}
@@ -132,13 +281,77 @@ func (s *SqliteRecordService) DeleteResource(ctx context.Context, insuredObj ent
 	if id == 0 {
 		return record, ErrRecordDoesNotExist
 	}
-	record, err = s.service.Db.DeleteById(ctx, insuredObj, id)
+	if _, ok := insuredObj.(*entity.Claim); ok { // claims are closed, not deleted
+		return record, fmt.Errorf("%w: a claim is closed, not deleted", ErrInvalidClaim)
+	}
+	record, err = s.service.DeleteById(ctx, insuredObj, id)
 	if err != nil {
 		return record, ErrRecordDoesNotExist
 	}
 	return record, nil
 }
 
+func (s *SqliteRecordService) GetSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter) ([]entity.Insured, int, error) {
+	insureds, total, err := s.service.GetSnapshot(ctx, asOf, filter)
+	if err != nil {
+		return nil, 0, ErrServerError
+	}
+	return insureds, total, nil
+}
+
+func (s *SqliteRecordService) StreamSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter, fn func(insured entity.Insured, total int) error) (int, error) {
+	return s.service.StreamSnapshot(ctx, asOf, filter, fn)
+}
+
+func (s *SqliteRecordService) PreviewDeleteResource(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (preview entity.DeletePreview, err error) {
+	if id == 0 {
+		return preview, ErrRecordDoesNotExist
+	}
+	if _, ok := insuredObj.(*entity.Claim); ok { // claims are closed, not deleted
+		return preview, fmt.Errorf("%w: a claim is closed, not deleted", ErrInvalidClaim)
+	}
+	preview, err = s.service.DeletePreviewById(ctx, insuredObj, id)
+	if err == entity.ErrRecordDoesNotExist {
+		return preview, ErrRecordDoesNotExist
+	} else if err != nil {
+		return preview, ErrServerError
+	}
+	return preview, nil
+}
+
+func (s *SqliteRecordService) PurgeResource(ctx context.Context, insuredObj entity.InsuredInterface, id int64) error {
+	if id == 0 {
+		return ErrRecordDoesNotExist
+	}
+	err := s.service.PurgeById(ctx, insuredObj, id)
+	if err == entity.ErrRecordDoesNotExist {
+		return ErrRecordDoesNotExist
+	} else if err != nil {
+		return ErrServerError
+	}
+	return nil
+}
+
+func (s *SqliteRecordService) RestoreResource(ctx context.Context, insuredObj entity.InsuredInterface, id int64, asOf time.Time) (entity.InsuredInterface, error) {
+	if id == 0 {
+		return nil, ErrRecordDoesNotExist
+	}
+	restored, err := s.service.RestoreById(ctx, insuredObj, id, asOf)
+	switch err {
+	case nil:
+		return restored, nil
+	case entity.ErrRecordDoesNotExist:
+		return nil, ErrRecordDoesNotExist
+	case entity.ErrRecordMatchingCriteriaDoesNotExist:
+		return nil, ErrNothingToRestore
+	case entity.ErrUpdateMustChangeAValue:
+		return nil, ErrRecordUpdateRequireChange
+	case entity.ErrInsuredDeleted:
+		return nil, ErrRestoreRequiresInsured
+	}
+	return nil, ErrServerError
+}
+
 func (s *SqliteRecordService) createInsured(ctx context.Context, timestamp time.Time, record entity.Record) (newRecord entity.Record, err error) {
 	name := record.DataVal("name")
 	var insured *entity.Insured
@@ -154,7 +367,7 @@ func (s *SqliteRecordService) createInsured(ctx context.Context, timestamp time.
 }
 
 func (s *SqliteRecordService) GetInsuredByDate(ctx context.Context, insuredId int64, dateValid time.Time) (entity.Insured, error) {
-	return s.service.Db.GetInsuredByDate(ctx, insuredId, dateValid)
+	return s.service.GetInsuredByDate(ctx, insuredId, dateValid)
 }
 
 // TODO: use map for natural key, or struct
@@ -163,7 +376,7 @@ func (s *SqliteRecordService) GetResourceByDate(ctx context.Context, insuredIfac
 		return nil, ErrNonexistentParentRecord
 	}
 
-	record, err := s.service.Db.GetByDate(ctx, insuredIfaceObj, naturalKey, insuredId, dateValid)
+	record, err := s.service.GetByDate(ctx, insuredIfaceObj, naturalKey, insuredId, dateValid)
 	if err != nil {
 		return nil, ErrServerError
 	}
@@ -173,10 +386,78 @@ func (s *SqliteRecordService) GetResourceByDate(ctx context.Context, insuredIfac
 	return nil, ErrRecordDoesNotExist
 }
 
+func (s *SqliteRecordService) GetInsuredByBitemporalDate(ctx context.Context, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (entity.Insured, error) {
+	return s.service.GetInsuredByBitemporalDate(ctx, insuredId, asOfValid, asOfRecorded)
+}
+
+func (s *SqliteRecordService) GetResourceByBitemporalDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (map[int]entity.InsuredInterface, error) {
+	if insuredId == 0 {
+		return nil, ErrNonexistentParentRecord
+	}
+	records, err := s.service.GetByBitemporalDate(ctx, insuredIfaceObj, insuredId, asOfValid, asOfRecorded)
+	if err != nil {
+		return nil, ErrServerError
+	}
+	return records, nil
+}
+
 func (s *SqliteRecordService) GetAll(ctx context.Context, entityType entity.InsuredInterface) (map[int]entity.InsuredInterface, error) {
-	return s.service.Db.GetAll(ctx, entityType)
+	return s.service.GetAll(ctx, entityType)
 }
 
 func (s *SqliteRecordService) GetAllByEntityId(ctx context.Context, entityType entity.InsuredInterface, entityId int64) (map[int]entity.InsuredInterface, error) {
-	return s.service.Db.GetAllByEntityId(ctx, entityType, entityId)
-}
\ No newline at end of file
+	return s.service.GetAllByEntityId(ctx, entityType, entityId)
+}
+
+func (s *SqliteRecordService) GetPendingChanges(ctx context.Context, insuredId int64) ([]entity.PendingChange, error) {
+	if insuredId == 0 {
+		return nil, ErrRecordDoesNotExist
+	}
+	if _, err := s.GetResourceById(ctx, &entity.Insured{}, int(insuredId)); err != nil {
+		return nil, ErrRecordDoesNotExist
+	}
+	changes, err := s.service.GetPendingChanges(ctx, insuredId, time.Now())
+	if err != nil {
+		return nil, ErrServerError
+	}
+	return changes, nil
+}
+
+func (s *SqliteRecordService) CancelPendingChange(ctx context.Context, insuredType entity.InsuredInterface, recordId int64) (entity.PendingChange, error) {
+	change, err := s.service.CancelPendingChange(ctx, insuredType, recordId, time.Now())
+	if err == entity.ErrRecordDoesNotExist {
+		return change, ErrRecordDoesNotExist
+	} else if err == entity.ErrRecordNotPending {
+		return change, ErrChangeNotPending
+	} else if err != nil {
+		return change, ErrServerError
+	}
+	return change, nil
+}
+
+func (s *SqliteRecordService) DiffInsured(ctx context.Context, insuredId int64, from time.Time, to time.Time) (diff entity.InsuredDiff, err error) {
+	if insuredId == 0 {
+		return diff, ErrRecordDoesNotExist
+	}
+	before, err := s.service.GetInsuredByDate(ctx, insuredId, from)
+	if err != nil || before.ID == 0 {
+		return diff, ErrRecordDoesNotExist
+	}
+	after, err := s.service.GetInsuredByDate(ctx, insuredId, to)
+	if err == entity.ErrRecordDoesNotExist { // deleted by "to": everything was removed
+		after = entity.Insured{ID: before.ID}
+	} else if err != nil {
+		return diff, ErrServerError
+	}
+	return entity.DiffInsured(before, after, from, to), nil
+}
+
+func (s *SqliteRecordService) GetTimeline(ctx context.Context, insuredId int64, filter entity.TimelineFilter) ([]entity.TimelineEvent, int, error) {
+	events, n, err := s.service.GetTimeline(ctx, insuredId, filter)
+	if err == entity.ErrRecordDoesNotExist {
+		return nil, 0, ErrRecordDoesNotExist
+	} else if err != nil {
+		return nil, 0, ErrServerError
+	}
+	return events, n, nil
+}
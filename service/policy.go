@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// createPolicy creates a new policy of the record's "insuredId", with its first term.
+// Zero validFrom means the policy is on record from its effective date, or from timestamp if that is earlier.
+// "expirationDate" defaults to a year after "effectiveDate", and "aggregateLimit" to "occurrenceLimit".
+func (s *SqliteRecordService) createPolicy(ctx context.Context, timestamp time.Time, validFrom time.Time, record entity.Record) (newRecord entity.Record, err error) {
+	insuredId, err := strconv.Atoi(record.DataVal("insuredId"))
+	if err != nil || insuredId < 1 {
+		return newRecord, ErrRecordIDInvalid
+	}
+	if _, err := s.GetResourceById(ctx, &entity.Insured{}, insuredId); err != nil {
+		return newRecord, ErrNonexistentParentRecord
+	}
+	for _, key := range []string{"effectiveDate", "occurrenceLimit", "premium"} {
+		if record.DataVal(key) == "" {
+			return newRecord, fmt.Errorf("%w: %s required", ErrInvalidPolicy, key)
+		}
+	}
+	policy := &entity.Policy{InsuredId: insuredId, Term: 1, RecordTimestamp: timestamp}
+	if err := setPolicyTerms(policy, record); err != nil {
+		return newRecord, err
+	}
+	if record.DataVal("expirationDate") == "" {
+		policy.ExpirationDate = policy.EffectiveDate.AddDate(1, 0, 0)
+	}
+	if record.DataVal("aggregateLimit") == "" {
+		policy.AggregateLimit = policy.OccurrenceLimit
+	}
+	policy.ValidFrom = validFrom
+	if validFrom.IsZero() && policy.EffectiveDate.Before(timestamp) {
+		policy.ValidFrom = policy.EffectiveDate
+	}
+	if err := validatePolicy(policy); err != nil {
+		return newRecord, err
+	}
+	newRecord, err = s.service.CreatePolicy(ctx, policy)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return newRecord, nil
+}
+
+// updatePolicy adds a record to the current term of the record's "policyId" (an endorsement).
+// The limits, premium, and expiration date may change; the effective date changes only by renewing.
+// Zero validFrom means the change takes effect at timestamp. It must take effect during the current term.
+func (s *SqliteRecordService) updatePolicy(ctx context.Context, timestamp time.Time, validFrom time.Time, record entity.Record) (newRecord entity.Record, err error) {
+	current, err := s.currentPolicy(ctx, record)
+	if err != nil {
+		return newRecord, err
+	}
+	policy := *current
+	if err := setPolicyTerms(&policy, record); err != nil {
+		return newRecord, err
+	}
+	if !policy.EffectiveDate.Equal(current.EffectiveDate) {
+		return newRecord, fmt.Errorf("%w: the effective date cannot change. Use 'renew' for the next term", ErrInvalidPolicy)
+	}
+	policy.RecordTimestamp, policy.ValidFrom, policy.ValidTo = timestamp, validFrom, time.Time{}
+	takesEffect := validFrom
+	if takesEffect.IsZero() {
+		takesEffect = timestamp
+	}
+	if takesEffect.Before(current.ValidFrom) || !takesEffect.Before(current.ExpirationDate) {
+		return newRecord, fmt.Errorf("%w: the change must take effect during the current term. Use 'renew' for the next term", ErrInvalidPolicy)
+	}
+	if err := validatePolicy(&policy); err != nil {
+		return newRecord, err
+	}
+	return s.service.UpdatePolicy(ctx, &policy)
+}
+
+// RenewPolicy adds the next term of the record's "policyId", starting when its latest term expires.
+// The term is as long as the latest, with the same limits and premium unless the record has
+// "occurrenceLimit", "aggregateLimit", "premium", or "expirationDate".
+func (s *SqliteRecordService) RenewPolicy(ctx context.Context, record entity.Record) (newRecord entity.Record, err error) {
+	current, err := s.currentPolicy(ctx, record)
+	if err != nil {
+		return newRecord, err
+	}
+	terms, err := s.service.GetAllByEntityId(ctx, &entity.Policy{}, int64(current.ID))
+	if err != nil {
+		return newRecord, ErrServerError
+	}
+	latest := *current
+	for _, t := range terms {
+		if t, ok := t.(*entity.Policy); ok && laterTerm(t, &latest) {
+			latest = *t
+		}
+	}
+	next := latest.Renew()
+	if record.DataVal("effectiveDate") != "" {
+		return newRecord, fmt.Errorf("%w: a renewal starts when the latest term expires", ErrInvalidPolicy)
+	}
+	if err := setPolicyTerms(&next, record); err != nil {
+		return newRecord, err
+	}
+	next.RecordTimestamp = time.Now()
+	next.ValidFrom = next.EffectiveDate
+	if err := validatePolicy(&next); err != nil {
+		return newRecord, err
+	}
+	newRecord, err = s.service.UpdatePolicy(ctx, &next)
+	if err == entity.ErrRecordDoesNotExist {
+		return entity.Record{}, ErrRecordDoesNotExist
+	} else if err != nil {
+		return entity.Record{}, err
+	}
+	newRecord.Data["validFrom"] = entity.FormatValidTime(next.ValidFrom)
+	return newRecord, nil
+}
+
+// currentPolicy returns the current record of the record's "policyId"
+func (s *SqliteRecordService) currentPolicy(ctx context.Context, record entity.Record) (*entity.Policy, error) {
+	policyId, err := strconv.Atoi(record.DataVal("policyId"))
+	if err != nil || policyId < 1 {
+		return nil, ErrEntityIDInvalid
+	}
+	current, err := s.GetResourceById(ctx, &entity.Policy{}, policyId)
+	if err != nil {
+		return nil, ErrRecordDoesNotExist
+	}
+	return current.(*entity.Policy), nil
+}
+
+// laterTerm returns true if a is a later term than b, or a later record of the same term
+func laterTerm(a *entity.Policy, b *entity.Policy) bool {
+	if a.Term != b.Term {
+		return a.Term > b.Term
+	}
+	if !a.ValidFrom.Equal(b.ValidFrom) {
+		return a.ValidFrom.After(b.ValidFrom)
+	}
+	return a.RecordTimestamp.After(b.RecordTimestamp)
+}
+
+// setPolicyTerms sets the policy's dates ("2006-01-02"), limits, and premium (e.g. "1250.00") that the record has
+func setPolicyTerms(policy *entity.Policy, record entity.Record) error {
+	dates := []struct {
+		key  string
+		date *time.Time
+	}{{"effectiveDate", &policy.EffectiveDate}, {"expirationDate", &policy.ExpirationDate}}
+	for _, d := range dates {
+		if value := record.DataVal(d.key); value != "" {
+			t, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return fmt.Errorf("%w: %s must be a date, e.g. '2006-01-02'", ErrInvalidPolicy, d.key)
+			}
+			*d.date = t
+		}
+	}
+	amounts := []struct {
+		key   string
+		cents *int64
+	}{{"occurrenceLimit", &policy.OccurrenceLimit}, {"aggregateLimit", &policy.AggregateLimit}, {"premium", &policy.Premium}}
+	for _, a := range amounts {
+		if value := record.DataVal(a.key); value != "" {
+			cents, err := entity.ParseAmount(value)
+			if err != nil {
+				return fmt.Errorf("%w: %s: %s", ErrInvalidPolicy, a.key, entity.ErrorMessage(err))
+			}
+			*a.cents = cents
+		}
+	}
+	return nil
+}
+
+// validatePolicy returns ErrInvalidPolicy, with the reason, if the policy is not valid
+func validatePolicy(policy *entity.Policy) error {
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPolicy, entity.ErrorMessage(err))
+	}
+	return nil
+}
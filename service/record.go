@@ -11,12 +11,24 @@ import (
 
 var ErrRecordDoesNotExist = errors.New("Record does not exist. Use 'new' to create.")
 var ErrRecordIDInvalid = errors.New("Record id must >= 0")
-var ErrEntityIDInvalid = errors.New("Operation requires entity id. E.g. 'employeeId' for employee, 'addressId' for address.")
+var ErrEntityIDInvalid = errors.New("Operation requires entity id. E.g. 'employeeId' for employee, 'addressId' for address, 'policyId' for policy, 'claimId' for claim.")
 var ErrRecordAlreadyExists = errors.New("Record already exists. Use 'update' to update")
 var ErrRecordUpdateRequireChange = errors.New("update must modify at least one value")
 var ErrServerError = errors.New("The server experienced a problem")
 var ErrInvalidRequest = errors.New("A required value for this operation was not received")
 var ErrNonexistentParentRecord = errors.New("Cannot create record for non-existent insuredId")
+var ErrCorrectionRequiresValidFrom = errors.New("Correction requires 'validFrom': the past date the change took effect")
+var ErrCorrectionNotInPast = errors.New("Correction must take effect in the past. Use 'update' for changes taking effect now")
+var ErrScheduledChangeNotInFuture = errors.New("Scheduled change must take effect in the future. Use 'correct' for changes that took effect in the past")
+var ErrValidToNotAfterValidFrom = errors.New("'validTo' must be after the change takes effect")
+var ErrChangeNotPending = errors.New("Change has already taken effect or was cancelled")
+var ErrNothingToRestore = errors.New("Nothing to restore: the record did not exist at that time")
+var ErrInvalidAddressType = errors.New("Address type must be 'mailing', 'billing', or 'location'")
+var ErrInvalidAddress = errors.New("Invalid address")
+var ErrInvalidPolicy = errors.New("Invalid policy")
+var ErrInvalidClaim = errors.New("Invalid claim")
+var ErrInvalidEmployee = errors.New("Invalid employee")
+var ErrRestoreRequiresInsured = errors.New("The insured is deleted. Restore the insured to restore its employees and address")
 
 // Implements method to get, create, and update record data.
 type RecordService interface {
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/seed"
+)
+
+var ErrStoreNotEmpty = errors.New("Seed data can only be added to a database without insureds")
+
+// Seed adds a fixture set to an empty store. Every record is written as the API writes it, with the same validation,
+// but recorded at the fixture's time. Returns ErrStoreNotEmpty if the store has insureds, so seeding twice changes nothing.
+func (s *SqliteRecordService) Seed(ctx context.Context, set seed.Set) error {
+	insureds, err := s.service.GetAll(ctx, &entity.Insured{})
+	if err != nil {
+		return err
+	} else if len(insureds) != 0 {
+		return ErrStoreNotEmpty
+	}
+	for _, insured := range set.Insureds {
+		if err := s.seedInsured(ctx, insured); err != nil {
+			return fmt.Errorf("seed %s: insured %q: %w", set.Name, insured.Name, err)
+		}
+	}
+	return nil
+}
+
+// seedInsured creates the insured, then its employees and addresses, one record at a time
+func (s *SqliteRecordService) seedInsured(ctx context.Context, fixture seed.Insured) error {
+	insured := &entity.Insured{Name: fixture.Name, PolicyNumber: fixture.PolicyNumber, RecordTimestamp: fixture.Recorded}
+	if _, err := s.service.CreateInsured(ctx, insured); err != nil {
+		return err
+	}
+	insuredId := strconv.Itoa(insured.ID)
+
+	for _, employee := range fixture.Employees {
+		employeeId := ""
+		for _, r := range employee.Records {
+			record := entity.Record{Data: map[string]string{
+				"name":      r.Name,
+				"startDate": r.StartDate,
+				"endDate":   r.EndDate,
+				"insuredId": insuredId,
+			}}
+			if employeeId == "" {
+				newRecord, err := s.createEmployee(ctx, r.Recorded, time.Time{}, record)
+				if err != nil {
+					return fmt.Errorf("employee %q: %w", r.Name, err)
+				}
+				employeeId = strconv.Itoa(newRecord.ID)
+				continue
+			}
+			record.Data["employeeId"] = employeeId
+			if _, err := s.updateEmployee(ctx, r.Recorded, time.Time{}, record); err != nil {
+				return fmt.Errorf("employee %s record at %v: %w", employeeId, r.Recorded, err)
+			}
+		}
+	}
+
+	created := map[string]bool{} // address types
+	for _, a := range fixture.Addresses {
+		record := entity.Record{Data: map[string]string{"address": a.Address, "insuredId": insuredId, "type": a.Type}}
+		write := s.updateAddress
+		if !created[a.Type] {
+			created[a.Type] = true
+			write = s.createAddress
+		}
+		if _, err := write(ctx, a.Recorded, time.Time{}, record); err != nil {
+			return fmt.Errorf("address %q: %w", a.Address, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// Store is every persistence operation SqliteRecordService uses.
+// Implemented by sqlite.DB, postgres.DB, memory.DB, and eventlog.DB, which return the same errors (entity.ErrRecordDoesNotExist, ...).
+type Store interface {
+	CreateInsured(ctx context.Context, insured *entity.Insured) (entity.Record, error)
+	CreateEmployee(ctx context.Context, employee *entity.Employee) (entity.Record, error)
+	UpdateEmployee(ctx context.Context, employee *entity.Employee) (entity.Record, error)
+	CountEmployeeRecords(ctx context.Context, employee entity.Employee) (int, error)
+	CreateAddress(ctx context.Context, address *entity.Address) (entity.Record, error)
+	UpdateAddress(ctx context.Context, address *entity.Address) (entity.Record, error)
+	CountInsuredAddresses(ctx context.Context, insured entity.Insured) (int, error)
+	CreatePolicy(ctx context.Context, policy *entity.Policy) (entity.Record, error)
+	UpdatePolicy(ctx context.Context, policy *entity.Policy) (entity.Record, error)
+	CreateClaim(ctx context.Context, claim *entity.Claim) (entity.Record, error)
+	UpdateClaim(ctx context.Context, claim *entity.Claim) (entity.Record, error)
+
+	GetById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (entity.InsuredInterface, error)
+	GetAll(ctx context.Context, entityType entity.InsuredInterface) (map[int]entity.InsuredInterface, error)
+	GetAllByEntityId(ctx context.Context, entityType entity.InsuredInterface, entityId int64) (map[int]entity.InsuredInterface, error)
+	GetByDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, naturalKey string, insuredId int64, date time.Time) (map[int]entity.InsuredInterface, error)
+	GetByBitemporalDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (map[int]entity.InsuredInterface, error)
+	GetInsuredByDate(ctx context.Context, insuredId int64, date time.Time) (entity.Insured, error)
+	GetInsuredByBitemporalDate(ctx context.Context, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (entity.Insured, error)
+	GetSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter) ([]entity.Insured, int, error)
+	StreamSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter, fn func(insured entity.Insured, total int) error) (int, error)
+	GetTimeline(ctx context.Context, insuredId int64, filter entity.TimelineFilter) ([]entity.TimelineEvent, int, error)
+	GetPendingChanges(ctx context.Context, insuredId int64, asOf time.Time) ([]entity.PendingChange, error)
+	CancelPendingChange(ctx context.Context, insuredIfaceObj entity.InsuredInterface, recordId int64, asOf time.Time) (entity.PendingChange, error)
+	DeleteById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (entity.InsuredInterface, error)
+	DeletePreviewById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (entity.DeletePreview, error)
+	PurgeById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) error
+	RestoreById(ctx context.Context, insuredObj entity.InsuredInterface, id int64, asOf time.Time) (entity.InsuredInterface, error)
+}
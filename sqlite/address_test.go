@@ -17,7 +17,7 @@ import (
 func TestAddressService_CreateAddress(t *testing.T) {
 	// Ensure address can be created.
 	t.Run("OK", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 		ctx := context.Background()
@@ -68,7 +68,7 @@ func TestAddressService_CreateAddress(t *testing.T) {
 
 	// Ensure an error is returned if address name is not set.
 	t.Run("ErrNameRequired", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 		if _, err := s.CreateAddress(context.Background(), &entity.Address{}); err == nil {
@@ -84,7 +84,7 @@ func TestAddressService_CreateAddress(t *testing.T) {
 /* func TestAddressService_UpdateAddress(t *testing.T) {
 	// Ensure address name & email can be updated by current user.
 	t.Run("OK", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewAddressService(db)
 		user0, ctx0 := MustCreateAddress(t, context.Background(), db, &entity.Address{
@@ -119,7 +119,7 @@ func TestAddressService_CreateAddress(t *testing.T) {
 /* func TestAddressService_DeleteAddress(t *testing.T) {
 	// Ensure address can delete self.
 	t.Run("OK", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewAddressService(db)
 		address0, ctx0 := MustCreateAddress(t, context.Background(), db, &entity.Address{Name: "Johnny Rotten", PolicyNumber: 333, RecordTimestamp: time.Now().UTC(), ID: 666})
@@ -134,7 +134,7 @@ func TestAddressService_CreateAddress(t *testing.T) {
 
 	// Ensure an error is returned if deleting a non-existent address.
 	t.Run("ErrNotFound", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewAddressService(db)
 		if err := s.DeleteAddress(context.Background(), 777); entity.ErrorCode(err) != entity.ENOTFOUND {
@@ -146,7 +146,7 @@ func TestAddressService_CreateAddress(t *testing.T) {
 func TestAddressService_FindAddress(t *testing.T) {
 	// Ensure an error is returned if fetching a non-existent address.
 	t.Run("ErrNotFound", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		//s := sqlite.NewInsuredService(db)
 		if _, err := db.GetById(context.Background(), &entity.Employee{}, 999); err == nil {
@@ -159,7 +159,7 @@ func TestAddressService_FindAddress(t *testing.T) {
 func TestAddressService_FindAddresss(t *testing.T) {
 	// Ensure addresses can be fetched by email address.
 	/* 	t.Run("PolicyNumber", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 
@@ -183,6 +183,166 @@ func TestAddressService_FindAddresss(t *testing.T) {
 }
 
 // MustCreateAddress creates a address in the database. Fatal on error
+// An insured's addresses of different types have independent histories
+func TestAddressService_TypedAddresses(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	s := sqlite.NewInsuredService(db)
+
+	created, _ := time.Parse("2006-01-02", "2000-01-01")
+	moved, _ := time.Parse("2006-01-02", "2001-01-01")
+	deleted, _ := time.Parse("2006-01-02", "2002-01-01")
+	billing, _ := MustCreateAddress(tb, ctx, db, &entity.Address{Type: entity.AddressBilling, Address: "1 Billing Lane", InsuredId: 1, RecordTimestamp: created})
+	if got, want := billing.AddressId, 2; got != want {
+		tb.Fatalf("AddressId=%v, want %v", got, want)
+	}
+	if _, err := s.UpdateAddress(ctx, &entity.Address{AddressId: billing.AddressId, Address: "2 Billing Lane", InsuredId: 1, RecordTimestamp: moved}); err != nil {
+		tb.Fatal(err)
+	}
+	// which address?
+	if _, err := s.UpdateAddress(ctx, &entity.Address{Address: "Venus", InsuredId: 1, RecordTimestamp: moved}); err != sqlite.ErrRecordIDInvalid {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordIDInvalid)
+	}
+	db.Now = func() time.Time { return deleted }
+	if _, err := db.DeleteById(ctx, &entity.Address{}, int64(billing.ID)); err != nil {
+		tb.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		asOf time.Time
+		want map[string]string
+	}{
+		{created.Add(-time.Second), map[string]string{entity.AddressMailing: "Mars"}},
+		{created, map[string]string{entity.AddressMailing: "Mars", entity.AddressBilling: "1 Billing Ln"}},
+		{moved, map[string]string{entity.AddressMailing: "Mars", entity.AddressBilling: "2 Billing Ln"}},
+		{deleted, map[string]string{entity.AddressMailing: "Mars"}},
+	} {
+		insured, err := db.GetInsuredByDate(ctx, 1, tt.asOf)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		got := map[string]string{}
+		for _, address := range *insured.Addresses {
+			got[address.Type] = address.Address
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			tb.Fatalf("%v: addresses mismatch (-want +got):\n%s", tt.asOf, diff)
+		}
+	}
+}
+
+// Addresses are stored as normalized fields. Addresses from before they had fields are split by the migration.
+func TestAddressService_StructuredAddress(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	s := sqlite.NewInsuredService(db)
+
+	migrator, err := db.Migrator()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := migrator.To(7); err != nil {
+		tb.Fatal(err)
+	}
+	if err := migrator.Up(); err != nil {
+		tb.Fatal(err)
+	}
+	insured, err := db.GetInsuredByDate(ctx, 1, time.Unix(469368001, 0))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	want := entity.Address{Line1: "123 REAL St", City: "Springfield", Region: "Oregon"}
+	for _, address := range *insured.Addresses {
+		got := entity.Address{Line1: address.Line1, Line2: address.Line2, City: address.City, Region: address.Region, PostalCode: address.PostalCode, Country: address.Country}
+		if diff := cmp.Diff(want, got); diff != "" {
+			tb.Fatalf("migrated address mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	created, _ := time.Parse("2006-01-02", "2000-01-01")
+	billing, _ := MustCreateAddress(tb, ctx, db, &entity.Address{
+		Type:            entity.AddressBilling,
+		Line1:           "1600  Pennsylvania Avenue NW",
+		City:            "Washington",
+		Region:          "district of columbia",
+		PostalCode:      "20500",
+		Country:         "usa",
+		InsuredId:       1,
+		RecordTimestamp: created,
+	})
+	if got, want := billing.Address, "1600 Pennsylvania Ave NW, Washington, DC 20500, US"; got != want {
+		tb.Fatalf("Address=%v, want %v", got, want)
+	}
+	// the same address, written differently
+	same := &entity.Address{AddressId: billing.AddressId, Address: "1600 pennsylvania ave. nw, WASHINGTON, DC 20500, United States", InsuredId: 1, RecordTimestamp: created.Add(time.Hour)}
+	if _, err := s.UpdateAddress(ctx, same); err != sqlite.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrUpdateMustChangeAValue)
+	}
+
+	for _, address := range []*entity.Address{
+		{Type: entity.AddressLocation, Line1: "1 Main St", City: "Springfield", Region: "OR", PostalCode: "9747", Country: "US", InsuredId: 1},
+		{Type: entity.AddressLocation, Line1: "24 Sussex Dr", City: "Ottawa", Region: "ON", Country: "CA", InsuredId: 1},
+		{Type: entity.AddressLocation, City: "Springfield", InsuredId: 1},
+	} {
+		if _, err := s.CreateAddress(ctx, address); entity.ErrorCode(err) != entity.EINVALID {
+			tb.Fatalf("%v: err=%v, want %v", address.Format(), err, entity.EINVALID)
+		}
+	}
+}
+
+// Purging an address removes every record of it, its tombstones, and the address. Other addresses stay.
+func TestAddressService_PurgeAddress(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	s := sqlite.NewInsuredService(db)
+
+	created, _ := time.Parse("2006-01-02", "2000-01-01")
+	moved, _ := time.Parse("2006-01-02", "2001-01-01")
+	deleted, _ := time.Parse("2006-01-02", "2002-01-01")
+	billing, _ := MustCreateAddress(tb, ctx, db, &entity.Address{Type: entity.AddressBilling, Address: "1 Billing Lane", InsuredId: 1, RecordTimestamp: created})
+	if _, err := s.UpdateAddress(ctx, &entity.Address{AddressId: billing.AddressId, Address: "2 Billing Lane", InsuredId: 1, RecordTimestamp: moved}); err != nil {
+		tb.Fatal(err)
+	}
+	db.Now = func() time.Time { return deleted }
+	if _, err := db.DeleteById(ctx, &entity.Address{}, int64(billing.ID)); err != nil {
+		tb.Fatal(err)
+	}
+
+	if err := db.PurgeById(ctx, &entity.Address{}, int64(billing.ID)); err != nil {
+		tb.Fatal(err)
+	}
+	var records, addresses int
+	if err := db.SQL.QueryRowContext(ctx, `SELECT COUNT(*) FROM insured_addresses_records WHERE address_id = ?`, billing.AddressId).Scan(&records); err != nil {
+		tb.Fatal(err)
+	} else if records != 0 {
+		tb.Fatalf("records=%v, want 0", records)
+	}
+	if err := db.SQL.QueryRowContext(ctx, `SELECT COUNT(*) FROM insured_addresses WHERE id = ?`, billing.AddressId).Scan(&addresses); err != nil {
+		tb.Fatal(err)
+	} else if addresses != 0 {
+		tb.Fatalf("addresses=%v, want 0", addresses)
+	}
+	for _, asOf := range []time.Time{created, moved, deleted} {
+		insured, err := db.GetInsuredByDate(ctx, 1, asOf)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		got := map[string]string{}
+		for _, address := range *insured.Addresses {
+			got[address.Type] = address.Address
+		}
+		if diff := cmp.Diff(map[string]string{entity.AddressMailing: "Mars"}, got); diff != "" {
+			tb.Fatalf("%v: addresses mismatch (-want +got):\n%s", asOf, diff)
+		}
+	}
+	if err := db.PurgeById(ctx, &entity.Address{}, int64(billing.ID)); err != sqlite.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordDoesNotExist)
+	}
+}
+
 func MustCreateAddress(tb testing.TB, ctx context.Context, db *sqlite.DB, address *entity.Address) (newAddress entity.Address, c context.Context) {
 	tb.Helper()
 	record, err := sqlite.NewInsuredService(db).CreateAddress(ctx, address)
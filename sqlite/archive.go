@@ -0,0 +1,359 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/sqlstore"
+)
+
+// Old record versions can be moved out of employees_records and insured_addresses_records into
+// the same tables in an archive database file, attached to every connection as "archive".
+// A version is moved only if no query as of the cutoff or later can return it, so reads as of the cutoff
+// or later use the main tables alone. Reads before the cutoff, and whole-history reads, include the archive.
+
+var ErrNoArchive = errors.New("no archive database. Set the archive path")
+
+// archiveSchema creates the archive's tables. Ids are kept from the main tables, which never reuse them.
+// archive_cutoff holds the latest cutoff archived to.
+const archiveSchema = `
+CREATE TABLE IF NOT EXISTS archive.employees_records (
+	"id"	INTEGER NOT NULL PRIMARY KEY,
+	"employee_id" INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"start_date"	TEXT NOT NULL,
+	"end_date"	TEXT NOT NULL DEFAULT '0001-01-01',
+	"job_class_code"	TEXT NOT NULL DEFAULT '',
+	"annual_payroll"	INTEGER NOT NULL DEFAULT 0,
+	"work_location"	TEXT NOT NULL DEFAULT '',
+	"record_timestamp"	INTEGER NOT NULL,
+	"valid_from" INTEGER NOT NULL DEFAULT 0,
+	"valid_to" INTEGER,
+	"tombstone" INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS archive.employees_records_employee_id ON employees_records ("employee_id");
+CREATE TABLE IF NOT EXISTS archive.insured_addresses_records (
+	"id"	INTEGER NOT NULL PRIMARY KEY,
+	"address_id"	INTEGER,
+	"address"	TEXT NOT NULL,
+	"line1"	TEXT NOT NULL DEFAULT '',
+	"line2"	TEXT NOT NULL DEFAULT '',
+	"city"	TEXT NOT NULL DEFAULT '',
+	"region"	TEXT NOT NULL DEFAULT '',
+	"postal_code"	TEXT NOT NULL DEFAULT '',
+	"country"	TEXT NOT NULL DEFAULT '',
+	"insured_id"	INTEGER NOT NULL,
+	"record_timestamp"	INTEGER NOT NULL,
+	"valid_from" INTEGER NOT NULL DEFAULT 0,
+	"valid_to" INTEGER,
+	"tombstone" INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS archive.insured_addresses_records_insured_id ON insured_addresses_records ("insured_id");
+CREATE TABLE IF NOT EXISTS archive.archive_cutoff (
+	"cutoff"	INTEGER NOT NULL
+);
+`
+
+const (
+	employeeRecordColumns = `id, employee_id, name, start_date, end_date, job_class_code, annual_payroll, work_location, record_timestamp, valid_from, valid_to, tombstone`
+	addressRecordColumns  = `id, address_id, address, line1, line2, city, region, postal_code, country, insured_id, record_timestamp, valid_from, valid_to, tombstone`
+)
+
+// archivedColumns are the columns of the records tables that are archived, by table
+var archivedColumns = map[string]string{
+	`employees_records`:         employeeRecordColumns,
+	`insured_addresses_records`: addressRecordColumns,
+}
+
+// archive is the sqlstore.Archive of a DB with an archive database
+type archive DB
+
+// Cutoff returns the time before which reads include the archive. See DB.ArchiveCutoff.
+func (a *archive) Cutoff() time.Time {
+	return (*DB)(a).ArchiveCutoff()
+}
+
+// Union returns a subquery selecting the rows of the table in both databases, if the table is archived
+func (a *archive) Union(table string) string {
+	columns, ok := archivedColumns[table]
+	if !ok {
+		return ""
+	}
+	return `(SELECT ` + columns + ` FROM main.` + table + ` UNION ALL SELECT ` + columns + ` FROM archive.` + table + `)`
+}
+
+// ArchiveResult reports what Archive moved
+type ArchiveResult struct {
+	Cutoff          time.Time
+	EmployeeRecords int64 // employee record versions moved
+	AddressRecords  int64 // address record versions moved
+	Reclaimed       int64 // bytes the main database file shrank by
+}
+
+// archiveConnector opens connections with the archive attached
+type archiveConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func newArchiveConnector(dsn string, archivePath string) *archiveConnector {
+	return &archiveConnector{dsn: dsn, driver: &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			_, err := conn.Exec(`ATTACH DATABASE ? AS archive`, []driver.Value{archivePath})
+			return err
+		},
+	}}
+}
+
+func (c *archiveConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *archiveConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// openArchive creates the archive's tables, if new, and reads its cutoff.
+// Adds address_id and the address fields to an archive made before addresses had them,
+// and the job class code, payroll, and work location to one made before employees had them.
+// See fillArchivedAddressIds and fillArchivedAddressFields.
+func (db *DB) openArchive() error {
+	if _, err := db.SQL.Exec(archiveSchema); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	for _, column := range []struct{ table, name, definition string }{
+		{"insured_addresses_records", "address_id", `"address_id" INTEGER`},
+		{"insured_addresses_records", "line1", `"line1" TEXT NOT NULL DEFAULT ''`},
+		{"insured_addresses_records", "line2", `"line2" TEXT NOT NULL DEFAULT ''`},
+		{"insured_addresses_records", "city", `"city" TEXT NOT NULL DEFAULT ''`},
+		{"insured_addresses_records", "region", `"region" TEXT NOT NULL DEFAULT ''`},
+		{"insured_addresses_records", "postal_code", `"postal_code" TEXT NOT NULL DEFAULT ''`},
+		{"insured_addresses_records", "country", `"country" TEXT NOT NULL DEFAULT ''`},
+		{"employees_records", "job_class_code", `"job_class_code" TEXT NOT NULL DEFAULT ''`},
+		{"employees_records", "annual_payroll", `"annual_payroll" INTEGER NOT NULL DEFAULT 0`},
+		{"employees_records", "work_location", `"work_location" TEXT NOT NULL DEFAULT ''`},
+	} {
+		var exists bool
+		if err := db.SQL.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?, 'archive') WHERE name = ?`, column.table, column.name).Scan(&exists); err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+		if !exists {
+			if _, err := db.SQL.Exec(`ALTER TABLE archive.` + column.table + ` ADD COLUMN ` + column.definition); err != nil {
+				return fmt.Errorf("archive: %w", err)
+			}
+		}
+	}
+	var cutoff sql.NullInt64
+	if err := db.SQL.QueryRow(`SELECT MAX(cutoff) FROM archive.archive_cutoff`).Scan(&cutoff); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	if cutoff.Valid {
+		db.setArchiveCutoff(time.Unix(cutoff.Int64, 0).UTC())
+	}
+	return nil
+}
+
+// fillArchivedAddressIds gives archived address records without an address id the insured's first address,
+// as migration 7 does for the main table. Needs the main database migrated.
+func (db *DB) fillArchivedAddressIds() error {
+	if _, err := db.SQL.Exec(`
+		INSERT INTO main.insured_addresses (insured_id, type)
+		SELECT DISTINCT insured_id, 'mailing' FROM archive.insured_addresses_records
+		WHERE address_id IS NULL AND insured_id NOT IN (SELECT insured_id FROM main.insured_addresses)
+		AND insured_id IN (SELECT id FROM main.insured)
+	`); err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	_, err := db.SQL.Exec(`
+		UPDATE archive.insured_addresses_records SET address_id = (
+			SELECT MIN(a.id) FROM main.insured_addresses a WHERE a.insured_id = insured_addresses_records.insured_id
+		) WHERE address_id IS NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	return nil
+}
+
+// fillArchivedCancellations moves the cancellations kept on archived records, before migration 12, to the
+// main database's cancellations tables, as the migration does for the main tables. Archived rows are never updated otherwise.
+func (db *DB) fillArchivedCancellations() error {
+	for _, table := range []string{"employees_records", "insured_addresses_records"} {
+		var exists bool
+		if err := db.SQL.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?, 'archive') WHERE name = 'cancelled_timestamp'`, table).Scan(&exists); err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+		if !exists {
+			continue
+		}
+		if _, err := db.SQL.Exec(`
+			INSERT INTO main.` + table + `_cancellations (record_id, record_timestamp)
+			SELECT id, cancelled_timestamp FROM archive.` + table + ` WHERE cancelled_timestamp IS NOT NULL
+		`); err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+		if _, err := db.SQL.Exec(`ALTER TABLE archive.` + table + ` DROP COLUMN cancelled_timestamp`); err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// fillArchivedAddressFields splits archived addresses stored only on one line into fields, as migration 8 does
+// for the main table, but with entity.ParseAddress. Archived rows are never updated otherwise.
+func (db *DB) fillArchivedAddressFields() error {
+	rows, err := db.SQL.Query(`SELECT id, address FROM archive.insured_addresses_records WHERE line1 = '' AND address != ''`)
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	addresses := map[int64]entity.Address{}
+	for rows.Next() {
+		var id int64
+		var address string
+		if err := rows.Scan(&id, &address); err != nil {
+			rows.Close()
+			return fmt.Errorf("archive: %w", err)
+		}
+		addresses[id] = entity.ParseAddress(address)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("archive: %w", err)
+	}
+	rows.Close()
+	for id, a := range addresses {
+		if _, err := db.SQL.Exec(`
+			UPDATE archive.insured_addresses_records SET line1 = ?, line2 = ?, city = ?, region = ?, postal_code = ?, country = ?
+			WHERE id = ?
+		`, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, id); err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// ArchiveCutoff returns the time before which reads include the archive. Zero if nothing was archived.
+func (db *DB) ArchiveCutoff() time.Time {
+	db.archiveMu.Lock()
+	defer db.archiveMu.Unlock()
+	return db.archiveCutoff
+}
+
+func (db *DB) setArchiveCutoff(cutoff time.Time) {
+	db.archiveMu.Lock()
+	defer db.archiveMu.Unlock()
+	if cutoff.After(db.archiveCutoff) {
+		db.archiveCutoff = cutoff
+	}
+}
+
+// Archive moves the employee and address record versions that cannot be seen as of cutoff or later to the archive,
+// then vacuums the main database. A version is moved if it was recorded and took effect before cutoff, and
+// before cutoff it was cancelled, its valid time ended, or a later open-ended version replaced it.
+// Current versions are never moved. Archiving again with the same cutoff moves nothing.
+func (db *DB) Archive(ctx context.Context, cutoff time.Time) (result ArchiveResult, err error) {
+	if db.ArchivePath == "" {
+		return result, ErrNoArchive
+	}
+	cutoff = cutoff.UTC().Truncate(time.Second)
+	if cutoff.After(db.Now()) {
+		return result, fmt.Errorf("archive cutoff %v is in the future", cutoff.Format(time.RFC3339))
+	}
+	result.Cutoff = cutoff
+	before, err := db.size(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+	if result.EmployeeRecords, err = archiveRecords(ctx, tx, `employees_records`, employeeRecordColumns, `employee_id`, cutoff); err != nil {
+		return result, err
+	}
+	if result.AddressRecords, err = archiveRecords(ctx, tx, `insured_addresses_records`, addressRecordColumns, `address_id`, cutoff); err != nil {
+		return result, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO archive.archive_cutoff (cutoff) VALUES (?)`, cutoff.Unix()); err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	db.setArchiveCutoff(cutoff)
+
+	if _, err := db.SQL.ExecContext(ctx, `VACUUM main`); err != nil {
+		return result, fmt.Errorf("vacuum: %w", err)
+	}
+	after, err := db.size(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Reclaimed = before - after
+	return result, nil
+}
+
+// archiveRecords copies a table's versions that can no longer be seen as of cutoff to the archive,
+// and deletes every archived version from the main table. partition is the column of the entity
+// whose versions replace each other. Returns the number of versions moved.
+// With WAL, the two databases commit separately: a copy whose delete was lost is deleted the next time.
+func archiveRecords(ctx context.Context, tx *sqlstore.Tx, table string, columns string, partition string, cutoff time.Time) (int64, error) {
+	c := cutoff.Unix()
+	_, err := tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO archive.`+table+` (`+columns+`)
+		SELECT `+columns+` FROM main.`+table+` t
+		WHERE t.record_timestamp < ? AND t.valid_from < ?
+		AND (
+			EXISTS (SELECT 1 FROM main.`+table+`_cancellations c WHERE c.record_id = t.id AND c.record_timestamp < ?)
+			OR (t.valid_to IS NOT NULL AND t.valid_to <= ?)
+			OR EXISTS (
+				SELECT 1 FROM main.`+table+` n
+				WHERE n.`+partition+` = t.`+partition+` AND n.id > t.id
+				AND n.record_timestamp < ? AND n.valid_from < ?
+				AND n.valid_to IS NULL AND NOT EXISTS (SELECT 1 FROM main.`+table+`_cancellations c WHERE c.record_id = n.id)
+				AND (n.valid_from > t.valid_from OR (n.valid_from = t.valid_from AND n.record_timestamp >= t.record_timestamp))
+			)
+		)
+	`, c, c, c, c, c, c)
+	if err != nil {
+		return 0, fmt.Errorf("archive %s: %w", table, err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM main.`+table+` WHERE id IN (SELECT id FROM archive.`+table+`)`)
+	if err != nil {
+		return 0, fmt.Errorf("archive %s: %w", table, err)
+	}
+	return result.RowsAffected()
+}
+
+// Purge deletes archived versions of employees, addresses, and insureds that were purged from the main tables.
+// The archive has no foreign keys to cascade.
+func (a *archive) Purge(ctx context.Context, tx *sqlstore.Tx) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM archive.employees_records WHERE employee_id NOT IN (SELECT id FROM main.employees)`); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM archive.insured_addresses_records
+		WHERE insured_id NOT IN (SELECT id FROM main.insured)
+		OR address_id NOT IN (SELECT id FROM main.insured_addresses)`)
+	return err
+}
+
+// size returns the size of the main database in bytes
+func (db *DB) size(ctx context.Context) (int64, error) {
+	var pages, pageSize int64
+	if err := db.SQL.QueryRowContext(ctx, `PRAGMA main.page_count`).Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := db.SQL.QueryRowContext(ctx, `PRAGMA main.page_size`).Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
@@ -0,0 +1,101 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/sqlite"
+)
+
+// MustOpenArchivedDB opens a demo database in dir with an archive. Fatal on error.
+func MustOpenArchivedDB(tb testing.TB, dir string, fixtures string) *sqlite.DB {
+	tb.Helper()
+	db := sqlite.NewDB(filepath.Join(dir, "db"))
+	db.ArchivePath = filepath.Join(dir, "archive.db")
+	if err := db.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	if fixtures != "" {
+		MustSeed(tb, db, fixtures)
+	}
+	return db
+}
+
+// Versions replaced before the cutoff are moved, and still read as of earlier times
+func TestDB_Archive(tb *testing.T) {
+	dir := tb.TempDir()
+	db := MustOpenArchivedDB(tb, dir, "demo")
+	ctx := context.Background()
+	cutoff := time.Date(1997, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	result, err := db.Archive(ctx, cutoff)
+	if err != nil {
+		tb.Fatal(err)
+	} else if result.EmployeeRecords != 1 || result.AddressRecords != 2 {
+		tb.Fatalf("result=%+v, want 1 employee and 2 address records", result)
+	}
+	if result, err := db.Archive(ctx, cutoff); err != nil {
+		tb.Fatal(err)
+	} else if result.EmployeeRecords != 0 || result.AddressRecords != 0 {
+		tb.Fatalf("again result=%+v, want none", result)
+	}
+	MustCloseDB(tb, db)
+
+	db = MustOpenArchivedDB(tb, dir, "")
+	defer MustCloseDB(tb, db)
+	if got := db.ArchiveCutoff(); !got.Equal(cutoff) {
+		tb.Fatalf("ArchiveCutoff=%v, want %v", got, cutoff)
+	}
+	for _, tt := range []struct {
+		date    time.Time
+		address string
+	}{
+		{time.Date(1985, 1, 1, 0, 0, 0, 0, time.UTC), "123 REAL St, Springfield, Oregon"}, // archived
+		{time.Date(1996, 6, 1, 0, 0, 0, 0, time.UTC), "Flavortown"},
+		{time.Date(1998, 1, 1, 0, 0, 0, 0, time.UTC), "Mars"},
+	} {
+		insured, err := db.GetInsuredByBitemporalDate(ctx, 1, tt.date, tt.date)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if got, want := len(*insured.Employees), 2; got != want {
+			tb.Fatalf("%v: len(Employees)=%v, want %v", tt.date, got, want)
+		} else if got, want := len(*insured.Addresses), 1; got != want {
+			tb.Fatalf("%v: len(Addresses)=%v, want %v", tt.date, got, want)
+		}
+		for _, address := range *insured.Addresses {
+			if address.Address != tt.address {
+				tb.Fatalf("%v: Address=%v, want %v", tt.date, address.Address, tt.address)
+			}
+		}
+	}
+
+	// history includes archived versions
+	if records, err := db.GetAllByEntityId(ctx, &entity.Employee{}, 2); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(records), 3; got != want {
+		tb.Fatalf("len(history)=%v, want %v", got, want)
+	}
+
+	// purging removes archived versions too
+	if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	if records, err := db.GetAllByEntityId(ctx, &entity.Employee{}, 2); err != nil {
+		tb.Fatal(err)
+	} else if got := len(records); got != 0 {
+		tb.Fatalf("len(history)=%v after purge, want 0", got)
+	}
+}
+
+// Without an archive path there is nowhere to archive to
+func TestDB_Archive_NoArchive(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	if _, err := db.Archive(context.Background(), time.Date(1997, 1, 1, 0, 0, 0, 0, time.UTC)); err != sqlite.ErrNoArchive {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrNoArchive)
+	}
+}
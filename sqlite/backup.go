@@ -0,0 +1,96 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup copies the database to a new file at path with SQLite's online backup API.
+// The copy is consistent as of its start, and the database stays in use: with WAL, writes do not wait for it.
+// The file is replaced only when the copy is complete.
+func (db *DB) Backup(ctx context.Context, path string) error {
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := backupTo(ctx, db.SQL, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func backupTo(ctx context.Context, src *sql.DB, path string) error {
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+	if err := copyDB(ctx, dest, src); err != nil {
+		return err
+	}
+	// one self-contained file, without -wal
+	_, err = dest.ExecContext(ctx, `PRAGMA journal_mode = delete`)
+	return err
+}
+
+// Restore replaces the contents of the database with the backup at path, with the online backup API.
+// The backup is checked first. Run it with the server stopped, then Open to apply newer migrations.
+func (db *DB) Restore(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var result string
+	if err := src.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	} else if result != "ok" {
+		return fmt.Errorf("backup %s failed integrity check: %s", path, result)
+	}
+	return copyDB(ctx, db.SQL, src)
+}
+
+// copyDB copies every page of src's main database to dest's, in one step
+func copyDB(ctx context.Context, dest *sql.DB, src *sql.DB) error {
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			d, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("backup: destination is not a sqlite3 connection")
+			}
+			s, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("backup: source is not a sqlite3 connection")
+			}
+			backup, err := d.Backup("main", s, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
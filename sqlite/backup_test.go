@@ -0,0 +1,63 @@
+package sqlite_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/sqlite"
+)
+
+// A backup is a complete database file, taken while the database is open
+func TestDB_Backup(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	path := filepath.Join(tb.TempDir(), "backup.db")
+	if err := db.Backup(ctx, path); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := os.Stat(path + "-wal"); !os.IsNotExist(err) {
+		tb.Fatalf("wal err=%v, want not exist: the backup is one file", err)
+	}
+
+	backup := sqlite.NewDB(path)
+	if err := backup.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	defer MustCloseDB(tb, backup)
+	if records, err := backup.GetAll(ctx, &entity.Insured{}); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(records), 2; got != want {
+		tb.Fatalf("len=%v, want %v", got, want)
+	}
+}
+
+// Restore puts the database back as it was at the backup
+func TestDB_Restore(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	path := filepath.Join(tb.TempDir(), "backup.db")
+	if err := db.Backup(ctx, path); err != nil {
+		tb.Fatal(err)
+	}
+	if err := db.PurgeById(ctx, &entity.Insured{}, 2); err != nil {
+		tb.Fatal(err)
+	}
+
+	if err := db.Restore(ctx, path); err != nil {
+		tb.Fatal(err)
+	}
+	if insured, err := db.GetById(ctx, &entity.Insured{}, 2); err != nil {
+		tb.Fatal(err)
+	} else if got, want := insured.(*entity.Insured).Name, "John Smith"; got != want {
+		tb.Fatalf("Name=%v, want %v", got, want)
+	}
+
+	if err := db.Restore(ctx, filepath.Join(tb.TempDir(), "none.db")); !os.IsNotExist(err) {
+		tb.Fatalf("err=%v, want not exist", err)
+	}
+}
@@ -0,0 +1,122 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/sqlite"
+)
+
+var benchInsureds = flag.Int("bench.insureds", 100000, "insureds in the benchmark database")
+
+const (
+	benchEmployees = 3  // employees per insured
+	benchVersions  = 10 // records per employee, and addresses per insured
+	benchStart     = 946684800
+	benchInterval  = 30 * 24 * 60 * 60 // between versions
+)
+
+// MustOpenBenchDB returns a database of n insureds with deep histories: each has benchEmployees employees
+// and an address with benchVersions records, and each employee benchVersions records, a benchInterval apart.
+// Rows are written with SQL, as going through the service would take too long. Fatal on error.
+func MustOpenBenchDB(tb testing.TB, n int) *sqlite.DB {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "bench.db")
+	db := sqlite.NewDB(path)
+	if err := db.Open(); err != nil {
+		tb.Fatal(err)
+	}
+
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer raw.Close()
+	for _, query := range []string{
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?1)
+		INSERT INTO insured (id, name, policy_number, record_timestamp)
+		SELECT i, 'Insured ' || i, 1000 + i, ?3 FROM n`,
+
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?1 * ?2)
+		INSERT INTO employees (id, insured_id)
+		SELECT i, (i - 1) / ?2 + 1 FROM n`,
+
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?1 * ?2),
+		v(k) AS (SELECT 0 UNION ALL SELECT k + 1 FROM v WHERE k < ?5 - 1)
+		INSERT INTO employees_records (employee_id, name, start_date, end_date, record_timestamp, valid_from)
+		SELECT i, 'Employee ' || i || ' v' || k, '2000-01-01', '0001-01-01', ?3 + k * ?4, ?3 + k * ?4 FROM n, v`,
+
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?1)
+		INSERT INTO insured_addresses (id, insured_id, type)
+		SELECT i, i, 'mailing' FROM n`,
+
+		`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?1),
+		v(k) AS (SELECT 0 UNION ALL SELECT k + 1 FROM v WHERE k < ?5 - 1)
+		INSERT INTO insured_addresses_records (address_id, address, insured_id, record_timestamp, valid_from)
+		SELECT i, k || ' Main Street', i, ?3 + k * ?4, ?3 + k * ?4 FROM n, v`,
+	} {
+		if _, err := raw.Exec(query, n, benchEmployees, benchStart, benchInterval, benchVersions); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return db
+}
+
+// Temporal reads of one insured, among many with deep histories
+func BenchmarkDB_Temporal(b *testing.B) {
+	n := *benchInsureds
+	db := MustOpenBenchDB(b, n)
+	defer MustCloseDB(b, db)
+	ctx := context.Background()
+	now := time.Now()
+	middle := time.Unix(benchStart+benchVersions/2*benchInterval, 0)
+	insuredId := func(i int) int64 { return int64(i*7919%n + 1) }
+
+	b.Run("GetInsuredByDate/now", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetInsuredByBitemporalDate(ctx, insuredId(i), now, now); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("GetInsuredByDate/past", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetInsuredByBitemporalDate(ctx, insuredId(i), middle, middle); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("GetEmployeeByBitemporalDate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetEmployeeByBitemporalDate(ctx, entity.Employee{}, insuredId(i)*benchEmployees, middle, now); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("GetAllByEntityId", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetAllByEntityId(ctx, &entity.Employee{}, insuredId(i)*benchEmployees); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("GetTimeline", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := db.GetTimeline(ctx, insuredId(i), entity.TimelineFilter{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("GetPendingChanges", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetPendingChanges(ctx, insuredId(i), middle); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
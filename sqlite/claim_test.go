@@ -0,0 +1,102 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/sqlite"
+)
+
+// Each change to a claim is a record, so its history is its status history.
+func TestClaimService_Claims(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	s := sqlite.NewInsuredService(db)
+
+	date := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02", value)
+		return t
+	}
+	reported, investigated, paid := date("2000-01-02"), date("2000-02-01"), date("2000-03-01")
+
+	claim := &entity.Claim{InsuredId: 1, LossDate: date("2000-01-01"), Description: "Fire", RecordTimestamp: reported}
+	if _, err := s.CreateClaim(ctx, claim); err != nil {
+		tb.Fatal(err)
+	}
+	if got, want := claim.Status, entity.ClaimOpen; got != want {
+		tb.Fatalf("Status=%v, want %v", got, want)
+	}
+	if _, err := s.CreateClaim(ctx, &entity.Claim{InsuredId: 1, LossDate: date("2000-01-01"), RecordTimestamp: reported}); entity.ErrorCode(err) != entity.EINVALID {
+		tb.Fatalf("err=%v, want %v", err, entity.EINVALID)
+	}
+
+	// no change
+	same := *claim
+	same.RecordTimestamp = investigated
+	if _, err := s.UpdateClaim(ctx, &same); err != sqlite.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrUpdateMustChangeAValue)
+	}
+	for _, change := range []struct {
+		status string
+		at     time.Time
+	}{
+		{entity.ClaimInvestigating, investigated},
+		{entity.ClaimPaid, paid},
+	} {
+		update := *claim
+		update.Status, update.RecordTimestamp = change.status, change.at
+		if _, err := s.UpdateClaim(ctx, &update); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if _, err := s.UpdateClaim(ctx, &entity.Claim{ID: 9, Description: "Flood", Status: entity.ClaimOpen, RecordTimestamp: paid}); err != sqlite.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordDoesNotExist)
+	}
+
+	for _, tt := range []struct {
+		asOf time.Time
+		want []string
+	}{
+		{reported.Add(-time.Second), []string{}},
+		{reported, []string{entity.ClaimOpen}},
+		{investigated, []string{entity.ClaimInvestigating}},
+		{paid, []string{entity.ClaimPaid}},
+	} {
+		records, err := db.GetByBitemporalDate(ctx, &entity.Claim{}, 1, tt.asOf, tt.asOf)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		got := []string{}
+		for _, record := range records {
+			got = append(got, record.(*entity.Claim).Status)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			tb.Fatalf("%v: statuses mismatch (-want +got):\n%s", tt.asOf, diff)
+		}
+	}
+
+	history, err := db.GetAllByEntityId(ctx, &entity.Claim{}, int64(claim.ID))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	got := []string{}
+	for i := 0; i < len(history); i++ {
+		got = append(got, history[i].(*entity.Claim).Status)
+	}
+	if diff := cmp.Diff([]string{entity.ClaimOpen, entity.ClaimInvestigating, entity.ClaimPaid}, got); diff != "" {
+		tb.Fatalf("history mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := db.PurgeById(ctx, &entity.Claim{}, int64(claim.ID)); err != nil {
+		tb.Fatal(err)
+	}
+	if history, err := db.GetAllByEntityId(ctx, &entity.Claim{}, int64(claim.ID)); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(history), 0; got != want {
+		tb.Fatalf("len(history)=%v, want %v", got, want)
+	}
+}
@@ -0,0 +1,17 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreateClaim creates a claim against the insured with its first record. See sqlstore.DB.CreateClaim.
+func (s *InsuredService) CreateClaim(ctx context.Context, claim *entity.Claim) (record entity.Record, err error) {
+	return s.Db.CreateClaim(ctx, claim)
+}
+
+// UpdateClaim adds a record to the claim with claim.ID, unless nothing changed. See sqlstore.DB.UpdateClaim.
+func (s *InsuredService) UpdateClaim(ctx context.Context, claim *entity.Claim) (record entity.Record, err error) {
+	return s.Db.UpdateClaim(ctx, claim)
+}
@@ -12,6 +12,8 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/seed"
+	"github.com/nickcoast/timetravel/service"
 	"github.com/nickcoast/timetravel/sqlite"
 )
 
@@ -19,12 +21,12 @@ var dump = flag.Bool("dump", true, "save work data")
 
 // Ensure the test database can open & close.
 func TestDB(t *testing.T) {
-	db := MustOpenDB(t)
+	db := MustOpenDB(t, "demo")
 	MustCloseDB(t, db)
 }
 
-// MustOpenDB returns a new, open DB. Fatal on error.
-func MustOpenDB(tb testing.TB) *sqlite.DB {
+// MustOpenDB returns a new, open DB with the fixture set named, e.g. "demo". None if empty. Fatal on error.
+func MustOpenDB(tb testing.TB, fixtures string) *sqlite.DB {
 	tb.Helper()
 
 	// Write to an in-memory database by default.
@@ -44,9 +46,25 @@ func MustOpenDB(tb testing.TB) *sqlite.DB {
 	if err := db.Open(); err != nil {
 		tb.Fatal(err)
 	}
+	if fixtures != "" {
+		MustSeed(tb, db, fixtures)
+	}
 	return db
 }
 
+// MustSeed adds the fixture set named, e.g. "demo", through the service. Fatal on error.
+func MustSeed(tb testing.TB, db service.Store, name string) {
+	tb.Helper()
+	set, err := seed.Load(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s := service.NewSqliteRecordService(db)
+	if err := s.Seed(context.Background(), set); err != nil {
+		tb.Fatal(err)
+	}
+}
+
 // MustCloseDB closes the DB. Fatal on error.
 func MustCloseDB(tb testing.TB, db *sqlite.DB) {
 	tb.Helper()
@@ -55,11 +73,40 @@ func MustCloseDB(tb testing.TB, db *sqlite.DB) {
 	}
 }
 
+// Every migration can be rolled back and applied again, with data in the tables
+func TestDB_Migrate(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	if _, err := db.DeleteById(ctx, &entity.Insured{}, 2); err != nil {
+		tb.Fatal(err)
+	}
+	migrator, err := db.Migrator()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for version := 10; version >= 0; version-- {
+		if err := migrator.To(version); err != nil {
+			tb.Fatalf("to %v: %v", version, err)
+		}
+	}
+	if err := migrator.Up(); err != nil {
+		tb.Fatal(err)
+	}
+	MustSeed(tb, db, "demo") // removed with the tables, so added again
+	records, err := db.GetAll(ctx, &entity.Insured{})
+	if err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(records), 2; got != want {
+		tb.Fatalf("len=%v, want %v", got, want)
+	}
+}
+
 func TestDB_GetResourceById(tb *testing.T) {
 	ctx := context.Background()
 	past, err := time.Parse("2006-01-02 15:04:05", "2006-01-02 15:04:05")
 	pastTimestamp := past
-	db := MustOpenDB(tb)
+	db := MustOpenDB(tb, "demo")
 	defer MustCloseDB(tb, db)
 	// Ensure Resource can be gotten by ID
 	tb.Run("TestDB_GetResourceById_Insured", func(tb *testing.T) { // TODO: add employees, addresses tests
@@ -100,7 +147,7 @@ func TestDB_GetResourceById(tb *testing.T) {
 
 	})
 	tb.Run("TestDB_GetResourceById_Insured", func(tb *testing.T) {
-		/* db := MustOpenDB(tb)
+		/* db := MustOpenDB(tb, "demo")
 		defer MustCloseDB(tb, db) */
 		eStartDate, err := time.Parse("2006-01-02", "2006-01-02")
 		eEndDate2, err := time.Parse("2006-01-02", "2007-07-04")
@@ -123,7 +170,7 @@ func TestDB_GetResourceById(tb *testing.T) {
 func TestDB_GetResourceByDate(tb *testing.T) {
 	// Ensure Resource can be gotten by ID
 	tb.Run("TestDB_GetResourceByDate_Insured", func(tb *testing.T) { // TODO: add employees, addresses tests
-		db := MustOpenDB(tb)
+		db := MustOpenDB(tb, "demo")
 		defer MustCloseDB(tb, db)
 		//s := sqlite.NewInsuredService(db)
 
@@ -174,3 +221,366 @@ func TestDB_GetResourceByDate(tb *testing.T) {
 		} */
 	})
 }
+
+func TestDB_GetByBitemporalDate(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	// Learned today that insured 1 was at a different address from 1990 on
+	validFrom, _ := time.Parse("2006-01-02", "1990-01-01")
+	now := time.Now().UTC().Truncate(time.Second)
+	MustCreateAddress(tb, ctx, db, &entity.Address{AddressId: 1, Address: "742 Evergreen Terrace", InsuredId: 1, RecordTimestamp: now, ValidFrom: validFrom})
+
+	asOfValid, _ := time.Parse("2006-01-02", "1995-01-01")
+	known, _ := time.Parse("2006-01-02", "2000-01-01")
+
+	tb.Run("KnownBeforeCorrection", func(tb *testing.T) {
+		records, err := db.GetByBitemporalDate(ctx, &entity.Address{}, 1, asOfValid, known)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		addresses, _ := entity.AddressesFromInsuredInterface(records)
+		if got, want := len(addresses), 1; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		} else if got, want := addresses[0].Address, "123 REAL St, Springfield, Oregon"; got != want {
+			tb.Fatalf("Address=%v, want %v", got, want)
+		}
+	})
+	tb.Run("KnownAfterCorrection", func(tb *testing.T) {
+		records, err := db.GetByBitemporalDate(ctx, &entity.Address{}, 1, asOfValid, now)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		addresses, _ := entity.AddressesFromInsuredInterface(records)
+		if got, want := addresses[0].Address, "742 Evergreen Ter"; got != want {
+			tb.Fatalf("Address=%v, want %v", got, want)
+		} else if got, want := addresses[0].ValidFrom.Unix(), validFrom.Unix(); got != want {
+			tb.Fatalf("ValidFrom=%v, want %v", got, want)
+		}
+	})
+	tb.Run("LaterChangeStillWins", func(tb *testing.T) { // "Mars" became valid in 1997, after the corrected valid_from
+		insured, err := db.GetInsuredByBitemporalDate(ctx, 1, now, now)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if got, want := (*insured.Addresses)[0].Address, "Mars"; got != want {
+			tb.Fatalf("Address=%v, want %v", got, want)
+		} else if got, want := len(*insured.Employees), 2; got != want {
+			tb.Fatalf("len(Employees)=%v, want %v", got, want)
+		}
+	})
+}
+
+func TestDB_DeleteById(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	deletedAt, _ := time.Parse("2006-01-02", "2010-01-01")
+	db.Now = func() time.Time { return deletedAt }
+	before, _ := time.Parse("2006-01-02", "2009-01-01")
+	after, _ := time.Parse("2006-01-02", "2011-01-01")
+
+	if _, err := db.DeleteById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+
+	tb.Run("BeforeDeletion", func(tb *testing.T) {
+		insured, err := db.GetInsuredByDate(ctx, 1, before)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if got, want := len(*insured.Employees), 2; got != want {
+			tb.Fatalf("len(Employees)=%v, want %v", got, want)
+		} else if got, want := (*insured.Addresses)[0].Address, "Mars"; got != want {
+			tb.Fatalf("Address=%v, want %v", got, want)
+		}
+	})
+	tb.Run("AfterDeletion", func(tb *testing.T) {
+		if _, err := db.GetInsuredByDate(ctx, 1, after); err != sqlite.ErrRecordDoesNotExist {
+			tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordDoesNotExist)
+		}
+		if _, err := db.GetById(ctx, &entity.Insured{}, 1); err != sqlite.ErrRecordDoesNotExist {
+			tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordDoesNotExist)
+		}
+		// employees are deleted with the insured
+		records, err := db.GetByDate(ctx, &entity.Employee{}, "", 1, after)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := len(records), 0; got != want {
+			tb.Fatalf("len(Employees)=%v, want %v", got, want)
+		}
+	})
+	tb.Run("Purge", func(tb *testing.T) {
+		if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := db.GetInsuredByDate(ctx, 1, before); err != sqlite.ErrRecordDoesNotExist {
+			tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordDoesNotExist)
+		}
+		if err := db.PurgeById(ctx, &entity.Insured{}, 1); err != sqlite.ErrRecordDoesNotExist {
+			tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordDoesNotExist)
+		}
+	})
+}
+
+func TestDB_RestoreById(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	deletedAt, _ := time.Parse("2006-01-02", "2010-01-01")
+	db.Now = func() time.Time { return deletedAt }
+	before, _ := time.Parse("2006-01-02", "2009-01-01")
+	if _, err := db.DeleteById(ctx, &entity.Insured{}, 1); err != nil {
+		tb.Fatal(err)
+	}
+	restoredAt, _ := time.Parse("2006-01-02", "2011-01-01")
+	db.Now = func() time.Time { return restoredAt }
+
+	tb.Run("EmployeeOfDeletedInsured", func(tb *testing.T) {
+		if _, err := db.RestoreById(ctx, &entity.Employee{}, 2, before); err != sqlite.ErrInsuredDeleted {
+			tb.Fatalf("err=%v, want %v", err, sqlite.ErrInsuredDeleted)
+		}
+	})
+	tb.Run("Insured", func(tb *testing.T) {
+		restored, err := db.RestoreById(ctx, &entity.Insured{}, 1, before)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		insured := restored.(*entity.Insured)
+		if got, want := len(*insured.Employees), 2; got != want {
+			tb.Fatalf("len(Employees)=%v, want %v", got, want)
+		} else if got, want := (*insured.Addresses)[0].Address, "Mars"; got != want {
+			tb.Fatalf("Address=%v, want %v", got, want)
+		}
+		if _, err := db.GetById(ctx, &entity.Insured{}, 1); err != nil {
+			tb.Fatal(err)
+		}
+		// still deleted between deletion and restore
+		between, _ := time.Parse("2006-01-02", "2010-06-01")
+		if _, err := db.GetInsuredByDate(ctx, 1, between); err != sqlite.ErrRecordDoesNotExist {
+			tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordDoesNotExist)
+		}
+	})
+	tb.Run("NothingToRestore", func(tb *testing.T) {
+		if _, err := db.RestoreById(ctx, &entity.Insured{}, 1, before); err != sqlite.ErrUpdateMustChangeAValue {
+			tb.Fatalf("err=%v, want %v", err, sqlite.ErrUpdateMustChangeAValue)
+		}
+		tooEarly, _ := time.Parse("2006-01-02", "1980-01-01")
+		if _, err := db.RestoreById(ctx, &entity.Employee{}, 2, tooEarly); err != sqlite.ErrRecordMatchingCriteriaDoesNotExist {
+			tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordMatchingCriteriaDoesNotExist)
+		}
+	})
+}
+
+// Cancelling a scheduled change, by hand or by deleting, adds a cancellation. Records already written do not change.
+func TestDB_CancelPendingChange(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	recorded, _ := time.Parse("2006-01-02", "2005-01-01")
+	validFrom, _ := time.Parse("2006-01-02", "2006-01-01")
+	cancelledAt, _ := time.Parse("2006-01-02", "2005-06-01")
+	later, _ := time.Parse("2006-01-02", "2007-01-01")
+	scheduled, _ := MustCreateAddress(tb, ctx, db, &entity.Address{AddressId: 1, Address: "742 Evergreen Terrace", InsuredId: 1, RecordTimestamp: recorded, ValidFrom: validFrom})
+	second, _ := MustCreateAddress(tb, ctx, db, &entity.Address{AddressId: 1, Address: "1 Main St", InsuredId: 1, RecordTimestamp: recorded, ValidFrom: later})
+
+	records := func() (rows string) {
+		tb.Helper()
+		err := db.SQL.QueryRowContext(ctx, `
+			SELECT group_concat(id || '|' || address || '|' || record_timestamp || '|' || valid_from || '|' || IFNULL(valid_to, '') || '|' || tombstone, ';')
+			FROM (SELECT * FROM insured_addresses_records WHERE id <= ? ORDER BY id)
+		`, second.ID).Scan(&rows)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return rows
+	}
+	before := records()
+
+	if _, err := db.CancelPendingChange(ctx, &entity.Address{}, int64(scheduled.ID), cancelledAt); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := db.CancelPendingChange(ctx, &entity.Address{}, int64(scheduled.ID), cancelledAt); err != sqlite.ErrRecordNotPending {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordNotPending)
+	}
+
+	for _, tt := range []struct {
+		asOfRecorded time.Time
+		want         string
+	}{
+		{recorded, "742 Evergreen Ter"}, // known before the cancellation
+		{cancelledAt, "Mars"},
+	} {
+		insured, err := db.GetInsuredByBitemporalDate(ctx, 1, validFrom, tt.asOfRecorded)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if got := (*insured.Addresses)[0].Address; got != tt.want {
+			tb.Fatalf("%v: Address=%v, want %v", tt.asOfRecorded, got, tt.want)
+		}
+	}
+
+	db.Now = func() time.Time { return cancelledAt }
+	if _, err := db.DeleteById(ctx, &entity.Address{}, int64(second.ID)); err != nil {
+		tb.Fatal(err)
+	}
+	if got := records(); got != before {
+		tb.Fatalf("records changed:\n%v\nwant\n%v", got, before)
+	}
+	var count int
+	if err := db.SQL.QueryRowContext(ctx, `SELECT COUNT(*) FROM insured_addresses_records_cancellations`).Scan(&count); err != nil {
+		tb.Fatal(err)
+	} else if got, want := count, 2; got != want {
+		tb.Fatalf("cancellations=%v, want %v", got, want)
+	}
+}
+
+func TestDB_GetSnapshot(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	asOf, _ := time.Parse("2006-01-02", "2001-01-01")
+
+	tb.Run("SameAsGetInsuredByDate", func(tb *testing.T) {
+		insureds, total, err := db.GetSnapshot(ctx, asOf, entity.InsuredFilter{})
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := total, 2; got != want {
+			tb.Fatalf("total=%v, want %v", got, want)
+		}
+		for _, insured := range insureds {
+			expected, err := db.GetInsuredByDate(ctx, int64(insured.ID), asOf)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			if got, want := len(*insured.Employees), len(*expected.Employees); got != want {
+				tb.Fatalf("insured %v: len(Employees)=%v, want %v", insured.ID, got, want)
+			} else if got, want := len(*insured.Addresses), len(*expected.Addresses); got != want {
+				tb.Fatalf("insured %v: len(Addresses)=%v, want %v", insured.ID, got, want)
+			}
+		}
+	})
+	tb.Run("BeforeCreation", func(tb *testing.T) {
+		before, _ := time.Parse("2006-01-02", "1997-02-01")
+		insureds, total, err := db.GetSnapshot(ctx, before, entity.InsuredFilter{})
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := total, 1; got != want {
+			tb.Fatalf("total=%v, want %v", got, want)
+		} else if got, want := (*insureds[0].Addresses)[0].Address, "Mars"; got != want {
+			tb.Fatalf("Address=%v, want %v", got, want)
+		}
+	})
+	tb.Run("LimitOffset", func(tb *testing.T) {
+		insureds, total, err := db.GetSnapshot(ctx, asOf, entity.InsuredFilter{Limit: 1, Offset: 1})
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := total, 2; got != want {
+			tb.Fatalf("total=%v, want %v", got, want)
+		} else if got, want := len(insureds), 1; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		} else if got, want := insureds[0].Name, "John Smith"; got != want {
+			tb.Fatalf("Name=%v, want %v", got, want)
+		}
+	})
+	tb.Run("OffsetPastEnd", func(tb *testing.T) {
+		insureds, total, err := db.GetSnapshot(ctx, asOf, entity.InsuredFilter{Limit: 1, Offset: 5})
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := total, 2; got != want {
+			tb.Fatalf("total=%v, want %v", got, want)
+		} else if got, want := len(insureds), 0; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		}
+	})
+	tb.Run("Filter", func(tb *testing.T) {
+		policyNumber := 1000
+		insureds, _, err := db.GetSnapshot(ctx, asOf, entity.InsuredFilter{PolicyNumber: &policyNumber})
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := len(insureds), 1; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		} else if got, want := insureds[0].Name, "Jimmy Temelpa"; got != want {
+			tb.Fatalf("Name=%v, want %v", got, want)
+		}
+	})
+	tb.Run("EmployeesAndAddresses", func(tb *testing.T) {
+		// an insured with several employees and addresses has each of them once
+		MustCreateAddress(tb, ctx, db, &entity.Address{Type: entity.AddressMailing, Address: "1 Main St", InsuredId: 2, RecordTimestamp: asOf, ValidFrom: asOf})
+		MustCreateAddress(tb, ctx, db, &entity.Address{Type: entity.AddressBilling, Address: "2 Main St", InsuredId: 2, RecordTimestamp: asOf, ValidFrom: asOf})
+		insureds, _, err := db.GetSnapshot(ctx, asOf, entity.InsuredFilter{})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for _, insured := range insureds {
+			expected, err := db.GetInsuredByDate(ctx, int64(insured.ID), asOf)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			if got, want := len(*insured.Employees), len(*expected.Employees); got != want {
+				tb.Fatalf("insured %v: len(Employees)=%v, want %v", insured.ID, got, want)
+			} else if got, want := len(*insured.Addresses), len(*expected.Addresses); got != want {
+				tb.Fatalf("insured %v: len(Addresses)=%v, want %v", insured.ID, got, want)
+			}
+			if insured.ID == 2 {
+				if got := len(*insured.Employees); got < 2 {
+					tb.Fatalf("len(Employees)=%v, want several", got)
+				} else if got, want := len(*insured.Addresses), 2; got != want {
+					tb.Fatalf("len(Addresses)=%v, want %v", got, want)
+				}
+			}
+			for _, employee := range *insured.Employees {
+				for _, want := range *expected.Employees {
+					if want.ID == employee.ID && (!employee.StartDate.Equal(want.StartDate) || employee.Name != want.Name) {
+						tb.Fatalf("employee %v: %v, want %v", employee.ID, employee, want)
+					}
+				}
+			}
+		}
+	})
+}
+
+func TestDB_GetTimeline(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	// two changes recorded at the same time, after every fixture
+	tied, _ := time.Parse("2006-01-02", "2030-01-01")
+	first, _ := MustCreateAddress(tb, ctx, db, &entity.Address{AddressId: 1, Address: "1 Main St", InsuredId: 1, RecordTimestamp: tied, ValidFrom: tied})
+	second, _ := MustCreateAddress(tb, ctx, db, &entity.Address{AddressId: 1, Address: "2 Main St", InsuredId: 1, RecordTimestamp: tied, ValidFrom: tied})
+
+	all, n, err := db.GetTimeline(ctx, 1, entity.TimelineFilter{})
+	if err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(all), n; got != want {
+		tb.Fatalf("len=%v, want %v", got, want)
+	} else if got, want := all[len(all)-2].RecordId, first.ID; got != want {
+		tb.Fatalf("RecordId=%v, want %v", got, want)
+	}
+
+	// descending, events recorded at the same time keep their order, one page at a time
+	for offset, recordId := range []int{first.ID, second.ID} {
+		events, total, err := db.GetTimeline(ctx, 1, entity.TimelineFilter{Descending: true, Limit: 1, Offset: offset})
+		if err != nil {
+			tb.Fatal(err)
+		} else if got := total; got != n {
+			tb.Fatalf("total=%v, want %v", got, n)
+		} else if got, want := len(events), 1; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		} else if got := events[0].RecordId; got != recordId {
+			tb.Fatalf("offset %v: RecordId=%v, want %v", offset, got, recordId)
+		} else if got, want := events[0].Type, entity.EventAddressUpdated; got != want {
+			tb.Fatalf("Type=%v, want %v", got, want)
+		}
+	}
+	if events, _, err := db.GetTimeline(ctx, 1, entity.TimelineFilter{Descending: true, Offset: 2}); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(events), n-2; got != want {
+		tb.Fatalf("len=%v, want %v", got, want)
+	}
+}
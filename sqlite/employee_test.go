@@ -21,7 +21,7 @@ import (
 func TestInsuredService_CreateEmployee(t *testing.T) {
 	// Ensure employee can be created.
 	t.Run("OK", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 		ctx := context.Background()
@@ -90,7 +90,7 @@ func TestInsuredService_CreateEmployee(t *testing.T) {
 
 	// Ensure an error is returned if employee name is not set.
 	t.Run("ErrNameRequired", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 		if _, err := s.CreateEmployee(context.Background(), &entity.Employee{}); err == nil {
@@ -106,7 +106,7 @@ func TestInsuredService_CreateEmployee(t *testing.T) {
 /* func TestEmployeeService_UpdateEmployee(t *testing.T) {
 	// Ensure employee name & email can be updated by current user.
 	t.Run("OK", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewEmployeeService(db)
 		user0, ctx0 := MustCreateEmployee(t, context.Background(), db, &entity.Employee{
@@ -141,7 +141,7 @@ func TestInsuredService_CreateEmployee(t *testing.T) {
 /* func TestEmployeeService_DeleteEmployee(t *testing.T) {
 	// Ensure employee can delete self.
 	t.Run("OK", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewEmployeeService(db)
 		employee0, ctx0 := MustCreateEmployee(t, context.Background(), db, &entity.Employee{Name: "Johnny Rotten", PolicyNumber: 333, RecordTimestamp: time.Now().UTC(), ID: 666})
@@ -156,7 +156,7 @@ func TestInsuredService_CreateEmployee(t *testing.T) {
 
 	// Ensure an error is returned if deleting a non-existent employee.
 	t.Run("ErrNotFound", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewEmployeeService(db)
 		if err := s.DeleteEmployee(context.Background(), 777); entity.ErrorCode(err) != entity.ENOTFOUND {
@@ -168,7 +168,7 @@ func TestInsuredService_CreateEmployee(t *testing.T) {
 func TestInsuredService_FindEmployee(t *testing.T) {
 	// Ensure an error is returned if fetching a non-existent employee.
 	t.Run("ErrNotFound", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		//s := sqlite.NewInsuredService(db)
 		if _, err := db.GetById(context.Background(), &entity.Employee{}, 999); err == nil {
@@ -181,7 +181,7 @@ func TestInsuredService_FindEmployee(t *testing.T) {
 func TestInsuredService_FindEmployees(t *testing.T) {
 	// Ensure employees can be fetched by email address.
 	/* 	t.Run("PolicyNumber", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 
@@ -206,7 +206,7 @@ func TestInsuredService_FindEmployees(t *testing.T) {
 
 func TestInsuredService_CountEmployees(t *testing.T) {
 	ctx := context.Background()
-	db := MustOpenDB(t)
+	db := MustOpenDB(t, "demo")
 	defer MustCloseDB(t, db)
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
@@ -256,6 +256,92 @@ func TestInsuredService_CountEmployees(t *testing.T) {
 	})
 }
 
+// Job class code, payroll, and work location have a history like the rest of the employee's record
+func TestInsuredService_EmployeeRating(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	s := sqlite.NewInsuredService(db)
+
+	date := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02", value)
+		return t
+	}
+	hired, raised, reclassed := date("2000-01-01"), date("2001-01-01"), date("2002-01-01")
+
+	employee := &entity.Employee{
+		Name:            "Estimator",
+		StartDate:       hired,
+		InsuredId:       1,
+		JobClassCode:    "8810",
+		AnnualPayroll:   5200000,
+		WorkLocation:    "Springfield",
+		RecordTimestamp: hired,
+	}
+	if _, err := s.CreateEmployee(ctx, employee); err != nil {
+		tb.Fatal(err)
+	}
+	invalid := *employee
+	invalid.ID, invalid.Name, invalid.JobClassCode = 0, "Someone else", "88"
+	if _, err := s.CreateEmployee(ctx, &invalid); entity.ErrorCode(err) != entity.EINVALID {
+		tb.Fatalf("err=%v, want %v", err, entity.EINVALID)
+	}
+
+	// no change
+	same := *employee
+	same.RecordTimestamp = raised
+	if _, err := s.UpdateEmployee(ctx, &same); err != sqlite.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrUpdateMustChangeAValue)
+	}
+	raise := *employee
+	raise.AnnualPayroll, raise.RecordTimestamp = 6000000, raised
+	if _, err := s.UpdateEmployee(ctx, &raise); err != nil {
+		tb.Fatal(err)
+	}
+	reclass := raise
+	reclass.JobClassCode, reclass.WorkLocation, reclass.RecordTimestamp = "8742", "Eugene", reclassed
+	if _, err := s.UpdateEmployee(ctx, &reclass); err != nil {
+		tb.Fatal(err)
+	}
+
+	type rating struct {
+		JobClassCode  string
+		AnnualPayroll int64
+		WorkLocation  string
+	}
+	ratingOf := func(e *entity.Employee) rating {
+		return rating{e.JobClassCode, e.AnnualPayroll, e.WorkLocation}
+	}
+	want := []rating{{"8810", 5200000, "Springfield"}, {"8810", 6000000, "Springfield"}, {"8742", 6000000, "Eugene"}}
+	for i, asOf := range []time.Time{hired, raised, reclassed} {
+		records, err := db.GetByBitemporalDate(ctx, &entity.Employee{}, 1, asOf, asOf)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		got := rating{}
+		for _, record := range records {
+			if e := record.(*entity.Employee); e.ID == employee.ID {
+				got = ratingOf(e)
+			}
+		}
+		if diff := cmp.Diff(want[i], got); diff != "" {
+			tb.Fatalf("%v: rating mismatch (-want +got):\n%s", asOf, diff)
+		}
+	}
+
+	history, err := db.GetAllByEntityId(ctx, &entity.Employee{}, int64(employee.ID))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	got := []rating{}
+	for i := 0; i < len(history); i++ {
+		got = append(got, ratingOf(history[i].(*entity.Employee)))
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		tb.Fatalf("history mismatch (-want +got):\n%s", diff)
+	}
+}
+
 // MustCreateEmployee creates a employee in the database. Fatal on error.
 func MustCreateEmployee(tb testing.TB, ctx context.Context, db *sqlite.DB, employee *entity.Employee) (*entity.Employee, context.Context) {
 	tb.Helper()
@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nickcoast/timetravel/sqlstore"
+)
+
+// QueryPlans returns SQLite's plan for each of sqlstore.TemporalQueries, by name, one step per line.
+// A step "SCAN t3" reads the whole table; "SEARCH t3 USING INDEX ..." does not.
+func (db *DB) QueryPlans(ctx context.Context) (map[string][]string, error) {
+	plans := make(map[string][]string)
+	for name, q := range sqlstore.TemporalQueries(db.Now()) {
+		query, args := q.Build()
+		rows, err := db.SQL.QueryContext(ctx, `EXPLAIN QUERY PLAN `+query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("explain %s: %w", name, err)
+		}
+		for rows.Next() {
+			var id, parent, notUsed int
+			var detail string
+			if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			plans[name] = append(plans[name], detail)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return plans, nil
+}
+
+// TableScans returns the steps of the plans that scan a whole table, as "name: step", sorted.
+// Scans of subqueries and common table expressions, which are already narrowed, are not included.
+func TableScans(plans map[string][]string) []string {
+	var scans []string
+	for name, steps := range plans {
+		for _, step := range steps {
+			if !strings.HasPrefix(step, "SCAN ") || strings.HasPrefix(step, "SCAN (") || strings.HasPrefix(step, "SCAN CONSTANT ROW") {
+				continue
+			}
+			if alias := strings.Fields(step)[1]; alias == "page" || alias == "sub" || strings.HasSuffix(alias, "_at") {
+				continue
+			}
+			scans = append(scans, name+": "+step)
+		}
+	}
+	sort.Strings(scans)
+	return scans
+}
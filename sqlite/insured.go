@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/sqlstore"
 )
 
 // InsuredService represents a service for managing insureds.
@@ -82,26 +83,15 @@ func (s *InsuredService) FindInsureds(ctx context.Context, filter entity.Insured
 	return findInsureds(ctx, tx, filter)
 }
 
-// CreateInsured creates a new insured.
+// CreateInsured creates a new insured. See sqlstore.DB.CreateInsured.
 // Used by CreateRecord inside conditional
 func (s *InsuredService) CreateInsured(ctx context.Context, insured *entity.Insured) (record entity.Record, err error) {
-	tx, err := s.Db.BeginTx(ctx, nil)
-	if err != nil {
-		return record, err
-	}
-	defer tx.Rollback()
-
-	// Create a new insured object
-	record, err = createInsured(ctx, tx, insured)
-	if err != nil {
-		return record, err
-	}
-	return record, tx.Commit()
+	return s.Db.CreateInsured(ctx, insured)
 }
 
 // findInsureds returns a list of insureds matching a filter. Also returns a count of
 // total matching insureds which may differ if filter.Limit is set.
-func findInsureds(ctx context.Context, tx *Tx, filter entity.InsuredFilter) (_ []*entity.Insured, n int, err error) {
+func findInsureds(ctx context.Context, tx *sqlstore.Tx, filter entity.InsuredFilter) (_ []*entity.Insured, n int, err error) {
 	// Build WHERE clause.
 	where, args := []string{"1 = 1"}, []interface{}{}
 	// TODO: can we consolidate this?
@@ -133,7 +123,7 @@ func findInsureds(ctx context.Context, tx *Tx, filter entity.InsuredFilter) (_ [
 		FROM insured
 		WHERE `+strings.Join(where, " AND ")+`
 		ORDER BY id ASC
-		`+FormatLimitOffset(filter.Limit, filter.Offset),
+		`+sqlstore.FormatLimitOffset(filter.Limit, filter.Offset),
 		args...,
 	)
 	if err != nil {
@@ -150,7 +140,7 @@ func findInsureds(ctx context.Context, tx *Tx, filter entity.InsuredFilter) (_ [
 			&insured.ID,
 			&insured.Name,
 			&insured.PolicyNumber,
-			(*NullTime)(&insured.RecordTimestamp), // TODO: check this
+			(*sqlstore.NullTime)(&insured.RecordTimestamp), // TODO: check this
 			&n,
 		); err != nil {
 			return nil, 0, err
@@ -168,58 +158,3 @@ func findInsureds(ctx context.Context, tx *Tx, filter entity.InsuredFilter) (_ [
 
 	return insureds, n, nil
 }
-
-// creates a new insured. Sets the new record ID to insured.ID and retrieves new policyNumber
-func createInsured(ctx context.Context, tx *Tx, insured *entity.Insured) (newRecord entity.Record, err error) {
-	// Perform basic field validation.
-	if err := insured.Validate(); err != nil {
-		return newRecord, err
-	}
-	policyNumber, err := getMaxPolicyNumber(ctx, tx)
-	policyNumber++ // safe if table is locked in transaction. else need trigger in DB
-	if err != nil {
-		return newRecord, FormatError(err)
-	}
-	insured.PolicyNumber = policyNumber
-	result, err := tx.ExecContext(ctx, `
-		INSERT INTO insured (
-			name,
-			policy_number,			
-			record_timestamp		
-		)
-		VALUES (?, ?, ?)
-	`,
-		insured.Name,
-		policyNumber,
-		insured.RecordTimestamp.Unix(), // can use a Scan method here if necessary
-	)
-	if err != nil {
-		return newRecord, FormatError(err)
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return newRecord, err
-	}
-	// TODO: try to set newRecord using DB.GetById
-	insured.ID = int(id)
-	newRecord = insured.ToRecord()
-
-	return newRecord, nil
-}
-
-// private helper to help insert policy numbers in order
-func getMaxPolicyNumber(ctx context.Context, tx *Tx) (max int, err error) {
-	// coalesce ensures '1000' is returned if no data exists in table
-	tx.QueryRowContext(ctx, `
-		SELECT coalesce(MAX(policy_number), 1000) AS max_policy_number 		
-		FROM insured		
-		ORDER BY id ASC`,
-	).Scan(&max)
-
-	if max == 0 {
-		return 0, fmt.Errorf("Failed to retrieve max policy number")
-	}
-	return max, nil
-
-}
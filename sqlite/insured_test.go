@@ -17,7 +17,7 @@ import (
 func TestInsuredService_CreateInsured(t *testing.T) {
 	// Ensure insured can be created.
 	t.Run("OK", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 
@@ -76,7 +76,7 @@ func TestInsuredService_CreateInsured(t *testing.T) {
 
 	// Ensure an error is returned if insured name is not set.
 	t.Run("ErrNameRequired", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 		if _, err := s.CreateInsured(context.Background(), &entity.Insured{}); err == nil {
@@ -91,7 +91,7 @@ func TestInsuredService_CreateInsured(t *testing.T) {
 /* func TestInsuredService_UpdateInsured(t *testing.T) {
 	// Ensure insured name & email can be updated by current user.
 	t.Run("OK", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 		user0, ctx0 := MustCreateInsured(t, context.Background(), db, &entity.Insured{
@@ -126,7 +126,7 @@ func TestInsuredService_CreateInsured(t *testing.T) {
 /* func TestInsuredService_DeleteInsured(t *testing.T) {
 	// Ensure insured can delete self.
 	t.Run("OK", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 		insured0, ctx0 := MustCreateInsured(t, context.Background(), db, &entity.Insured{Name: "Johnny Rotten", PolicyNumber: 333, RecordTimestamp: time.Now().UTC(), ID: 666})
@@ -141,7 +141,7 @@ func TestInsuredService_CreateInsured(t *testing.T) {
 
 	// Ensure an error is returned if deleting a non-existent insured.
 	t.Run("ErrNotFound", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 		if err := s.DeleteInsured(context.Background(), 777); entity.ErrorCode(err) != entity.ENOTFOUND {
@@ -153,7 +153,7 @@ func TestInsuredService_CreateInsured(t *testing.T) {
 func TestInsuredService_FindInsured(t *testing.T) {
 	// Ensure an error is returned if fetching a non-existent insured.
 	t.Run("ErrNotFound", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 		if _, err := s.Db.GetById(context.Background(), &entity.Insured{}, 1111); err == nil { // TODO: entity.ErrorCode(err) != entity.ENOTFOUND
@@ -165,7 +165,7 @@ func TestInsuredService_FindInsured(t *testing.T) {
 func TestInsuredService_FindInsureds(t *testing.T) {
 	// Ensure insureds can be fetched by email address.
 	t.Run("PolicyNumber", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 
@@ -320,7 +320,7 @@ func MustCreateInsured(tb testing.TB, ctx context.Context, db *sqlite.DB, insure
 /* func TestInsuredService_GetMaxPolicyNumber(t *testing.T) {
 	// Ensure insureds can be fetched by email address.
 	t.Run("MaxPolicyNumber", func(t *testing.T) {
-		db := MustOpenDB(t)
+		db := MustOpenDB(t, "demo")
 		defer MustCloseDB(t, db)
 		s := sqlite.NewInsuredService(db)
 
@@ -348,7 +348,7 @@ func MustCreateInsured(tb testing.TB, ctx context.Context, db *sqlite.DB, insure
 func TestInsuredService_GetInsuredByDate(tb *testing.T) {
 	// Ensure Resource can be gotten by ID
 	tb.Run("TestInsuredService_GetInsuredByDate", func(tb *testing.T) { // TODO: add employees, addresses tests
-		db := MustOpenDB(tb)
+		db := MustOpenDB(tb, "demo")
 		defer MustCloseDB(tb, db)
 		//s := sqlite.NewInsuredService(db)
 
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "insured_addresses_records";
+DROP TABLE IF EXISTS "employees_records";
+DROP TABLE IF EXISTS "employees";
+DROP TABLE IF EXISTS "insured";
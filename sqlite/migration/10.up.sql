@@ -0,0 +1,25 @@
+/* Claims against an insured. Each change to a claim, e.g. of its status, is a record in claims_records,
+   so the records are the claim's status history. Loss dates are "2006-01-02". */
+CREATE TABLE IF NOT EXISTS "claims" (
+	"id"	INTEGER NOT NULL,
+	"insured_id"	INTEGER NOT NULL,
+	FOREIGN KEY("insured_id") REFERENCES "insured" ("id") ON DELETE CASCADE ON UPDATE CASCADE,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+CREATE INDEX IF NOT EXISTS "claims_insured_id" ON "claims" ("insured_id");
+
+CREATE TABLE IF NOT EXISTS "claims_records" (
+	"id"	INTEGER NOT NULL, /* *record* id */
+	"claim_id"	INTEGER NOT NULL,
+	"loss_date"	TEXT NOT NULL,
+	"description"	TEXT NOT NULL,
+	"status"	TEXT NOT NULL DEFAULT 'open' CHECK ("status" IN ('open', 'investigating', 'paid', 'denied', 'closed')),
+	"record_timestamp"	INTEGER NOT NULL,
+	"valid_from" INTEGER NOT NULL DEFAULT 0,
+	"valid_to" INTEGER, /* NULL until superseded */
+	"cancelled_timestamp" INTEGER,
+	"tombstone" INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	FOREIGN KEY("claim_id") REFERENCES "claims"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "claims_records_claim_id_valid_from" ON "claims_records" ("claim_id", "valid_from", "record_timestamp");
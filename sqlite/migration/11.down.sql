@@ -0,0 +1,3 @@
+ALTER TABLE "employees_records" DROP COLUMN "work_location";
+ALTER TABLE "employees_records" DROP COLUMN "annual_payroll";
+ALTER TABLE "employees_records" DROP COLUMN "job_class_code";
@@ -0,0 +1,5 @@
+/* Employee attributes for workers' comp rating, with the same history as the rest of the employee's record:
+   job class code (e.g. "8810"), annual payroll in cents, and work location. Existing records have none. */
+ALTER TABLE "employees_records" ADD COLUMN "job_class_code" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "employees_records" ADD COLUMN "annual_payroll" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "employees_records" ADD COLUMN "work_location" TEXT NOT NULL DEFAULT '';
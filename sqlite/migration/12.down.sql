@@ -0,0 +1,21 @@
+ALTER TABLE "claims_records" ADD COLUMN "cancelled_timestamp" INTEGER;
+ALTER TABLE "policies_records" ADD COLUMN "cancelled_timestamp" INTEGER;
+ALTER TABLE "insured_addresses_records" ADD COLUMN "cancelled_timestamp" INTEGER;
+ALTER TABLE "employees_records" ADD COLUMN "cancelled_timestamp" INTEGER;
+
+UPDATE "policies_records" SET "cancelled_timestamp" = (
+	SELECT MIN(c."record_timestamp") FROM "policies_records_cancellations" c WHERE c."record_id" = "policies_records"."id"
+);
+UPDATE "insured_addresses_records" SET "cancelled_timestamp" = (
+	SELECT MIN(c."record_timestamp") FROM "insured_addresses_records_cancellations" c WHERE c."record_id" = "insured_addresses_records"."id"
+);
+UPDATE "employees_records" SET "cancelled_timestamp" = (
+	SELECT MIN(c."record_timestamp") FROM "employees_records_cancellations" c WHERE c."record_id" = "employees_records"."id"
+);
+
+DROP INDEX IF EXISTS "policies_records_cancellations_record_id";
+DROP TABLE IF EXISTS "policies_records_cancellations";
+DROP INDEX IF EXISTS "insured_addresses_records_cancellations_record_id";
+DROP TABLE IF EXISTS "insured_addresses_records_cancellations";
+DROP INDEX IF EXISTS "employees_records_cancellations_record_id";
+DROP TABLE IF EXISTS "employees_records_cancellations";
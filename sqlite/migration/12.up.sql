@@ -0,0 +1,38 @@
+/* Cancellations of scheduled (future-dated) records are rows of their own, so records are never changed once written.
+   A record is cancelled as of the earliest record_timestamp of its cancellations.
+   No foreign keys: records may be moved to the archive database, and their cancellations stay. */
+CREATE TABLE IF NOT EXISTS "employees_records_cancellations" (
+	"id"	INTEGER NOT NULL,
+	"record_id"	INTEGER NOT NULL, /* employees_records id */
+	"record_timestamp"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+CREATE INDEX IF NOT EXISTS "employees_records_cancellations_record_id" ON "employees_records_cancellations" ("record_id", "record_timestamp");
+
+CREATE TABLE IF NOT EXISTS "insured_addresses_records_cancellations" (
+	"id"	INTEGER NOT NULL,
+	"record_id"	INTEGER NOT NULL, /* insured_addresses_records id */
+	"record_timestamp"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+CREATE INDEX IF NOT EXISTS "insured_addresses_records_cancellations_record_id" ON "insured_addresses_records_cancellations" ("record_id", "record_timestamp");
+
+CREATE TABLE IF NOT EXISTS "policies_records_cancellations" (
+	"id"	INTEGER NOT NULL,
+	"record_id"	INTEGER NOT NULL, /* policies_records id */
+	"record_timestamp"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+CREATE INDEX IF NOT EXISTS "policies_records_cancellations_record_id" ON "policies_records_cancellations" ("record_id", "record_timestamp");
+
+INSERT INTO "employees_records_cancellations" ("record_id", "record_timestamp")
+SELECT "id", "cancelled_timestamp" FROM "employees_records" WHERE "cancelled_timestamp" IS NOT NULL;
+INSERT INTO "insured_addresses_records_cancellations" ("record_id", "record_timestamp")
+SELECT "id", "cancelled_timestamp" FROM "insured_addresses_records" WHERE "cancelled_timestamp" IS NOT NULL;
+INSERT INTO "policies_records_cancellations" ("record_id", "record_timestamp")
+SELECT "id", "cancelled_timestamp" FROM "policies_records" WHERE "cancelled_timestamp" IS NOT NULL;
+
+ALTER TABLE "employees_records" DROP COLUMN "cancelled_timestamp";
+ALTER TABLE "insured_addresses_records" DROP COLUMN "cancelled_timestamp";
+ALTER TABLE "policies_records" DROP COLUMN "cancelled_timestamp";
+ALTER TABLE "claims_records" DROP COLUMN "cancelled_timestamp"; /* claims are not cancelled */
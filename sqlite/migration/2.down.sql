@@ -0,0 +1,5 @@
+ALTER TABLE "employees_records" DROP COLUMN "valid_to";
+ALTER TABLE "employees_records" DROP COLUMN "valid_from";
+
+ALTER TABLE "insured_addresses_records" DROP COLUMN "valid_to";
+ALTER TABLE "insured_addresses_records" DROP COLUMN "valid_from";
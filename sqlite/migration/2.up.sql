@@ -0,0 +1,9 @@
+/* Valid time for time-travelable records. record_timestamp is when the system learned of a record
+   (transaction time). valid_from/valid_to is when the record is true in the real world (valid time). */
+ALTER TABLE "employees_records" ADD COLUMN "valid_from" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "employees_records" ADD COLUMN "valid_to" INTEGER; /* NULL until superseded */
+UPDATE "employees_records" SET "valid_from" = "record_timestamp";
+
+ALTER TABLE "insured_addresses_records" ADD COLUMN "valid_from" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "insured_addresses_records" ADD COLUMN "valid_to" INTEGER; /* NULL until superseded */
+UPDATE "insured_addresses_records" SET "valid_from" = "record_timestamp";
@@ -0,0 +1,2 @@
+ALTER TABLE employees_records DROP COLUMN "cancelled_timestamp";
+ALTER TABLE insured_addresses_records DROP COLUMN "cancelled_timestamp";
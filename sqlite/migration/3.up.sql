@@ -0,0 +1,2 @@
+ALTER TABLE employees_records ADD COLUMN "cancelled_timestamp" INTEGER;
+ALTER TABLE insured_addresses_records ADD COLUMN "cancelled_timestamp" INTEGER;
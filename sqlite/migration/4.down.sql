@@ -0,0 +1,26 @@
+/* Removes soft delete. Tombstones are deleted: the entities they deleted are no longer deleted. */
+DROP TABLE "insured_tombstones";
+
+DELETE FROM "insured_addresses_records" WHERE "tombstone" = 1;
+ALTER TABLE "insured_addresses_records" DROP COLUMN "tombstone";
+
+/* Rebuild employees_records with UNIQUE("employee_id","record_timestamp") again */
+DELETE FROM "employees_records" WHERE "tombstone" = 1;
+CREATE TABLE "employees_records_old" (
+	"id"	INTEGER NOT NULL UNIQUE, /* *record* id */
+	"employee_id" INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"start_date"	TEXT NOT NULL,
+	"end_date"	TEXT NOT NULL DEFAULT '0001-01-01', /* Cannot be null and have UNIQUE constraint */
+	"record_timestamp"	INTEGER NOT NULL,
+	"valid_from" INTEGER NOT NULL DEFAULT 0,
+	"valid_to" INTEGER, /* NULL until superseded */
+	"cancelled_timestamp" INTEGER,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	UNIQUE("employee_id","record_timestamp"),
+	FOREIGN KEY("employee_id") REFERENCES "employees"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+INSERT INTO "employees_records_old" ("id", "employee_id", "name", "start_date", "end_date", "record_timestamp", "valid_from", "valid_to", "cancelled_timestamp")
+SELECT "id", "employee_id", "name", "start_date", "end_date", "record_timestamp", "valid_from", "valid_to", "cancelled_timestamp" FROM "employees_records";
+DROP TABLE "employees_records";
+ALTER TABLE "employees_records_old" RENAME TO "employees_records";
@@ -0,0 +1,34 @@
+/* Soft delete. Deleting writes a tombstone with its own record_timestamp instead of removing history,
+   so the entity can still be seen as of any time before the deletion. */
+
+/* Rebuild employees_records without UNIQUE("employee_id","record_timestamp"):
+   a tombstone may be recorded in the same second as the change before it. */
+CREATE TABLE "employees_records_new" (
+	"id"	INTEGER NOT NULL UNIQUE, /* *record* id */
+	"employee_id" INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"start_date"	TEXT NOT NULL,
+	"end_date"	TEXT NOT NULL DEFAULT '0001-01-01', /* Cannot be null and have UNIQUE constraint */
+	"record_timestamp"	INTEGER NOT NULL,
+	"valid_from" INTEGER NOT NULL DEFAULT 0,
+	"valid_to" INTEGER, /* NULL until superseded */
+	"cancelled_timestamp" INTEGER,
+	"tombstone" INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	FOREIGN KEY("employee_id") REFERENCES "employees"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+INSERT INTO "employees_records_new" ("id", "employee_id", "name", "start_date", "end_date", "record_timestamp", "valid_from", "valid_to", "cancelled_timestamp")
+SELECT "id", "employee_id", "name", "start_date", "end_date", "record_timestamp", "valid_from", "valid_to", "cancelled_timestamp" FROM "employees_records";
+DROP TABLE "employees_records";
+ALTER TABLE "employees_records_new" RENAME TO "employees_records";
+
+ALTER TABLE "insured_addresses_records" ADD COLUMN "tombstone" INTEGER NOT NULL DEFAULT 0;
+
+/* insured has no records table */
+CREATE TABLE IF NOT EXISTS "insured_tombstones" (
+	"id"	INTEGER NOT NULL,
+	"insured_id"	INTEGER NOT NULL,
+	"record_timestamp"	INTEGER NOT NULL,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	FOREIGN KEY("insured_id") REFERENCES "insured"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
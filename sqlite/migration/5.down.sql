@@ -0,0 +1,3 @@
+/* Removes restore. Insureds deleted and restored since are deleted again. */
+DELETE FROM "insured_tombstones" WHERE "restore" = 1;
+ALTER TABLE "insured_tombstones" DROP COLUMN "restore";
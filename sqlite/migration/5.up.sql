@@ -0,0 +1,3 @@
+/* Restore. A restore row undoes the insured's tombstones before it.
+   The insured is deleted if its latest row is a tombstone (restore = 0). */
+ALTER TABLE "insured_tombstones" ADD COLUMN "restore" INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "insured_tombstones_insured_id";
+DROP INDEX IF EXISTS "insured_addresses_records_insured_id_valid_from";
+DROP INDEX IF EXISTS "insured_addresses_records_insured_id_record_timestamp";
+DROP INDEX IF EXISTS "employees_records_employee_id_valid_from";
+DROP INDEX IF EXISTS "employees_insured_id";
@@ -0,0 +1,8 @@
+/* Indexes for temporal reads. Records are found by their entity, then by valid time and record time:
+   as-of reads filter and order on valid_from and record_timestamp, timelines on record_timestamp.
+   Employee timelines and history find records by employee_id, which the valid_from index serves. */
+CREATE INDEX IF NOT EXISTS "employees_insured_id" ON "employees" ("insured_id");
+CREATE INDEX IF NOT EXISTS "employees_records_employee_id_valid_from" ON "employees_records" ("employee_id", "valid_from", "record_timestamp");
+CREATE INDEX IF NOT EXISTS "insured_addresses_records_insured_id_record_timestamp" ON "insured_addresses_records" ("insured_id", "record_timestamp");
+CREATE INDEX IF NOT EXISTS "insured_addresses_records_insured_id_valid_from" ON "insured_addresses_records" ("insured_id", "valid_from", "record_timestamp");
+CREATE INDEX IF NOT EXISTS "insured_tombstones_insured_id" ON "insured_tombstones" ("insured_id");
@@ -0,0 +1,21 @@
+/* Addresses. An insured has any number of addresses, each with a type (mailing, billing, or location)
+   and a history of its own in insured_addresses_records.
+   Existing records become the history of one mailing address per insured. */
+CREATE TABLE IF NOT EXISTS "insured_addresses" (
+	"id"	INTEGER NOT NULL,
+	"insured_id"	INTEGER NOT NULL,
+	"type"	TEXT NOT NULL DEFAULT 'mailing',
+	FOREIGN KEY("insured_id") REFERENCES "insured" ("id") ON DELETE CASCADE ON UPDATE CASCADE,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+CREATE INDEX IF NOT EXISTS "insured_addresses_insured_id" ON "insured_addresses" ("insured_id");
+
+INSERT INTO "insured_addresses" ("insured_id", "type")
+SELECT DISTINCT "insured_id", 'mailing' FROM "insured_addresses_records" ORDER BY "insured_id";
+
+/* No foreign key, so the column can be dropped again. Records are deleted with their insured. */
+ALTER TABLE "insured_addresses_records" ADD COLUMN "address_id" INTEGER;
+UPDATE "insured_addresses_records" SET "address_id" = (
+	SELECT a."id" FROM "insured_addresses" a WHERE a."insured_id" = "insured_addresses_records"."insured_id"
+);
+CREATE INDEX IF NOT EXISTS "insured_addresses_records_address_id_valid_from" ON "insured_addresses_records" ("address_id", "valid_from", "record_timestamp");
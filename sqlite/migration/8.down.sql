@@ -0,0 +1,6 @@
+ALTER TABLE "insured_addresses_records" DROP COLUMN "country";
+ALTER TABLE "insured_addresses_records" DROP COLUMN "postal_code";
+ALTER TABLE "insured_addresses_records" DROP COLUMN "region";
+ALTER TABLE "insured_addresses_records" DROP COLUMN "city";
+ALTER TABLE "insured_addresses_records" DROP COLUMN "line2";
+ALTER TABLE "insured_addresses_records" DROP COLUMN "line1";
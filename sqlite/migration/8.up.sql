@@ -0,0 +1,29 @@
+/* Structured addresses. "address" stays as the fields on one line.
+   Existing addresses are split on commas, best-effort: "line1, city, region" with a trailing US ZIP code
+   moved from the region to postal_code. One part is line1, two are line1 and city, and any more after
+   the third part stay in the region. Country is left empty, so postal codes are not validated. */
+ALTER TABLE "insured_addresses_records" ADD COLUMN "line1" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "insured_addresses_records" ADD COLUMN "line2" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "insured_addresses_records" ADD COLUMN "city" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "insured_addresses_records" ADD COLUMN "region" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "insured_addresses_records" ADD COLUMN "postal_code" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "insured_addresses_records" ADD COLUMN "country" TEXT NOT NULL DEFAULT '';
+
+/* line1, and the rest in city */
+UPDATE "insured_addresses_records" SET
+	"line1" = CASE WHEN instr("address", ',') = 0 THEN trim("address") ELSE trim(substr("address", 1, instr("address", ',') - 1)) END,
+	"city" = CASE WHEN instr("address", ',') = 0 THEN '' ELSE trim(substr("address", instr("address", ',') + 1)) END;
+/* city, and the rest in region */
+UPDATE "insured_addresses_records" SET
+	"city" = trim(substr("city", 1, instr("city", ',') - 1)),
+	"region" = trim(substr("city", instr("city", ',') + 1))
+WHERE instr("city", ',') > 0;
+/* ZIP codes */
+UPDATE "insured_addresses_records" SET
+	"region" = trim(substr("region", 1, length("region") - 5)),
+	"postal_code" = substr("region", -5)
+WHERE "region" GLOB '* [0-9][0-9][0-9][0-9][0-9]';
+UPDATE "insured_addresses_records" SET
+	"region" = trim(substr("region", 1, length("region") - 10)),
+	"postal_code" = substr("region", -10)
+WHERE "region" GLOB '* [0-9][0-9][0-9][0-9][0-9]-[0-9][0-9][0-9][0-9]';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "policies_records_policy_id_valid_from";
+DROP TABLE IF EXISTS "policies_records";
+DROP INDEX IF EXISTS "policies_insured_id";
+DROP TABLE IF EXISTS "policies";
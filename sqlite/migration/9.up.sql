@@ -0,0 +1,30 @@
+/* Policies. An insured has any number of policies, each with a policy number that stays the same when it is renewed.
+   Each term, and each change to a term, is a record in policies_records. Dates are "2006-01-02", amounts in cents.
+   The first policy of an insured may use the insured's policy number. */
+CREATE TABLE IF NOT EXISTS "policies" (
+	"id"	INTEGER NOT NULL,
+	"insured_id"	INTEGER NOT NULL,
+	"policy_number"	INTEGER NOT NULL UNIQUE,
+	FOREIGN KEY("insured_id") REFERENCES "insured" ("id") ON DELETE CASCADE ON UPDATE CASCADE,
+	PRIMARY KEY("id" AUTOINCREMENT)
+);
+CREATE INDEX IF NOT EXISTS "policies_insured_id" ON "policies" ("insured_id");
+
+CREATE TABLE IF NOT EXISTS "policies_records" (
+	"id"	INTEGER NOT NULL, /* *record* id */
+	"policy_id"	INTEGER NOT NULL,
+	"term"	INTEGER NOT NULL DEFAULT 1,
+	"effective_date"	TEXT NOT NULL,
+	"expiration_date"	TEXT NOT NULL,
+	"occurrence_limit"	INTEGER NOT NULL,
+	"aggregate_limit"	INTEGER NOT NULL,
+	"premium"	INTEGER NOT NULL,
+	"record_timestamp"	INTEGER NOT NULL,
+	"valid_from" INTEGER NOT NULL DEFAULT 0,
+	"valid_to" INTEGER, /* NULL until superseded */
+	"cancelled_timestamp" INTEGER,
+	"tombstone" INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY("id" AUTOINCREMENT),
+	FOREIGN KEY("policy_id") REFERENCES "policies"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "policies_records_policy_id_valid_from" ON "policies_records" ("policy_id", "valid_from", "record_timestamp");
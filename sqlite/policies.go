@@ -0,0 +1,17 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreatePolicy creates a policy of the insured with its first record. See sqlstore.DB.CreatePolicy.
+func (s *InsuredService) CreatePolicy(ctx context.Context, policy *entity.Policy) (record entity.Record, err error) {
+	return s.Db.CreatePolicy(ctx, policy)
+}
+
+// UpdatePolicy adds a record to the policy with policy.ID, unless its terms did not change. See sqlstore.DB.UpdatePolicy.
+func (s *InsuredService) UpdatePolicy(ctx context.Context, policy *entity.Policy) (record entity.Record, err error) {
+	return s.Db.UpdatePolicy(ctx, policy)
+}
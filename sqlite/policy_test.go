@@ -0,0 +1,135 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/sqlite"
+)
+
+// A policy's terms, endorsements, and renewals are records of the policy. getbydate returns the policies in force.
+func TestPolicyService_Policies(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+	s := sqlite.NewInsuredService(db)
+
+	date := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02", value)
+		return t
+	}
+	created, endorsed, renewed, deleted := date("2000-01-01"), date("2000-07-01"), date("2000-12-01"), date("2001-06-01")
+
+	policy := &entity.Policy{
+		InsuredId:       1,
+		EffectiveDate:   created,
+		ExpirationDate:  date("2001-01-01"),
+		OccurrenceLimit: 100000000,
+		AggregateLimit:  200000000,
+		Premium:         125000,
+		RecordTimestamp: created,
+	}
+	if _, err := s.CreatePolicy(ctx, policy); err != nil {
+		tb.Fatal(err)
+	}
+	insured, err := db.GetInsuredById(ctx, entity.Insured{}, 1)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if got, want := policy.PolicyNumber, insured.PolicyNumber; got != want {
+		tb.Fatalf("PolicyNumber=%v, want %v", got, want)
+	}
+	// the insured's policy number is taken
+	second := &entity.Policy{InsuredId: 1, EffectiveDate: created, ExpirationDate: date("2001-01-01"), OccurrenceLimit: 100, AggregateLimit: 100, RecordTimestamp: created}
+	if _, err := s.CreatePolicy(ctx, second); err != nil {
+		tb.Fatal(err)
+	} else if second.PolicyNumber <= policy.PolicyNumber {
+		tb.Fatalf("PolicyNumber=%v, want more than %v", second.PolicyNumber, policy.PolicyNumber)
+	}
+
+	// no change
+	same := *policy
+	same.RecordTimestamp = endorsed
+	if _, err := s.UpdatePolicy(ctx, &same); err != sqlite.ErrUpdateMustChangeAValue {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrUpdateMustChangeAValue)
+	}
+	endorsement := *policy
+	endorsement.Premium, endorsement.RecordTimestamp = 150000, endorsed
+	if _, err := s.UpdatePolicy(ctx, &endorsement); err != nil {
+		tb.Fatal(err)
+	}
+	renewal := endorsement.Renew()
+	renewal.RecordTimestamp, renewal.ValidFrom = renewed, renewal.EffectiveDate
+	if _, err := s.UpdatePolicy(ctx, &renewal); err != nil {
+		tb.Fatal(err)
+	}
+	if got, want := renewal.ExpirationDate, date("2002-01-01"); !got.Equal(want) {
+		tb.Fatalf("ExpirationDate=%v, want %v", got, want)
+	}
+
+	type term struct {
+		Term    int
+		Premium int64
+	}
+	for _, tt := range []struct {
+		asOf time.Time
+		want []term
+	}{
+		{created.Add(-time.Second), []term{}},
+		{date("2000-03-01"), []term{{1, 125000}}},
+		{date("2000-08-01"), []term{{1, 150000}}},
+		{date("2001-03-01"), []term{{2, 150000}}},
+		{date("2002-03-01"), []term{}},
+	} {
+		records, err := db.GetByBitemporalDate(ctx, &entity.Policy{}, 1, tt.asOf, tt.asOf)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		got := []term{}
+		for _, record := range records {
+			if p := record.(*entity.Policy); p.ID == policy.ID {
+				got = append(got, term{p.Term, p.Premium})
+			}
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			tb.Fatalf("%v: policies mismatch (-want +got):\n%s", tt.asOf, diff)
+		}
+	}
+
+	history, err := db.GetAllByEntityId(ctx, &entity.Policy{}, int64(policy.ID))
+	if err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(history), 3; got != want {
+		tb.Fatalf("len(history)=%v, want %v", got, want)
+	}
+
+	db.Now = func() time.Time { return deleted }
+	if _, err := db.DeleteById(ctx, &entity.Policy{}, int64(policy.ID)); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := s.UpdatePolicy(ctx, &endorsement); err != sqlite.ErrRecordDoesNotExist {
+		tb.Fatalf("err=%v, want %v", err, sqlite.ErrRecordDoesNotExist)
+	}
+	if records, err := db.GetByBitemporalDate(ctx, &entity.Policy{}, 1, deleted, deleted); err != nil {
+		tb.Fatal(err)
+	} else if _, ok := records[policy.ID]; ok {
+		tb.Fatalf("deleted policy %v in force", policy.ID)
+	}
+	if history, err := db.GetAllByEntityId(ctx, &entity.Policy{}, int64(policy.ID)); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(history), 3; got != want {
+		tb.Fatalf("len(history)=%v, want %v", got, want)
+	}
+
+	if err := db.PurgeById(ctx, &entity.Policy{}, int64(policy.ID)); err != nil {
+		tb.Fatal(err)
+	}
+	if history, err := db.GetAllByEntityId(ctx, &entity.Policy{}, int64(policy.ID)); err != nil {
+		tb.Fatal(err)
+	} else if got, want := len(history), 0; got != want {
+		tb.Fatalf("len(history)=%v, want %v", got, want)
+	}
+}
@@ -0,0 +1,202 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/sqlite"
+)
+
+// Temporal reads give the same results for the "demo" fixture set
+func TestQuery_Fixtures(tb *testing.T) {
+	db := MustOpenDB(tb, "demo")
+	defer MustCloseDB(tb, db)
+	ctx := context.Background()
+
+	tb.Run("GetAll", func(tb *testing.T) {
+		for _, tt := range []struct {
+			obj  entity.InsuredInterface
+			want int
+		}{
+			{&entity.Insured{}, 2},
+			{&entity.Employee{}, 5},
+			{&entity.Address{}, 4},
+		} {
+			records, err := db.GetAll(ctx, tt.obj)
+			if err != nil {
+				tb.Fatal(err)
+			} else if got := len(records); got != tt.want {
+				tb.Fatalf("%T: len=%v, want %v", tt.obj, got, tt.want)
+			}
+		}
+	})
+	tb.Run("GetAllByEntityId", func(tb *testing.T) {
+		records, err := db.GetAllByEntityId(ctx, &entity.Employee{}, 2)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := len(records), 3; got != want {
+			tb.Fatalf("len=%v, want %v", got, want)
+		}
+	})
+	tb.Run("GetById", func(tb *testing.T) {
+		address, err := db.GetAddressById(ctx, entity.Address{}, 3)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := address.InsuredId, 1; got != want {
+			tb.Fatalf("InsuredId=%v, want %v", got, want)
+		}
+		address, err = db.GetAddressById(ctx, entity.Address{}, 99)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := address.ID, 0; got != want {
+			tb.Fatalf("ID=%v, want %v", got, want)
+		}
+		insured, err := db.GetInsuredById(ctx, entity.Insured{}, 2)
+		if err != nil {
+			tb.Fatal(err)
+		} else if got, want := insured.PolicyNumber, 1001; got != want {
+			tb.Fatalf("PolicyNumber=%v, want %v", got, want)
+		}
+	})
+	tb.Run("GetByDate", func(tb *testing.T) {
+		for _, tt := range []struct {
+			timestamp int64
+			employees []string
+			address   string
+		}{
+			{468072000, []string{"1984-10-01 0001-01-01"}, "123 Fake St, Springfield, Oregon"},
+			{469368000, []string{"1984-10-01 0001-01-01", "1984-11-10 0001-01-01"}, "123 Fake St, Springfield, Oregon"},
+			{469368001, []string{"1984-10-01 0001-01-01", "1984-11-10 0001-01-01"}, "123 REAL St, Springfield, Oregon"},
+			{820584000, []string{"1984-10-01 0001-01-01", "1984-11-10 1996-01-02"}, ""},
+			{852206400, []string{"1984-10-01 0001-01-01", "1984-11-10 1996-06-01"}, ""},
+			{852206401, []string{"1984-10-01 0001-01-01", "1984-11-10 1996-06-01"}, "Mars"},
+		} {
+			date := time.Unix(tt.timestamp, 0)
+			records, err := db.GetByDate(ctx, &entity.Employee{}, "", 1, date)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			var employees []string
+			for _, record := range records {
+				employee := record.(*entity.Employee)
+				employees = append(employees, employee.StartDate.Format("2006-01-02")+" "+employee.EndDate.Format("2006-01-02"))
+			}
+			sort.Strings(employees)
+			if got, want := len(employees), len(tt.employees); got != want {
+				tb.Fatalf("%v: len(Employees)=%v, want %v", tt.timestamp, got, want)
+			}
+			for i := range employees {
+				if employees[i] != tt.employees[i] {
+					tb.Fatalf("%v: Employees=%v, want %v", tt.timestamp, employees, tt.employees)
+				}
+			}
+			if tt.address == "" {
+				continue
+			}
+			records, err = db.GetByDate(ctx, &entity.Address{}, "", 1, date)
+			if err != nil {
+				tb.Fatal(err)
+			} else if got, want := len(records), 1; got != want {
+				tb.Fatalf("%v: len(Addresses)=%v, want %v", tt.timestamp, got, want)
+			} else if got := records[0].(*entity.Address).Address; got != tt.address {
+				tb.Fatalf("%v: Address=%v, want %v", tt.timestamp, got, tt.address)
+			}
+		}
+	})
+	tb.Run("CountInsuredRecordsAtDate", func(tb *testing.T) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		defer tx.Rollback()
+		for _, tt := range []struct {
+			obj       entity.InsuredInterface
+			insuredId int64
+			timestamp int64
+			want      int
+		}{
+			{&entity.Employee{}, 1, 468072000, 1},
+			{&entity.Employee{}, 1, 852206401, 2},
+			{&entity.Employee{}, 2, 954590400, 3},
+			{&entity.Address{}, 1, 852206401, 1},
+			{&entity.Address{}, 2, 954590400, 0},
+		} {
+			count, err := db.CountInsuredRecordsAtDate(ctx, tx.Tx, tt.obj, tt.insuredId, time.Unix(tt.timestamp, 0))
+			if err != nil {
+				tb.Fatal(err)
+			} else if count != tt.want {
+				tb.Fatalf("%T %v at %v: count=%v, want %v", tt.obj, tt.insuredId, tt.timestamp, count, tt.want)
+			}
+		}
+	})
+	tb.Run("BoundParameters", func(tb *testing.T) {
+		name := "Jimmy' OR '1' = '1"
+		insureds, total, err := db.GetSnapshot(ctx, time.Now(), entity.InsuredFilter{Name: &name})
+		if err != nil {
+			tb.Fatal(err)
+		} else if len(insureds) != 0 || total != 0 {
+			tb.Fatalf("len=%v total=%v, want 0", len(insureds), total)
+		}
+	})
+}
+
+// Temporal queries find their rows with indexes. Without the indexes, they scan tables.
+func TestQuery_Plans(tb *testing.T) {
+	path := filepath.Join(tb.TempDir(), "plans.db")
+	db := sqlite.NewDB(path)
+	if err := db.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	defer MustCloseDB(tb, db)
+	MustSeed(tb, db, "demo")
+	ctx := context.Background()
+
+	plans, err := db.QueryPlans(ctx)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if scans := sqlite.TableScans(plans); len(scans) > 0 {
+		tb.Fatalf("full table scans:\n%s", strings.Join(scans, "\n"))
+	}
+
+	// drop every index the migrations created
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer raw.Close()
+	rows, err := raw.Query(`SELECT name FROM sqlite_master WHERE type = 'index' AND sql IS NOT NULL`)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var indexes []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			tb.Fatal(err)
+		}
+		indexes = append(indexes, name)
+	}
+	rows.Close()
+	for _, name := range indexes {
+		if _, err := raw.Exec(`DROP INDEX "` + name + `"`); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	unindexed := sqlite.NewDB(path) // new connections, which read the new schema
+	if err := unindexed.Connect(); err != nil {
+		tb.Fatal(err)
+	}
+	defer MustCloseDB(tb, unindexed)
+	if plans, err = unindexed.QueryPlans(ctx); err != nil {
+		tb.Fatal(err)
+	} else if scans := sqlite.TableScans(plans); len(scans) == 0 {
+		tb.Fatal("no full table scans without the indexes")
+	}
+}
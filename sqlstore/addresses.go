@@ -0,0 +1,137 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreateAddress creates an address of the insured, with its first record
+func (db *DB) CreateAddress(ctx context.Context, address *entity.Address) (record entity.Record, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return record, err
+	}
+	defer tx.Rollback()
+
+	record, err = createAddress(ctx, tx, address)
+	if err != nil {
+		return record, err
+	}
+	return record, tx.Commit()
+}
+
+// createAddress inserts an address record for the insured. Sets the new record id to address.ID.
+// If address.AddressId is 0, the record starts a new address of address.Type. The address is normalized first.
+func createAddress(ctx context.Context, tx *Tx, address *entity.Address) (newRecord entity.Record, err error) {
+	address.Normalize()
+	if err := address.Validate(); err != nil {
+		return newRecord, err
+	}
+	if address.Type == "" {
+		address.Type = entity.AddressMailing
+	}
+	if address.AddressId == 0 {
+		address.AddressId, err = tx.insert(ctx, `INSERT INTO insured_addresses (insured_id, type) VALUES (?, ?)`, address.InsuredId, address.Type)
+		if err != nil {
+			return newRecord, tx.db.FormatError(err)
+		}
+	}
+	address.ID, err = tx.insert(ctx, `
+		INSERT INTO `+address.GetDataTableName()+` (
+			address_id,
+			address,
+			line1,
+			line2,
+			city,
+			region,
+			postal_code,
+			country,
+			insured_id,
+			record_timestamp,
+			valid_from,
+			valid_to
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		address.AddressId,
+		address.Address,
+		address.Line1,
+		address.Line2,
+		address.City,
+		address.Region,
+		address.PostalCode,
+		address.Country,
+		address.InsuredId,
+		address.RecordTimestamp.Unix(),
+		validFromUnix(address.ValidFrom, address.RecordTimestamp),
+		validToUnix(address.ValidTo),
+	)
+	if err != nil {
+		return newRecord, tx.db.FormatError(err)
+	}
+	return address.ToRecord(), nil
+}
+
+// CountInsuredAddresses returns the number of address records of the insured that are not deleted
+func (db *DB) CountInsuredAddresses(ctx context.Context, insured entity.Insured) (count int, err error) {
+	if err := insured.Validate(); err != nil {
+		return count, err
+	}
+	query, args := selectRecords(source{}, &entity.Address{}).
+		Where(`t2.insured_id = ?`, insured.ID).
+		Where(addressNotDeleted(source{})).
+		Count()
+	err = db.queryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+// UpdateAddress adds a record to the address with address.AddressId, unless the address did not change.
+// No address id updates the insured's only address.
+func (db *DB) UpdateAddress(ctx context.Context, address *entity.Address) (record entity.Record, err error) {
+	// compare with the address valid when this change takes effect
+	asOfRecorded := address.RecordTimestamp
+	if asOfRecorded.IsZero() {
+		asOfRecorded = time.Now()
+	}
+	asOfValid := address.ValidFrom
+	if asOfValid.IsZero() {
+		asOfValid = asOfRecorded
+	}
+	insured, err := db.GetInsuredByBitemporalDate(ctx, int64(address.InsuredId), asOfValid, asOfRecorded)
+	if err != nil {
+		return record, err
+	}
+	count, err := db.CountInsuredAddresses(ctx, insured)
+	if err != nil {
+		return record, err
+	} else if count == 0 {
+		return record, ErrRecordAlreadyExists
+	}
+	if address.AddressId == 0 {
+		if len(*insured.Addresses) != 1 {
+			return record, ErrRecordIDInvalid
+		}
+		for _, current := range *insured.Addresses {
+			address.AddressId, address.Type = current.AddressId, current.Type
+		}
+	}
+	for _, current := range *insured.Addresses {
+		if current.AddressId == address.AddressId && address.SameAddress(current) {
+			return record, ErrUpdateMustChangeAValue
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return record, err
+	}
+	defer tx.Rollback()
+
+	record, err = createAddress(ctx, tx, address)
+	if err != nil {
+		return record, err
+	}
+	return record, tx.Commit()
+}
@@ -0,0 +1,54 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+)
+
+// Archive holds old employee and address record versions outside the records tables, e.g. sqlite.DB's archive
+// database. A version is archived only if no query as of the cutoff or later can return it, so reads as of the cutoff
+// or later use the records tables alone. Reads before the cutoff, and whole-history reads, include the archive.
+type Archive interface {
+	// Cutoff returns the time before which reads include the archive. Zero if nothing was archived.
+	Cutoff() time.Time
+	// Union returns a subquery selecting the rows of a records table and its archive. Empty if the table is not archived.
+	Union(table string) string
+	// Purge deletes the archived versions of employees and addresses purged from the records tables
+	Purge(ctx context.Context, tx *Tx) error
+}
+
+// source is where a query reads records tables from: the records tables, or their union with the archive
+type source struct {
+	archive Archive
+}
+
+// records returns the table to read, or, with the archive, a subquery selecting the rows of both
+func (src source) records(table string) string {
+	if src.archive == nil {
+		return table
+	}
+	if union := src.archive.Union(table); union != "" {
+		return union
+	}
+	return table
+}
+
+// source returns where reads as of asOf find records: with the archive, if any of asOf is before the archive's cutoff.
+// With no asOf, e.g. for a whole history, whenever anything was archived.
+func (db *DB) source(asOf ...time.Time) source {
+	if db.Archive == nil {
+		return source{}
+	}
+	cutoff := db.Archive.Cutoff()
+	if cutoff.IsZero() {
+		return source{}
+	}
+	archived := len(asOf) == 0
+	for _, t := range asOf {
+		archived = archived || t.Before(cutoff)
+	}
+	if !archived {
+		return source{}
+	}
+	return source{archive: db.Archive}
+}
@@ -0,0 +1,120 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreateClaim creates a claim against the insured with its first record. Sets the new claim id to claim.ID.
+// A claim without a status is open.
+func (db *DB) CreateClaim(ctx context.Context, claim *entity.Claim) (record entity.Record, err error) {
+	if claim.Status == "" {
+		claim.Status = entity.ClaimOpen
+	}
+	if err := claim.Validate(); err != nil {
+		return record, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return record, err
+	}
+	defer tx.Rollback()
+
+	claim.ID, err = tx.insert(ctx, `INSERT INTO `+claim.GetIdentTableName()+` (insured_id) VALUES (?)`, claim.InsuredId)
+	if err != nil {
+		return record, tx.db.FormatError(err)
+	}
+	record, err = updateClaim(ctx, tx, claim)
+	if err != nil {
+		return record, err
+	}
+	return record, tx.Commit()
+}
+
+// UpdateClaim adds a record to the claim with claim.ID, unless nothing changed. The insured is the claim's.
+// Status transitions are not checked here: see entity.Claim.CanBecome.
+func (db *DB) UpdateClaim(ctx context.Context, claim *entity.Claim) (record entity.Record, err error) {
+	current, err := db.GetClaimByBitemporalDate(ctx, entity.Claim{}, int64(claim.ID), claim.RecordTimestamp, claim.RecordTimestamp)
+	if err != nil {
+		return record, err
+	} else if current.ID == 0 {
+		return record, ErrRecordDoesNotExist
+	}
+	if current.SameClaim(claim) {
+		return record, ErrUpdateMustChangeAValue
+	}
+	claim.InsuredId = current.InsuredId
+	if err := claim.Validate(); err != nil {
+		return record, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return record, err
+	}
+	defer tx.Rollback()
+
+	record, err = updateClaim(ctx, tx, claim)
+	if err != nil {
+		return record, err
+	}
+	return record, tx.Commit()
+}
+
+// updateClaim inserts a record for the existing claim claim.ID
+func updateClaim(ctx context.Context, tx *Tx, claim *entity.Claim) (record entity.Record, err error) {
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO `+claim.GetDataTableName()+` (
+			claim_id,
+			loss_date,
+			description,
+			status,
+			record_timestamp,
+			valid_from,
+			valid_to
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		claim.ID,
+		claim.LossDate.Format("2006-01-02"),
+		claim.Description,
+		claim.Status,
+		claim.RecordTimestamp.Unix(),
+		validFromUnix(claim.ValidFrom, claim.RecordTimestamp),
+		validToUnix(claim.ValidTo),
+	)
+	if err != nil {
+		return record, tx.db.FormatError(err)
+	}
+	return claim.ToRecord(), nil
+}
+
+// GetClaimById returns the claim's current record
+func (db *DB) GetClaimById(ctx context.Context, claim entity.Claim, id int64) (*entity.Claim, error) {
+	now := db.Now()
+	return db.GetClaimByBitemporalDate(ctx, claim, id, now, now)
+}
+
+// GetClaimByBitemporalDate returns the claim's record valid at asOfValid, as known at asOfRecorded.
+// Returned claim has ID 0 if there is no such record.
+func (db *DB) GetClaimByBitemporalDate(ctx context.Context, claim entity.Claim, id int64, asOfValid time.Time, asOfRecorded time.Time) (*entity.Claim, error) {
+	if id == 0 {
+		return &entity.Claim{}, ErrRecordDoesNotExist
+	}
+	query, args := selectByBitemporalDate(source{}, &claim, asOfValid, asOfRecorded, "t2.id = ?", id).Build()
+	rows, err := db.queryContext(ctx, query, args...)
+	if err != nil {
+		return &entity.Claim{}, fmt.Errorf("Query failed")
+	}
+	records, err := scanRows(&claim, rows)
+	if err != nil {
+		return &entity.Claim{}, err
+	}
+	for _, record := range records {
+		return record.(*entity.Claim), nil
+	}
+	return &entity.Claim{}, nil
+}
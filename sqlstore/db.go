@@ -0,0 +1,560 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// The reads and writes of packages sqlite and postgres, which embed DB with their Dialect and connection.
+// Both have the same schema. Timestamps are stored as unix seconds.
+// Queries are written with "?" placeholders, which Tx and DB rebind for the dialect.
+
+// Dialect is what differs between the SQL databases a DB can use
+type Dialect interface {
+	// Rebind writes the "?" placeholders of query as the database expects
+	Rebind(query string) string
+	// Insert runs an INSERT into a table with an "id" primary key, and returns the new id
+	Insert(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error)
+	// LockPolicyNumbers makes other transactions numbering policies wait for tx, so numbers are not reused
+	LockPolicyNumbers(ctx context.Context, tx *sql.Tx) error
+	// ForUpdate is the clause locking the rows a SELECT reads until its transaction ends.
+	// Empty if the database serializes writes anyway.
+	ForUpdate() string
+	// FormatError returns err as one of this package's errors, e.g. ErrRecordAlreadyExists, if possible
+	FormatError(err error) error
+}
+
+type DB struct {
+	SQL     *sql.DB // set by the embedding package when it connects
+	Dialect Dialect
+	Archive Archive // nil if there is none
+
+	Now func() time.Time
+}
+
+var ErrRecordDoesNotExist = entity.ErrRecordDoesNotExist
+var ErrRecordIDInvalid = entity.ErrRecordIDInvalid
+var ErrRecordAlreadyExists = entity.ErrRecordAlreadyExists
+var ErrRecordMatchingCriteriaDoesNotExist = entity.ErrRecordMatchingCriteriaDoesNotExist
+var ErrUpdateMustChangeAValue = entity.ErrUpdateMustChangeAValue
+var ErrRecordNotPending = entity.ErrRecordNotPending
+var ErrInsuredDeleted = entity.ErrInsuredDeleted
+
+func (db *DB) GetById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (record entity.InsuredInterface, err error) {
+	if id == 0 {
+		return record, ErrRecordDoesNotExist
+	}
+	switch objType := insuredObj.(type) {
+	case *entity.Insured:
+		return db.GetInsuredById(ctx, *objType, id)
+	case *entity.Employee:
+		return db.GetEmployeeById(ctx, *objType, id)
+	case *entity.Address:
+		return db.GetAddressById(ctx, *objType, id)
+	case *entity.Policy:
+		return db.GetPolicyById(ctx, *objType, id)
+	case *entity.Claim:
+		return db.GetClaimById(ctx, *objType, id)
+	}
+	return nil, nil
+}
+
+// GetInsuredById returns the insured record for this Id. Deleted insureds do not exist.
+func (db *DB) GetInsuredById(ctx context.Context, insured entity.Insured, id int64) (*entity.Insured, error) {
+	insuredObj, err := db.getInsuredById(ctx, insured, id)
+	if err != nil {
+		return insuredObj, err
+	}
+	now := db.Now()
+	deleted, err := db.insuredDeletedAt(ctx, id, now, now)
+	if err != nil {
+		return &entity.Insured{}, err
+	} else if deleted {
+		return &entity.Insured{}, ErrRecordDoesNotExist
+	}
+	return insuredObj, nil
+}
+
+// getInsuredById returns the insured record for this Id, deleted or not
+func (db *DB) getInsuredById(ctx context.Context, insured entity.Insured, id int64) (*entity.Insured, error) {
+	if id == 0 {
+		return &entity.Insured{}, ErrRecordDoesNotExist
+	}
+	query, args := selectByIds(source{}, &insured, []int64{id}).Build()
+	rows, err := db.queryContext(ctx, query, args...)
+	if err != nil {
+		return &entity.Insured{}, fmt.Errorf("Query failed")
+	}
+	records, err := scanRows(&insured, rows)
+	if err != nil {
+		return &entity.Insured{}, err
+	}
+	for _, record := range records {
+		return record.(*entity.Insured), nil
+	}
+	return &entity.Insured{}, ErrRecordDoesNotExist
+}
+
+// GetEmployeeById returns the employee record for this Id that is valid now
+func (db *DB) GetEmployeeById(ctx context.Context, employee entity.Employee, id int64) (*entity.Employee, error) {
+	now := db.Now()
+	return db.GetEmployeeByBitemporalDate(ctx, employee, id, now, now)
+}
+
+// GetEmployeeByBitemporalDate returns the employee record for this Id valid at asOfValid, as known at asOfRecorded
+// Returned employee has ID 0 if there is no such record.
+func (db *DB) GetEmployeeByBitemporalDate(ctx context.Context, employee entity.Employee, id int64, asOfValid time.Time, asOfRecorded time.Time) (*entity.Employee, error) {
+	if id == 0 {
+		return &entity.Employee{}, ErrRecordDoesNotExist
+	}
+	query, args := selectByBitemporalDate(db.source(asOfValid, asOfRecorded), &employee, asOfValid, asOfRecorded, "t2.id = ?", id).Build()
+	rows, err := db.queryContext(ctx, query, args...)
+	if err != nil {
+		return &entity.Employee{}, fmt.Errorf("Query failed")
+	}
+	records, err := scanRows(&employee, rows)
+	if err != nil {
+		return &entity.Employee{}, err
+	}
+	for _, record := range records {
+		return record.(*entity.Employee), nil
+	}
+	return &entity.Employee{}, nil
+}
+
+// GetAddressById returns the address record for this Id, if the address is not deleted
+func (db *DB) GetAddressById(ctx context.Context, address entity.Address, id int64) (*entity.Address, error) {
+	if id == 0 {
+		return &entity.Address{}, ErrRecordDoesNotExist
+	}
+	query, args := selectByIds(db.source(), &address, []int64{id}).Build()
+	rows, err := db.queryContext(ctx, query, args...)
+	if err != nil {
+		return &entity.Address{}, fmt.Errorf("Query failed")
+	}
+	records, err := scanRows(&address, rows)
+	if err != nil {
+		return &entity.Address{}, err
+	}
+	for _, record := range records {
+		return record.(*entity.Address), nil
+	}
+	return &entity.Address{}, nil
+}
+
+// scanRows reads employee, address, policy, claim, or insured rows selected by selectRecords, and closes rows
+func scanRows(insuredIfaceObj entity.InsuredInterface, rows *sql.Rows) (map[int]entity.InsuredInterface, error) {
+	defer rows.Close()
+	insuredIfaceMap := make(map[int]entity.InsuredInterface)
+	i := 0
+	for rows.Next() {
+		var garbage int64 // max_timestamp, same as record_timestamp
+		switch insuredIfaceObj.(type) {
+		case *entity.Employee:
+			var recordId int
+			employee := entity.Employee{}
+			if err := rows.Scan(
+				&employee.ID,
+				&recordId, // not implemented in Employee yet
+				&employee.InsuredId,
+				&employee.Name,
+				(*ShortTime)(&employee.StartDate),
+				(*ShortTime)(&employee.EndDate),
+				&employee.JobClassCode,
+				&employee.AnnualPayroll,
+				&employee.WorkLocation,
+				(*NullTime)(&employee.RecordTimestamp),
+				(*NullTime)(&employee.ValidFrom),
+				(*NullTime)(&employee.ValidTo),
+				&garbage,
+			); err != nil {
+				return nil, err
+			}
+			insuredIfaceMap[i] = &employee
+		case *entity.Address:
+			address := entity.Address{}
+			if err := rows.Scan(
+				&address.ID,
+				&address.AddressId,
+				&address.Type,
+				&address.Address,
+				&address.Line1,
+				&address.Line2,
+				&address.City,
+				&address.Region,
+				&address.PostalCode,
+				&address.Country,
+				&address.InsuredId,
+				(*NullTime)(&address.RecordTimestamp),
+				(*NullTime)(&address.ValidFrom),
+				(*NullTime)(&address.ValidTo),
+				&garbage,
+			); err != nil {
+				return nil, err
+			}
+			insuredIfaceMap[i] = &address
+		case *entity.Policy:
+			policy := entity.Policy{}
+			if err := rows.Scan(
+				&policy.ID,
+				&policy.PolicyNumber,
+				&policy.InsuredId,
+				&policy.Term,
+				(*ShortTime)(&policy.EffectiveDate),
+				(*ShortTime)(&policy.ExpirationDate),
+				&policy.OccurrenceLimit,
+				&policy.AggregateLimit,
+				&policy.Premium,
+				(*NullTime)(&policy.RecordTimestamp),
+				(*NullTime)(&policy.ValidFrom),
+				(*NullTime)(&policy.ValidTo),
+				&garbage,
+			); err != nil {
+				return nil, err
+			}
+			insuredIfaceMap[i] = &policy
+		case *entity.Claim:
+			claim := entity.Claim{}
+			if err := rows.Scan(
+				&claim.ID,
+				&claim.InsuredId,
+				(*ShortTime)(&claim.LossDate),
+				&claim.Description,
+				&claim.Status,
+				(*NullTime)(&claim.RecordTimestamp),
+				(*NullTime)(&claim.ValidFrom),
+				(*NullTime)(&claim.ValidTo),
+				&garbage,
+			); err != nil {
+				return nil, err
+			}
+			insuredIfaceMap[i] = &claim
+		case *entity.Insured:
+			insured := entity.Insured{}
+			if err := rows.Scan(&insured.ID,
+				&insured.Name,
+				&insured.PolicyNumber,
+				(*NullTime)(&insured.RecordTimestamp),
+			); err != nil {
+				return nil, err
+			}
+			insuredIfaceMap[i] = &insured
+		}
+		i++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rowsErr: %v", err)
+	}
+	return insuredIfaceMap, nil
+}
+
+// GetInsuredByDate returns the insured with its employees and address valid at date, as known at date
+func (db *DB) GetInsuredByDate(ctx context.Context, insuredId int64, date time.Time) (insured entity.Insured, err error) {
+	return db.GetInsuredByBitemporalDate(ctx, insuredId, date, date)
+}
+
+// GetAll returns all insureds or address records. Employees and policies are returned as they are now,
+// so scheduled and cancelled employee and policy records are not included.
+func (db *DB) GetAll(ctx context.Context, entityType entity.InsuredInterface) (records map[int]entity.InsuredInterface, err error) {
+	q := selectAll(db.source(), entityType)
+	now := db.Now()
+	switch entityType.(type) {
+	case *entity.Employee:
+		q = selectByBitemporalDate(db.source(now), entityType, now, now, "")
+	case *entity.Policy:
+		q = selectByBitemporalDate(source{}, entityType, now, now, policyInsuredNotDeleted)
+	}
+	if q == nil {
+		return records, fmt.Errorf("Query failed")
+	}
+	query, args := q.Build()
+	rows, err := db.queryContext(ctx, query, args...)
+	if err != nil {
+		return records, err
+	}
+	return scanRows(entityType, rows)
+}
+
+func (db *DB) GetAllByEntityId(ctx context.Context, entityType entity.InsuredInterface, entityId int64) (records map[int]entity.InsuredInterface, err error) {
+	q := selectAllRecordsByEntityId(db.source(), entityType, entityId)
+	if q == nil {
+		return records, fmt.Errorf("Query failed")
+	}
+	query, args := q.Build()
+	rows, err := db.queryContext(ctx, query, args...)
+	if err != nil {
+		return records, err
+	}
+	return scanRows(entityType, rows)
+}
+
+// GetByDate returns the records for insuredId valid at date, as they were known at date.
+func (db *DB) GetByDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, naturalKey string, insuredId int64, date time.Time) (records map[int]entity.InsuredInterface, err error) {
+	if insuredId == 0 {
+		return records, ErrRecordDoesNotExist
+	}
+	return db.GetByBitemporalDate(ctx, insuredIfaceObj, insuredId, date, date)
+}
+
+// GetByBitemporalDate returns the records for insuredId that were true at asOfValid (valid time),
+// as the system knew them at asOfRecorded (transaction time).
+// Of the records covering asOfValid, the one with the latest valid_from wins, then the latest record_timestamp.
+// Policies are returned if they are in force at asOfValid, and the insured is not deleted.
+func (db *DB) GetByBitemporalDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (records map[int]entity.InsuredInterface, err error) {
+	if insuredId == 0 {
+		return records, ErrRecordDoesNotExist
+	}
+	q := selectByBitemporalDate(db.source(asOfValid, asOfRecorded), insuredIfaceObj, asOfValid, asOfRecorded, "t2.insured_id = ?", insuredId)
+	if q == nil {
+		return records, fmt.Errorf("Query failed")
+	}
+	if _, ok := insuredIfaceObj.(*entity.Policy); ok {
+		if deleted, err := db.insuredDeletedAt(ctx, insuredId, asOfValid, asOfRecorded); err != nil {
+			return records, err
+		} else if deleted {
+			return map[int]entity.InsuredInterface{}, nil
+		}
+		date := asOfValid.UTC().Format("2006-01-02")
+		q.Where(policyInForce, date, date)
+	}
+	query, args := q.Build()
+	rows, err := db.queryContext(ctx, query, args...)
+	if err != nil {
+		return records, fmt.Errorf("Query failed")
+	}
+	records, err = scanRows(insuredIfaceObj, rows)
+	if err != nil {
+		return nil, fmt.Errorf("Server Error")
+	}
+	return records, nil
+}
+
+// GetInsuredByBitemporalDate returns the insured with its employees and address valid at asOfValid, as known at asOfRecorded
+func (db *DB) GetInsuredByBitemporalDate(ctx context.Context, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (insured entity.Insured, err error) {
+	if insuredId == 0 {
+		return insured, ErrRecordDoesNotExist
+	}
+	insuredObj, err := db.getInsuredById(ctx, entity.Insured{}, insuredId)
+	if err == ErrRecordDoesNotExist || insuredObj.ID == 0 {
+		return entity.Insured{}, ErrRecordDoesNotExist
+	} else if err != nil {
+		return entity.Insured{}, db.FormatError(err)
+	}
+	if deleted, err := db.insuredDeletedAt(ctx, insuredId, asOfValid, asOfRecorded); err != nil {
+		return entity.Insured{}, err
+	} else if deleted {
+		return entity.Insured{}, ErrRecordDoesNotExist
+	}
+	employeeRecords, err := db.GetByBitemporalDate(ctx, &entity.Employee{}, insuredId, asOfValid, asOfRecorded)
+	if err != nil {
+		return entity.Insured{}, db.FormatError(err)
+	}
+	addressRecords, err := db.GetByBitemporalDate(ctx, &entity.Address{}, insuredId, asOfValid, asOfRecorded)
+	if err != nil {
+		return entity.Insured{}, db.FormatError(err)
+	}
+
+	employees, err := entity.EmployeesFromInsuredInterface(employeeRecords)
+	addresses, err := entity.AddressesFromInsuredInterface(addressRecords)
+
+	insuredObj.Employees = &employees
+	insuredObj.Addresses = &addresses
+	return *insuredObj, nil
+}
+
+// CountInsuredRecordsAtDate counts the insured's employees or addresses valid at date, as known at date
+func (db *DB) CountInsuredRecordsAtDate(ctx context.Context, tx *sql.Tx, insuredIfaceObj entity.InsuredInterface, insuredId int64, date time.Time) (int, error) {
+	count := 0
+	q := selectByBitemporalDate(db.source(date), insuredIfaceObj, date, date, "t2.insured_id = ?", insuredId)
+	if q == nil {
+		return 0, fmt.Errorf("Query failed")
+	}
+	query, args := q.Count()
+	err := tx.QueryRowContext(ctx, db.Dialect.Rebind(query), args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// BeginTx starts a transaction and returns a wrapper Tx type. This type
+// provides a reference to the database and a fixed timestamp at the start of
+// the transaction. The timestamp allows us to mock time during tests as well.
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.SQL.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{
+		Tx:  tx,
+		db:  db,
+		now: db.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// Tx wraps the SQL Tx object to provide a timestamp at the start of the transaction.
+// Its queries are written with "?" placeholders.
+type Tx struct {
+	*sql.Tx
+	db  *DB
+	now time.Time
+}
+
+// ExecContext runs a statement written with "?" placeholders
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.db.Dialect.Rebind(query), args...)
+}
+
+// QueryContext runs a query written with "?" placeholders
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.db.Dialect.Rebind(query), args...)
+}
+
+// QueryRowContext runs a query written with "?" placeholders, returning at most one row
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.db.Dialect.Rebind(query), args...)
+}
+
+// insert runs an INSERT written with "?" placeholders into a table with an "id" primary key, and returns the new id
+func (tx *Tx) insert(ctx context.Context, query string, args ...interface{}) (int, error) {
+	id, err := tx.db.Dialect.Insert(ctx, tx.Tx, tx.db.Dialect.Rebind(query), args...)
+	return int(id), err
+}
+
+// queryContext runs a query written with "?" placeholders outside a transaction
+func (db *DB) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.SQL.QueryContext(ctx, db.Dialect.Rebind(query), args...)
+}
+
+// queryRowContext runs a query written with "?" placeholders outside a transaction, returning at most one row
+func (db *DB) queryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.SQL.QueryRowContext(ctx, db.Dialect.Rebind(query), args...)
+}
+
+// inTx runs fn in a transaction, committing if it returns nil
+func (db *DB) inTx(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FormatError returns err as one of this package's errors, if the dialect knows it. Otherwise returns err.
+func (db *DB) FormatError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return db.Dialect.FormatError(err)
+}
+
+// validFromUnix returns the valid_from value for a new record.
+// Records without an explicit valid time become valid when they are recorded.
+func validFromUnix(validFrom time.Time, recordTimestamp time.Time) int64 {
+	if validFrom.IsZero() {
+		return recordTimestamp.Unix()
+	}
+	return validFrom.Unix()
+}
+
+// validToUnix returns the valid_to value for a new record. NULL if open-ended.
+func validToUnix(validTo time.Time) interface{} {
+	if validTo.IsZero() {
+		return nil
+	}
+	return validTo.Unix()
+}
+
+type ShortTime time.Time
+
+// Scan converts a short string time ("2006-01-02") to time.Time. NULL or empty is zero time.
+func (n *ShortTime) Scan(value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		*(*time.Time)(n) = time.Time{}
+		return nil
+	case string:
+		if value == "" {
+			*(*time.Time)(n) = time.Time{}
+			return nil
+		}
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return fmt.Errorf("ShortTime: cannot convert %q to time.Time: %w", value, err)
+		}
+		*(*time.Time)(n) = t
+		return nil
+	}
+	return fmt.Errorf("ShortTime: cannot scan to time.Time: %T", value)
+}
+
+// NullTime represents a helper wrapper for time.Time. It automatically converts
+// time fields to/from RFC 3339 format. Also supports NULL for zero time.
+type NullTime time.Time
+
+// Scan reads a time value from the database.
+// Maybe better way
+func (n *NullTime) Scan(value interface{}) error {
+	if value == nil { // reflect.TypeOf(nil) cannot be inspected below
+		*(*time.Time)(n) = time.Time{}
+		return nil
+	}
+	valtypes := map[string]int{"int": 0, "int32": 1, "int64": 2}
+	valtype := reflect.TypeOf(value).String()
+	if _, ok := valtypes[valtype]; ok {
+		if int64val, ok := value.(int64); ok {
+			*(*time.Time)(n) = time.Unix(int64val, 0).UTC()
+			return nil
+		} else if intval, ok := value.(int32); ok {
+			int64val := int64(intval)
+			*(*time.Time)(n) = time.Unix(int64val, 0).UTC()
+			return nil
+		} else if intval, ok := value.(int); ok {
+			int64val := int64(intval)
+			*(*time.Time)(n) = time.Unix(int64val, 0).UTC()
+			return nil
+		}
+	}
+
+	if value == nil {
+		*(*time.Time)(n) = time.Time{}
+		return nil
+	} else if value, ok := value.(string); ok {
+		*(*time.Time)(n), _ = time.Parse(time.RFC3339, value)
+		return nil
+	}
+	return fmt.Errorf("NullTime: cannot scan to time.Time: %T", value)
+}
+
+// Value formats a time value for the database.
+func (n *NullTime) Value() (driver.Value, error) {
+	if n == nil || (*time.Time)(n).IsZero() {
+		return nil, nil
+	}
+	return (*time.Time)(n).UTC().Format(time.RFC3339), nil
+}
+
+// FormatLimitOffset returns a SQL string for a given limit & offset.
+// Clauses are only added if limit and/or offset are greater than zero.
+// SQLite has no OFFSET without LIMIT, so an offset alone is written with the largest limit.
+func FormatLimitOffset(limit, offset int) string {
+	if limit > 0 && offset > 0 {
+		return fmt.Sprintf(`LIMIT %d OFFSET %d`, limit, offset)
+	} else if limit > 0 {
+		return fmt.Sprintf(`LIMIT %d`, limit)
+	} else if offset > 0 {
+		return fmt.Sprintf(`LIMIT %d OFFSET %d`, math.MaxInt64, offset)
+	}
+	return ""
+}
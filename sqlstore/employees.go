@@ -0,0 +1,126 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreateEmployee creates a new employee and its first record
+func (db *DB) CreateEmployee(ctx context.Context, employee *entity.Employee) (record entity.Record, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return record, err
+	}
+	defer tx.Rollback()
+
+	record, err = createEmployee(ctx, tx, employee)
+	if err != nil {
+		return record, err
+	}
+	return record, tx.Commit()
+}
+
+// createEmployee creates a new employee. Sets the new employee id to employee.ID
+func createEmployee(ctx context.Context, tx *Tx, employee *entity.Employee) (record entity.Record, err error) {
+	if err := employee.Validate(); err != nil {
+		return record, err
+	}
+	employee.ID, err = tx.insert(ctx, `INSERT INTO `+employee.GetIdentTableName()+` (insured_id) VALUES (?)`, employee.InsuredId)
+	if err != nil {
+		return record, tx.db.FormatError(err)
+	}
+	return updateEmployee(ctx, tx, employee)
+}
+
+// UpdateEmployee adds a new record for the employee, unless nothing changed
+func (db *DB) UpdateEmployee(ctx context.Context, employee *entity.Employee) (record entity.Record, err error) {
+	count, err := db.CountEmployeeRecords(ctx, *employee)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	if count == 0 {
+		return entity.Record{}, fmt.Errorf("Employee '%v' for Insured ID '%v' does not exist. Use 'new' to update it.", employee.Name, employee.InsuredId)
+	}
+
+	// compare with the record valid when this change takes effect
+	asOfValid := employee.ValidFrom
+	if asOfValid.IsZero() {
+		asOfValid = employee.RecordTimestamp
+	}
+	currentRecord, err := db.GetEmployeeByBitemporalDate(ctx, entity.Employee{}, int64(employee.ID), asOfValid, employee.RecordTimestamp)
+	if err != nil {
+		return record, err
+	}
+	if sameEmployee(currentRecord, employee) {
+		return record, ErrUpdateMustChangeAValue
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return record, err
+	}
+	defer tx.Rollback()
+
+	record, err = updateEmployee(ctx, tx, employee)
+	if err != nil {
+		return record, err
+	}
+	return record, tx.Commit()
+}
+
+// updateEmployee inserts a record for the existing employee employee.ID
+func updateEmployee(ctx context.Context, tx *Tx, employee *entity.Employee) (record entity.Record, err error) {
+	if err := employee.Validate(); err != nil {
+		return record, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO `+employee.GetDataTableName()+` (
+			employee_id,
+			name,
+			start_date,
+			end_date,
+			job_class_code,
+			annual_payroll,
+			work_location,
+			record_timestamp,
+			valid_from,
+			valid_to
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		employee.ID,
+		employee.Name,
+		employee.StartDate.Format("2006-01-02"),
+		employee.EndDate.Format("2006-01-02"),
+		employee.JobClassCode,
+		employee.AnnualPayroll,
+		employee.WorkLocation,
+		employee.RecordTimestamp.Unix(),
+		validFromUnix(employee.ValidFrom, employee.RecordTimestamp),
+		validToUnix(employee.ValidTo),
+	)
+	if err != nil {
+		return record, tx.db.FormatError(err)
+	}
+	return employee.ToRecord(), nil
+}
+
+// CountEmployeeRecords returns 1 if the employee exists and is not deleted, regardless of its time-travelable attributes
+func (db *DB) CountEmployeeRecords(ctx context.Context, employee entity.Employee) (count int, err error) {
+	if err := employee.Validate(); err != nil {
+		return 0, err
+	}
+	// deleted employees (latest record is a tombstone) do not count
+	err = db.queryRowContext(ctx, `
+	SELECT COUNT(*) FROM employees
+	WHERE id = ?
+	AND NOT EXISTS (
+		SELECT 1 FROM employees_records d
+		WHERE d.employee_id = employees.id AND d.tombstone = 1
+		AND NOT EXISTS (SELECT 1 FROM employees_records r WHERE r.employee_id = d.employee_id AND r.id > d.id)
+	)
+`, employee.ID).Scan(&count)
+	return count, err
+}
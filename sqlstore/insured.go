@@ -0,0 +1,72 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreateInsured creates a new insured with the next policy number, unless insured has one
+func (db *DB) CreateInsured(ctx context.Context, insured *entity.Insured) (record entity.Record, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return record, err
+	}
+	defer tx.Rollback()
+
+	record, err = createInsured(ctx, tx, insured)
+	if err != nil {
+		return record, err
+	}
+	return record, tx.Commit()
+}
+
+// creates a new insured. Sets the new record ID to insured.ID and retrieves new policyNumber, unless insured has one
+func createInsured(ctx context.Context, tx *Tx, insured *entity.Insured) (newRecord entity.Record, err error) {
+	if err := insured.Validate(); err != nil {
+		return newRecord, err
+	}
+	// concurrent creates wait, so policy numbers are not reused
+	if err := tx.db.Dialect.LockPolicyNumbers(ctx, tx.Tx); err != nil {
+		return newRecord, tx.db.FormatError(err)
+	}
+	policyNumber := insured.PolicyNumber // set by seed data
+	if policyNumber == 0 {
+		if policyNumber, err = getMaxPolicyNumber(ctx, tx); err != nil {
+			return newRecord, err
+		}
+		policyNumber++
+	}
+	insured.PolicyNumber = policyNumber
+
+	insured.ID, err = tx.insert(ctx, `
+		INSERT INTO insured (
+			name,
+			policy_number,
+			record_timestamp
+		)
+		VALUES (?, ?, ?)
+	`,
+		insured.Name,
+		policyNumber,
+		insured.RecordTimestamp.Unix(),
+	)
+	if err != nil {
+		return newRecord, tx.db.FormatError(err)
+	}
+	return insured.ToRecord(), nil
+}
+
+// getMaxPolicyNumber returns the highest policy number of the insureds and policies, or 1000 if there are none.
+// Callers lock the insured table first, so policy numbers are not reused.
+func getMaxPolicyNumber(ctx context.Context, tx *Tx) (max int, err error) {
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(policy_number), 1000)
+		FROM (SELECT policy_number FROM insured UNION ALL SELECT policy_number FROM policies) numbers`,
+	).Scan(&max)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to retrieve max policy number")
+	}
+	return max, nil
+}
@@ -0,0 +1,152 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// GetPendingChanges returns the scheduled changes for insuredId as of asOf:
+// records already recorded that take effect after asOf and have not been cancelled.
+// Sorted by the date they take effect.
+func (db *DB) GetPendingChanges(ctx context.Context, insuredId int64, asOf time.Time) (changes []entity.PendingChange, err error) {
+	if insuredId == 0 {
+		return changes, ErrRecordDoesNotExist
+	}
+	for _, obj := range []entity.InsuredInterface{&entity.Employee{}, &entity.Address{}} {
+		query, args := selectPending(obj, asOf, "t2.insured_id = ?", insuredId).Build()
+		rows, err := db.queryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("Query failed")
+		}
+		pending, err := scanPendingRows(obj, rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, pending...)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].ValidFrom.Before(changes[j].ValidFrom)
+	})
+	return changes, nil
+}
+
+// CancelPendingChange cancels the scheduled change with this record id, as of asOf.
+// The record is kept as it was, and a cancellation added, so earlier answers can still be reproduced.
+// Returns ErrRecordNotPending if the change has already taken effect or was already cancelled.
+func (db *DB) CancelPendingChange(ctx context.Context, insuredIfaceObj entity.InsuredInterface, recordId int64, asOf time.Time) (change entity.PendingChange, err error) {
+	if recordId == 0 {
+		return change, ErrRecordDoesNotExist
+	}
+	var q *Query
+	switch insuredIfaceObj.(type) {
+	case *entity.Employee:
+		q = selectPending(insuredIfaceObj, asOf, "t3.id = ?", recordId)
+	case *entity.Address:
+		q = selectPending(insuredIfaceObj, asOf, "t2.id = ?", recordId)
+	default:
+		return change, fmt.Errorf("Query failed")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return change, err
+	}
+	defer tx.Rollback()
+
+	// cancellation is only allowed for records that are still pending. The dialect locks them so until commit.
+	query, args := q.Build()
+	if forUpdate := db.Dialect.ForUpdate(); forUpdate != "" {
+		query += "\n" + forUpdate
+	}
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return change, fmt.Errorf("Query failed")
+	}
+	pending, err := scanPendingRows(insuredIfaceObj, rows)
+	if err != nil {
+		return change, err
+	}
+	table := insuredIfaceObj.GetDataTableName()
+	if len(pending) == 0 {
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE id = ?`, recordId).Scan(&count); err != nil {
+			return change, err
+		}
+		if count == 0 {
+			return change, ErrRecordDoesNotExist
+		}
+		return change, ErrRecordNotPending
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+cancellations(table)+` (record_id, record_timestamp) VALUES (?, ?)`, recordId, asOf.Unix()); err != nil {
+		return change, db.FormatError(err)
+	}
+	if err = tx.Commit(); err != nil {
+		return change, err
+	}
+	return pending[0], nil
+}
+
+// scanPendingRows reads rows selected by selectPending, and closes rows
+func scanPendingRows(insuredIfaceObj entity.InsuredInterface, rows *sql.Rows) (changes []entity.PendingChange, err error) {
+	defer rows.Close()
+	for rows.Next() {
+		change := entity.PendingChange{}
+		switch insuredIfaceObj.(type) {
+		case *entity.Employee:
+			employee := entity.Employee{}
+			if err := rows.Scan(
+				&employee.ID,
+				&change.RecordId,
+				&employee.InsuredId,
+				&employee.Name,
+				(*ShortTime)(&employee.StartDate),
+				(*ShortTime)(&employee.EndDate),
+				&employee.JobClassCode,
+				&employee.AnnualPayroll,
+				&employee.WorkLocation,
+				(*NullTime)(&employee.RecordTimestamp),
+				(*NullTime)(&employee.ValidFrom),
+				(*NullTime)(&employee.ValidTo),
+			); err != nil {
+				return nil, err
+			}
+			change.Resource = &employee
+			change.ValidFrom = employee.ValidFrom
+			change.RecordTimestamp = employee.RecordTimestamp
+		case *entity.Address:
+			address := entity.Address{}
+			if err := rows.Scan(
+				&address.ID,
+				&change.RecordId,
+				&address.AddressId,
+				&address.Type,
+				&address.Address,
+				&address.Line1,
+				&address.Line2,
+				&address.City,
+				&address.Region,
+				&address.PostalCode,
+				&address.Country,
+				&address.InsuredId,
+				(*NullTime)(&address.RecordTimestamp),
+				(*NullTime)(&address.ValidFrom),
+				(*NullTime)(&address.ValidTo),
+			); err != nil {
+				return nil, err
+			}
+			change.Resource = &address
+			change.ValidFrom = address.ValidFrom
+			change.RecordTimestamp = address.RecordTimestamp
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rowsErr: %v", err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,237 @@
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// CreatePolicy creates a policy of the insured and its first record.
+// A policy without a policy number gets the insured's, if no policy has it yet, else the next policy number.
+func (db *DB) CreatePolicy(ctx context.Context, policy *entity.Policy) (record entity.Record, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return record, err
+	}
+	defer tx.Rollback()
+
+	record, err = createPolicy(ctx, tx, policy)
+	if err != nil {
+		return record, err
+	}
+	return record, tx.Commit()
+}
+
+// createPolicy creates a new policy. Sets the new policy id to policy.ID
+func createPolicy(ctx context.Context, tx *Tx, policy *entity.Policy) (record entity.Record, err error) {
+	if policy.Term == 0 {
+		policy.Term = 1
+	}
+	if err := policy.Validate(); err != nil {
+		return record, err
+	}
+	// concurrent creates wait, so policy numbers are not reused
+	if err := tx.db.Dialect.LockPolicyNumbers(ctx, tx.Tx); err != nil {
+		return record, tx.db.FormatError(err)
+	}
+	if policy.PolicyNumber == 0 {
+		if policy.PolicyNumber, err = nextPolicyNumber(ctx, tx, policy.InsuredId); err != nil {
+			return record, err
+		}
+	}
+	policy.ID, err = tx.insert(ctx, `INSERT INTO `+policy.GetIdentTableName()+` (insured_id, policy_number) VALUES (?, ?)`,
+		policy.InsuredId,
+		policy.PolicyNumber,
+	)
+	if err != nil {
+		return record, tx.db.FormatError(err)
+	}
+	return updatePolicy(ctx, tx, policy)
+}
+
+// nextPolicyNumber returns the insured's policy number if no policy has it, else the next unused policy number
+func nextPolicyNumber(ctx context.Context, tx *Tx, insuredId int) (int, error) {
+	var policyNumber int
+	var used bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT policy_number, EXISTS (SELECT 1 FROM policies p WHERE p.policy_number = insured.policy_number)
+		FROM insured
+		WHERE id = ?`,
+		insuredId,
+	).Scan(&policyNumber, &used)
+	if err != nil {
+		return 0, ErrRecordDoesNotExist
+	}
+	if !used {
+		return policyNumber, nil
+	}
+	max, err := getMaxPolicyNumber(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	return max + 1, nil
+}
+
+// UpdatePolicy adds a new record for the policy, unless its terms did not change.
+// A renewal is a record of the next term. The policy number and insured are the policy's.
+func (db *DB) UpdatePolicy(ctx context.Context, policy *entity.Policy) (record entity.Record, err error) {
+	exists, err := db.policyExists(ctx, int64(policy.ID))
+	if err != nil {
+		return record, err
+	} else if !exists {
+		return record, ErrRecordDoesNotExist
+	}
+
+	// compare with the record valid when this change takes effect
+	asOfValid := policy.ValidFrom
+	if asOfValid.IsZero() {
+		asOfValid = policy.RecordTimestamp
+	}
+	current, err := db.GetPolicyByBitemporalDate(ctx, entity.Policy{}, int64(policy.ID), asOfValid, policy.RecordTimestamp)
+	if err != nil {
+		return record, err
+	}
+	if current.ID != 0 && current.SameTerms(policy) {
+		return record, ErrUpdateMustChangeAValue
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return record, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `SELECT insured_id, policy_number FROM policies WHERE id = ?`, policy.ID).
+		Scan(&policy.InsuredId, &policy.PolicyNumber)
+	if err != nil {
+		return record, tx.db.FormatError(err)
+	}
+	record, err = updatePolicy(ctx, tx, policy)
+	if err != nil {
+		return record, err
+	}
+	return record, tx.Commit()
+}
+
+// updatePolicy inserts a record for the existing policy policy.ID
+func updatePolicy(ctx context.Context, tx *Tx, policy *entity.Policy) (record entity.Record, err error) {
+	if err := policy.Validate(); err != nil {
+		return record, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO `+policy.GetDataTableName()+` (
+			policy_id,
+			term,
+			effective_date,
+			expiration_date,
+			occurrence_limit,
+			aggregate_limit,
+			premium,
+			record_timestamp,
+			valid_from,
+			valid_to
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		policy.ID,
+		policy.Term,
+		policy.EffectiveDate.Format("2006-01-02"),
+		policy.ExpirationDate.Format("2006-01-02"),
+		policy.OccurrenceLimit,
+		policy.AggregateLimit,
+		policy.Premium,
+		policy.RecordTimestamp.Unix(),
+		validFromUnix(policy.ValidFrom, policy.RecordTimestamp),
+		validToUnix(policy.ValidTo),
+	)
+	if err != nil {
+		return record, tx.db.FormatError(err)
+	}
+	return policy.ToRecord(), nil
+}
+
+// policyExists returns true if the policy exists and is not deleted (its latest record is not a tombstone)
+func (db *DB) policyExists(ctx context.Context, id int64) (bool, error) {
+	var count int
+	err := db.queryRowContext(ctx, `
+	SELECT COUNT(*) FROM policies
+	WHERE id = ?
+	AND NOT EXISTS (
+		SELECT 1 FROM policies_records d
+		WHERE d.policy_id = policies.id AND d.tombstone = 1
+		AND NOT EXISTS (SELECT 1 FROM policies_records r WHERE r.policy_id = d.policy_id AND r.id > d.id)
+	)
+`, id).Scan(&count)
+	return count > 0, err
+}
+
+// GetPolicyById returns the policy's record valid now, if the policy and its insured are not deleted
+func (db *DB) GetPolicyById(ctx context.Context, policy entity.Policy, id int64) (*entity.Policy, error) {
+	now := db.Now()
+	current, err := db.GetPolicyByBitemporalDate(ctx, policy, id, now, now)
+	if err != nil || current.ID == 0 {
+		return current, err
+	}
+	if deleted, err := db.insuredDeletedAt(ctx, int64(current.InsuredId), now, now); err != nil {
+		return &entity.Policy{}, err
+	} else if deleted {
+		return &entity.Policy{}, nil
+	}
+	return current, nil
+}
+
+// GetPolicyByBitemporalDate returns the policy's record valid at asOfValid, as known at asOfRecorded.
+// Returned policy has ID 0 if there is no such record.
+func (db *DB) GetPolicyByBitemporalDate(ctx context.Context, policy entity.Policy, id int64, asOfValid time.Time, asOfRecorded time.Time) (*entity.Policy, error) {
+	if id == 0 {
+		return &entity.Policy{}, ErrRecordDoesNotExist
+	}
+	query, args := selectByBitemporalDate(source{}, &policy, asOfValid, asOfRecorded, "t2.id = ?", id).Build()
+	rows, err := db.queryContext(ctx, query, args...)
+	if err != nil {
+		return &entity.Policy{}, fmt.Errorf("Query failed")
+	}
+	records, err := scanRows(&policy, rows)
+	if err != nil {
+		return &entity.Policy{}, err
+	}
+	for _, record := range records {
+		return record.(*entity.Policy), nil
+	}
+	return &entity.Policy{}, nil
+}
+
+// deletePolicy writes a tombstone policy record, effective now
+func deletePolicy(ctx context.Context, tx *Tx, policy *entity.Policy, now time.Time) error {
+	if err := cancelPending(ctx, tx, policy.GetDataTableName(), "policy_id", policy.ID, now); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO policies_records (
+			policy_id,
+			term,
+			effective_date,
+			expiration_date,
+			occurrence_limit,
+			aggregate_limit,
+			premium,
+			record_timestamp,
+			valid_from,
+			tombstone
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+	`,
+		policy.ID,
+		policy.Term,
+		policy.EffectiveDate.Format("2006-01-02"),
+		policy.ExpirationDate.Format("2006-01-02"),
+		policy.OccurrenceLimit,
+		policy.AggregateLimit,
+		policy.Premium,
+		now.Unix(),
+		now.Unix(),
+	)
+	return tx.db.FormatError(err)
+}
@@ -0,0 +1,320 @@
+package sqlstore
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// Query is a SELECT statement built from parts. Conditions are written with "?",
+// which Tx and DB rebind for the dialect when the query runs.
+// Values are always bound parameters. Only table and column names, which are fixed in this package,
+// and integer limit & offset are written into the SQL.
+type Query struct {
+	with      []string
+	withArgs  []interface{}
+	columns   []string
+	from      string
+	fromArgs  []interface{}
+	where     []string
+	whereArgs []interface{}
+	groupBy   []string
+	orderBy   []string
+	limit     int
+	offset    int
+}
+
+// newQuery returns a query selecting columns from a table, or tables joined with their aliases
+func newQuery(from string, columns ...string) *Query {
+	return &Query{from: from, columns: columns}
+}
+
+// With adds the subquery as a common table expression
+func (q *Query) With(name string, sub *Query) *Query {
+	subQuery, args := sub.Build()
+	q.with = append(q.with, name+` AS (`+"\n"+subQuery+"\n"+`)`)
+	q.withArgs = append(q.withArgs, args...)
+	return q
+}
+
+// FromQuery selects from the subquery, aliased "sub", instead of a table
+func (q *Query) FromQuery(sub *Query) *Query {
+	return q.FromUnion(sub)
+}
+
+// FromUnion selects from the rows of every subquery, aliased "sub", instead of a table.
+// The subqueries have the same columns, named by the first.
+func (q *Query) FromUnion(subs ...*Query) *Query {
+	queries := make([]string, len(subs))
+	q.fromArgs = nil
+	for i, sub := range subs {
+		subQuery, args := sub.Build()
+		queries[i] = subQuery
+		q.fromArgs = append(q.fromArgs, args...)
+	}
+	q.from = `(` + "\n" + strings.Join(queries, "\n"+`UNION ALL`+"\n") + "\n" + `) AS sub`
+	return q
+}
+
+// Where adds a condition, with a "?" for each arg. Conditions are joined with AND.
+func (q *Query) Where(condition string, args ...interface{}) *Query {
+	q.where = append(q.where, condition)
+	q.whereArgs = append(q.whereArgs, args...)
+	return q
+}
+
+// WhereIn adds the condition column IN (ids). No ids matches nothing.
+func (q *Query) WhereIn(column string, ids []int64) *Query {
+	if len(ids) == 0 {
+		return q.Where(`0 = 1`)
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return q.Where(column+` IN (?`+strings.Repeat(`, ?`, len(ids)-1)+`)`, args...)
+}
+
+func (q *Query) GroupBy(columns ...string) *Query {
+	q.groupBy = append(q.groupBy, columns...)
+	return q
+}
+
+func (q *Query) OrderBy(columns ...string) *Query {
+	q.orderBy = append(q.orderBy, columns...)
+	return q
+}
+
+func (q *Query) LimitOffset(limit, offset int) *Query {
+	q.limit, q.offset = limit, offset
+	return q
+}
+
+// Build returns the SQL and its parameters, in order
+func (q *Query) Build() (string, []interface{}) {
+	var b strings.Builder
+	if len(q.with) > 0 {
+		b.WriteString(`WITH ` + strings.Join(q.with, ",\n") + "\n")
+	}
+	b.WriteString(`SELECT ` + strings.Join(q.columns, `, `) + "\n")
+	b.WriteString(`FROM ` + q.from)
+	if len(q.where) > 0 {
+		b.WriteString("\n" + `WHERE ` + strings.Join(q.where, "\n"+`AND `))
+	}
+	if len(q.groupBy) > 0 {
+		b.WriteString("\n" + `GROUP BY ` + strings.Join(q.groupBy, `, `))
+	}
+	if len(q.orderBy) > 0 {
+		b.WriteString("\n" + `ORDER BY ` + strings.Join(q.orderBy, `, `))
+	}
+	if limitOffset := FormatLimitOffset(q.limit, q.offset); limitOffset != "" {
+		b.WriteString("\n" + limitOffset)
+	}
+	return b.String(), q.args()
+}
+
+// Count returns SQL counting the rows the query would return, ignoring limit & offset, and its parameters
+func (q *Query) Count() (string, []interface{}) {
+	inner := *q
+	inner.with, inner.withArgs = nil, nil
+	inner.orderBy = nil
+	inner.limit, inner.offset = 0, 0
+	count := newQuery(``, `COUNT(*)`).FromQuery(&inner)
+	count.with, count.withArgs = q.with, q.withArgs
+	return count.Build()
+}
+
+func (q *Query) args() []interface{} {
+	args := make([]interface{}, 0, len(q.withArgs)+len(q.fromArgs)+len(q.whereArgs))
+	args = append(args, q.withArgs...)
+	args = append(args, q.fromArgs...)
+	return append(args, q.whereArgs...)
+}
+
+// selectRecords selects the records of an InsuredInterface type from src, with the columns scanRows expects.
+// Employees are aliased t2 (employees) and t3 (employees_records), addresses t2 (insured_addresses_records)
+// and t4 (insured_addresses), policies t2 (policies) and t5 (policies_records), claims t2 (claims)
+// and t6 (claims_records), and insureds t1.
+func selectRecords(src source, insuredIfaceObj entity.InsuredInterface) *Query {
+	switch insuredIfaceObj.(type) {
+	case *entity.Employee:
+		return newQuery(`employees t2`+"\n"+`JOIN `+src.records(`employees_records`)+` t3 ON t2.id = t3.employee_id`,
+			`t3.employee_id AS id`, `t3.id AS record_id`, `t2.insured_id`, `t3.name`, `t3.start_date`, `t3.end_date`, `t3.job_class_code`, `t3.annual_payroll`, `t3.work_location`,
+			`t3.record_timestamp`, `t3.valid_from`, `t3.valid_to`, `t3.record_timestamp AS max_timestamp`)
+	case *entity.Address:
+		return newQuery(src.records(`insured_addresses_records`)+` t2`+"\n"+`JOIN insured_addresses t4 ON t4.id = t2.address_id`,
+			`t2.id`, `t2.address_id`, `t4.type`, `t2.address`, `t2.line1`, `t2.line2`, `t2.city`, `t2.region`, `t2.postal_code`, `t2.country`, `t2.insured_id`, `t2.record_timestamp`, `t2.valid_from`, `t2.valid_to`, `t2.record_timestamp AS max_timestamp`)
+	case *entity.Policy:
+		return newQuery(`policies t2`+"\n"+`JOIN policies_records t5 ON t2.id = t5.policy_id`,
+			`t5.policy_id AS id`, `t2.policy_number`, `t2.insured_id`, `t5.term`, `t5.effective_date`, `t5.expiration_date`,
+			`t5.occurrence_limit`, `t5.aggregate_limit`, `t5.premium`, `t5.record_timestamp`, `t5.valid_from`, `t5.valid_to`, `t5.record_timestamp AS max_timestamp`)
+	case *entity.Claim:
+		return newQuery(`claims t2`+"\n"+`JOIN claims_records t6 ON t2.id = t6.claim_id`,
+			`t6.claim_id AS id`, `t2.insured_id`, `t6.loss_date`, `t6.description`, `t6.status`, `t6.record_timestamp`, `t6.valid_from`, `t6.valid_to`, `t6.record_timestamp AS max_timestamp`)
+	case *entity.Insured:
+		return newQuery(`insured t1`, `t1.id`, `t1.name`, `t1.policy_number`, `t1.record_timestamp`)
+	}
+	return nil
+}
+
+// policyInForce is a WHERE condition on the policy records selected by selectByBitemporalDate:
+// the date ("2006-01-02") is in the record's coverage period
+const policyInForce = `effective_date <= ? AND expiration_date > ?`
+
+// policyInsuredNotDeleted is a WHERE condition on policies t2: its insured is not deleted.
+// Deleting an insured writes no policy tombstones, so its policies are hidden with it and come back when it is restored.
+const policyInsuredNotDeleted = `EXISTS (SELECT 1 FROM insured t1 WHERE t1.id = t2.insured_id AND ` + insuredNotDeleted + `)`
+
+// selectAll selects all insureds or addresses that are not deleted
+func selectAll(src source, insuredIfaceObj entity.InsuredInterface) *Query {
+	switch insuredIfaceObj.(type) {
+	case *entity.Insured:
+		return selectRecords(src, insuredIfaceObj).Where(insuredNotDeleted).OrderBy(`t1.id`)
+	case *entity.Address:
+		return selectRecords(src, insuredIfaceObj).Where(addressNotDeleted(src)).OrderBy(`t2.id`)
+	}
+	return nil
+}
+
+// selectAllRecordsByEntityId selects every record of the entity, except tombstones
+func selectAllRecordsByEntityId(src source, insuredIfaceObj entity.InsuredInterface, entityId int64) *Query {
+	switch insuredIfaceObj.(type) {
+	case *entity.Employee:
+		return selectRecords(src, insuredIfaceObj).Where(`t3.employee_id = ?`, entityId).Where(`t3.tombstone = 0`).OrderBy(`t3.id`)
+	case *entity.Insured:
+		return selectRecords(src, insuredIfaceObj).Where(`t1.id = ?`, entityId)
+	case *entity.Address:
+		return selectRecords(src, insuredIfaceObj).Where(`t2.id = ?`, entityId).Where(`t2.tombstone = 0`)
+	case *entity.Policy:
+		return selectRecords(src, insuredIfaceObj).Where(`t5.policy_id = ?`, entityId).Where(`t5.tombstone = 0`).OrderBy(`t5.id`)
+	case *entity.Claim:
+		return selectRecords(src, insuredIfaceObj).Where(`t6.claim_id = ?`, entityId).Where(`t6.tombstone = 0`).OrderBy(`t6.id`)
+	}
+	return nil
+}
+
+// selectByIds selects insureds (deleted or not), or addresses that are not deleted, by id.
+// Employees are selected with selectByBitemporalDate.
+func selectByIds(src source, insuredIfaceObj entity.InsuredInterface, ids []int64) *Query {
+	switch insuredIfaceObj.(type) {
+	case *entity.Insured:
+		return selectRecords(src, insuredIfaceObj).WhereIn(`t1.id`, ids)
+	case *entity.Address:
+		return selectRecords(src, insuredIfaceObj).WhereIn(`t2.id`, ids).Where(addressNotDeleted(src))
+	}
+	return nil
+}
+
+// selectByBitemporalDate selects the record of each employee, address, policy, or claim in src that covers asOfValid,
+// as known at asOfRecorded. Cancelled records are ignored, and deleted entities are left out.
+// Of the records covering asOfValid, the one with the latest valid_from wins, then the latest record_timestamp.
+// condition (e.g. "t2.insured_id = ?") restricts the entities, and may be empty.
+func selectByBitemporalDate(src source, insuredIfaceObj entity.InsuredInterface, asOfValid time.Time, asOfRecorded time.Time, condition string, args ...interface{}) *Query {
+	inner := selectRecords(src, insuredIfaceObj)
+	var table, partition string
+	cancellable := true
+	switch insuredIfaceObj.(type) {
+	case *entity.Employee:
+		table, partition = `t3`, `t3.employee_id`
+	case *entity.Address:
+		table, partition = `t2`, `t2.address_id`
+	case *entity.Policy:
+		table, partition = `t5`, `t5.policy_id`
+	case *entity.Claim:
+		table, partition, cancellable = `t6`, `t6.claim_id`, false
+	default:
+		return nil
+	}
+	inner.columns = append(inner.columns[:len(inner.columns)-1], // no max_timestamp
+		table+`.tombstone`,
+		`ROW_NUMBER() OVER (PARTITION BY `+partition+` ORDER BY `+table+`.valid_from DESC, `+table+`.record_timestamp DESC, `+table+`.id DESC) AS row_num`)
+	if condition != "" {
+		inner.Where(condition, args...)
+	}
+	recorded, valid := asOfRecorded.Unix(), asOfValid.Unix()
+	inner.Where(table+`.record_timestamp <= ?`, recorded).
+		Where(table+`.valid_from <= ?`, valid).
+		Where(`(`+table+`.valid_to IS NULL OR `+table+`.valid_to > ?)`, valid)
+	if cancellable {
+		inner.Where(`NOT EXISTS (SELECT 1 FROM `+cancellations(insuredIfaceObj.GetDataTableName())+` c WHERE c.record_id = `+table+`.id AND c.record_timestamp <= ?)`, recorded)
+	}
+
+	switch insuredIfaceObj.(type) {
+	case *entity.Employee:
+		return newQuery(``, `id`, `record_id`, `insured_id`, `name`, `start_date`, `end_date`, `job_class_code`, `annual_payroll`, `work_location`, `record_timestamp`, `valid_from`, `valid_to`, `record_timestamp AS max_timestamp`).
+			FromQuery(inner).
+			Where(`row_num = 1 AND tombstone = 0`).
+			OrderBy(`id`)
+	case *entity.Policy:
+		return newQuery(``, `id`, `policy_number`, `insured_id`, `term`, `effective_date`, `expiration_date`,
+			`occurrence_limit`, `aggregate_limit`, `premium`, `record_timestamp`, `valid_from`, `valid_to`, `record_timestamp AS max_timestamp`).
+			FromQuery(inner).
+			Where(`row_num = 1 AND tombstone = 0`).
+			OrderBy(`id`)
+	case *entity.Claim:
+		return newQuery(``, `id`, `insured_id`, `loss_date`, `description`, `status`, `record_timestamp`, `valid_from`, `valid_to`, `record_timestamp AS max_timestamp`).
+			FromQuery(inner).
+			Where(`row_num = 1 AND tombstone = 0`).
+			OrderBy(`id`)
+	default:
+		return newQuery(``, `id`, `address_id`, `type`, `address`, `line1`, `line2`, `city`, `region`, `postal_code`, `country`, `insured_id`, `record_timestamp`, `valid_from`, `valid_to`, `record_timestamp AS max_timestamp`).
+			FromQuery(inner).
+			Where(`row_num = 1 AND tombstone = 0`).
+			OrderBy(`address_id`)
+	}
+}
+
+// cancellations returns the table of the cancellations of the records in recordsTable.
+// Records are never changed: a cancellation is a row of its own, and the earliest one cancels the record.
+func cancellations(recordsTable string) string {
+	return recordsTable + `_cancellations`
+}
+
+// selectPending selects employee or address records recorded by, and taking effect after, asOf, that are not cancelled.
+// condition (e.g. "t2.insured_id = ?") restricts the records.
+func selectPending(insuredIfaceObj entity.InsuredInterface, asOf time.Time, condition string, args ...interface{}) *Query {
+	var q *Query
+	var table string
+	switch insuredIfaceObj.(type) {
+	case *entity.Employee:
+		table = `t3`
+		q = newQuery(`employees t2`+"\n"+`JOIN employees_records t3 ON t2.id = t3.employee_id`,
+			`t3.employee_id AS id`, `t3.id AS record_id`, `t2.insured_id`, `t3.name`, `t3.start_date`, `t3.end_date`, `t3.job_class_code`, `t3.annual_payroll`, `t3.work_location`,
+			`t3.record_timestamp`, `t3.valid_from`, `t3.valid_to`)
+	case *entity.Address:
+		table = `t2`
+		q = newQuery(`insured_addresses_records t2`+"\n"+`JOIN insured_addresses t4 ON t4.id = t2.address_id`,
+			`t2.id`, `t2.id AS record_id`, `t2.address_id`, `t4.type`, `t2.address`, `t2.line1`, `t2.line2`, `t2.city`, `t2.region`, `t2.postal_code`, `t2.country`, `t2.insured_id`, `t2.record_timestamp`, `t2.valid_from`, `t2.valid_to`)
+	default:
+		return nil
+	}
+	return q.Where(condition, args...).
+		Where(table+`.record_timestamp <= ?`, asOf.Unix()).
+		Where(table+`.valid_from > ?`, asOf.Unix()).
+		Where(`NOT EXISTS (SELECT 1 FROM `+cancellations(insuredIfaceObj.GetDataTableName())+` c WHERE c.record_id = `+table+`.id)`).
+		OrderBy(table+`.valid_from`, table+`.id`)
+}
+
+// TemporalQueries are the reads of one insured's, employee's, policy's, or claim's records, by name, without the archive.
+// Each should find its rows with an index rather than scan a table.
+func TemporalQueries(asOf time.Time) map[string]*Query {
+	return map[string]*Query{
+		"employee by date":     selectByBitemporalDate(source{}, &entity.Employee{}, asOf, asOf, "t2.id = ?", 1),
+		"employees by date":    selectByBitemporalDate(source{}, &entity.Employee{}, asOf, asOf, "t2.insured_id = ?", 1),
+		"addresses by date":    selectByBitemporalDate(source{}, &entity.Address{}, asOf, asOf, "t2.insured_id = ?", 1),
+		"employee history":     selectAllRecordsByEntityId(source{}, &entity.Employee{}, 1),
+		"address by id":        selectByIds(source{}, &entity.Address{}, []int64{1}),
+		"insured by id":        selectByIds(source{}, &entity.Insured{}, []int64{1}),
+		"pending employees":    selectPending(&entity.Employee{}, asOf, "t2.insured_id = ?", 1),
+		"pending addresses":    selectPending(&entity.Address{}, asOf, "t2.insured_id = ?", 1),
+		"employee timeline":    employeeTimelineQuery(source{}, 1),
+		"address timeline":     addressTimelineQuery(source{}, 1),
+		"addresses of insured": selectRecords(source{}, &entity.Address{}).Where(`t2.insured_id = ?`, 1).Where(addressNotDeleted(source{})),
+		"policy by date":       selectByBitemporalDate(source{}, &entity.Policy{}, asOf, asOf, "t2.id = ?", 1),
+		"policies by date":     selectByBitemporalDate(source{}, &entity.Policy{}, asOf, asOf, "t2.insured_id = ?", 1),
+		"policy history":       selectAllRecordsByEntityId(source{}, &entity.Policy{}, 1),
+		"claim by date":        selectByBitemporalDate(source{}, &entity.Claim{}, asOf, asOf, "t2.id = ?", 1),
+		"claim history":        selectAllRecordsByEntityId(source{}, &entity.Claim{}, 1),
+	}
+}
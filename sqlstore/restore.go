@@ -0,0 +1,259 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// RestoreById re-materializes the insured, employee, or address as it was valid at asOf (as known now)
+// by appending new records effective now. Existing records are never modified, except that
+// pending (future-dated) changes to restored entities are cancelled.
+// Works for deleted entities and for entities changed by bad updates since asOf.
+// Restoring an insured also restores its employees and addresses, and deletes employees and addresses added after asOf.
+// For addresses, id is any record id of the address.
+func (db *DB) RestoreById(ctx context.Context, insuredObj entity.InsuredInterface, id int64, asOf time.Time) (restored entity.InsuredInterface, err error) {
+	if id == 0 {
+		return insuredObj, ErrRecordIDInvalid
+	}
+	now := db.Now()
+	if asOf.After(now) {
+		return insuredObj, ErrRecordMatchingCriteriaDoesNotExist
+	}
+
+	// read everything before writing: reads use their own connections
+	switch insuredObj.(type) {
+	case *entity.Employee:
+		then, current, err := db.employeeThenAndNow(ctx, id, asOf, now)
+		if err != nil {
+			return insuredObj, err
+		}
+		if err := db.checkInsuredNotDeleted(ctx, int64(then.InsuredId), now); err != nil {
+			return insuredObj, err
+		}
+		if sameEmployee(then, current) {
+			return insuredObj, ErrUpdateMustChangeAValue
+		}
+		err = db.inTx(ctx, func(tx *Tx) error {
+			return restoreEmployee(ctx, tx, then, now)
+		})
+		if err != nil {
+			return insuredObj, err
+		}
+		return db.GetEmployeeById(ctx, entity.Employee{}, id)
+	case *entity.Address:
+		insuredId, addressId, err := db.addressOfRecord(ctx, id)
+		if err != nil {
+			return insuredObj, err
+		}
+		if err := db.checkInsuredNotDeleted(ctx, insuredId, now); err != nil {
+			return insuredObj, err
+		}
+		then, current, err := db.addressThenAndNow(ctx, insuredId, addressId, asOf, now)
+		if err != nil {
+			return insuredObj, err
+		}
+		if then == nil {
+			return insuredObj, ErrRecordMatchingCriteriaDoesNotExist
+		}
+		if current != nil && current.SameAddress(*then) {
+			return insuredObj, ErrUpdateMustChangeAValue
+		}
+		err = db.inTx(ctx, func(tx *Tx) error {
+			return restoreAddress(ctx, tx, then, now)
+		})
+		if err != nil {
+			return insuredObj, err
+		}
+		return then, nil
+	case *entity.Insured:
+		return db.restoreInsured(ctx, id, asOf, now)
+	}
+	return insuredObj, fmt.Errorf("Server error.")
+}
+
+// restoreInsured restores the insured, its employees, and its addresses as they were at asOf
+func (db *DB) restoreInsured(ctx context.Context, id int64, asOf time.Time, now time.Time) (*entity.Insured, error) {
+	then, err := db.GetInsuredByBitemporalDate(ctx, id, asOf, now)
+	if err != nil {
+		return &entity.Insured{}, err
+	}
+	deleted, err := db.insuredDeletedAt(ctx, id, now, now)
+	if err != nil {
+		return &entity.Insured{}, err
+	}
+	// current employees and addresses. A deleted insured has none.
+	currentEmployees := map[int]entity.InsuredInterface{}
+	currentAddresses := map[int]entity.InsuredInterface{}
+	if !deleted {
+		if currentEmployees, err = db.GetByBitemporalDate(ctx, &entity.Employee{}, id, now, now); err != nil {
+			return &entity.Insured{}, err
+		}
+		if currentAddresses, err = db.GetByBitemporalDate(ctx, &entity.Address{}, id, now, now); err != nil {
+			return &entity.Insured{}, err
+		}
+	}
+	current := map[int]entity.Employee{}
+	for _, obj := range currentEmployees {
+		employee := obj.(*entity.Employee)
+		current[employee.ID] = *employee
+	}
+	currentAddress := map[int]entity.Address{}
+	for _, obj := range currentAddresses {
+		address := obj.(*entity.Address)
+		currentAddress[address.AddressId] = *address
+	}
+
+	changed := deleted
+	err = db.inTx(ctx, func(tx *Tx) error {
+		if deleted {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO insured_tombstones (insured_id, record_timestamp, restore) VALUES (?, ?, 1)`, id, now.Unix()); err != nil {
+				return tx.db.FormatError(err)
+			}
+		}
+		for _, employee := range *then.Employees {
+			employee := employee
+			if currentEmployee, ok := current[employee.ID]; ok {
+				delete(current, employee.ID)
+				if sameEmployee(&employee, &currentEmployee) {
+					continue
+				}
+			}
+			changed = true
+			if err := restoreEmployee(ctx, tx, &employee, now); err != nil {
+				return err
+			}
+		}
+		for _, employee := range current { // added after asOf
+			employee := employee
+			changed = true
+			if err := deleteEmployee(ctx, tx, &employee, now); err != nil {
+				return err
+			}
+		}
+		for _, address := range *then.Addresses {
+			address := address
+			if current, ok := currentAddress[address.AddressId]; ok {
+				delete(currentAddress, address.AddressId)
+				if current.SameAddress(address) {
+					continue
+				}
+			}
+			changed = true
+			if err := restoreAddress(ctx, tx, &address, now); err != nil {
+				return err
+			}
+		}
+		for _, address := range currentAddress { // added after asOf
+			address := address
+			changed = true
+			if err := deleteAddress(ctx, tx, &address, now); err != nil {
+				return err
+			}
+		}
+		if !changed {
+			return ErrUpdateMustChangeAValue
+		}
+		return nil
+	})
+	if err != nil {
+		return &entity.Insured{}, err
+	}
+	restored, err := db.GetInsuredByBitemporalDate(ctx, id, now, now)
+	return &restored, err
+}
+
+// restoreEmployee appends a copy of the employee record, effective now
+func restoreEmployee(ctx context.Context, tx *Tx, employee *entity.Employee, now time.Time) error {
+	if err := cancelPending(ctx, tx, employee.GetDataTableName(), "employee_id", employee.ID, now); err != nil {
+		return err
+	}
+	restored := *employee
+	restored.RecordTimestamp = now
+	restored.ValidFrom = now
+	restored.ValidTo = time.Time{}
+	_, err := updateEmployee(ctx, tx, &restored)
+	return err
+}
+
+// restoreAddress appends a copy of the address record, effective now.
+// Sets the address's ID to the new record id.
+func restoreAddress(ctx context.Context, tx *Tx, address *entity.Address, now time.Time) error {
+	if err := cancelPending(ctx, tx, address.GetDataTableName(), "address_id", address.AddressId, now); err != nil {
+		return err
+	}
+	address.RecordTimestamp = now
+	address.ValidFrom = now
+	address.ValidTo = time.Time{}
+	_, err := createAddress(ctx, tx, address)
+	return err
+}
+
+// employeeThenAndNow returns the employee valid at asOf and now, both as known now.
+// Current employee has ID 0 if deleted.
+func (db *DB) employeeThenAndNow(ctx context.Context, id int64, asOf time.Time, now time.Time) (then *entity.Employee, current *entity.Employee, err error) {
+	then, err = db.GetEmployeeByBitemporalDate(ctx, entity.Employee{}, id, asOf, now)
+	if err != nil {
+		return then, current, err
+	}
+	if then.ID == 0 {
+		return then, current, ErrRecordMatchingCriteriaDoesNotExist
+	}
+	current, err = db.GetEmployeeByBitemporalDate(ctx, entity.Employee{}, id, now, now)
+	return then, current, err
+}
+
+// addressThenAndNow returns the insured's address valid at asOf and now, both as known now. Either may be nil.
+func (db *DB) addressThenAndNow(ctx context.Context, insuredId int64, addressId int64, asOf time.Time, now time.Time) (then *entity.Address, current *entity.Address, err error) {
+	thenRecords, err := db.GetByBitemporalDate(ctx, &entity.Address{}, insuredId, asOf, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, obj := range thenRecords {
+		if address := obj.(*entity.Address); int64(address.AddressId) == addressId {
+			then = address
+		}
+	}
+	currentRecords, err := db.GetByBitemporalDate(ctx, &entity.Address{}, insuredId, now, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, obj := range currentRecords {
+		if address := obj.(*entity.Address); int64(address.AddressId) == addressId {
+			current = address
+		}
+	}
+	return then, current, nil
+}
+
+// addressOfRecord returns the insured id and address id of an address record, including tombstones
+func (db *DB) addressOfRecord(ctx context.Context, recordId int64) (insuredId int64, addressId int64, err error) {
+	err = db.queryRowContext(ctx, `SELECT insured_id, address_id FROM insured_addresses_records WHERE id = ?`, recordId).Scan(&insuredId, &addressId)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrRecordDoesNotExist
+	}
+	return insuredId, addressId, err
+}
+
+// checkInsuredNotDeleted returns ErrInsuredDeleted if the insured is deleted now.
+// Employees and addresses of a deleted insured are restored with the insured.
+func (db *DB) checkInsuredNotDeleted(ctx context.Context, insuredId int64, now time.Time) error {
+	deleted, err := db.insuredDeletedAt(ctx, insuredId, now, now)
+	if err != nil {
+		return err
+	} else if deleted {
+		return ErrInsuredDeleted
+	}
+	return nil
+}
+
+// sameEmployee returns true if the employees' time-travelable values are equal. A nil or zero employee is deleted.
+func sameEmployee(a *entity.Employee, b *entity.Employee) bool {
+	if a == nil || b == nil || a.ID == 0 || b.ID == 0 {
+		return false
+	}
+	return a.SameEmployee(b)
+}
@@ -0,0 +1,202 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// GetSnapshot returns every insured matching filter as it was at asOf, with its employees and addresses.
+// Also returns the total count of matching insureds, which may differ if filter.Limit is set.
+func (db *DB) GetSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter) (insureds []entity.Insured, total int, err error) {
+	insureds = make([]entity.Insured, 0)
+	total, err = db.StreamSnapshot(ctx, asOf, filter, func(insured entity.Insured, _ int) error {
+		insureds = append(insureds, insured)
+		return nil
+	})
+	return insureds, total, err
+}
+
+// snapshotBatch is how many insureds StreamSnapshot reads at a time
+const snapshotBatch = 500
+
+// StreamSnapshot is GetSnapshot calling fn with each insured, in id order, as it is read.
+// fn also receives the total count of matching insureds. An error from fn stops the stream.
+// Insureds are included if created by asOf and not deleted at asOf.
+// Insureds are read in batches: one query for a batch's insureds, one for their employees and one for their addresses,
+// merged by insured id. The total is counted with another query. All read the same state of the database.
+func (db *DB) StreamSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter, fn func(insured entity.Insured, total int) error) (total int, err error) {
+	src := db.source(asOf)
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query, args := selectSnapshotInsureds(src, asOf, filter).Count()
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("Query failed")
+	}
+
+	// batches after the first start past the last insured read, rather than at an offset
+	offset, remaining := filter.Offset, filter.Limit
+	var after int64
+	for filter.Limit == 0 || remaining > 0 {
+		limit := snapshotBatch
+		if filter.Limit > 0 && remaining < limit {
+			limit = remaining
+		}
+		page := selectSnapshotInsureds(src, asOf, filter).
+			Where(`t1.id > ?`, after).
+			OrderBy(`t1.id`).
+			LimitOffset(limit, offset)
+		insureds, err := snapshotBatchRead(ctx, tx, src, asOf, page)
+		if err != nil {
+			return total, err
+		}
+		for _, insured := range insureds {
+			if err := fn(insured, total); err != nil {
+				return total, err
+			}
+		}
+		if len(insureds) < limit {
+			break
+		}
+		after = int64(insureds[len(insureds)-1].ID)
+		offset, remaining = 0, remaining-len(insureds)
+	}
+	return total, nil
+}
+
+// snapshotBatchRead returns the insureds selected by page, in id order, with their employees and addresses at asOf
+func snapshotBatchRead(ctx context.Context, tx *Tx, src source, asOf time.Time, page *Query) (insureds []entity.Insured, err error) {
+	query, args := newQuery(`page p`, `p.id`, `p.name`, `p.policy_number`, `p.record_timestamp`).
+		With(`page`, page).
+		OrderBy(`p.id`).
+		Build()
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Query failed")
+	}
+	defer rows.Close()
+
+	byId := make(map[int]*entity.Insured)
+	for rows.Next() {
+		var insured entity.Insured
+		if err := rows.Scan(&insured.ID, &insured.Name, &insured.PolicyNumber, (*NullTime)(&insured.RecordTimestamp)); err != nil {
+			return nil, err
+		}
+		employees := make(map[int]entity.Employee)
+		addresses := make(map[int]entity.Address)
+		insured.Employees, insured.Addresses = &employees, &addresses
+		insureds = append(insureds, insured)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rowsErr: %v", err)
+	}
+	rows.Close()
+	if len(insureds) == 0 {
+		return insureds, nil
+	}
+	for i := range insureds {
+		byId[insureds[i].ID] = &insureds[i]
+	}
+
+	query, args = newQuery(`employees_at e`,
+		`e.insured_id`, `e.id`, `e.name`, `e.start_date`, `e.end_date`, `e.job_class_code`, `e.annual_payroll`, `e.work_location`, `e.record_timestamp`, `e.valid_from`, `e.valid_to`).
+		With(`page`, page).
+		With(`employees_at`, selectByBitemporalDate(src, &entity.Employee{}, asOf, asOf, `t2.insured_id IN (SELECT id FROM page)`)).
+		OrderBy(`e.insured_id`, `e.id`).
+		Build()
+	rows, err = tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Query failed")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var employee entity.Employee
+		if err := rows.Scan(
+			&employee.InsuredId,
+			&employee.ID,
+			&employee.Name,
+			(*ShortTime)(&employee.StartDate),
+			(*ShortTime)(&employee.EndDate),
+			&employee.JobClassCode,
+			&employee.AnnualPayroll,
+			&employee.WorkLocation,
+			(*NullTime)(&employee.RecordTimestamp),
+			(*NullTime)(&employee.ValidFrom),
+			(*NullTime)(&employee.ValidTo),
+		); err != nil {
+			return nil, err
+		}
+		employees := *byId[employee.InsuredId].Employees
+		employees[len(employees)] = employee
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rowsErr: %v", err)
+	}
+	rows.Close()
+
+	query, args = newQuery(`addresses_at a`,
+		`a.insured_id`, `a.id`, `a.address_id`, `a.type`, `a.address`, `a.line1`, `a.line2`, `a.city`, `a.region`, `a.postal_code`, `a.country`, `a.record_timestamp`, `a.valid_from`, `a.valid_to`).
+		With(`page`, page).
+		With(`addresses_at`, selectByBitemporalDate(src, &entity.Address{}, asOf, asOf, `t2.insured_id IN (SELECT id FROM page)`)).
+		OrderBy(`a.insured_id`, `a.address_id`).
+		Build()
+	rows, err = tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Query failed")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var address entity.Address
+		if err := rows.Scan(
+			&address.InsuredId,
+			&address.ID,
+			&address.AddressId,
+			&address.Type,
+			&address.Address,
+			&address.Line1,
+			&address.Line2,
+			&address.City,
+			&address.Region,
+			&address.PostalCode,
+			&address.Country,
+			(*NullTime)(&address.RecordTimestamp),
+			(*NullTime)(&address.ValidFrom),
+			(*NullTime)(&address.ValidTo),
+		); err != nil {
+			return nil, err
+		}
+		addresses := *byId[address.InsuredId].Addresses
+		addresses[len(addresses)] = address
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rowsErr: %v", err)
+	}
+	return insureds, nil
+}
+
+// selectSnapshotInsureds selects every insured matching filter at asOf: created by asOf, and not deleted at asOf
+func selectSnapshotInsureds(src source, asOf time.Time, filter entity.InsuredFilter) *Query {
+	insureds := selectRecords(src, &entity.Insured{}).
+		Where(`t1.record_timestamp <= ?`, asOf.Unix()).
+		Where(`COALESCE((SELECT d.restore FROM insured_tombstones d WHERE d.insured_id = t1.id AND d.record_timestamp <= ? ORDER BY d.id DESC LIMIT 1), 1) = 1`, asOf.Unix())
+	if v := filter.ID; v != nil {
+		insureds.Where(`t1.id = ?`, *v)
+	}
+	if v := filter.PolicyNumber; v != nil {
+		insureds.Where(`t1.policy_number = ?`, *v)
+	}
+	if v := filter.RecordTimestamp; v != nil {
+		insureds.Where(`t1.record_timestamp < ?`, *v)
+	}
+	if v := filter.Name; v != nil {
+		insureds.Where(`t1.name = ?`, *v)
+	}
+	return insureds
+}
@@ -0,0 +1,253 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// Sources of timeline events, in the order events recorded at the same time are listed
+const (
+	timelineInsured = iota
+	timelineEmployee
+	timelineAddress
+	timelineTombstone // after its employees and address, which are deleted with it
+)
+
+// GetTimeline merges the insured's creation and every employee and address record into one
+// stream of events, sorted by the time they were recorded. Also returns total count of events
+// in the filter's window, which may differ from returned results if filter.Limit is specified.
+// Events are ordered, counted, and paged by the database. Events recorded at the same time are
+// listed in the same order whether the timeline is ascending or descending.
+func (db *DB) GetTimeline(ctx context.Context, insuredId int64, filter entity.TimelineFilter) (events []entity.TimelineEvent, n int, err error) {
+	if insuredId == 0 {
+		return nil, 0, ErrRecordDoesNotExist
+	}
+	insured, err := db.getInsuredById(ctx, entity.Insured{}, insuredId) // deleted insureds have a timeline too
+	if err != nil {
+		return nil, 0, err
+	}
+	// timeline shows the insured as created, without employees or addresses
+	insured.Employees = &map[int]entity.Employee{}
+	insured.Addresses = &map[int]entity.Address{}
+
+	// one snapshot of the database for every query below
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	src := db.source()
+	query, args := timelineQuery(src, insuredId, filter).Count()
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return nil, 0, fmt.Errorf("Query failed")
+	}
+	query, args = timelineQuery(src, insuredId, filter).
+		LimitOffset(filter.Limit, filter.Offset).
+		Build()
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Query failed")
+	}
+	defer rows.Close()
+
+	events = []entity.TimelineEvent{}
+	var sources []int
+	var employeeIds, addressIds []int64
+	for rows.Next() {
+		var event entity.TimelineEvent
+		var source int
+		if err := rows.Scan(&source, &event.Type, (*NullTime)(&event.Timestamp), &event.RecordId); err != nil {
+			return nil, 0, err
+		}
+		switch source {
+		case timelineEmployee:
+			employeeIds = append(employeeIds, int64(event.RecordId))
+		case timelineAddress:
+			addressIds = append(addressIds, int64(event.RecordId))
+		default:
+			event.Resource = insured
+		}
+		events = append(events, event)
+		sources = append(sources, source)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("rowsErr: %v", err)
+	}
+	rows.Close()
+
+	// the records of the page's events only
+	employees, err := employeeTimeline(ctx, tx, insuredId, employeeIds)
+	if err != nil {
+		return nil, 0, err
+	}
+	addresses, err := addressTimeline(ctx, tx, insuredId, addressIds)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range events {
+		switch sources[i] {
+		case timelineEmployee:
+			events[i].Resource = employees[events[i].RecordId]
+		case timelineAddress:
+			events[i].Resource = addresses[events[i].RecordId]
+		}
+	}
+	return events, n, nil
+}
+
+// timelineQuery selects the source, type, timestamp, and record id of every event of the insured in filter's window,
+// ordered by timestamp. Ties are broken by source, then record id, then a record before its cancellation.
+// Employee and address events are created after no record or a tombstone, and updated otherwise.
+func timelineQuery(src source, insuredId int64, filter entity.TimelineFilter) *Query {
+	employees := `employees t2` + "\n" + `JOIN ` + src.records(`employees_records`) + ` t3 ON t2.id = t3.employee_id`
+	addresses := src.records(`insured_addresses_records`) + ` t2`
+
+	q := newQuery(``, `sub.source`, `sub.event_type`, `sub.record_timestamp`, `sub.record_id`).FromUnion(
+		newQuery(`insured t1`,
+			fmt.Sprint(timelineInsured)+` AS source`, `'`+entity.EventInsuredCreated+`' AS event_type`, `t1.record_timestamp`, `t1.id AS record_id`, `0 AS seq`).
+			Where(`t1.id = ?`, insuredId),
+		newQuery(employees,
+			fmt.Sprint(timelineEmployee),
+			`CASE WHEN t3.tombstone = 1 THEN '`+entity.EventEmployeeDeleted+`'`+
+				` WHEN COALESCE(LAG(t3.tombstone) OVER (PARTITION BY t3.employee_id ORDER BY t3.record_timestamp, t3.id), 1) = 1 THEN '`+entity.EventEmployeeCreated+`'`+
+				` ELSE '`+entity.EventEmployeeUpdated+`' END`,
+			`t3.record_timestamp`, `t3.id`, `0`).
+			Where(`t2.insured_id = ?`, insuredId),
+		newQuery(employees+"\n"+`JOIN `+cancellations(`employees_records`)+` c ON c.record_id = t3.id`,
+			fmt.Sprint(timelineEmployee), `'`+entity.EventEmployeeCancelled+`'`, `MIN(c.record_timestamp)`, `t3.id`, `1`).
+			Where(`t2.insured_id = ?`, insuredId).
+			GroupBy(`t3.id`),
+		newQuery(addresses,
+			fmt.Sprint(timelineAddress),
+			`CASE WHEN t2.tombstone = 1 THEN '`+entity.EventAddressDeleted+`'`+
+				` WHEN COALESCE(LAG(t2.tombstone) OVER (PARTITION BY t2.address_id ORDER BY t2.record_timestamp, t2.id), 1) = 1 THEN '`+entity.EventAddressCreated+`'`+
+				` ELSE '`+entity.EventAddressUpdated+`' END`,
+			`t2.record_timestamp`, `t2.id`, `0`).
+			Where(`t2.insured_id = ?`, insuredId),
+		newQuery(addresses+"\n"+`JOIN `+cancellations(`insured_addresses_records`)+` c ON c.record_id = t2.id`,
+			fmt.Sprint(timelineAddress), `'`+entity.EventAddressCancelled+`'`, `MIN(c.record_timestamp)`, `t2.id`, `1`).
+			Where(`t2.insured_id = ?`, insuredId).
+			GroupBy(`t2.id`),
+		newQuery(`insured_tombstones d`,
+			fmt.Sprint(timelineTombstone),
+			`CASE WHEN d.restore = 1 THEN '`+entity.EventInsuredRestored+`' ELSE '`+entity.EventInsuredDeleted+`' END`,
+			`d.record_timestamp`, `d.id`, `0`).
+			Where(`d.insured_id = ?`, insuredId),
+	)
+	if !filter.From.IsZero() {
+		// timestamps are whole seconds: the first one not before From
+		from := filter.From.Unix()
+		if filter.From.Nanosecond() > 0 {
+			from++
+		}
+		q.Where(`sub.record_timestamp >= ?`, from)
+	}
+	if !filter.To.IsZero() {
+		q.Where(`sub.record_timestamp <= ?`, filter.To.Unix())
+	}
+	if filter.Descending {
+		return q.OrderBy(`sub.record_timestamp DESC`, `sub.source`, `sub.record_id`, `sub.seq`)
+	}
+	return q.OrderBy(`sub.record_timestamp`, `sub.source`, `sub.record_id`, `sub.seq`)
+}
+
+// employeeTimelineQuery selects every employee record of the insured in src, in the order recorded
+func employeeTimelineQuery(src source, insuredId int64) *Query {
+	return newQuery(`employees t2`+"\n"+`JOIN `+src.records(`employees_records`)+` t3 ON t2.id = t3.employee_id`,
+		`t3.employee_id`, `t3.id`, `t2.insured_id`, `t3.name`, `t3.start_date`, `t3.end_date`, `t3.job_class_code`, `t3.annual_payroll`, `t3.work_location`, `t3.record_timestamp`, `t3.valid_from`, `t3.valid_to`).
+		Where(`t2.insured_id = ?`, insuredId).
+		OrderBy(`t3.record_timestamp`, `t3.id`)
+}
+
+// employeeTimeline returns the employee records of the insured with the given record ids, by record id
+func employeeTimeline(ctx context.Context, tx *Tx, insuredId int64, recordIds []int64) (employees map[int]*entity.Employee, err error) {
+	employees = make(map[int]*entity.Employee)
+	if len(recordIds) == 0 {
+		return employees, nil
+	}
+	query, args := employeeTimelineQuery(tx.db.source(), insuredId).WhereIn(`t3.id`, recordIds).Build()
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Query failed")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		employee := entity.Employee{}
+		var recordId int
+		if err := rows.Scan(
+			&employee.ID,
+			&recordId,
+			&employee.InsuredId,
+			&employee.Name,
+			(*ShortTime)(&employee.StartDate),
+			(*ShortTime)(&employee.EndDate),
+			&employee.JobClassCode,
+			&employee.AnnualPayroll,
+			&employee.WorkLocation,
+			(*NullTime)(&employee.RecordTimestamp),
+			(*NullTime)(&employee.ValidFrom),
+			(*NullTime)(&employee.ValidTo),
+		); err != nil {
+			return nil, err
+		}
+		employees[recordId] = &employee
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rowsErr: %v", err)
+	}
+	return employees, nil
+}
+
+// addressTimelineQuery selects every address record of the insured in src, in the order recorded
+func addressTimelineQuery(src source, insuredId int64) *Query {
+	return newQuery(src.records(`insured_addresses_records`)+` t2`+"\n"+`JOIN insured_addresses t4 ON t4.id = t2.address_id`,
+		`t2.id`, `t2.address_id`, `t4.type`, `t2.address`, `t2.line1`, `t2.line2`, `t2.city`, `t2.region`, `t2.postal_code`, `t2.country`, `t2.insured_id`, `t2.record_timestamp`, `t2.valid_from`, `t2.valid_to`).
+		Where(`t2.insured_id = ?`, insuredId).
+		OrderBy(`t2.record_timestamp`, `t2.id`)
+}
+
+// addressTimeline returns the address records of the insured with the given record ids, by record id
+func addressTimeline(ctx context.Context, tx *Tx, insuredId int64, recordIds []int64) (addresses map[int]*entity.Address, err error) {
+	addresses = make(map[int]*entity.Address)
+	if len(recordIds) == 0 {
+		return addresses, nil
+	}
+	query, args := addressTimelineQuery(tx.db.source(), insuredId).WhereIn(`t2.id`, recordIds).Build()
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Query failed")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		address := entity.Address{}
+		if err := rows.Scan(
+			&address.ID,
+			&address.AddressId,
+			&address.Type,
+			&address.Address,
+			&address.Line1,
+			&address.Line2,
+			&address.City,
+			&address.Region,
+			&address.PostalCode,
+			&address.Country,
+			&address.InsuredId,
+			(*NullTime)(&address.RecordTimestamp),
+			(*NullTime)(&address.ValidFrom),
+			(*NullTime)(&address.ValidTo),
+		); err != nil {
+			return nil, err
+		}
+		addresses[address.ID] = &address
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rowsErr: %v", err)
+	}
+	return addresses, nil
+}
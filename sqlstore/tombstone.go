@@ -0,0 +1,260 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+)
+
+// insuredNotDeleted is a WHERE condition on insured t1: it has no tombstone, or was restored since
+const insuredNotDeleted = `COALESCE((SELECT d.restore FROM insured_tombstones d WHERE d.insured_id = t1.id ORDER BY d.id DESC LIMIT 1), 1) = 1`
+
+// addressNotDeleted is a WHERE condition on insured_addresses_records t2:
+// it is not a tombstone, and no tombstone for its address was written after it in src
+func addressNotDeleted(src source) string {
+	return `t2.tombstone = 0 AND NOT EXISTS (SELECT 1 FROM ` + src.records(`insured_addresses_records`) + ` d WHERE d.address_id = t2.address_id AND d.tombstone = 1 AND d.id > t2.id)`
+}
+
+// DeleteById soft deletes the insured, employee, address, or policy by writing a tombstone recorded now.
+// History is kept: the entity can still be seen as of any time before the deletion.
+// Deleting an insured also deletes its employees and addresses. Deleting an address record deletes its address.
+// Pending (future-dated) changes to deleted entities are cancelled.
+func (db *DB) DeleteById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (deletedRecord entity.InsuredInterface, err error) {
+	if id == 0 {
+		return deletedRecord, ErrRecordIDInvalid
+	}
+	deletedRecord, err = db.GetById(ctx, insuredObj, id)
+	if err != nil || deletedRecord == nil || deletedRecord.GetId() == 0 {
+		return insuredObj, ErrRecordDoesNotExist
+	}
+
+	now := db.Now()
+	var current entity.Insured
+	if insured, ok := deletedRecord.(*entity.Insured); ok {
+		// read before writing: reads use their own connections
+		if current, err = db.GetInsuredByBitemporalDate(ctx, int64(insured.ID), now, now); err != nil {
+			return deletedRecord, err
+		}
+	}
+	err = db.inTx(ctx, func(tx *Tx) error {
+		switch obj := deletedRecord.(type) {
+		case *entity.Employee:
+			return deleteEmployee(ctx, tx, obj, now)
+		case *entity.Address:
+			return deleteAddress(ctx, tx, obj, now)
+		case *entity.Policy:
+			return deletePolicy(ctx, tx, obj, now)
+		case *entity.Insured:
+			return deleteInsured(ctx, tx, &current, now)
+		}
+		return fmt.Errorf("Server error.")
+	})
+	return deletedRecord, err
+}
+
+// DeletePreviewById returns what DeleteById would delete now, without deleting anything
+func (db *DB) DeletePreviewById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (preview entity.DeletePreview, err error) {
+	if id == 0 {
+		return preview, ErrRecordIDInvalid
+	}
+	record, err := db.GetById(ctx, insuredObj, id)
+	if err != nil || record == nil || record.GetId() == 0 {
+		return preview, ErrRecordDoesNotExist
+	}
+	preview.Resource = record
+	switch obj := record.(type) {
+	case *entity.Employee:
+		preview.EmployeeRecords = 1
+	case *entity.Address:
+		preview.AddressRecords = 1
+	case *entity.Insured:
+		now := db.Now()
+		current, err := db.GetInsuredByBitemporalDate(ctx, int64(obj.ID), now, now)
+		if err != nil {
+			return preview, err
+		}
+		preview.EmployeeRecords = len(*current.Employees)
+		preview.AddressRecords = len(*current.Addresses)
+	}
+	return preview, nil
+}
+
+// PurgeById permanently deletes the insured, employee, address, policy, or claim record and all of its history.
+// Unlike DeleteById, this cannot be undone and earlier times can no longer be seen.
+func (db *DB) PurgeById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) error {
+	if id == 0 {
+		return ErrRecordIDInvalid
+	}
+	tableName := insuredObj.GetIdentTableName()
+	return db.inTx(ctx, func(tx *Tx) error {
+		if _, ok := insuredObj.(*entity.Address); ok {
+			if err := purgeAddress(ctx, tx, id); err != nil {
+				return err
+			}
+		} else {
+			result, err := tx.ExecContext(ctx, `DELETE FROM `+tableName+` WHERE id = ?`, id) // ON DELETE CASCADE removes records and tombstones
+			if err != nil {
+				return fmt.Errorf("Server error.")
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("Server error.")
+			}
+			if rows == 0 {
+				return ErrRecordDoesNotExist
+			}
+		}
+		if db.Archive != nil {
+			if err := db.Archive.Purge(ctx, tx); err != nil {
+				return fmt.Errorf("Server error.")
+			}
+		}
+		if err := purgeCancellations(ctx, tx); err != nil {
+			return fmt.Errorf("Server error.")
+		}
+		return nil
+	})
+}
+
+// purgeAddress deletes every record of the address that the record id belongs to, its tombstones, and the address.
+// Address records have no foreign key to the address, so nothing cascades.
+func purgeAddress(ctx context.Context, tx *Tx, id int64) error {
+	var addressId int64
+	err := tx.QueryRowContext(ctx, `SELECT address_id FROM `+tx.db.source().records("insured_addresses_records")+` t2 WHERE t2.id = ?`, id).Scan(&addressId)
+	if err == sql.ErrNoRows {
+		return ErrRecordDoesNotExist
+	} else if err != nil {
+		return fmt.Errorf("Server error.")
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM insured_addresses_records WHERE address_id = ?`, addressId); err != nil {
+		return fmt.Errorf("Server error.")
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM insured_addresses WHERE id = ?`, addressId); err != nil {
+		return fmt.Errorf("Server error.")
+	}
+	return nil
+}
+
+// deleteEmployee writes a tombstone employee record, effective now
+func deleteEmployee(ctx context.Context, tx *Tx, employee *entity.Employee, now time.Time) error {
+	if err := cancelPending(ctx, tx, employee.GetDataTableName(), "employee_id", employee.ID, now); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO employees_records (
+			employee_id,
+			name,
+			start_date,
+			end_date,
+			record_timestamp,
+			valid_from,
+			tombstone
+		)
+		VALUES (?, ?, ?, ?, ?, ?, 1)
+	`,
+		employee.ID,
+		employee.Name,
+		employee.StartDate.Format("2006-01-02"),
+		employee.EndDate.Format("2006-01-02"),
+		now.Unix(),
+		now.Unix(),
+	)
+	return tx.db.FormatError(err)
+}
+
+// deleteAddress writes a tombstone record for the address, effective now
+func deleteAddress(ctx context.Context, tx *Tx, address *entity.Address, now time.Time) error {
+	if err := cancelPending(ctx, tx, address.GetDataTableName(), "address_id", address.AddressId, now); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO insured_addresses_records (
+			address_id,
+			address,
+			line1,
+			line2,
+			city,
+			region,
+			postal_code,
+			country,
+			insured_id,
+			record_timestamp,
+			valid_from,
+			tombstone
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)
+	`,
+		address.AddressId,
+		address.Address,
+		address.Line1,
+		address.Line2,
+		address.City,
+		address.Region,
+		address.PostalCode,
+		address.Country,
+		address.InsuredId,
+		now.Unix(),
+		now.Unix(),
+	)
+	return tx.db.FormatError(err)
+}
+
+// deleteInsured writes an insured tombstone, and tombstones for its current employees and addresses
+func deleteInsured(ctx context.Context, tx *Tx, current *entity.Insured, now time.Time) error {
+	for _, employee := range *current.Employees {
+		employee := employee
+		if err := deleteEmployee(ctx, tx, &employee, now); err != nil {
+			return err
+		}
+	}
+	for _, address := range *current.Addresses {
+		address := address
+		if err := deleteAddress(ctx, tx, &address, now); err != nil {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO insured_tombstones (insured_id, record_timestamp) VALUES (?, ?)`, current.ID, now.Unix())
+	return tx.db.FormatError(err)
+}
+
+// insuredDeletedAt returns true if the insured was deleted (and not restored) by asOfValid, as known at asOfRecorded.
+// Deletion and restore take effect when they are recorded.
+func (db *DB) insuredDeletedAt(ctx context.Context, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (bool, error) {
+	var deleted int
+	query := `SELECT COALESCE((` + "\n" +
+		`	SELECT 1 - restore FROM insured_tombstones` + "\n" +
+		`	WHERE insured_id = ? AND record_timestamp <= ? AND record_timestamp <= ?` + "\n" +
+		`	ORDER BY id DESC LIMIT 1` + "\n" +
+		`), 0)`
+	if err := db.queryRowContext(ctx, query, insuredId, asOfValid.Unix(), asOfRecorded.Unix()).Scan(&deleted); err != nil {
+		return false, err
+	}
+	return deleted == 1, nil
+}
+
+// cancelPending adds a cancellation, as of now, of each pending (future-dated) record for key = id in a records table
+// that is not cancelled yet. The records are not changed.
+func cancelPending(ctx context.Context, tx *Tx, table string, key string, id int, now time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO `+cancellations(table)+` (record_id, record_timestamp)
+		SELECT r.id, ? FROM `+table+` r
+		WHERE r.`+key+` = ? AND r.valid_from > ?
+		AND NOT EXISTS (SELECT 1 FROM `+cancellations(table)+` c WHERE c.record_id = r.id)`,
+		now.Unix(), id, now.Unix())
+	return tx.db.FormatError(err)
+}
+
+// purgeCancellations deletes the cancellations of records that were purged.
+// Cancellations have no foreign key where records can be archived, so nothing cascades to them.
+func purgeCancellations(ctx context.Context, tx *Tx) error {
+	for _, table := range []string{`employees_records`, `insured_addresses_records`, `policies_records`} {
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+cancellations(table)+` WHERE record_id NOT IN (SELECT id FROM `+tx.db.source().records(table)+` r)`)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
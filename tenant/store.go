@@ -0,0 +1,239 @@
+package tenant
+
+import (
+	"context"
+	"time"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/service"
+	"github.com/nickcoast/timetravel/sqlite"
+)
+
+// Pool is a service.Store of the request's tenant: each operation uses the database of the tenant in ctx.
+
+var _ service.Store = (*Pool)(nil)
+
+// FromContext returns the database of the tenant in ctx
+func (p *Pool) FromContext(ctx context.Context) (*sqlite.DB, error) {
+	name := service.TenantFromContext(ctx)
+	if name == "" {
+		return nil, ErrNoTenant
+	}
+	return p.DB(name)
+}
+
+func (p *Pool) CreateInsured(ctx context.Context, insured *entity.Insured) (entity.Record, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return db.CreateInsured(ctx, insured)
+}
+
+func (p *Pool) CreateEmployee(ctx context.Context, employee *entity.Employee) (entity.Record, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return db.CreateEmployee(ctx, employee)
+}
+
+func (p *Pool) UpdateEmployee(ctx context.Context, employee *entity.Employee) (entity.Record, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return db.UpdateEmployee(ctx, employee)
+}
+
+func (p *Pool) CountEmployeeRecords(ctx context.Context, employee entity.Employee) (int, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return db.CountEmployeeRecords(ctx, employee)
+}
+
+func (p *Pool) CreateAddress(ctx context.Context, address *entity.Address) (entity.Record, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return db.CreateAddress(ctx, address)
+}
+
+func (p *Pool) UpdateAddress(ctx context.Context, address *entity.Address) (entity.Record, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return db.UpdateAddress(ctx, address)
+}
+
+func (p *Pool) CountInsuredAddresses(ctx context.Context, insured entity.Insured) (int, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return db.CountInsuredAddresses(ctx, insured)
+}
+
+func (p *Pool) CreatePolicy(ctx context.Context, policy *entity.Policy) (entity.Record, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return db.CreatePolicy(ctx, policy)
+}
+
+func (p *Pool) UpdatePolicy(ctx context.Context, policy *entity.Policy) (entity.Record, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return db.UpdatePolicy(ctx, policy)
+}
+
+func (p *Pool) CreateClaim(ctx context.Context, claim *entity.Claim) (entity.Record, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return db.CreateClaim(ctx, claim)
+}
+
+func (p *Pool) UpdateClaim(ctx context.Context, claim *entity.Claim) (entity.Record, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Record{}, err
+	}
+	return db.UpdateClaim(ctx, claim)
+}
+
+func (p *Pool) GetById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (entity.InsuredInterface, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetById(ctx, insuredObj, id)
+}
+
+func (p *Pool) GetAll(ctx context.Context, entityType entity.InsuredInterface) (map[int]entity.InsuredInterface, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetAll(ctx, entityType)
+}
+
+func (p *Pool) GetAllByEntityId(ctx context.Context, entityType entity.InsuredInterface, entityId int64) (map[int]entity.InsuredInterface, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetAllByEntityId(ctx, entityType, entityId)
+}
+
+func (p *Pool) GetByDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, naturalKey string, insuredId int64, date time.Time) (map[int]entity.InsuredInterface, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetByDate(ctx, insuredIfaceObj, naturalKey, insuredId, date)
+}
+
+func (p *Pool) GetByBitemporalDate(ctx context.Context, insuredIfaceObj entity.InsuredInterface, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (map[int]entity.InsuredInterface, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetByBitemporalDate(ctx, insuredIfaceObj, insuredId, asOfValid, asOfRecorded)
+}
+
+func (p *Pool) GetInsuredByDate(ctx context.Context, insuredId int64, date time.Time) (entity.Insured, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Insured{}, err
+	}
+	return db.GetInsuredByDate(ctx, insuredId, date)
+}
+
+func (p *Pool) GetInsuredByBitemporalDate(ctx context.Context, insuredId int64, asOfValid time.Time, asOfRecorded time.Time) (entity.Insured, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.Insured{}, err
+	}
+	return db.GetInsuredByBitemporalDate(ctx, insuredId, asOfValid, asOfRecorded)
+}
+
+func (p *Pool) GetSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter) ([]entity.Insured, int, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return db.GetSnapshot(ctx, asOf, filter)
+}
+
+func (p *Pool) StreamSnapshot(ctx context.Context, asOf time.Time, filter entity.InsuredFilter, fn func(insured entity.Insured, total int) error) (int, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return db.StreamSnapshot(ctx, asOf, filter, fn)
+}
+
+func (p *Pool) GetTimeline(ctx context.Context, insuredId int64, filter entity.TimelineFilter) ([]entity.TimelineEvent, int, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return db.GetTimeline(ctx, insuredId, filter)
+}
+
+func (p *Pool) GetPendingChanges(ctx context.Context, insuredId int64, asOf time.Time) ([]entity.PendingChange, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.GetPendingChanges(ctx, insuredId, asOf)
+}
+
+func (p *Pool) CancelPendingChange(ctx context.Context, insuredIfaceObj entity.InsuredInterface, recordId int64, asOf time.Time) (entity.PendingChange, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.PendingChange{}, err
+	}
+	return db.CancelPendingChange(ctx, insuredIfaceObj, recordId, asOf)
+}
+
+func (p *Pool) DeleteById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (entity.InsuredInterface, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.DeleteById(ctx, insuredObj, id)
+}
+
+func (p *Pool) DeletePreviewById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) (entity.DeletePreview, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return entity.DeletePreview{}, err
+	}
+	return db.DeletePreviewById(ctx, insuredObj, id)
+}
+
+func (p *Pool) PurgeById(ctx context.Context, insuredObj entity.InsuredInterface, id int64) error {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return db.PurgeById(ctx, insuredObj, id)
+}
+
+func (p *Pool) RestoreById(ctx context.Context, insuredObj entity.InsuredInterface, id int64, asOf time.Time) (entity.InsuredInterface, error) {
+	db, err := p.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.RestoreById(ctx, insuredObj, id, asOf)
+}
@@ -0,0 +1,193 @@
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nickcoast/timetravel/sqlite"
+)
+
+// Tenants are agencies whose data is kept apart: each has its own SQLite database file,
+// named by putting the tenant's name into a DSN template, e.g. "tenants/{tenant}.db".
+// A tenant's database is opened, and migrated, the first time it is used.
+
+// Placeholder is replaced with the tenant's name in the DSN template
+const Placeholder = "{tenant}"
+
+var ErrNoTenant = errors.New("no tenant. Set the tenant header or use the tenant's subdomain")
+var ErrUnknownTenant = errors.New("tenant does not exist")
+var ErrTenantExists = errors.New("tenant already exists")
+var ErrInvalidName = errors.New("tenant name must be 1-63 lowercase letters, digits, and dashes, starting with a letter or digit")
+var ErrClosed = errors.New("tenants are closed")
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Tenant is a tenant and its database file
+type Tenant struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Open bool   `json:"open"` // its database is open
+}
+
+// Pool opens and holds the tenants' databases, by tenant name
+type Pool struct {
+	DSN string // template, with Placeholder
+
+	mu     sync.Mutex
+	dbs    map[string]*sqlite.DB
+	closed bool
+}
+
+// NewPool returns a Pool of the databases named by the DSN template
+func NewPool(dsn string) (*Pool, error) {
+	if !strings.Contains(filePath(dsn), Placeholder) {
+		return nil, fmt.Errorf("tenant dsn %q must contain %s in its file name", dsn, Placeholder)
+	}
+	return &Pool{DSN: dsn, dbs: make(map[string]*sqlite.DB)}, nil
+}
+
+// DB returns the tenant's database, opening and migrating it if it is not open yet
+func (p *Pool) DB(name string) (*sqlite.DB, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrUnknownTenant
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
+	if db, ok := p.dbs[name]; ok {
+		return db, nil
+	}
+	if _, err := os.Stat(p.path(name)); os.IsNotExist(err) {
+		return nil, ErrUnknownTenant
+	} else if err != nil {
+		return nil, err
+	}
+	return p.open(name)
+}
+
+// open opens and migrates the tenant's database, creating it if new. p.mu must be held.
+func (p *Pool) open(name string) (*sqlite.DB, error) {
+	db := sqlite.NewDB(p.dsn(name))
+	if err := db.Open(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("tenant %s: %w", name, err)
+	}
+	p.dbs[name] = db
+	return db, nil
+}
+
+// List returns the tenants with a database file, by name
+func (p *Pool) List() ([]Tenant, error) {
+	path := p.path(Placeholder)
+	i := strings.Index(path, Placeholder)
+	prefix, suffix := path[:i], path[i+len(Placeholder):]
+	matches, err := filepath.Glob(prefix + "*" + suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var tenants []Tenant
+	for _, match := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(match, prefix), suffix)
+		if !validName.MatchString(name) || strings.HasSuffix(name, "-wal") || strings.HasSuffix(name, "-shm") || strings.HasSuffix(name, "-journal") {
+			continue
+		}
+		_, open := p.dbs[name]
+		tenants = append(tenants, Tenant{Name: name, Path: match, Open: open})
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants, nil
+}
+
+// Create creates and migrates the tenant's database
+func (p *Pool) Create(name string) (Tenant, error) {
+	if !validName.MatchString(name) {
+		return Tenant{}, ErrInvalidName
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return Tenant{}, ErrClosed
+	}
+	path := p.path(name)
+	if _, err := os.Stat(path); err == nil {
+		return Tenant{}, ErrTenantExists
+	} else if !os.IsNotExist(err) {
+		return Tenant{}, err
+	}
+	if _, err := p.open(name); err != nil {
+		return Tenant{}, err
+	}
+	return Tenant{Name: name, Path: path, Open: true}, nil
+}
+
+// Drop closes the tenant's database and deletes its files. Its data cannot be recovered.
+func (p *Pool) Drop(name string) error {
+	if !validName.MatchString(name) {
+		return ErrUnknownTenant
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	path := p.path(name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return ErrUnknownTenant
+	} else if err != nil {
+		return err
+	}
+	if db, ok := p.dbs[name]; ok {
+		delete(p.dbs, name)
+		if err := db.Close(); err != nil {
+			return err
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+// Close closes every open database
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	var err error
+	for name, db := range p.dbs {
+		if e := db.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(p.dbs, name)
+	}
+	return err
+}
+
+// dsn returns the tenant's DSN
+func (p *Pool) dsn(name string) string {
+	return strings.ReplaceAll(p.DSN, Placeholder, name)
+}
+
+// path returns the tenant's database file
+func (p *Pool) path(name string) string {
+	return filePath(p.dsn(name))
+}
+
+// filePath returns the file of a SQLite DSN, without "file:" and parameters
+func filePath(dsn string) string {
+	dsn = strings.TrimPrefix(dsn, "file:")
+	if i := strings.Index(dsn, "?"); i >= 0 {
+		dsn = dsn[:i]
+	}
+	return dsn
+}
@@ -0,0 +1,97 @@
+package tenant_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nickcoast/timetravel/entity"
+	"github.com/nickcoast/timetravel/service"
+	"github.com/nickcoast/timetravel/tenant"
+)
+
+// MustOpenPool returns a Pool of databases in a temporary directory. Fatal on error.
+func MustOpenPool(tb testing.TB) *tenant.Pool {
+	tb.Helper()
+	pool, err := tenant.NewPool("file:" + filepath.Join(tb.TempDir(), "{tenant}.db") + "?_fk=1")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+// MustCreate creates the tenant. Fatal on error.
+func MustCreate(tb testing.TB, pool *tenant.Pool, name string) tenant.Tenant {
+	tb.Helper()
+	t, err := pool.Create(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return t
+}
+
+// Tenants are created, listed, and dropped with their database files
+func TestPool_Create(tb *testing.T) {
+	pool := MustOpenPool(tb)
+	acme := MustCreate(tb, pool, "acme")
+	MustCreate(tb, pool, "globex")
+	if _, err := os.Stat(acme.Path); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := pool.Create("acme"); err != tenant.ErrTenantExists {
+		tb.Fatalf("err=%v, want %v", err, tenant.ErrTenantExists)
+	}
+	for _, name := range []string{"", "Acme", "../acme", "-acme"} {
+		if _, err := pool.Create(name); err != tenant.ErrInvalidName {
+			tb.Fatalf("%q: err=%v, want %v", name, err, tenant.ErrInvalidName)
+		}
+	}
+
+	if tenants, err := pool.List(); err != nil {
+		tb.Fatal(err)
+	} else if len(tenants) != 2 || tenants[0].Name != "acme" || tenants[1].Name != "globex" {
+		tb.Fatalf("tenants=%+v", tenants)
+	}
+
+	if err := pool.Drop("acme"); err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := os.Stat(acme.Path); !os.IsNotExist(err) {
+		tb.Fatalf("err=%v, want not exist", err)
+	}
+	if err := pool.Drop("acme"); err != tenant.ErrUnknownTenant {
+		tb.Fatalf("err=%v, want %v", err, tenant.ErrUnknownTenant)
+	}
+	if _, err := pool.DB("acme"); err != tenant.ErrUnknownTenant {
+		tb.Fatalf("err=%v, want %v", err, tenant.ErrUnknownTenant)
+	}
+}
+
+// The pool is a store of the tenant in the context
+func TestPool_Store(tb *testing.T) {
+	pool := MustOpenPool(tb)
+	MustCreate(tb, pool, "acme")
+	MustCreate(tb, pool, "globex")
+
+	acme := service.NewContextWithTenant(context.Background(), "acme")
+	if _, err := pool.CreateInsured(acme, &entity.Insured{Name: "Wile E. Coyote", PolicyNumber: 1000}); err != nil {
+		tb.Fatal(err)
+	}
+	if records, err := pool.GetAll(acme, &entity.Insured{}); err != nil {
+		tb.Fatal(err)
+	} else if len(records) != 1 {
+		tb.Fatalf("acme len=%v, want 1", len(records))
+	}
+	globex := service.NewContextWithTenant(context.Background(), "globex")
+	if records, err := pool.GetAll(globex, &entity.Insured{}); err != nil {
+		tb.Fatal(err)
+	} else if len(records) != 0 {
+		tb.Fatalf("globex len=%v, want 0", len(records))
+	}
+
+	if _, err := pool.GetAll(context.Background(), &entity.Insured{}); err != tenant.ErrNoTenant {
+		tb.Fatalf("err=%v, want %v", err, tenant.ErrNoTenant)
+	}
+}